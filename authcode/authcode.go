@@ -2,6 +2,8 @@ package authcode
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/base64"
 	"errors"
 	"sync"
@@ -13,6 +15,44 @@ type Code struct {
 	ClientID    string
 	RedirectURI string
 	Expiry      time.Time
+
+	// What the user authorized, for the token endpoint
+	Subject string // local user ID
+	Scope   string // space-separated
+	Nonce   string
+	GrantID string // the delegation the user consented in; "" if none was recorded
+
+	// PKCE (RFC 7636); empty if the client sent no code_challenge
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+// ChallengeS256 is the only code_challenge_method accepted: plain would
+// put the verifier itself in the front channel.
+const ChallengeS256 = "S256"
+
+// VerifyChallenge checks a code_verifier against the code_challenge the
+// code was issued for (RFC 7636 §4.6). A verifier is required exactly when
+// a challenge was sent.
+func (c *Code) VerifyChallenge(verifier string) error {
+	if c.CodeChallenge == "" {
+		if verifier != "" {
+			return errors.New("code_verifier sent for a code issued without code_challenge")
+		}
+		return nil
+	}
+	if verifier == "" {
+		return errors.New("code_verifier is required")
+	}
+	if c.CodeChallengeMethod != ChallengeS256 {
+		return errors.New("unsupported code_challenge_method")
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+	if subtle.ConstantTimeCompare([]byte(challenge), []byte(c.CodeChallenge)) != 1 {
+		return errors.New("code_verifier does not match code_challenge")
+	}
+	return nil
 }
 
 type Store struct {
@@ -29,22 +69,24 @@ func NewStore(ttl time.Duration) *Store {
 }
 
 func (s *Store) Generate(clientID, redirectURI string) (string, error) {
+	return s.Issue(Code{ClientID: clientID, RedirectURI: redirectURI})
+}
+
+// Issue stores c under a new random code value and returns the value.
+// Value and Expiry are set by the store.
+func (s *Store) Issue(c Code) (string, error) {
 	b := make([]byte, 32)
 	if _, err := rand.Read(b); err != nil {
 		return "", err
 	}
-	code := base64.RawURLEncoding.EncodeToString(b)
+	c.Value = base64.RawURLEncoding.EncodeToString(b)
+	c.Expiry = time.Now().Add(s.ttl)
 
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.codes[code] = Code{
-		Value:       code,
-		ClientID:    clientID,
-		RedirectURI: redirectURI,
-		Expiry:      time.Now().Add(s.ttl),
-	}
+	s.codes[c.Value] = c
 
-	return code, nil
+	return c.Value, nil
 }
 
 func (s *Store) Validate(code string) (*Code, error) {
@@ -62,6 +104,31 @@ func (s *Store) Validate(code string) (*Code, error) {
 	return &c, nil
 }
 
+// Redeem looks up a code for the token endpoint and removes it, so each
+// code is exchanged at most once (RFC 6749 §4.1.2). The code must have
+// been issued to clientID for redirectURI.
+func (s *Store) Redeem(code, clientID, redirectURI string) (*Code, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.codes[code]
+	if !ok {
+		return nil, errors.New("code not found")
+	}
+	delete(s.codes, code)
+	if time.Now().After(c.Expiry) {
+		return nil, errors.New("code expired")
+	}
+	if c.ClientID != clientID {
+		return nil, errors.New("code was issued to another client")
+	}
+	if c.RedirectURI != redirectURI {
+		return nil, errors.New("redirect_uri does not match the authorization request")
+	}
+
+	return &c, nil
+}
+
 func (s *Store) Delete(code string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -0,0 +1,502 @@
+package expr
+
+import (
+	stderrors "errors"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// ErrLimitExceeded is returned when an evaluation runs out of steps or
+// memory.
+var ErrLimitExceeded = stderrors.New("expression exceeded its evaluation limit")
+
+type machine struct {
+	limits Limits
+	steps  int
+	memory int
+	vars   map[string]interface{}
+}
+
+// step charges n units of work.
+func (m *machine) step(n int) error {
+	m.steps += n
+	if m.steps > m.limits.MaxSteps {
+		return fmt.Errorf("%w: more than %d steps", ErrLimitExceeded, m.limits.MaxSteps)
+	}
+	return nil
+}
+
+// alloc charges n bytes of memory. Nothing is freed during an evaluation,
+// so this bounds the total allocated by the expression.
+func (m *machine) alloc(n int) error {
+	m.memory += n
+	if m.memory > m.limits.MaxMemory {
+		return fmt.Errorf("%w: more than %d bytes", ErrLimitExceeded, m.limits.MaxMemory)
+	}
+	return nil
+}
+
+// Rough per-value sizes charged by alloc.
+const (
+	sliceSlot = 16
+	mapSlot   = 48
+)
+
+func (n *litNode) eval(m *machine) (interface{}, error) {
+	return n.v, m.step(1)
+}
+
+func (n *identNode) eval(m *machine) (interface{}, error) {
+	return m.vars[n.name], m.step(1)
+}
+
+func (n *listNode) eval(m *machine) (interface{}, error) {
+	if err := m.step(1); err != nil {
+		return nil, err
+	}
+	if err := m.alloc(len(n.items) * sliceSlot); err != nil {
+		return nil, err
+	}
+	out := make([]interface{}, 0, len(n.items))
+	for _, item := range n.items {
+		v, err := item.eval(m)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+func (n *mapNode) eval(m *machine) (interface{}, error) {
+	if err := m.step(1); err != nil {
+		return nil, err
+	}
+	if err := m.alloc(len(n.keys) * mapSlot); err != nil {
+		return nil, err
+	}
+	out := make(map[string]interface{}, len(n.keys))
+	for i, k := range n.keys {
+		v, err := n.values[i].eval(m)
+		if err != nil {
+			return nil, err
+		}
+		out[k] = v
+	}
+	return out, nil
+}
+
+func (n *unaryNode) eval(m *machine) (interface{}, error) {
+	x, err := n.x.eval(m)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.step(1); err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "!":
+		b, ok := x.(bool)
+		if !ok {
+			return nil, fmt.Errorf("! needs a bool, got %s", typeName(x))
+		}
+		return !b, nil
+	default: // "-"
+		f, ok := number(x)
+		if !ok {
+			return nil, fmt.Errorf("- needs a number, got %s", typeName(x))
+		}
+		return -f, nil
+	}
+}
+
+func (n *condNode) eval(m *machine) (interface{}, error) {
+	c, err := n.cond.eval(m)
+	if err != nil {
+		return nil, err
+	}
+	b, ok := c.(bool)
+	if !ok {
+		return nil, fmt.Errorf("condition must be a bool, got %s", typeName(c))
+	}
+	if b {
+		return n.then.eval(m)
+	}
+	return n.els.eval(m)
+}
+
+func (n *binaryNode) eval(m *machine) (interface{}, error) {
+	l, err := n.l.eval(m)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.step(1); err != nil {
+		return nil, err
+	}
+	// Short-circuit operators evaluate the right side only when needed.
+	switch n.op {
+	case "&&", "||":
+		lb, ok := l.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%s needs bools, got %s", n.op, typeName(l))
+		}
+		if (n.op == "&&") != lb {
+			return lb, nil
+		}
+		r, err := n.r.eval(m)
+		if err != nil {
+			return nil, err
+		}
+		rb, ok := r.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%s needs bools, got %s", n.op, typeName(r))
+		}
+		return rb, nil
+	case "??":
+		if l != nil {
+			return l, nil
+		}
+		return n.r.eval(m)
+	}
+	r, err := n.r.eval(m)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "==":
+		return equal(l, r), nil
+	case "!=":
+		return !equal(l, r), nil
+	case "in":
+		return m.contains(r, l)
+	case "+":
+		return m.add(l, r)
+	case "<", "<=", ">", ">=":
+		return compare(n.op, l, r)
+	}
+	lf, lok := number(l)
+	rf, rok := number(r)
+	if !lok || !rok {
+		return nil, fmt.Errorf("%s needs numbers, got %s and %s", n.op, typeName(l), typeName(r))
+	}
+	switch n.op {
+	case "-":
+		return lf - rf, nil
+	case "*":
+		return lf * rf, nil
+	case "/":
+		if rf == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return lf / rf, nil
+	default: // "%"
+		if rf == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return math.Mod(lf, rf), nil
+	}
+}
+
+func (m *machine) add(l, r interface{}) (interface{}, error) {
+	if ls, ok := l.(string); ok {
+		if rs, ok := r.(string); ok {
+			if err := m.alloc(len(ls) + len(rs)); err != nil {
+				return nil, err
+			}
+			return ls + rs, nil
+		}
+	}
+	if ll, ok := asList(l); ok {
+		if rl, ok := asList(r); ok {
+			if err := m.alloc((len(ll) + len(rl)) * sliceSlot); err != nil {
+				return nil, err
+			}
+			return append(slices.Clone(ll), rl...), nil
+		}
+	}
+	lf, lok := number(l)
+	rf, rok := number(r)
+	if !lok || !rok {
+		return nil, fmt.Errorf("+ cannot add %s and %s", typeName(l), typeName(r))
+	}
+	return lf + rf, nil
+}
+
+// contains implements "x in c" for lists, maps (keys) and strings
+// (substrings).
+func (m *machine) contains(c, x interface{}) (interface{}, error) {
+	switch v := c.(type) {
+	case string:
+		s, ok := x.(string)
+		if !ok {
+			return nil, fmt.Errorf("in: cannot look for %s in a string", typeName(x))
+		}
+		return strings.Contains(v, s), m.step(len(v) / 64)
+	case map[string]interface{}:
+		s, ok := x.(string)
+		return ok && v[s] != nil, nil
+	case nil:
+		return false, nil
+	}
+	list, ok := asList(c)
+	if !ok {
+		return nil, fmt.Errorf("in: cannot search %s", typeName(c))
+	}
+	if err := m.step(len(list)); err != nil {
+		return nil, err
+	}
+	for _, item := range list {
+		if equal(item, x) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func compare(op string, l, r interface{}) (interface{}, error) {
+	var c int
+	if ls, ok := l.(string); ok {
+		rs, ok := r.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s cannot compare string and %s", op, typeName(r))
+		}
+		c = strings.Compare(ls, rs)
+	} else {
+		lf, lok := number(l)
+		rf, rok := number(r)
+		if !lok || !rok {
+			return nil, fmt.Errorf("%s cannot compare %s and %s", op, typeName(l), typeName(r))
+		}
+		switch {
+		case lf < rf:
+			c = -1
+		case lf > rf:
+			c = 1
+		}
+	}
+	switch op {
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	default:
+		return c >= 0, nil
+	}
+}
+
+func (n *memberNode) eval(m *machine) (interface{}, error) {
+	x, err := n.x.eval(m)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.step(1); err != nil {
+		return nil, err
+	}
+	return member(x, n.name)
+}
+
+// member reads a field of a map. Fields of null and missing fields are
+// null, so optional attributes can be tested with == null or ??.
+func member(x interface{}, name string) (interface{}, error) {
+	switch v := x.(type) {
+	case nil:
+		return nil, nil
+	case map[string]interface{}:
+		return v[name], nil
+	}
+	return nil, fmt.Errorf("cannot read field %q of %s", name, typeName(x))
+}
+
+func (n *indexNode) eval(m *machine) (interface{}, error) {
+	x, err := n.x.eval(m)
+	if err != nil {
+		return nil, err
+	}
+	idx, err := n.idx.eval(m)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.step(1); err != nil {
+		return nil, err
+	}
+	if s, ok := idx.(string); ok {
+		return member(x, s)
+	}
+	if x == nil {
+		return nil, nil
+	}
+	list, ok := asList(x)
+	f, isNum := number(idx)
+	if !ok || !isNum || f != math.Trunc(f) {
+		return nil, fmt.Errorf("cannot index %s with %s", typeName(x), typeName(idx))
+	}
+	i := int(f)
+	if i < 0 {
+		i += len(list)
+	}
+	if i < 0 || i >= len(list) {
+		return nil, nil
+	}
+	return list[i], nil
+}
+
+func (n *callNode) eval(m *machine) (interface{}, error) {
+	args := make([]interface{}, len(n.args))
+	for i, a := range n.args {
+		v, err := a.eval(m)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+	if err := m.step(1); err != nil {
+		return nil, err
+	}
+	v, err := n.fn.call(m, args)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", n.fn.name, err)
+	}
+	return v, nil
+}
+
+func (n *macroNode) eval(m *machine) (interface{}, error) {
+	x, err := n.list.eval(m)
+	if err != nil {
+		return nil, err
+	}
+	if x == nil {
+		x = []interface{}{}
+	}
+	list, ok := asList(x)
+	if !ok {
+		return nil, fmt.Errorf("%s needs a list, got %s", n.macro, typeName(x))
+	}
+	if n.macro == "filter" || n.macro == "map" {
+		if err := m.alloc(len(list) * sliceSlot); err != nil {
+			return nil, err
+		}
+	}
+	// Bind the element name for the body and restore any outer binding.
+	outer, hadOuter := m.vars[n.name]
+	defer func() {
+		if hadOuter {
+			m.vars[n.name] = outer
+		} else {
+			delete(m.vars, n.name)
+		}
+	}()
+	out := []interface{}{}
+	for _, item := range list {
+		m.vars[n.name] = item
+		v, err := n.body.eval(m)
+		if err != nil {
+			return nil, err
+		}
+		if n.macro == "map" {
+			out = append(out, v)
+			continue
+		}
+		b, ok := v.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%s: predicate must return a bool, got %s", n.macro, typeName(v))
+		}
+		switch {
+		case n.macro == "filter" && b:
+			out = append(out, item)
+		case n.macro == "any" && b:
+			return true, nil
+		case n.macro == "all" && !b:
+			return false, nil
+		}
+	}
+	switch n.macro {
+	case "any":
+		return false, nil
+	case "all":
+		return true, nil
+	}
+	return out, nil
+}
+
+// number converts Go numeric values to float64, the only number type the
+// language has.
+func number(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+func asList(v interface{}) ([]interface{}, bool) {
+	switch l := v.(type) {
+	case []interface{}:
+		return l, true
+	case []string:
+		out := make([]interface{}, len(l))
+		for i, s := range l {
+			out[i] = s
+		}
+		return out, true
+	}
+	return nil, false
+}
+
+func equal(a, b interface{}) bool {
+	if af, ok := number(a); ok {
+		bf, ok := number(b)
+		return ok && af == bf
+	}
+	if al, ok := asList(a); ok {
+		bl, ok := asList(b)
+		if !ok || len(al) != len(bl) {
+			return false
+		}
+		for i := range al {
+			if !equal(al[i], bl[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func typeName(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "bool"
+	case string:
+		return "string"
+	case map[string]interface{}:
+		return "map"
+	}
+	if _, ok := number(v); ok {
+		return "number"
+	}
+	if _, ok := asList(v); ok {
+		return "list"
+	}
+	return fmt.Sprintf("%T", v)
+}
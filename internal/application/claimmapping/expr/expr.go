@@ -0,0 +1,125 @@
+// Package expr is a small, sandboxed expression language for computing
+// claims. Expressions are pure: they read the variables they are given
+// and return a value, with no access to I/O, the clock or the process.
+// Every evaluation runs under a step and memory budget, so a bad
+// expression fails instead of stalling token issuance.
+//
+// Values are null, bools, numbers (float64), strings, lists and maps with
+// string keys. The syntax is C-like:
+//
+//	user.email ?? claims.mail
+//	"admins" in groups ? ["admin"] : []
+//	map(filter(groups, g, startsWith(g, "app-x-")), g, trimPrefix(g, "app-x-"))
+//
+// Operators are ! - * / % + < <= > >= in == != && || ?? and ?:. Missing
+// map fields read as null. filter, map, any and all take a list, a
+// variable name and an expression evaluated per element.
+package expr
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Limits bound a single evaluation.
+type Limits struct {
+	MaxSteps  int // evaluation steps; string and list work is charged by size
+	MaxMemory int // bytes of strings, lists and maps the expression may build
+}
+
+// DefaultLimits are generous for claim computations and small enough to
+// keep a runaway expression from affecting other requests.
+var DefaultLimits = Limits{MaxSteps: 10000, MaxMemory: 64 << 10}
+
+// Program is a compiled expression. It is safe for concurrent use.
+type Program struct {
+	src  string
+	root node
+}
+
+// Compile parses src. Every variable the expression reads must be in
+// vars, and every function must exist with the right number of arguments.
+func Compile(src string, vars []string) (*Program, error) {
+	root, err := parse(src, vars)
+	if err != nil {
+		return nil, err
+	}
+	return &Program{src: src, root: root}, nil
+}
+
+// String returns the source of the expression.
+func (p *Program) String() string { return p.src }
+
+// Eval runs the program against vars. A zero limit uses the default.
+func (p *Program) Eval(vars map[string]interface{}, limits Limits) (interface{}, error) {
+	v, _, err := p.EvalStats(vars, limits)
+	return v, err
+}
+
+// Stats describe what an evaluation consumed.
+type Stats struct {
+	Steps  int `json:"steps"`
+	Memory int `json:"memory"`
+}
+
+// EvalStats is Eval that also reports the resources used, for dry runs.
+func (p *Program) EvalStats(vars map[string]interface{}, limits Limits) (v interface{}, stats Stats, err error) {
+	if limits.MaxSteps <= 0 {
+		limits.MaxSteps = DefaultLimits.MaxSteps
+	}
+	if limits.MaxMemory <= 0 {
+		limits.MaxMemory = DefaultLimits.MaxMemory
+	}
+	m := &machine{limits: limits, vars: make(map[string]interface{}, len(vars))}
+	for k, val := range vars {
+		m.vars[k] = val
+	}
+	defer func() {
+		// The evaluator must never take the server down.
+		if r := recover(); r != nil {
+			v, err = nil, fmt.Errorf("expression failed: %v", r)
+		}
+		stats = Stats{Steps: m.steps, Memory: m.memory}
+	}()
+	out, err := p.root.eval(m)
+	if err != nil {
+		return nil, stats, err
+	}
+	return toOutput(out), stats, nil
+}
+
+// toOutput turns integral numbers back into int64 so results marshal
+// without a fractional part and compare equal to claim values.
+func toOutput(v interface{}) interface{} {
+	switch x := v.(type) {
+	case float64:
+		if x == math.Trunc(x) && math.Abs(x) < 1<<53 {
+			return int64(x)
+		}
+		return x
+	case []interface{}:
+		out := make([]interface{}, len(x))
+		for i, item := range x {
+			out[i] = toOutput(item)
+		}
+		return out
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(x))
+		for k, item := range x {
+			out[k] = toOutput(item)
+		}
+		return out
+	}
+	return v
+}
+
+// Functions returns the names of the built-in functions and macros.
+func Functions() []string {
+	names := append([]string{}, macros...)
+	for name := range functions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
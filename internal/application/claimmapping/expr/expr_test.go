@@ -0,0 +1,165 @@
+package expr
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testVars = []string{"user", "groups", "claims"}
+
+func eval(t *testing.T, src string, vars map[string]interface{}) interface{} {
+	t.Helper()
+	p, err := Compile(src, testVars)
+	require.NoError(t, err, src)
+	v, err := p.Eval(vars, Limits{})
+	require.NoError(t, err, src)
+	return v
+}
+
+func TestEval(t *testing.T) {
+	vars := map[string]interface{}{
+		"user":   map[string]interface{}{"email": "Alice@Example.com", "level": int64(3)},
+		"groups": []string{"app-x-admin", "app-x-reader", "staff"},
+		"claims": map[string]interface{}{"given_name": "Alice", "family_name": "Liddell"},
+	}
+	for src, want := range map[string]interface{}{
+		`1 + 2 * 3`:         int64(7),
+		`(1 + 2) * 3`:       int64(9),
+		`7 % 4 - -1`:        int64(4),
+		`10 / 4`:            2.5,
+		`lower(user.email)`: "alice@example.com",
+		`claims.given_name + " " + claims.family_name`: "Alice Liddell",
+		`user.level >= 3 && "staff" in groups`:         true,
+		`!("root" in groups) || false`:                 true,
+		`user.missing ?? "fallback"`:                   "fallback",
+		`user.missing.deeper == null`:                  true,
+		`user["email"] == user.email`:                  true,
+		`groups[0]`:                                    "app-x-admin",
+		`groups[-1]`:                                   "staff",
+		`groups[10]`:                                   nil,
+		`"staff" in groups ? "employee" : "guest"`:     "employee",
+		`false ? 1 : true ? 2 : 3`:                     int64(2),
+		`len(groups)`:                                  int64(3),
+		`join(split("a,b", ","), "|")`:                 "a|b",
+		`matches(user.email, "^[^@]+@example\\.com$")`: false,
+		`coalesce(null, "", "x")`:                      "x",
+		`unique(["a", "b", "a"])`:                      []interface{}{"a", "b"},
+		`{name: claims.given_name, "n": 1}`:            map[string]interface{}{"name": "Alice", "n": int64(1)},
+		`[1, "two"] + [null]`:                          []interface{}{int64(1), "two", nil},
+		`any(groups, g, startsWith(g, "staff"))`:       true,
+		`all(groups, g, startsWith(g, "app-"))`:        false,
+		`string(int("42")) + "!"`:                      "42!",
+		`"@example" in user.email`:                     false,
+	} {
+		assert.Equal(t, want, eval(t, src, vars), src)
+	}
+}
+
+func TestEval_FilterAndStripPrefix(t *testing.T) {
+	// roles = groups filtered by prefix app-x-, stripped of the prefix.
+	v := eval(t, `map(filter(groups, g, startsWith(g, "app-x-")), g, trimPrefix(g, "app-x-"))`,
+		map[string]interface{}{"groups": []string{"app-x-admin", "app-y-admin", "app-x-reader"}})
+	assert.Equal(t, []interface{}{"admin", "reader"}, v)
+
+	v = eval(t, `filter(groups, g, g != "x")`, map[string]interface{}{"groups": nil})
+	assert.Equal(t, []interface{}{}, v, "a missing list filters to an empty one")
+}
+
+func TestCompile_Errors(t *testing.T) {
+	for _, src := range []string{
+		``,
+		`1 +`,
+		`(1`,
+		`unknownVar`,
+		`nope(1)`,
+		`lower()`,
+		`lower("a", "b")`,
+		`filter(groups, 1, true)`,
+		`filter(groups, g, g) + g`, // g is only in scope inside the body
+		`"unterminated`,
+		`1 # 2`,
+		`user.`,
+		strings.Repeat("(", 100) + "1" + strings.Repeat(")", 100),
+		strings.Repeat("a", maxSourceLen+1),
+	} {
+		_, err := Compile(src, testVars)
+		assert.Error(t, err, src)
+	}
+}
+
+func TestEval_RuntimeErrors(t *testing.T) {
+	for _, src := range []string{
+		`1 + "a"`,
+		`1 / 0`,
+		`!1`,
+		`1 ? 2 : 3`,
+		`lower(1)`,
+		`groups.name`,
+		`filter(groups, g, 1)`,
+	} {
+		p, err := Compile(src, testVars)
+		require.NoError(t, err, src)
+		_, err = p.Eval(map[string]interface{}{"groups": []string{"a"}}, Limits{})
+		assert.Error(t, err, src)
+	}
+}
+
+func TestEval_Limits(t *testing.T) {
+	big := make([]interface{}, 200)
+	for i := range big {
+		big[i] = "group"
+	}
+	vars := map[string]interface{}{"groups": big}
+
+	// Nested iteration is quadratic in steps.
+	p, err := Compile(`map(groups, a, map(groups, b, a + b))`, testVars)
+	require.NoError(t, err)
+	_, err = p.Eval(vars, Limits{MaxSteps: 5000, MaxMemory: 1 << 30})
+	assert.ErrorIs(t, err, ErrLimitExceeded)
+
+	// Repeated doubling runs out of memory long before steps.
+	p, err = Compile(`replace(replace(replace(replace(replace("xxxxxxxx", "x", "xxxxxxxx"), "x", "xxxxxxxx"), "x", "xxxxxxxx"), "x", "xxxxxxxx"), "x", "xxxxxxxx")`, testVars)
+	require.NoError(t, err)
+	_, err = p.Eval(nil, Limits{MaxSteps: 1 << 30, MaxMemory: 64 << 10})
+	assert.ErrorIs(t, err, ErrLimitExceeded)
+
+	_, stats, err := p.EvalStats(nil, Limits{MaxSteps: 1 << 30, MaxMemory: 1 << 30})
+	require.NoError(t, err)
+	assert.Greater(t, stats.Memory, 64<<10)
+	assert.Greater(t, stats.Steps, 0)
+}
+
+func TestEval_LimitsChargedBeforeBuilding(t *testing.T) {
+	big := make([]interface{}, 200)
+	for i := range big {
+		big[i] = "group"
+	}
+	limits := Limits{MaxSteps: 1 << 30, MaxMemory: 64 << 10}
+
+	// The joined result would be 200 MB; it must not be built.
+	p, err := Compile(`join(groups, user)`, testVars)
+	require.NoError(t, err)
+	_, err = p.Eval(map[string]interface{}{"groups": big, "user": strings.Repeat("x", 1<<20)}, limits)
+	assert.ErrorIs(t, err, ErrLimitExceeded)
+
+	p, err = Compile(`split(user, ",")`, testVars)
+	require.NoError(t, err)
+	_, err = p.Eval(map[string]interface{}{"user": strings.Repeat(",", 16<<10)}, limits)
+	assert.ErrorIs(t, err, ErrLimitExceeded)
+
+	assert.Equal(t, []interface{}{"a", "b"}, eval(t, `split("a,b", ",")`, nil))
+	assert.Equal(t, "a-b", eval(t, `join(["a", "b"], "-")`, nil))
+}
+
+func TestEval_DoesNotModifyVars(t *testing.T) {
+	vars := map[string]interface{}{"groups": []string{"a"}, "user": "outer"}
+	p, err := Compile(`map(groups, user, user + "!")`, testVars)
+	require.NoError(t, err)
+	v, err := p.Eval(vars, Limits{})
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"a!"}, v)
+	assert.Equal(t, "outer", vars["user"])
+}
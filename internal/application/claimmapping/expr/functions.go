@@ -0,0 +1,282 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// maxPatternLen bounds the regular expressions matches() compiles. Go's
+// regexp runs in linear time, so the pattern size is the only lever.
+const maxPatternLen = 256
+
+type function struct {
+	name             string
+	minArgs, maxArgs int // maxArgs < 0 means variadic
+	call             func(m *machine, args []interface{}) (interface{}, error)
+}
+
+var functions = map[string]*function{}
+
+func register(name string, minArgs, maxArgs int, call func(m *machine, args []interface{}) (interface{}, error)) {
+	functions[name] = &function{name: name, minArgs: minArgs, maxArgs: maxArgs, call: call}
+}
+
+// stringFunc registers a function of one string returning a new string.
+func stringFunc(name string, fn func(string) string) {
+	register(name, 1, 1, func(m *machine, args []interface{}) (interface{}, error) {
+		s, err := str(args[0])
+		if err != nil {
+			return nil, err
+		}
+		if err := m.step(len(s)/64 + 1); err != nil {
+			return nil, err
+		}
+		out := fn(s)
+		return out, m.alloc(len(out))
+	})
+}
+
+// predicate registers a function of two strings returning a bool.
+func predicate(name string, fn func(s, t string) bool) {
+	register(name, 2, 2, func(m *machine, args []interface{}) (interface{}, error) {
+		s, err := str(args[0])
+		if err != nil {
+			return nil, err
+		}
+		t, err := str(args[1])
+		if err != nil {
+			return nil, err
+		}
+		return fn(s, t), m.step(len(s)/64 + 1)
+	})
+}
+
+func init() {
+	stringFunc("lower", strings.ToLower)
+	stringFunc("upper", strings.ToUpper)
+	stringFunc("trim", strings.TrimSpace)
+	predicate("startsWith", strings.HasPrefix)
+	predicate("endsWith", strings.HasSuffix)
+	register("trimPrefix", 2, 2, func(m *machine, args []interface{}) (interface{}, error) {
+		return twoStrings(m, args, strings.TrimPrefix)
+	})
+	register("trimSuffix", 2, 2, func(m *machine, args []interface{}) (interface{}, error) {
+		return twoStrings(m, args, strings.TrimSuffix)
+	})
+	register("replace", 3, 3, func(m *machine, args []interface{}) (interface{}, error) {
+		s, err := str(args[0])
+		if err != nil {
+			return nil, err
+		}
+		old, err := str(args[1])
+		if err != nil {
+			return nil, err
+		}
+		repl, err := str(args[2])
+		if err != nil {
+			return nil, err
+		}
+		if err := m.step(len(s)/64 + 1); err != nil {
+			return nil, err
+		}
+		// Charge the worst case before building the result.
+		if err := m.alloc(len(s) + (len(s)+1)*len(repl)); err != nil {
+			return nil, err
+		}
+		return strings.ReplaceAll(s, old, repl), nil
+	})
+	register("split", 2, 2, func(m *machine, args []interface{}) (interface{}, error) {
+		s, err := str(args[0])
+		if err != nil {
+			return nil, err
+		}
+		sep, err := str(args[1])
+		if err != nil {
+			return nil, err
+		}
+		if sep == "" {
+			return nil, fmt.Errorf("empty separator")
+		}
+		// Count the parts to charge for them before splitting.
+		n := strings.Count(s, sep) + 1
+		if err := m.step(n); err != nil {
+			return nil, err
+		}
+		if err := m.alloc(len(s) + n*sliceSlot); err != nil {
+			return nil, err
+		}
+		parts := strings.Split(s, sep)
+		out := make([]interface{}, len(parts))
+		for i, p := range parts {
+			out[i] = p
+		}
+		return out, nil
+	})
+	register("join", 2, 2, func(m *machine, args []interface{}) (interface{}, error) {
+		list, err := strList(args[0])
+		if err != nil {
+			return nil, err
+		}
+		sep, err := str(args[1])
+		if err != nil {
+			return nil, err
+		}
+		if err := m.step(len(list)); err != nil {
+			return nil, err
+		}
+		// Charge the size of the result before building it.
+		size := 0
+		for _, item := range list {
+			size += len(item)
+		}
+		if len(list) > 1 {
+			size += (len(list) - 1) * len(sep)
+		}
+		if err := m.alloc(size); err != nil {
+			return nil, err
+		}
+		return strings.Join(list, sep), nil
+	})
+	register("contains", 2, 2, func(m *machine, args []interface{}) (interface{}, error) {
+		return m.contains(args[0], args[1])
+	})
+	register("matches", 2, 2, func(m *machine, args []interface{}) (interface{}, error) {
+		s, err := str(args[0])
+		if err != nil {
+			return nil, err
+		}
+		pattern, err := str(args[1])
+		if err != nil {
+			return nil, err
+		}
+		if len(pattern) > maxPatternLen {
+			return nil, fmt.Errorf("pattern longer than %d characters", maxPatternLen)
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		if err := m.step(len(pattern) + len(s)/16 + 1); err != nil {
+			return nil, err
+		}
+		return re.MatchString(s), nil
+	})
+	register("len", 1, 1, func(m *machine, args []interface{}) (interface{}, error) {
+		switch v := args[0].(type) {
+		case nil:
+			return float64(0), nil
+		case string:
+			return float64(len(v)), nil
+		case map[string]interface{}:
+			return float64(len(v)), nil
+		}
+		if list, ok := asList(args[0]); ok {
+			return float64(len(list)), nil
+		}
+		return nil, fmt.Errorf("cannot take the length of %s", typeName(args[0]))
+	})
+	register("unique", 1, 1, func(m *machine, args []interface{}) (interface{}, error) {
+		list, ok := asList(args[0])
+		if !ok {
+			return nil, fmt.Errorf("needs a list, got %s", typeName(args[0]))
+		}
+		if err := m.step(len(list) * len(list) / 16); err != nil {
+			return nil, err
+		}
+		if err := m.alloc(len(list) * sliceSlot); err != nil {
+			return nil, err
+		}
+		out := []interface{}{}
+		for _, item := range list {
+			seen := false
+			for _, o := range out {
+				if equal(o, item) {
+					seen = true
+					break
+				}
+			}
+			if !seen {
+				out = append(out, item)
+			}
+		}
+		return out, nil
+	})
+	register("coalesce", 1, -1, func(m *machine, args []interface{}) (interface{}, error) {
+		for _, a := range args {
+			if a != nil && a != "" {
+				return a, nil
+			}
+		}
+		return nil, nil
+	})
+	register("string", 1, 1, func(m *machine, args []interface{}) (interface{}, error) {
+		out := format(args[0])
+		return out, m.alloc(len(out))
+	})
+	register("int", 1, 1, func(m *machine, args []interface{}) (interface{}, error) {
+		if f, ok := number(args[0]); ok {
+			return math.Trunc(f), nil
+		}
+		if s, ok := args[0].(string); ok {
+			n, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%q is not an integer", s)
+			}
+			return float64(n), nil
+		}
+		return nil, fmt.Errorf("cannot convert %s to int", typeName(args[0]))
+	})
+}
+
+func twoStrings(m *machine, args []interface{}, fn func(s, t string) string) (interface{}, error) {
+	s, err := str(args[0])
+	if err != nil {
+		return nil, err
+	}
+	t, err := str(args[1])
+	if err != nil {
+		return nil, err
+	}
+	if err := m.step(len(s)/64 + 1); err != nil {
+		return nil, err
+	}
+	out := fn(s, t)
+	return out, m.alloc(len(out))
+}
+
+func str(v interface{}) (string, error) {
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("needs a string, got %s", typeName(v))
+	}
+	return s, nil
+}
+
+func strList(v interface{}) ([]string, error) {
+	list, ok := asList(v)
+	if !ok {
+		return nil, fmt.Errorf("needs a list, got %s", typeName(v))
+	}
+	out := make([]string, len(list))
+	for i, item := range list {
+		out[i] = format(item)
+	}
+	return out, nil
+}
+
+// format renders a value as a string; integral numbers have no decimals.
+func format(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return x
+	}
+	if f, ok := number(v); ok {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,359 @@
+package expr
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Compile-time limits. They bound the work the parser does and the depth
+// of recursion the evaluator can reach.
+const (
+	maxSourceLen = 4096
+	maxDepth     = 64
+)
+
+type node interface {
+	eval(m *machine) (interface{}, error)
+}
+
+type (
+	litNode   struct{ v interface{} }
+	identNode struct{ name string }
+	listNode  struct{ items []node }
+	mapNode   struct {
+		keys   []string
+		values []node
+	}
+	unaryNode struct {
+		op string
+		x  node
+	}
+	binaryNode struct {
+		op   string
+		l, r node
+	}
+	condNode   struct{ cond, then, els node }
+	memberNode struct {
+		x    node
+		name string
+	}
+	indexNode struct{ x, idx node }
+	callNode  struct {
+		fn   *function
+		args []node
+	}
+	// macroNode is filter/map/any/all: the body is evaluated once per list
+	// element with the element bound to name.
+	macroNode struct {
+		macro string
+		list  node
+		name  string
+		body  node
+	}
+)
+
+var macros = []string{"filter", "map", "any", "all"}
+
+type parser struct {
+	toks  []token
+	pos   int
+	depth int
+	scope []string // variables in scope: the environment plus macro bindings
+}
+
+func parse(src string, vars []string) (node, error) {
+	if len(src) > maxSourceLen {
+		return nil, fmt.Errorf("expression longer than %d characters", maxSourceLen)
+	}
+	toks, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks, scope: slices.Clone(vars)}
+	n, err := p.expr(0)
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, p.errorf(t, "unexpected %s", describe(t))
+	}
+	return n, nil
+}
+
+func (p *parser) peek() token { return p.toks[p.pos] }
+
+func (p *parser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) isOp(op string) bool {
+	t := p.peek()
+	return t.kind == tokOp && t.text == op
+}
+
+func (p *parser) expect(op string) error {
+	if t := p.next(); t.kind != tokOp || t.text != op {
+		return p.errorf(t, "expected %q, found %s", op, describe(t))
+	}
+	return nil
+}
+
+func (p *parser) errorf(t token, format string, args ...interface{}) error {
+	return fmt.Errorf("%s at %d", fmt.Sprintf(format, args...), t.pos)
+}
+
+func describe(t token) string {
+	switch t.kind {
+	case tokEOF:
+		return "end of expression"
+	case tokNumber:
+		return "number"
+	case tokString:
+		return "string"
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// binding powers of the infix operators; higher binds tighter.
+var infix = map[string]int{
+	"?":  1,
+	"??": 2,
+	"||": 3,
+	"&&": 4,
+	"==": 5, "!=": 5,
+	"<": 6, "<=": 6, ">": 6, ">=": 6, "in": 6,
+	"+": 7, "-": 7,
+	"*": 8, "/": 8, "%": 8,
+}
+
+const prefixPower = 9
+
+func (p *parser) infixOp() (string, int) {
+	t := p.peek()
+	if t.kind == tokOp || (t.kind == tokIdent && t.text == "in") {
+		if bp, ok := infix[t.text]; ok {
+			return t.text, bp
+		}
+	}
+	return "", 0
+}
+
+// expr parses an expression whose operators bind tighter than minBP.
+func (p *parser) expr(minBP int) (node, error) {
+	p.depth++
+	defer func() { p.depth-- }()
+	if p.depth > maxDepth {
+		return nil, p.errorf(p.peek(), "expression nested deeper than %d", maxDepth)
+	}
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, bp := p.infixOp()
+		if bp == 0 || bp <= minBP {
+			return left, nil
+		}
+		p.next()
+		if op == "?" {
+			// Right-associative: a ? b : c ? d : e.
+			then, err := p.expr(0)
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(":"); err != nil {
+				return nil, err
+			}
+			els, err := p.expr(bp - 1)
+			if err != nil {
+				return nil, err
+			}
+			left = &condNode{cond: left, then: then, els: els}
+			continue
+		}
+		right, err := p.expr(bp)
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: op, l: left, r: right}
+	}
+}
+
+func (p *parser) unary() (node, error) {
+	if p.isOp("!") || p.isOp("-") {
+		op := p.next().text
+		x, err := p.expr(prefixPower)
+		if err != nil {
+			return nil, err
+		}
+		return &unaryNode{op: op, x: x}, nil
+	}
+	x, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	return p.postfix(x)
+}
+
+func (p *parser) postfix(x node) (node, error) {
+	for {
+		switch {
+		case p.isOp("."):
+			p.next()
+			t := p.next()
+			if t.kind != tokIdent {
+				return nil, p.errorf(t, "expected field name, found %s", describe(t))
+			}
+			x = &memberNode{x: x, name: t.text}
+		case p.isOp("["):
+			p.next()
+			idx, err := p.expr(0)
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			x = &indexNode{x: x, idx: idx}
+		default:
+			return x, nil
+		}
+	}
+}
+
+func (p *parser) primary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		return &litNode{v: t.num}, nil
+	case tokString:
+		return &litNode{v: t.text}, nil
+	case tokIdent:
+		switch t.text {
+		case "true":
+			return &litNode{v: true}, nil
+		case "false":
+			return &litNode{v: false}, nil
+		case "null":
+			return &litNode{v: nil}, nil
+		}
+		if p.isOp("(") {
+			return p.call(t)
+		}
+		if !slices.Contains(p.scope, t.text) {
+			return nil, p.errorf(t, "unknown variable %q", t.text)
+		}
+		return &identNode{name: t.text}, nil
+	case tokOp:
+		switch t.text {
+		case "(":
+			x, err := p.expr(0)
+			if err != nil {
+				return nil, err
+			}
+			return x, p.expect(")")
+		case "[":
+			items, err := p.list("]")
+			if err != nil {
+				return nil, err
+			}
+			return &listNode{items: items}, nil
+		case "{":
+			return p.mapLiteral()
+		}
+	}
+	return nil, p.errorf(t, "unexpected %s", describe(t))
+}
+
+// list parses comma-separated expressions up to the closing delimiter.
+func (p *parser) list(end string) ([]node, error) {
+	var items []node
+	for !p.isOp(end) {
+		item, err := p.expr(0)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+		if !p.isOp(",") {
+			break
+		}
+		p.next()
+	}
+	return items, p.expect(end)
+}
+
+func (p *parser) mapLiteral() (node, error) {
+	m := &mapNode{}
+	for !p.isOp("}") {
+		t := p.next()
+		if t.kind != tokIdent && t.kind != tokString {
+			return nil, p.errorf(t, "expected key, found %s", describe(t))
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		v, err := p.expr(0)
+		if err != nil {
+			return nil, err
+		}
+		m.keys = append(m.keys, t.text)
+		m.values = append(m.values, v)
+		if !p.isOp(",") {
+			break
+		}
+		p.next()
+	}
+	return m, p.expect("}")
+}
+
+func (p *parser) call(name token) (node, error) {
+	p.next() // (
+	if slices.Contains(macros, name.text) {
+		return p.macro(name)
+	}
+	fn, ok := functions[name.text]
+	if !ok {
+		return nil, p.errorf(name, "unknown function %q", name.text)
+	}
+	args, err := p.list(")")
+	if err != nil {
+		return nil, err
+	}
+	if len(args) < fn.minArgs || (fn.maxArgs >= 0 && len(args) > fn.maxArgs) {
+		return nil, p.errorf(name, "%s: wrong number of arguments", name.text)
+	}
+	return &callNode{fn: fn, args: args}, nil
+}
+
+// macro parses filter(list, x, body) and its siblings. x is in scope only
+// inside body.
+func (p *parser) macro(name token) (node, error) {
+	list, err := p.expr(0)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(","); err != nil {
+		return nil, err
+	}
+	v := p.next()
+	if v.kind != tokIdent {
+		return nil, p.errorf(v, "%s: expected variable name, found %s", name.text, describe(v))
+	}
+	if err := p.expect(","); err != nil {
+		return nil, err
+	}
+	p.scope = append(p.scope, v.text)
+	body, err := p.expr(0)
+	p.scope = p.scope[:len(p.scope)-1]
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	return &macroNode{macro: name.text, list: list, name: v.text, body: body}, nil
+}
@@ -0,0 +1,91 @@
+package claimmapping
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/martencassel/oidcsim/internal/domain/configuration"
+)
+
+// DefaultMaxGroups is the number of groups a token carries before the
+// groups claim is replaced by an overage indicator. It keeps tokens small
+// enough for headers and URLs.
+const DefaultMaxGroups = 200
+
+// Group is a group membership of the user.
+type Group struct {
+	ID     string
+	Name   string
+	Claims map[string]interface{} // the group's claims; "roles" grants application roles
+}
+
+// GroupValues returns the groups a client may see, as names or IDs per
+// cfg.Format, in membership order.
+func GroupValues(groups []Group, cfg configuration.GroupClaimsConfig) []string {
+	out := []string{}
+	for _, g := range groups {
+		if len(cfg.Prefixes) > 0 && !hasAnyPrefix(g.Name, cfg.Prefixes) {
+			continue
+		}
+		if len(cfg.Allow) > 0 && !slices.Contains(cfg.Allow, g.Name) && !slices.Contains(cfg.Allow, g.ID) {
+			continue
+		}
+		v := g.Name
+		if cfg.Format == "id" {
+			v = g.ID
+		}
+		if !slices.Contains(out, v) {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// RoleValues derives application roles from the user's groups: roles the
+// group grants in its "roles" claim, cfg.RoleMap entries and groups named
+// with cfg.RolePrefix. With cfg.AllowRoles set, other roles are dropped.
+func RoleValues(groups []Group, cfg configuration.GroupClaimsConfig) []string {
+	out := []string{}
+	add := func(role string) {
+		if role == "" || slices.Contains(out, role) {
+			return
+		}
+		if len(cfg.AllowRoles) > 0 && !slices.Contains(cfg.AllowRoles, role) {
+			return
+		}
+		out = append(out, role)
+	}
+	for _, g := range groups {
+		if g.Claims != nil {
+			if roles, ok := g.Claims["roles"]; ok {
+				for _, r := range toStrings(roles) {
+					add(r)
+				}
+			}
+		}
+		if role, ok := cfg.RoleMap[g.Name]; ok {
+			add(role)
+		}
+		if cfg.RolePrefix != "" && strings.HasPrefix(g.Name, cfg.RolePrefix) {
+			add(strings.TrimPrefix(g.Name, cfg.RolePrefix))
+		}
+	}
+	return out
+}
+
+// MaxGroups returns the overage threshold of cfg.
+func MaxGroups(cfg configuration.GroupClaimsConfig) int {
+	if cfg.MaxGroups > 0 {
+		return cfg.MaxGroups
+	}
+	return DefaultMaxGroups
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
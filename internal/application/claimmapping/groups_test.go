@@ -0,0 +1,35 @@
+package claimmapping
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/martencassel/oidcsim/internal/domain/configuration"
+)
+
+var testGroups = []Group{
+	{ID: "1", Name: "app-x-admin"},
+	{ID: "2", Name: "app-y-reader"},
+	{ID: "3", Name: "staff", Claims: map[string]interface{}{"roles": []string{"employee", "app-x-admin"}}},
+}
+
+func TestGroupValues(t *testing.T) {
+	assert.Equal(t, []string{"app-x-admin", "app-y-reader", "staff"}, GroupValues(testGroups, configuration.GroupClaimsConfig{}))
+	assert.Equal(t, []string{"1"}, GroupValues(testGroups, configuration.GroupClaimsConfig{Format: "id", Prefixes: []string{"app-x-"}}))
+	assert.Equal(t, []string{"app-y-reader", "staff"}, GroupValues(testGroups, configuration.GroupClaimsConfig{Allow: []string{"2", "staff"}}))
+	assert.Equal(t, []string{}, GroupValues(nil, configuration.GroupClaimsConfig{}))
+}
+
+func TestRoleValues(t *testing.T) {
+	cfg := configuration.GroupClaimsConfig{RolePrefix: "app-x-", RoleMap: map[string]string{"app-y-reader": "reader"}}
+	assert.Equal(t, []string{"admin", "reader", "employee", "app-x-admin"}, RoleValues(testGroups, cfg))
+
+	cfg.AllowRoles = []string{"admin", "employee"}
+	assert.Equal(t, []string{"admin", "employee"}, RoleValues(testGroups, cfg))
+}
+
+func TestMaxGroups(t *testing.T) {
+	assert.Equal(t, DefaultMaxGroups, MaxGroups(configuration.GroupClaimsConfig{}))
+	assert.Equal(t, 5, MaxGroups(configuration.GroupClaimsConfig{MaxGroups: 5}))
+}
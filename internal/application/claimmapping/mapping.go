@@ -0,0 +1,483 @@
+// Package claimmapping applies declarative claim mapping rules
+// (configuration.ClaimMappingConfig) to the attributes of a user before
+// they are released in a token or userinfo response.
+//
+// Rules run in two stages: the rules of the identity source the user came
+// from normalise source attributes into internal claims, then the rules of
+// the client shape those claims for the relying party. Within a stage,
+// rules run in order and each sees the output of the previous one.
+package claimmapping
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/martencassel/oidcsim/internal/application/claimmapping/expr"
+	"github.com/martencassel/oidcsim/internal/domain/configuration"
+)
+
+// Token kinds a rule can be limited to with ClaimMappingConfig.Tokens.
+const (
+	TokenID       = "id_token"
+	TokenAccess   = "access_token"
+	TokenUserinfo = "userinfo"
+)
+
+// Mapping operations. A rule without Op renames SourceAttr to TargetClaim.
+const (
+	OpRename   = "rename"
+	OpCopy     = "copy"
+	OpConstant = "constant"
+	OpDefault  = "default"
+	OpJoin     = "join"
+	OpSplit    = "split"
+	OpRegex    = "regex"
+	OpMap      = "map"
+	OpRemove   = "remove"
+	OpExpr     = "expr"
+)
+
+// ExprVars are the variables an expression can read:
+//
+//	user    {id, username, email, source}
+//	groups  names of the user's groups
+//	client  {id, name}
+//	scopes  granted scopes
+//	auth    {acr, amr, auth_time}
+//	claims  the claims mapped so far
+//	value   the rule's source attribute, or null
+//	token   id_token, access_token or userinfo
+var ExprVars = []string{"user", "groups", "client", "scopes", "auth", "claims", "value", "token"}
+
+// reservedClaims are set by the token service and cannot be mapped.
+var reservedClaims = []string{
+	"iss", "sub", "aud", "exp", "nbf", "iat", "jti", "client_id", "scope",
+	"cnf", "azp", "nonce", "auth_time", "at_hash", "c_hash", "sid", "acr", "amr",
+}
+
+// Rule is a validated mapping rule.
+type Rule struct {
+	cfg  configuration.ClaimMappingConfig
+	re   *regexp.Regexp
+	prog *expr.Program // for OpExpr
+	when *expr.Program // When.Expr
+}
+
+// Rules is an ordered list of rules.
+type Rules []Rule
+
+// Compile validates cfgs and prepares them for Apply. Configuration should
+// be compiled when it is loaded so mistakes surface before a token is
+// issued.
+func Compile(cfgs []configuration.ClaimMappingConfig) (Rules, error) {
+	rules := make(Rules, 0, len(cfgs))
+	for i, cfg := range cfgs {
+		rule, err := compileRule(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("claim mapping %d (%s): %w", i, cfg.TargetClaim, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func compileRule(cfg configuration.ClaimMappingConfig) (Rule, error) {
+	if cfg.Op == "" {
+		cfg.Op = OpRename
+	}
+	if cfg.TargetClaim == "" {
+		return Rule{}, fmt.Errorf("target is required")
+	}
+	if slices.Contains(reservedClaims, cfg.TargetClaim) {
+		return Rule{}, fmt.Errorf("claim %q is set by the token service and cannot be mapped", cfg.TargetClaim)
+	}
+	rule := Rule{cfg: cfg}
+	switch cfg.Op {
+	case OpRename, OpCopy, OpJoin, OpSplit:
+		if cfg.SourceAttr == "" {
+			return Rule{}, fmt.Errorf("%s requires a source", cfg.Op)
+		}
+	case OpConstant:
+		if cfg.Value == nil {
+			return Rule{}, fmt.Errorf("constant requires a value")
+		}
+	case OpDefault:
+		if cfg.SourceAttr == "" && cfg.Value == nil {
+			return Rule{}, fmt.Errorf("default requires a source or a value")
+		}
+	case OpRegex:
+		if cfg.SourceAttr == "" || cfg.Pattern == "" {
+			return Rule{}, fmt.Errorf("regex requires a source and a pattern")
+		}
+		re, err := regexp.Compile(cfg.Pattern)
+		if err != nil {
+			return Rule{}, fmt.Errorf("invalid pattern: %w", err)
+		}
+		rule.re = re
+	case OpMap:
+		if cfg.SourceAttr == "" || len(cfg.Table) == 0 {
+			return Rule{}, fmt.Errorf("map requires a source and a table")
+		}
+	case OpExpr:
+		if cfg.Expr == "" {
+			return Rule{}, fmt.Errorf("expr requires an expression")
+		}
+		prog, err := expr.Compile(cfg.Expr, ExprVars)
+		if err != nil {
+			return Rule{}, fmt.Errorf("invalid expression: %w", err)
+		}
+		rule.prog = prog
+	case OpRemove:
+	default:
+		return Rule{}, fmt.Errorf("unknown op %q", cfg.Op)
+	}
+	switch cfg.Type {
+	case "", "string", "int", "float", "bool", "strings":
+	default:
+		return Rule{}, fmt.Errorf("unknown type %q", cfg.Type)
+	}
+	for _, token := range cfg.Tokens {
+		if token != TokenID && token != TokenAccess && token != TokenUserinfo {
+			return Rule{}, fmt.Errorf("unknown token %q", token)
+		}
+	}
+	if cfg.When != nil && cfg.When.Equals != nil && cfg.When.Claim == "" {
+		return Rule{}, fmt.Errorf("when.equals requires when.claim")
+	}
+	if cfg.When != nil && cfg.When.Expr != "" {
+		prog, err := expr.Compile(cfg.When.Expr, ExprVars)
+		if err != nil {
+			return Rule{}, fmt.Errorf("invalid when.expr: %w", err)
+		}
+		rule.when = prog
+	}
+	return rule, nil
+}
+
+// Context is what a rule's conditions and expressions are evaluated
+// against.
+type Context struct {
+	Token  string   // TokenID, TokenAccess or TokenUserinfo
+	Scopes []string // granted scopes
+	User   UserInfo
+	Groups []string // names of the user's groups
+	Client ClientInfo
+	Auth   AuthInfo
+	Limits expr.Limits // per expression; zero uses expr.DefaultLimits
+}
+
+// UserInfo identifies the user whose claims are mapped.
+type UserInfo struct {
+	ID       string
+	Username string
+	Email    string
+	Source   string
+}
+
+// ClientInfo identifies the client the claims are released to.
+type ClientInfo struct {
+	ID   string
+	Name string
+}
+
+// AuthInfo describes the authentication the token is based on.
+type AuthInfo struct {
+	ACR      string
+	AMR      []string
+	AuthTime time.Time
+}
+
+// vars returns the expression environment for a rule.
+func (ctx Context) vars(claims map[string]interface{}, value interface{}) map[string]interface{} {
+	auth := map[string]interface{}{"acr": ctx.Auth.ACR, "amr": stringList(ctx.Auth.AMR), "auth_time": nil}
+	if !ctx.Auth.AuthTime.IsZero() {
+		auth["auth_time"] = ctx.Auth.AuthTime.Unix()
+	}
+	return map[string]interface{}{
+		"user": map[string]interface{}{
+			"id": ctx.User.ID, "username": ctx.User.Username, "email": ctx.User.Email, "source": ctx.User.Source,
+		},
+		"groups": stringList(ctx.Groups),
+		"client": map[string]interface{}{"id": ctx.Client.ID, "name": ctx.Client.Name},
+		"scopes": stringList(ctx.Scopes),
+		"auth":   auth,
+		"claims": claims,
+		"value":  value,
+		"token":  ctx.Token,
+	}
+}
+
+// Eval runs a program compiled with ExprVars against the context, as a
+// rule would. It is used to dry-run expressions.
+func (ctx Context) Eval(p *expr.Program, claims map[string]interface{}, value interface{}) (interface{}, expr.Stats, error) {
+	return p.EvalStats(ctx.vars(claims, value), ctx.Limits)
+}
+
+func stringList(l []string) []interface{} {
+	out := make([]interface{}, len(l))
+	for i, s := range l {
+		out[i] = s
+	}
+	return out
+}
+
+// Apply runs the rules over claims in place. It returns the claims the
+// rules wrote; claims removed by a later rule are not included. A rule
+// whose expression fails is skipped and its error returned.
+func (rs Rules) Apply(claims map[string]interface{}, ctx Context) (map[string]bool, []error) {
+	mapped := map[string]bool{}
+	var errs []error
+	for _, r := range rs {
+		if err := r.apply(claims, ctx, mapped); err != nil {
+			errs = append(errs, fmt.Errorf("claim %s: %w", r.cfg.TargetClaim, err))
+		}
+	}
+	return mapped, errs
+}
+
+func (r Rule) apply(claims map[string]interface{}, ctx Context, mapped map[string]bool) error {
+	cfg := r.cfg
+	if len(cfg.Tokens) > 0 && !slices.Contains(cfg.Tokens, ctx.Token) {
+		return nil
+	}
+	src, hasSrc := lookup(claims, cfg.SourceAttr)
+	if ok, err := r.matches(claims, ctx, src); !ok || err != nil {
+		return err
+	}
+
+	var out interface{}
+	switch cfg.Op {
+	case OpRename, OpCopy:
+		if !hasSrc {
+			return nil
+		}
+		out = src
+	case OpConstant:
+		out = cfg.Value
+	case OpDefault:
+		if _, ok := lookup(claims, cfg.TargetClaim); ok {
+			return nil
+		}
+		if hasSrc {
+			out = src
+		} else if cfg.Value != nil {
+			out = cfg.Value
+		} else {
+			return nil
+		}
+	case OpJoin:
+		if !hasSrc {
+			return nil
+		}
+		sep := cfg.Separator
+		if sep == "" {
+			sep = " "
+		}
+		out = strings.Join(toStrings(src), sep)
+	case OpSplit:
+		if !hasSrc {
+			return nil
+		}
+		sep := cfg.Separator
+		if sep == "" {
+			sep = ","
+		}
+		var parts []string
+		for _, s := range toStrings(src) {
+			for _, p := range strings.Split(s, sep) {
+				if p = strings.TrimSpace(p); p != "" {
+					parts = append(parts, p)
+				}
+			}
+		}
+		out = parts
+	case OpRegex:
+		if !hasSrc {
+			return nil
+		}
+		var ok bool
+		if out, ok = eachValue(src, r.extract); !ok {
+			return nil
+		}
+	case OpMap:
+		if !hasSrc {
+			return nil
+		}
+		var ok bool
+		if out, ok = eachValue(src, r.lookupTable); !ok {
+			return nil
+		}
+	case OpRemove:
+		delete(claims, cfg.TargetClaim)
+		delete(mapped, cfg.TargetClaim)
+		return nil
+	case OpExpr:
+		v, err := r.prog.Eval(ctx.vars(claims, src), ctx.Limits)
+		if err != nil {
+			return err
+		}
+		if v == nil {
+			delete(claims, cfg.TargetClaim)
+			delete(mapped, cfg.TargetClaim)
+			return nil
+		}
+		out = v
+	}
+
+	if cfg.Type != "" {
+		coerced, err := coerce(out, cfg.Type)
+		if err != nil {
+			return err
+		}
+		out = coerced
+	}
+	if cfg.Op == OpRename && cfg.SourceAttr != cfg.TargetClaim {
+		delete(claims, cfg.SourceAttr)
+		delete(mapped, cfg.SourceAttr)
+	}
+	claims[cfg.TargetClaim] = out
+	mapped[cfg.TargetClaim] = true
+	return nil
+}
+
+// matches evaluates the rule's condition.
+func (r Rule) matches(claims map[string]interface{}, ctx Context, src interface{}) (bool, error) {
+	when := r.cfg.When
+	if when == nil {
+		return true, nil
+	}
+	if when.Scope != "" && !slices.Contains(ctx.Scopes, when.Scope) {
+		return false, nil
+	}
+	if when.Claim != "" {
+		v, ok := lookup(claims, when.Claim)
+		if !ok {
+			return false, nil
+		}
+		if when.Equals != nil && !slices.Contains(toStrings(v), fmt.Sprint(when.Equals)) {
+			return false, nil
+		}
+	}
+	if r.when != nil {
+		v, err := r.when.Eval(ctx.vars(claims, src), ctx.Limits)
+		if err != nil {
+			return false, err
+		}
+		b, ok := v.(bool)
+		if !ok {
+			return false, fmt.Errorf("when.expr must return a bool")
+		}
+		return b, nil
+	}
+	return true, nil
+}
+
+// extract returns the first group of the pattern's match, or the whole
+// match when the pattern has no groups.
+func (r Rule) extract(s string) (string, bool) {
+	m := r.re.FindStringSubmatch(s)
+	if m == nil {
+		return "", false
+	}
+	if len(m) > 1 {
+		return m[1], true
+	}
+	return m[0], true
+}
+
+// lookupTable maps s through the table. Values not in the table map to
+// the rule's value, if one is set, and are dropped otherwise.
+func (r Rule) lookupTable(s string) (string, bool) {
+	if v, ok := r.cfg.Table[s]; ok {
+		return v, true
+	}
+	if r.cfg.Value != nil {
+		return fmt.Sprint(r.cfg.Value), true
+	}
+	return "", false
+}
+
+// eachValue applies fn to a single value or to every element of a list.
+// A list keeps the elements fn accepts; a single value must be accepted.
+func eachValue(v interface{}, fn func(string) (string, bool)) (interface{}, bool) {
+	if list, ok := asList(v); ok {
+		out := []string{}
+		for _, item := range list {
+			if s, ok := fn(fmt.Sprint(item)); ok {
+				out = append(out, s)
+			}
+		}
+		return out, len(out) > 0
+	}
+	return fn(fmt.Sprint(v))
+}
+
+// lookup returns a claim that is present and not empty.
+func lookup(claims map[string]interface{}, name string) (interface{}, bool) {
+	if name == "" {
+		return nil, false
+	}
+	v, ok := claims[name]
+	if !ok || v == nil || v == "" {
+		return nil, false
+	}
+	if list, isList := asList(v); isList && len(list) == 0 {
+		return nil, false
+	}
+	return v, true
+}
+
+func asList(v interface{}) ([]interface{}, bool) {
+	switch l := v.(type) {
+	case []interface{}:
+		return l, true
+	case []string:
+		out := make([]interface{}, len(l))
+		for i, s := range l {
+			out[i] = s
+		}
+		return out, true
+	}
+	return nil, false
+}
+
+func toStrings(v interface{}) []string {
+	list, ok := asList(v)
+	if !ok {
+		return []string{fmt.Sprint(v)}
+	}
+	out := make([]string, len(list))
+	for i, item := range list {
+		out[i] = fmt.Sprint(item)
+	}
+	return out
+}
+
+// coerce converts v to typ. Only "strings" accepts a list.
+func coerce(v interface{}, typ string) (interface{}, error) {
+	if typ == "strings" {
+		return toStrings(v), nil
+	}
+	if _, ok := asList(v); ok {
+		return nil, fmt.Errorf("cannot convert a list to %s", typ)
+	}
+	s := fmt.Sprint(v)
+	switch typ {
+	case "string":
+		return s, nil
+	case "int":
+		if f, ok := v.(float64); ok && f == float64(int64(f)) {
+			return int64(f), nil
+		}
+		return strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	case "float":
+		return strconv.ParseFloat(strings.TrimSpace(s), 64)
+	case "bool":
+		return strconv.ParseBool(strings.TrimSpace(s))
+	}
+	return nil, fmt.Errorf("unknown type %q", typ)
+}
@@ -0,0 +1,203 @@
+package claimmapping
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+
+	"github.com/martencassel/oidcsim/internal/application/claimmapping/expr"
+	"github.com/martencassel/oidcsim/internal/domain/configuration"
+)
+
+func mustCompile(t *testing.T, src string) Rules {
+	t.Helper()
+	var cfgs []configuration.ClaimMappingConfig
+	require.NoError(t, yaml.Unmarshal([]byte(src), &cfgs))
+	rules, err := Compile(cfgs)
+	require.NoError(t, err)
+	return rules
+}
+
+func TestRules_Operations(t *testing.T) {
+	rules := mustCompile(t, `
+- { source: mail, target: email }
+- { source: givenName, target: given_name, op: copy }
+- { target: tenant, op: constant, value: acme }
+- { source: upn, target: login, op: default }
+- { source: mail_alt, target: login, op: default, value: unknown }
+- { source: memberOf, target: roles, op: regex, pattern: "CN=([^,]+)" }
+- { source: countryCode, target: region, op: map, table: { SE: EU, US: NA } }
+- { source: tags, target: tag_list, op: join, separator: "," }
+- { source: aliases, target: alias_list, op: split }
+- { source: level, target: level, op: copy, type: int }
+- { source: vip, target: vip, op: copy, type: bool }
+`)
+	claims := map[string]interface{}{
+		"mail":        "alice@example.com",
+		"givenName":   "Alice",
+		"memberOf":    []interface{}{"CN=Admins,OU=Groups", "CN=Staff,OU=Groups", "OU=NoCN"},
+		"countryCode": "SE",
+		"tags":        []string{"a", "b"},
+		"aliases":     "ali, al ,",
+		"level":       "3",
+		"vip":         "true",
+	}
+	mapped, errs := rules.Apply(claims, Context{Token: TokenID})
+	require.Empty(t, errs)
+
+	assert.Equal(t, "alice@example.com", claims["email"])
+	assert.NotContains(t, claims, "mail", "rename removes the source attribute")
+	assert.Equal(t, "Alice", claims["givenName"], "copy keeps the source attribute")
+	assert.Equal(t, "Alice", claims["given_name"])
+	assert.Equal(t, "acme", claims["tenant"])
+	assert.Equal(t, "unknown", claims["login"], "default falls back to the value when no source is present")
+	assert.Equal(t, []string{"Admins", "Staff"}, claims["roles"])
+	assert.Equal(t, "EU", claims["region"])
+	assert.Equal(t, "a,b", claims["tag_list"])
+	assert.Equal(t, []string{"ali", "al"}, claims["alias_list"])
+	assert.Equal(t, int64(3), claims["level"])
+	assert.Equal(t, true, claims["vip"])
+	for _, name := range []string{"email", "given_name", "tenant", "login", "roles", "region", "tag_list", "alias_list", "level", "vip"} {
+		assert.True(t, mapped[name], name)
+	}
+}
+
+func TestRules_DefaultKeepsExistingValue(t *testing.T) {
+	rules := mustCompile(t, `
+- { source: upn, target: email, op: default }
+- { source: mail, target: email, op: default }
+`)
+	claims := map[string]interface{}{"mail": "m@example.com", "upn": "u@example.com"}
+	rules.Apply(claims, Context{})
+	assert.Equal(t, "u@example.com", claims["email"], "the first present source wins")
+}
+
+func TestRules_MapUnmatchedValues(t *testing.T) {
+	rules := mustCompile(t, `
+- { source: country, target: region, op: map, table: { SE: EU } }
+- { source: country, target: zone, op: map, table: { SE: EU }, value: other }
+`)
+	claims := map[string]interface{}{"country": "BR"}
+	rules.Apply(claims, Context{})
+	assert.NotContains(t, claims, "region", "unmatched values are dropped without a fallback")
+	assert.Equal(t, "other", claims["zone"])
+}
+
+func TestRules_Conditions(t *testing.T) {
+	rules := mustCompile(t, `
+- { target: phone_number, op: remove, when: { claim: trust, equals: low } }
+- { target: department, op: constant, value: sales, when: { scope: hr } }
+- { target: at_only, op: constant, value: x, tokens: [access_token] }
+`)
+	claims := map[string]interface{}{"trust": "low", "phone_number": "+46"}
+	mapped, _ := rules.Apply(claims, Context{Token: TokenUserinfo, Scopes: []string{"openid"}})
+	assert.NotContains(t, claims, "phone_number")
+	assert.NotContains(t, claims, "department", "scope condition not met")
+	assert.NotContains(t, claims, "at_only", "rule limited to access tokens")
+	assert.Empty(t, mapped)
+
+	claims = map[string]interface{}{"trust": "high", "phone_number": "+46"}
+	rules.Apply(claims, Context{Token: TokenAccess, Scopes: []string{"hr"}})
+	assert.Equal(t, "+46", claims["phone_number"])
+	assert.Equal(t, "sales", claims["department"])
+	assert.Equal(t, "x", claims["at_only"])
+}
+
+func TestRules_FailedCoercionSkipsRule(t *testing.T) {
+	rules := mustCompile(t, `[{ source: level, target: level_num, op: copy, type: int }]`)
+	claims := map[string]interface{}{"level": "high"}
+	mapped, errs := rules.Apply(claims, Context{})
+	assert.Empty(t, mapped)
+	assert.Len(t, errs, 1)
+	assert.NotContains(t, claims, "level_num")
+}
+
+func TestCompile_Errors(t *testing.T) {
+	for name, cfg := range map[string]configuration.ClaimMappingConfig{
+		"no target":      {SourceAttr: "mail"},
+		"reserved claim": {SourceAttr: "uid", TargetClaim: "sub"},
+		"unknown op":     {SourceAttr: "a", TargetClaim: "b", Op: "eval"},
+		"rename no src":  {TargetClaim: "b"},
+		"constant":       {TargetClaim: "b", Op: OpConstant},
+		"bad pattern":    {SourceAttr: "a", TargetClaim: "b", Op: OpRegex, Pattern: "("},
+		"empty table":    {SourceAttr: "a", TargetClaim: "b", Op: OpMap},
+		"unknown type":   {SourceAttr: "a", TargetClaim: "b", Type: "date"},
+		"unknown token":  {SourceAttr: "a", TargetClaim: "b", Tokens: []string{"refresh_token"}},
+		"equals only":    {SourceAttr: "a", TargetClaim: "b", When: &configuration.ClaimCondition{Equals: "x"}},
+	} {
+		_, err := Compile([]configuration.ClaimMappingConfig{cfg})
+		assert.Error(t, err, name)
+	}
+}
+
+func TestPipeline_SourceThenClientRules(t *testing.T) {
+	p, err := NewPipeline([]configuration.IdentitySourceConfig{{
+		Name:         "ldap",
+		ClaimMapping: []configuration.ClaimMappingConfig{{SourceAttr: "mail", TargetClaim: "email"}},
+	}})
+	require.NoError(t, err)
+	client := mustCompile(t, `[{ source: email, target: upn, op: copy }]`)
+	attrs := map[string]interface{}{"mail": "a@example.com"}
+
+	res := p.Apply(Input{Source: "ldap", Attributes: attrs, ClientRules: client})
+	assert.Equal(t, "a@example.com", res.Claims["upn"], "client rules see the source's output")
+	assert.Equal(t, map[string]bool{"email": true, "upn": true}, res.Mapped)
+	assert.Equal(t, map[string]interface{}{"mail": "a@example.com"}, attrs, "input is not modified")
+
+	res = p.Apply(Input{Source: "local", Attributes: attrs, ClientRules: client})
+	assert.Empty(t, res.Mapped, "other sources do not get the ldap rules")
+
+	_, err = NewPipeline([]configuration.IdentitySourceConfig{{
+		Name:         "bad",
+		ClaimMapping: []configuration.ClaimMappingConfig{{SourceAttr: "a", TargetClaim: "b", Op: "nope"}},
+	}})
+	assert.Error(t, err)
+}
+
+func TestRules_Expressions(t *testing.T) {
+	rules := mustCompile(t, `
+- target: roles
+  op: expr
+  expr: 'map(filter(groups, g, startsWith(g, "app-x-")), g, trimPrefix(g, "app-x-"))'
+- target: display
+  op: expr
+  expr: 'claims.given_name + " (" + client.id + ")"'
+  when: { expr: 'len(claims.roles ?? []) > 0 || "profile" in scopes' }
+- { target: nickname, op: expr, expr: 'null' }
+- { source: level, target: level_label, op: expr, expr: 'value >= 3 ? "high" : "low"' }
+`)
+	_, err := Compile([]configuration.ClaimMappingConfig{{TargetClaim: "x", Op: OpExpr, Expr: "roles"}})
+	assert.Error(t, err, "claims are read through claims.<name>")
+
+	claims := map[string]interface{}{"given_name": "Alice", "nickname": "al", "level": 4}
+	mapped, errs := rules.Apply(claims, Context{
+		Groups: []string{"app-x-admin", "staff"},
+		Client: ClientInfo{ID: "app"},
+		Scopes: []string{"openid", "profile"},
+	})
+	require.Empty(t, errs)
+	assert.Equal(t, []interface{}{"admin"}, claims["roles"])
+	assert.Equal(t, "Alice (app)", claims["display"])
+	assert.NotContains(t, claims, "nickname", "a null result removes the claim")
+	assert.Equal(t, "high", claims["level_label"])
+	assert.Equal(t, map[string]bool{"roles": true, "display": true, "level_label": true}, mapped)
+
+	// A failing expression skips only its own rule.
+	claims = map[string]interface{}{"level": "four"}
+	_, errs = rules.Apply(claims, Context{})
+	assert.Len(t, errs, 1)
+	assert.Equal(t, []interface{}{}, claims["roles"])
+}
+
+func TestRules_ExpressionLimits(t *testing.T) {
+	rules := mustCompile(t, `[{ target: x, op: expr, expr: 'map(groups, a, map(groups, b, a + b))' }]`)
+	groups := make([]string, 100)
+	for i := range groups {
+		groups[i] = "g"
+	}
+	_, errs := rules.Apply(map[string]interface{}{}, Context{Groups: groups, Limits: expr.Limits{MaxSteps: 1000}})
+	require.Len(t, errs, 1)
+	assert.ErrorIs(t, errs[0], expr.ErrLimitExceeded)
+}
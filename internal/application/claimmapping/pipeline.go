@@ -0,0 +1,95 @@
+package claimmapping
+
+import (
+	"fmt"
+
+	"github.com/martencassel/oidcsim/internal/application/claimmapping/expr"
+	"github.com/martencassel/oidcsim/internal/domain/configuration"
+)
+
+// Pipeline holds the compiled rules of every identity source. Client rules
+// are passed with each request because they live with the client
+// registration.
+type Pipeline struct {
+	sources map[string]Rules
+	limits  expr.Limits
+}
+
+// NewPipeline compiles the claim mapping of each identity source, keyed by
+// source name.
+func NewPipeline(sources []configuration.IdentitySourceConfig) (*Pipeline, error) {
+	p := &Pipeline{sources: map[string]Rules{}}
+	for _, src := range sources {
+		if len(src.ClaimMapping) == 0 {
+			continue
+		}
+		if src.Name == "" {
+			return nil, fmt.Errorf("identity source with claim mapping has no name")
+		}
+		rules, err := Compile(src.ClaimMapping)
+		if err != nil {
+			return nil, fmt.Errorf("identity source %s: %w", src.Name, err)
+		}
+		p.sources[src.Name] = rules
+	}
+	return p, nil
+}
+
+// SetLimits bounds every expression the pipeline evaluates.
+func (p *Pipeline) SetLimits(limits expr.Limits) {
+	p.limits = limits
+}
+
+// Limits returns the expression limits set with SetLimits.
+func (p *Pipeline) Limits() expr.Limits {
+	if p == nil {
+		return expr.Limits{}
+	}
+	return p.limits
+}
+
+// Input is one mapping request.
+type Input struct {
+	Context
+	Source      string                 // identity source the user came from
+	Attributes  map[string]interface{} // user attributes; not modified
+	ClientRules Rules
+}
+
+// Result is the mapped claim set.
+type Result struct {
+	Claims map[string]interface{}
+	Mapped map[string]bool // claims written by a rule
+	Errors []error         // rules skipped because they failed
+}
+
+// Apply runs the source rules and then the client rules over a copy of
+// the input attributes. A nil Pipeline applies only the client rules.
+func (p *Pipeline) Apply(in Input) Result {
+	claims := make(map[string]interface{}, len(in.Attributes))
+	for k, v := range in.Attributes {
+		claims[k] = v
+	}
+	mapped := map[string]bool{}
+	var errs []error
+	stages := []Rules{nil, in.ClientRules}
+	if p != nil {
+		stages[0] = p.sources[in.Source]
+		if in.Limits == (expr.Limits{}) {
+			in.Limits = p.limits
+		}
+	}
+	for _, rules := range stages {
+		written, failed := rules.Apply(claims, in.Context)
+		for name := range written {
+			mapped[name] = true
+		}
+		errs = append(errs, failed...)
+	}
+	for name := range mapped {
+		if _, ok := claims[name]; !ok {
+			delete(mapped, name)
+		}
+	}
+	return Result{Claims: claims, Mapped: mapped, Errors: errs}
+}
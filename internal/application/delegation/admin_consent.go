@@ -0,0 +1,122 @@
+package delegation
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	delegation "github.com/martencassel/oidcsim/internal/domain/delegation"
+)
+
+// GrantAdminConsent pre-authorizes the client for the users subjects
+// selects, e.g. when a tenant onboards an internal application. Their
+// Delegations are created as they next sign in to the client, without a
+// consent screen.
+func (s *delegationServiceImpl) GrantAdminConsent(ctx context.Context, clientID string, scopes []string, subjects delegation.SubjectSelector, grantedBy string) (delegation.AdminConsent, error) {
+	if s.admin == nil {
+		return delegation.AdminConsent{}, ErrAdminConsentNotConfigured
+	}
+	a, err := delegation.NewAdminConsent(clientID, slices.Clone(scopes), subjects, grantedBy)
+	if err != nil {
+		return delegation.AdminConsent{}, err
+	}
+	if err := s.admin.Save(ctx, a); err != nil {
+		return delegation.AdminConsent{}, err
+	}
+	return a, nil
+}
+
+// ListAdminConsents returns the client's admin consents that are not
+// revoked, newest first.
+func (s *delegationServiceImpl) ListAdminConsents(ctx context.Context, clientID string) ([]delegation.AdminConsent, error) {
+	if s.admin == nil {
+		return nil, nil
+	}
+	all, err := s.admin.ListByClient(ctx, clientID)
+	if err != nil {
+		return nil, err
+	}
+	active := make([]delegation.AdminConsent, 0, len(all))
+	for _, a := range all {
+		if !a.IsRevoked() {
+			active = append(active, a)
+		}
+	}
+	slices.SortFunc(active, func(a, b delegation.AdminConsent) int { return b.CreatedAt.Compare(a.CreatedAt) })
+	return active, nil
+}
+
+// RevokeAdminConsent revokes the admin consent and every Delegation it
+// granted, so tokens issued under them stop working and the users are
+// asked for consent themselves next time. Delegations users granted on
+// their own only lose the scopes the admin consent added to them.
+func (s *delegationServiceImpl) RevokeAdminConsent(ctx context.Context, adminConsentID string) error {
+	if s.admin == nil {
+		return ErrAdminConsentNotConfigured
+	}
+	a, err := s.admin.FindByID(ctx, adminConsentID)
+	if err != nil {
+		return err
+	}
+	if a == nil {
+		return fmt.Errorf("admin consent not found: %s", adminConsentID)
+	}
+	if !a.IsRevoked() {
+		now := time.Now()
+		a.RevokedAt = &now
+		if err := s.admin.Save(ctx, *a); err != nil {
+			return err
+		}
+	}
+	granted, err := s.repo.ListByClient(ctx, a.ClientID)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, d := range granted {
+		if d.IsRevoked() {
+			continue
+		}
+		if d.AdminConsentID == a.ID {
+			if err := s.repo.Revoke(ctx, d.ID, now); err != nil {
+				return err
+			}
+		} else if d.RemoveAdminScopes(a.ID) {
+			if err := s.repo.Save(ctx, d); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// adminConsentFor returns an admin consent to the client that selects the
+// user and covers every one of scopes, or nil when there is none. Group
+// memberships are only looked up when a consent names groups.
+func (s *delegationServiceImpl) adminConsentFor(ctx context.Context, userID, clientID string, scopes []string) (*delegation.AdminConsent, error) {
+	if s.admin == nil {
+		return nil, nil
+	}
+	consents, err := s.admin.ListByClient(ctx, clientID)
+	if err != nil {
+		return nil, err
+	}
+	var groups []string
+	groupsLoaded := false
+	for _, a := range consents {
+		if a.IsRevoked() || !a.Covers(scopes) {
+			continue
+		}
+		if len(a.Subjects.GroupIDs) > 0 && !groupsLoaded && s.groups != nil {
+			if groups, err = s.groups(ctx, userID); err != nil {
+				return nil, err
+			}
+			groupsLoaded = true
+		}
+		if a.Subjects.Matches(userID, groups) {
+			return &a, nil
+		}
+	}
+	return nil, nil
+}
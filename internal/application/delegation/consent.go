@@ -1,5 +1,7 @@
 package delegation
 
+import "github.com/martencassel/oidcsim/internal/domain/delegation"
+
 type ConsentStatus string
 
 const (
@@ -8,4 +10,15 @@ const (
 	ConsentRequired ConsentStatus = "required"
 )
 
-
+// StatusOf returns the consent status a decision stands for. No decision
+// yet means the user has to be asked.
+func StatusOf(d delegation.ConsentDecision) ConsentStatus {
+	switch d {
+	case delegation.ConsentStatusGranted, delegation.ConsentDecisionApprove:
+		return ConsentGranted
+	case delegation.ConsentDecisionDeny:
+		return ConsentDenied
+	default:
+		return ConsentRequired
+	}
+}
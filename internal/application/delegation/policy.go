@@ -0,0 +1,33 @@
+package delegation
+
+import (
+	"context"
+
+	"github.com/martencassel/oidcsim/internal/identity"
+	"github.com/martencassel/oidcsim/internal/store"
+)
+
+// FirstPartyClients trusts the clients registered as first party.
+func FirstPartyClients(clients store.ClientStore) TrustedClients {
+	return func(ctx context.Context, clientID string) bool {
+		client, err := clients.GetByID(ctx, clientID)
+		return err == nil && client.Meta.FirstParty && client.Meta.Enabled
+	}
+}
+
+// IdentityGroups looks up group memberships in the identity store.
+func IdentityGroups(ids identity.IdentityStore) UserGroups {
+	return func(ctx context.Context, userID string) ([]string, error) {
+		groups, err := ids.GetUserGroups(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		out := make([]string, 0, len(groups))
+		for _, g := range groups {
+			if g != nil {
+				out = append(out, g.ID)
+			}
+		}
+		return out, nil
+	}
+}
@@ -2,13 +2,35 @@ package delegation
 
 import (
 	"context"
+	"time"
 
 	"github.com/martencassel/oidcsim/internal/domain/delegation"
 )
 
+// Repository stores Delegations. Revoked ones are kept, so FindByID and
+// the List methods return them too; a user has at most one delegation to
+// a client that is not revoked, which FindByUserAndClient returns.
 type Repository interface {
 	FindByUserAndClient(ctx context.Context, userID, clientID string) (*delegation.Delegation, error)
 	FindByID(ctx context.Context, delegationID string) (*delegation.Delegation, error)
+	ListByClient(ctx context.Context, clientID string) ([]delegation.Delegation, error)
+	ListByUser(ctx context.Context, userID string) ([]delegation.Delegation, error)
 	Save(ctx context.Context, d delegation.Delegation) error
-	Delete(ctx context.Context, userID, clientID string) error
+	// Revoke marks the delegation revoked at the given time. Revoking a
+	// revoked delegation keeps the original time.
+	Revoke(ctx context.Context, delegationID string, at time.Time) error
 }
+
+// TrustedClients reports whether a client is trusted to skip consent,
+// e.g. because it is a first-party application.
+type TrustedClients func(ctx context.Context, clientID string) bool
+
+type AdminConsentRepository interface {
+	FindByID(ctx context.Context, id string) (*delegation.AdminConsent, error)
+	ListByClient(ctx context.Context, clientID string) ([]delegation.AdminConsent, error)
+	Save(ctx context.Context, a delegation.AdminConsent) error
+}
+
+// UserGroups returns the IDs of the groups a user belongs to, which admin
+// consents for groups are matched against.
+type UserGroups func(ctx context.Context, userID string) ([]string, error)
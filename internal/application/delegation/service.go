@@ -2,7 +2,9 @@ package delegation
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"slices"
 	"time"
 
 	delegation "github.com/martencassel/oidcsim/internal/domain/delegation"
@@ -12,51 +14,255 @@ type DelegationService interface {
 	// EnsureConsent ensures that a consent/delegation exists for the given user and client with the requested scopes.
 	EnsureConsent(ctx context.Context, userID string, clientID string, scopes []string) (*delegation.ConsentResult, error)
 
+	// ApproveConsent records that the user granted scopes to the client. Unless remember is set
+	// the user is asked again on the next authorization request.
+	ApproveConsent(ctx context.Context, userID string, clientID string, scopes []string, remember bool) (*delegation.ConsentResult, error)
+
+	// ApplyGrant records consent as the client's grant_management_action directs. An empty action
+	// behaves like ApproveConsent.
+	ApplyGrant(ctx context.Context, userID string, clientID string, action delegation.GrantManagementAction, grantID string, scopes []string, remember bool) (*delegation.ConsentResult, error)
+
+	// CheckGrant returns ErrUnknownGrant unless grantID is the user's active grant to the client.
+	CheckGrant(ctx context.Context, userID string, clientID string, grantID string) error
+
+	// GrantedScopes returns the scopes of the user's active delegation to the client; none if there is no such delegation.
+	GrantedScopes(ctx context.Context, userID string, clientID string) ([]string, error)
+
 	// GetDelegation retrieves an existing delegation by its ID.
 	GetDelegation(ctx context.Context, delegationID string) (delegation.Delegation, error)
 
+	// ListDelegations returns the active delegations of a user, newest first.
+	ListDelegations(ctx context.Context, userID string) ([]delegation.Delegation, error)
+
 	// RevokeDelegation revokes an existing delegation by its ID.
 	RevokeDelegation(ctx context.Context, delegationID string) error
 
+	// CheckDelegation checks a use of the user's delegation to the client, e.g. at code redemption,
+	// and returns its ID; "" when the user has not delegated to the client.
+	CheckDelegation(ctx context.Context, userID string, clientID string, use delegation.Use) (string, error)
+
+	// ValidateDelegation checks that the delegation is active and its constraints allow the use.
+	ValidateDelegation(ctx context.Context, delegationID string, use delegation.Use) error
+
 	// ValidateDelegationForRefresh checks if the delegation is valid for use in a refresh token flow.
-	ValidateDelegationForRefresh(ctx context.Context, delegationID string) error
+	ValidateDelegationForRefresh(ctx context.Context, delegationID string, use delegation.Use) error
+
+	// GrantAdminConsent records consent an administrator grants to the client on behalf of the selected users.
+	GrantAdminConsent(ctx context.Context, clientID string, scopes []string, subjects delegation.SubjectSelector, grantedBy string) (delegation.AdminConsent, error)
+
+	// ListAdminConsents returns the admin consents to the client that are not revoked, newest first.
+	ListAdminConsents(ctx context.Context, clientID string) ([]delegation.AdminConsent, error)
+
+	// RevokeAdminConsent revokes an admin consent and every Delegation it granted.
+	RevokeAdminConsent(ctx context.Context, adminConsentID string) error
 }
 
+// ErrUnknownGrant is returned for a grant_id that is not the user's
+// active grant to the client.
+var ErrUnknownGrant = errors.New("unknown grant")
+
+// ErrDelegationNotFound is returned for a delegation ID that is not on
+// record, such as the grant of a code issued before the delegation was
+// deleted.
+var ErrDelegationNotFound = errors.New("delegation not found")
+
+// ErrAdminConsentNotConfigured is returned by the admin consent methods
+// of a service built without WithAdminConsents.
+var ErrAdminConsentNotConfigured = errors.New("admin consent is not configured")
+
 type delegationServiceImpl struct {
-	repo Repository
+	repo    Repository
+	trusted TrustedClients
+	admin   AdminConsentRepository
+	groups  UserGroups
+}
+
+// Option configures the delegation service.
+type Option func(*delegationServiceImpl)
+
+// WithAdminConsents enables admin consent, stored in repo. groups resolves
+// the users' group memberships for consents granted to groups; without it
+// those consents match nobody.
+func WithAdminConsents(repo AdminConsentRepository, groups UserGroups) Option {
+	return func(s *delegationServiceImpl) {
+		s.admin = repo
+		s.groups = groups
+	}
 }
 
-func NewDelegationService(repo Repository) DelegationService {
-	return &delegationServiceImpl{
-		repo: repo,
+// NewDelegationService returns the delegation service. Clients trusted
+// reports true for are granted consent without asking; trusted may be nil.
+func NewDelegationService(repo Repository, trusted TrustedClients, opts ...Option) DelegationService {
+	s := &delegationServiceImpl{
+		repo:    repo,
+		trusted: trusted,
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
+	return s
 }
 
 // EnsureConsent checks whether the user has already granted consent to the client for the requested scopes.
 //
-// CURRENT BEHAVIOR:
-// - Consent is auto-approved for all clients and scopes.
-// - A new Delegation is created and persisted unconditionally.
-//
-// FUTURE EXTENSIONS:
-// - Lookup existing Delegation and check if it covers requested scopes.
-// - Apply consent policy (e.g. trusted clients, sensitive scopes, prompt=none).
-// - Redirect to consent UI if required.
+// - An active, remembered Delegation that covers every scope is granted as is; nothing is saved.
+// - Trusted clients (e.g. first-party applications) get the missing scopes merged in without asking.
+// - An admin consent that selects the user and covers every scope is granted on the user's behalf.
+// - Otherwise the decision is left open and Missing lists the scopes to ask for (all, if not remembered).
 //
 // This method is called during the /authorize flow after authentication is confirmed.
 func (s *delegationServiceImpl) EnsureConsent(ctx context.Context, userID string, clientID string, scopes []string) (*delegation.ConsentResult, error) {
-	// Always auto-approve for now
-	d, err := delegation.NewDelegation(userID, clientID, scopes)
+	existing, err := s.activeDelegation(ctx, userID, clientID)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil && existing.Remember && existing.Covers(scopes) {
+		return &delegation.ConsentResult{Decision: delegation.ConsentStatusGranted, DelegationId: existing.ID}, nil
+	}
+	if s.trusted != nil && s.trusted(ctx, clientID) {
+		return s.grant(ctx, existing, userID, clientID, scopes, true, "")
+	}
+	admin, err := s.adminConsentFor(ctx, userID, clientID, scopes)
+	if err != nil {
+		return nil, err
+	}
+	if admin != nil {
+		return s.grant(ctx, existing, userID, clientID, scopes, true, admin.ID)
+	}
+	result := &delegation.ConsentResult{Decision: delegation.ConsentDecisionNone, Missing: scopes}
+	if existing != nil {
+		result.DelegationId = existing.ID
+		if existing.Remember {
+			result.Missing = existing.Missing(scopes)
+		}
+	}
+	return result, nil
+}
+
+// ApproveConsent merges the approved scopes into the stored Delegation,
+// creating it on the first approval. The Delegation is kept either way so
+// tokens issued under it stay valid; remember only decides whether the
+// next request skips the consent screen.
+func (s *delegationServiceImpl) ApproveConsent(ctx context.Context, userID string, clientID string, scopes []string, remember bool) (*delegation.ConsentResult, error) {
+	return s.ApplyGrant(ctx, userID, clientID, "", "", scopes, remember)
+}
+
+// ApplyGrant records approved scopes as the authorization request's
+// grant_management_action directs (FAPI Grant Management §5.4):
+//
+// - create starts a new grant with a new ID; the user's previous grant to the client is revoked, as a user has one grant per client.
+// - merge adds the scopes to grant grantID, as approval does by default.
+// - replace leaves grant grantID with exactly the scopes.
+//
+// merge and replace return ErrUnknownGrant unless grantID is the user's
+// active grant to the client.
+func (s *delegationServiceImpl) ApplyGrant(ctx context.Context, userID string, clientID string, action delegation.GrantManagementAction, grantID string, scopes []string, remember bool) (*delegation.ConsentResult, error) {
+	existing, err := s.activeDelegation(ctx, userID, clientID)
+	if err != nil {
+		return nil, err
+	}
+	if action == delegation.GrantActionMerge || action == delegation.GrantActionReplace {
+		if existing == nil || existing.ID != grantID {
+			return nil, ErrUnknownGrant
+		}
+	}
+	switch action {
+	case delegation.GrantActionCreate:
+		// grant revokes the current one before creating the new one
+		return s.grant(ctx, nil, userID, clientID, scopes, remember, "")
+	case delegation.GrantActionReplace:
+		if !existing.Replace(scopes) && existing.Remember == remember {
+			return &delegation.ConsentResult{Decision: delegation.ConsentStatusGranted, DelegationId: existing.ID}, nil
+		}
+		existing.Remember = remember
+		if err := s.repo.Save(ctx, *existing); err != nil {
+			return nil, err
+		}
+		return &delegation.ConsentResult{Decision: delegation.ConsentStatusGranted, DelegationId: existing.ID}, nil
+	default:
+		return s.grant(ctx, existing, userID, clientID, scopes, remember, "")
+	}
+}
+
+// CheckGrant checks the grant_id of an authorization request before the
+// user is asked, so an unknown grant is reported to the client rather
+// than after consent.
+func (s *delegationServiceImpl) CheckGrant(ctx context.Context, userID string, clientID string, grantID string) error {
+	existing, err := s.activeDelegation(ctx, userID, clientID)
+	if err != nil {
+		return err
+	}
+	if existing == nil || existing.ID != grantID {
+		return ErrUnknownGrant
+	}
+	return nil
+}
+
+// GrantedScopes returns what the user has granted the client so far, for
+// incremental authorization (include_granted_scopes). Revoked and expired
+// delegations grant nothing.
+func (s *delegationServiceImpl) GrantedScopes(ctx context.Context, userID string, clientID string) ([]string, error) {
+	d, err := s.activeDelegation(ctx, userID, clientID)
+	if err != nil || d == nil {
+		return nil, err
+	}
+	return slices.Clone(d.Scopes), nil
+}
+
+// activeDelegation returns the user's delegation to the client, or nil
+// when there is none that is still active.
+func (s *delegationServiceImpl) activeDelegation(ctx context.Context, userID, clientID string) (*delegation.Delegation, error) {
+	d, err := s.repo.FindByUserAndClient(ctx, userID, clientID)
 	if err != nil {
 		return nil, err
 	}
-	if err := s.repo.Save(ctx, d); err != nil {
+	if d == nil || !d.IsActive(time.Now()) {
+		return nil, nil
+	}
+	return d, nil
+}
+
+// grant merges scopes into existing, or creates a Delegation when there
+// is none, and saves it only if it changed. A new Delegation supersedes
+// the user's previous one to the client, which is revoked, e.g. when it
+// expired. A non-empty adminConsentID names the admin consent granting
+// the scopes: a Delegation it creates is linked to it, so revoking the
+// consent revokes the Delegation; on one the user granted, only the
+// scopes it adds are recorded as the consent's.
+func (s *delegationServiceImpl) grant(ctx context.Context, existing *delegation.Delegation, userID, clientID string, scopes []string, remember bool, adminConsentID string) (*delegation.ConsentResult, error) {
+	if existing == nil {
+		previous, err := s.repo.FindByUserAndClient(ctx, userID, clientID)
+		if err != nil {
+			return nil, err
+		}
+		if previous != nil {
+			if err := s.repo.Revoke(ctx, previous.ID, time.Now()); err != nil {
+				return nil, err
+			}
+		}
+		d, err := delegation.NewDelegation(userID, clientID, slices.Clone(scopes))
+		if err != nil {
+			return nil, err
+		}
+		d.Remember = remember
+		d.AdminConsentID = adminConsentID
+		existing = &d
+	} else {
+		var changed bool
+		if adminConsentID == "" || adminConsentID == existing.AdminConsentID {
+			changed = existing.Merge(scopes)
+		} else {
+			changed = existing.MergeAdminScopes(scopes, adminConsentID)
+		}
+		if !changed && existing.Remember == remember {
+			return &delegation.ConsentResult{Decision: delegation.ConsentStatusGranted, DelegationId: existing.ID}, nil
+		}
+		existing.Remember = remember
+	}
+	if err := s.repo.Save(ctx, *existing); err != nil {
 		return nil, err
 	}
-	return &delegation.ConsentResult{
-		Decision:     delegation.ConsentStatusGranted,
-		DelegationId: d.ID,
-	}, nil
+	return &delegation.ConsentResult{Decision: delegation.ConsentStatusGranted, DelegationId: existing.ID}, nil
 }
 
 // GetDelegation retrieves a Delegation by its ID.
@@ -73,54 +279,94 @@ func (s *delegationServiceImpl) GetDelegation(ctx context.Context, delegationID
 		return delegation.Delegation{}, err
 	}
 	if d == nil {
-		return delegation.Delegation{}, fmt.Errorf("delegation not found: %s", delegationID)
+		return delegation.Delegation{}, fmt.Errorf("%w: %s", ErrDelegationNotFound, delegationID)
 	}
 	return *d, nil
 }
 
-// RevokeDelegation deletes a Delegation by its ID.
+// ListDelegations returns the Delegations userID has granted that are
+// still active, newest first. It backs the "connected apps" page.
+func (s *delegationServiceImpl) ListDelegations(ctx context.Context, userID string) ([]delegation.Delegation, error) {
+	all, err := s.repo.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	active := make([]delegation.Delegation, 0, len(all))
+	for _, d := range all {
+		if d.IsActive(now) {
+			active = append(active, d)
+		}
+	}
+	slices.SortFunc(active, func(a, b delegation.Delegation) int { return b.CreatedAt.Compare(a.CreatedAt) })
+	return active, nil
+}
+
+// RevokeDelegation revokes a Delegation by its ID.
 //
 // Use cases:
 // - User-initiated revocation (e.g. "disconnect this app" from a dashboard).
 // - Admin-triggered revocation (e.g. suspicious activity, scope abuse).
 // - Expiry or rotation of Delegations (e.g. time-based invalidation).
 //
-// This method removes the delegation from the repository, effectively revoking the client's access.
-
+// The delegation is kept with its RevokedAt set, so tokens issued under it
+// fail validation with ErrRevoked and the grant stays on record.
 func (s *delegationServiceImpl) RevokeDelegation(ctx context.Context, delegationID string) error {
 	delegation, err := s.repo.FindByID(ctx, delegationID)
 	if err != nil {
 		return err
 	}
 	if delegation == nil {
-		return fmt.Errorf("delegation not found: %s", delegationID)
+		return fmt.Errorf("%w: %s", ErrDelegationNotFound, delegationID)
 	}
-	return s.repo.Delete(ctx, delegation.ClientID, delegation.ID)
+	return s.repo.Revoke(ctx, delegation.ID, time.Now())
 }
 
-// ValidateDelegationForRefresh ensures that a refresh token is still backed by a valid Delegation.
+// CheckDelegation checks use against the user's Delegation to the client.
 //
-// Use cases:
-// - Enforces ongoing user consent when clients use refresh tokens.
-// - Prevents token renewal if the Delegation has been revoked or expired.
-// - Supports dynamic consent revocation (e.g. user disconnects app, admin disables access).
+// Called when an authorization code is redeemed. A user without a
+// Delegation passes, since not every flow records consent; one whose
+// Delegation is revoked, expired or constrained otherwise does not.
+func (s *delegationServiceImpl) CheckDelegation(ctx context.Context, userID string, clientID string, use delegation.Use) (string, error) {
+	d, err := s.repo.FindByUserAndClient(ctx, userID, clientID)
+	if err != nil {
+		return "", err
+	}
+	if d == nil {
+		return "", nil
+	}
+	if err := d.Check(use); err != nil {
+		return "", err
+	}
+	return d.ID, nil
+}
+
+// ValidateDelegation checks use against the Delegation with the given ID.
 //
-// This method is typically called during the refresh token grant flow.
-// If the Delegation is missing, revoked, or expired, the refresh request should be denied.
-func (s *delegationServiceImpl) ValidateDelegationForRefresh(ctx context.Context, delegationID string) error {
+// Called during introspection of tokens issued under a Delegation, so a
+// token stops working as soon as the Delegation is revoked or leaves its
+// time window, not only when the token expires.
+func (s *delegationServiceImpl) ValidateDelegation(ctx context.Context, delegationID string, use delegation.Use) error {
 	d, err := s.repo.FindByID(ctx, delegationID)
 	if err != nil {
 		return err
 	}
 	if d == nil {
-		return fmt.Errorf("delegation not found: %s", delegationID)
-	}
-	if d.IsRevoked() {
-		return fmt.Errorf("delegation revoked")
-	}
-	if d.IsExpired(time.Now()) {
-		return fmt.Errorf("delegation expired")
+		return fmt.Errorf("%w: %s", ErrDelegationNotFound, delegationID)
 	}
-	// 4. Valid
-	return nil
+	return d.Check(use)
+}
+
+// ValidateDelegationForRefresh ensures that a refresh token is still backed by a valid Delegation.
+//
+// Use cases:
+// - Enforces ongoing user consent when clients use refresh tokens.
+// - Prevents token renewal if the Delegation has been revoked or expired.
+// - Supports dynamic consent revocation (e.g. user disconnects app, admin disables access).
+// - Applies the Delegation's constraints to the refresh request (time window, caller IP, audience).
+//
+// This method is typically called during the refresh token grant flow.
+// If the Delegation is missing, revoked, expired or constrained, the refresh request should be denied.
+func (s *delegationServiceImpl) ValidateDelegationForRefresh(ctx context.Context, delegationID string, use delegation.Use) error {
+	return s.ValidateDelegation(ctx, delegationID, use)
 }
@@ -0,0 +1,452 @@
+package delegation
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/martencassel/oidcsim/internal/domain/delegation"
+)
+
+// fakeRepo keys delegations by ID and keeps revoked ones, like the
+// memory repo.
+type fakeRepo struct {
+	data  map[string]delegation.Delegation
+	saves int
+}
+
+func newFakeRepo() *fakeRepo { return &fakeRepo{data: map[string]delegation.Delegation{}} }
+
+func (r *fakeRepo) FindByUserAndClient(_ context.Context, userID, clientID string) (*delegation.Delegation, error) {
+	for _, d := range r.data {
+		if d.UserID == userID && d.ClientID == clientID && !d.IsRevoked() {
+			return &d, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *fakeRepo) FindByID(_ context.Context, id string) (*delegation.Delegation, error) {
+	for _, d := range r.data {
+		if d.ID == id {
+			return &d, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *fakeRepo) ListByClient(_ context.Context, clientID string) ([]delegation.Delegation, error) {
+	var out []delegation.Delegation
+	for _, d := range r.data {
+		if d.ClientID == clientID {
+			out = append(out, d)
+		}
+	}
+	return out, nil
+}
+
+func (r *fakeRepo) ListByUser(_ context.Context, userID string) ([]delegation.Delegation, error) {
+	var out []delegation.Delegation
+	for _, d := range r.data {
+		if d.UserID == userID {
+			out = append(out, d)
+		}
+	}
+	return out, nil
+}
+
+func (r *fakeRepo) Save(_ context.Context, d delegation.Delegation) error {
+	r.saves++
+	r.data[d.ID] = d
+	return nil
+}
+
+func (r *fakeRepo) Revoke(_ context.Context, id string, at time.Time) error {
+	if d, ok := r.data[id]; ok && !d.IsRevoked() {
+		d.RevokedAt = &at
+		r.data[id] = d
+	}
+	return nil
+}
+
+func TestEnsureConsent_PromptsOnlyForMissingScopes(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeRepo()
+	svc := NewDelegationService(repo, nil)
+
+	res, err := svc.EnsureConsent(ctx, "alice", "app", []string{"openid", "profile"})
+	require.NoError(t, err)
+	assert.Equal(t, ConsentRequired, StatusOf(res.Decision))
+	assert.Equal(t, []string{"openid", "profile"}, res.Missing)
+	assert.Zero(t, repo.saves, "nothing is stored before the user approves")
+
+	res, err = svc.ApproveConsent(ctx, "alice", "app", []string{"openid", "profile"}, true)
+	require.NoError(t, err)
+	assert.Equal(t, ConsentGranted, StatusOf(res.Decision))
+	id := res.DelegationId
+
+	res, err = svc.EnsureConsent(ctx, "alice", "app", []string{"profile", "openid"})
+	require.NoError(t, err)
+	assert.Equal(t, ConsentGranted, StatusOf(res.Decision))
+	assert.Equal(t, id, res.DelegationId)
+	assert.Equal(t, 1, repo.saves, "a covered request does not change the grant")
+
+	res, err = svc.EnsureConsent(ctx, "alice", "app", []string{"openid", "email"})
+	require.NoError(t, err)
+	assert.Equal(t, ConsentRequired, StatusOf(res.Decision))
+	assert.Equal(t, []string{"email"}, res.Missing)
+	assert.Equal(t, id, res.DelegationId)
+
+	_, err = svc.ApproveConsent(ctx, "alice", "app", []string{"email"}, true)
+	require.NoError(t, err)
+	d, _ := repo.FindByUserAndClient(ctx, "alice", "app")
+	assert.Equal(t, id, d.ID, "approval merges into the stored grant")
+	assert.Equal(t, []string{"openid", "profile", "email"}, d.Scopes)
+}
+
+func TestEnsureConsent_AsksAgainUnlessRemembered(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeRepo()
+	svc := NewDelegationService(repo, nil)
+
+	granted, err := svc.ApproveConsent(ctx, "alice", "app", []string{"openid", "profile"}, false)
+	require.NoError(t, err)
+
+	res, err := svc.EnsureConsent(ctx, "alice", "app", []string{"openid"})
+	require.NoError(t, err)
+	assert.Equal(t, ConsentRequired, StatusOf(res.Decision))
+	assert.Equal(t, []string{"openid"}, res.Missing)
+	assert.Equal(t, granted.DelegationId, res.DelegationId, "the grant is kept for the tokens issued under it")
+
+	_, err = svc.ApproveConsent(ctx, "alice", "app", []string{"openid"}, true)
+	require.NoError(t, err)
+	res, err = svc.EnsureConsent(ctx, "alice", "app", []string{"openid", "profile"})
+	require.NoError(t, err)
+	assert.Equal(t, ConsentGranted, StatusOf(res.Decision))
+	assert.Equal(t, 2, repo.saves, "remembering the decision is a change")
+}
+
+func TestEnsureConsent_IgnoresInactiveDelegations(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeRepo()
+	past := time.Now().Add(-time.Hour)
+	repo.data["old"] = delegation.Delegation{ID: "old", UserID: "alice", ClientID: "app", Scopes: []string{"openid"}, ExpiresAt: &past}
+	svc := NewDelegationService(repo, nil)
+
+	res, err := svc.EnsureConsent(ctx, "alice", "app", []string{"openid"})
+	require.NoError(t, err)
+	assert.Equal(t, ConsentRequired, StatusOf(res.Decision))
+	assert.Empty(t, res.DelegationId)
+
+	res, err = svc.ApproveConsent(ctx, "alice", "app", []string{"openid"}, true)
+	require.NoError(t, err)
+	assert.NotEqual(t, "old", res.DelegationId)
+	assert.True(t, repo.data["old"].IsRevoked(), "the expired delegation is superseded")
+}
+
+func TestEnsureConsent_TrustedClientsSkipConsent(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeRepo()
+	svc := NewDelegationService(repo, func(_ context.Context, clientID string) bool { return clientID == "portal" })
+
+	res, err := svc.EnsureConsent(ctx, "alice", "portal", []string{"openid"})
+	require.NoError(t, err)
+	assert.Equal(t, ConsentGranted, StatusOf(res.Decision))
+	assert.NotEmpty(t, res.DelegationId)
+
+	res, err = svc.EnsureConsent(ctx, "alice", "portal", []string{"openid", "email"})
+	require.NoError(t, err)
+	assert.Equal(t, ConsentGranted, StatusOf(res.Decision))
+	d, _ := repo.FindByUserAndClient(ctx, "alice", "portal")
+	assert.Equal(t, []string{"openid", "email"}, d.Scopes)
+
+	res, err = svc.EnsureConsent(ctx, "alice", "partner", []string{"openid"})
+	require.NoError(t, err)
+	assert.Equal(t, ConsentRequired, StatusOf(res.Decision))
+}
+
+func TestListDelegations_ActiveNewestFirst(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeRepo()
+	now := time.Now()
+	past := now.Add(-time.Minute)
+	repo.data["old"] = delegation.Delegation{ID: "old", UserID: "alice", ClientID: "old", CreatedAt: now.Add(-2 * time.Hour)}
+	repo.data["new"] = delegation.Delegation{ID: "new", UserID: "alice", ClientID: "new", CreatedAt: now.Add(-time.Hour)}
+	repo.data["gone"] = delegation.Delegation{ID: "gone", UserID: "alice", ClientID: "gone", CreatedAt: now, RevokedAt: &past}
+	repo.data["bob"] = delegation.Delegation{ID: "bob", UserID: "bob", ClientID: "new", CreatedAt: now}
+	svc := NewDelegationService(repo, nil)
+
+	list, err := svc.ListDelegations(ctx, "alice")
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	assert.Equal(t, "new", list[0].ID)
+	assert.Equal(t, "old", list[1].ID)
+
+	require.NoError(t, svc.RevokeDelegation(ctx, "new"))
+	list, err = svc.ListDelegations(ctx, "alice")
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, "old", list[0].ID)
+}
+
+func TestCheckDelegation_EnforcesConstraints(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeRepo()
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 6, 0)
+	repo.data["d1"] = delegation.Delegation{ID: "d1", UserID: "alice", ClientID: "app", Constraints: delegation.Constraints{
+		NotBefore: &start,
+		NotAfter:  &end,
+		IPCIDRs:   []string{"10.1.0.0/16"},
+		Audiences: []string{"api"},
+		Resources: []string{"https://api.example.com"},
+	}}
+	svc := NewDelegationService(repo, nil)
+	office := net.ParseIP("10.1.2.3")
+	during := start.AddDate(0, 1, 0)
+
+	tests := []struct {
+		name string
+		use  delegation.Use
+		err  error
+	}{
+		{"allowed", delegation.Use{At: during, IP: office, Audience: "api", Resources: []string{"https://api.example.com"}}, nil},
+		{"before window", delegation.Use{At: start.Add(-time.Second), IP: office}, delegation.ErrOutsideWindow},
+		{"after window", delegation.Use{At: end.Add(time.Second), IP: office}, delegation.ErrOutsideWindow},
+		{"other network", delegation.Use{At: during, IP: net.ParseIP("192.0.2.1")}, delegation.ErrIPNotAllowed},
+		{"other audience", delegation.Use{At: during, IP: office, Audience: "billing"}, delegation.ErrAudienceNotAllowed},
+		{"other resource", delegation.Use{At: during, IP: office, Resources: []string{"https://other.example.com"}}, delegation.ErrResourceNotAllowed},
+		{"unknown IP and audience are not checked", delegation.Use{At: during}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := svc.CheckDelegation(ctx, "alice", "app", tt.use)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				assert.ErrorIs(t, svc.ValidateDelegationForRefresh(ctx, "d1", tt.use), tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "d1", id)
+			assert.NoError(t, svc.ValidateDelegation(ctx, "d1", tt.use))
+		})
+	}
+
+	id, err := svc.CheckDelegation(ctx, "alice", "other", delegation.Use{At: during})
+	require.NoError(t, err)
+	assert.Empty(t, id, "no delegation, nothing to enforce")
+
+	require.NoError(t, svc.RevokeDelegation(ctx, "d1"))
+	assert.ErrorIs(t, svc.ValidateDelegation(ctx, "d1", delegation.Use{At: during}), delegation.ErrRevoked, "tokens stop working once the grant is revoked")
+}
+
+func TestValidateDelegation_NotFound(t *testing.T) {
+	svc := NewDelegationService(newFakeRepo(), nil)
+	ctx := context.Background()
+
+	assert.ErrorIs(t, svc.ValidateDelegation(ctx, "missing", delegation.Use{At: time.Now()}), ErrDelegationNotFound)
+	_, err := svc.GetDelegation(ctx, "missing")
+	assert.ErrorIs(t, err, ErrDelegationNotFound)
+	assert.ErrorIs(t, svc.RevokeDelegation(ctx, "missing"), ErrDelegationNotFound)
+}
+
+func TestConstraints_Validate(t *testing.T) {
+	now := time.Now()
+	later := now.Add(time.Hour)
+	assert.NoError(t, delegation.Constraints{NotBefore: &now, NotAfter: &later, IPCIDRs: []string{"10.0.0.0/8", "2001:db8::/32"}}.Validate())
+	assert.Error(t, delegation.Constraints{NotBefore: &later, NotAfter: &now}.Validate())
+	assert.Error(t, delegation.Constraints{IPCIDRs: []string{"10.0.0.1"}}.Validate())
+	assert.True(t, delegation.Constraints{}.IsZero())
+}
+
+func TestApplyGrant_Actions(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeRepo()
+	svc := NewDelegationService(repo, nil)
+
+	_, err := svc.ApplyGrant(ctx, "alice", "app", delegation.GrantActionMerge, "missing", []string{"openid"}, true)
+	assert.ErrorIs(t, err, ErrUnknownGrant, "there is no grant to merge into")
+
+	res, err := svc.ApplyGrant(ctx, "alice", "app", delegation.GrantActionCreate, "", []string{"openid", "profile"}, true)
+	require.NoError(t, err)
+	first := res.DelegationId
+	require.NoError(t, svc.CheckGrant(ctx, "alice", "app", first))
+	assert.ErrorIs(t, svc.CheckGrant(ctx, "bob", "app", first), ErrUnknownGrant, "grants belong to their user")
+
+	res, err = svc.ApplyGrant(ctx, "alice", "app", delegation.GrantActionMerge, first, []string{"email"}, true)
+	require.NoError(t, err)
+	assert.Equal(t, first, res.DelegationId)
+	d, _ := repo.FindByUserAndClient(ctx, "alice", "app")
+	assert.Equal(t, []string{"openid", "profile", "email"}, d.Scopes)
+
+	_, err = svc.ApplyGrant(ctx, "alice", "app", delegation.GrantActionReplace, first, []string{"openid"}, true)
+	require.NoError(t, err)
+	d, _ = repo.FindByUserAndClient(ctx, "alice", "app")
+	assert.Equal(t, first, d.ID)
+	assert.Equal(t, []string{"openid"}, d.Scopes, "replace drops the scopes not asked for")
+
+	res, err = svc.ApplyGrant(ctx, "alice", "app", delegation.GrantActionCreate, "", []string{"email"}, true)
+	require.NoError(t, err)
+	assert.NotEqual(t, first, res.DelegationId)
+	assert.ErrorIs(t, svc.CheckGrant(ctx, "alice", "app", first), ErrUnknownGrant, "create supersedes the previous grant")
+	d, _ = repo.FindByUserAndClient(ctx, "alice", "app")
+	assert.Equal(t, []string{"email"}, d.Scopes)
+}
+
+func TestGrantedScopes_IncrementalAuthorization(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeRepo()
+	svc := NewDelegationService(repo, nil)
+
+	granted, err := svc.GrantedScopes(ctx, "alice", "app")
+	require.NoError(t, err)
+	assert.Empty(t, granted)
+
+	res, err := svc.ApproveConsent(ctx, "alice", "app", []string{"openid", "profile"}, true)
+	require.NoError(t, err)
+	granted, err = svc.GrantedScopes(ctx, "alice", "app")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"email", "openid", "profile"}, delegation.IncludeGrantedScopes([]string{"email", "openid"}, granted))
+
+	require.NoError(t, svc.RevokeDelegation(ctx, res.DelegationId))
+	granted, err = svc.GrantedScopes(ctx, "alice", "app")
+	require.NoError(t, err)
+	assert.Empty(t, granted, "a revoked grant is not included")
+}
+
+func TestParseGrantManagementAction(t *testing.T) {
+	for _, tc := range []struct {
+		action, grantID string
+		ok              bool
+	}{
+		{"", "", true},
+		{"", "g1", false},
+		{"create", "", true},
+		{"create", "g1", false},
+		{"merge", "g1", true},
+		{"merge", "", false},
+		{"replace", "g1", true},
+		{"replace", "", false},
+		{"update", "g1", false},
+	} {
+		_, err := delegation.ParseGrantManagementAction(tc.action, tc.grantID)
+		assert.Equal(t, tc.ok, err == nil, "action %q grant_id %q", tc.action, tc.grantID)
+	}
+}
+
+type fakeAdminRepo map[string]delegation.AdminConsent
+
+func (r fakeAdminRepo) FindByID(_ context.Context, id string) (*delegation.AdminConsent, error) {
+	if a, ok := r[id]; ok {
+		return &a, nil
+	}
+	return nil, nil
+}
+
+func (r fakeAdminRepo) ListByClient(_ context.Context, clientID string) ([]delegation.AdminConsent, error) {
+	var out []delegation.AdminConsent
+	for _, a := range r {
+		if a.ClientID == clientID {
+			out = append(out, a)
+		}
+	}
+	return out, nil
+}
+
+func (r fakeAdminRepo) Save(_ context.Context, a delegation.AdminConsent) error {
+	r[a.ID] = a
+	return nil
+}
+
+func TestEnsureConsent_AdminConsent(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeRepo()
+	groups := func(_ context.Context, userID string) ([]string, error) {
+		if userID == "carol" {
+			return []string{"engineering"}, nil
+		}
+		return nil, nil
+	}
+	svc := NewDelegationService(repo, nil, WithAdminConsents(fakeAdminRepo{}, groups))
+
+	_, err := svc.GrantAdminConsent(ctx, "app", []string{"openid"}, delegation.SubjectSelector{}, "admin")
+	assert.Error(t, err, "an admin consent must select someone")
+	byGroup, err := svc.GrantAdminConsent(ctx, "app", []string{"openid", "profile"}, delegation.SubjectSelector{GroupIDs: []string{"engineering"}}, "admin")
+	require.NoError(t, err)
+	_, err = svc.GrantAdminConsent(ctx, "app", []string{"openid"}, delegation.SubjectSelector{UserIDs: []string{"alice"}}, "admin")
+	require.NoError(t, err)
+
+	res, err := svc.EnsureConsent(ctx, "carol", "app", []string{"openid", "profile"})
+	require.NoError(t, err)
+	assert.Equal(t, ConsentGranted, StatusOf(res.Decision), "group members are not asked")
+	d, _ := repo.FindByUserAndClient(ctx, "carol", "app")
+	assert.Equal(t, delegation.ConsentTypeAdmin, d.ConsentType())
+	assert.Equal(t, byGroup.ID, d.AdminConsentID)
+
+	res, err = svc.EnsureConsent(ctx, "alice", "app", []string{"openid"})
+	require.NoError(t, err)
+	assert.Equal(t, ConsentGranted, StatusOf(res.Decision), "listed users are not asked")
+	res, err = svc.EnsureConsent(ctx, "alice", "app", []string{"openid", "profile"})
+	require.NoError(t, err)
+	assert.Equal(t, ConsentRequired, StatusOf(res.Decision), "scopes beyond the admin consent are asked for")
+
+	res, err = svc.EnsureConsent(ctx, "bob", "app", []string{"openid"})
+	require.NoError(t, err)
+	assert.Equal(t, ConsentRequired, StatusOf(res.Decision), "users the consent does not select are asked")
+	_, err = svc.ApproveConsent(ctx, "bob", "app", []string{"openid"}, true)
+	require.NoError(t, err)
+
+	require.NoError(t, svc.RevokeAdminConsent(ctx, byGroup.ID))
+	list, err := svc.ListAdminConsents(ctx, "app")
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	d, _ = repo.FindByUserAndClient(ctx, "carol", "app")
+	assert.Nil(t, d, "revoking the admin consent revokes the grants it made")
+	res, err = svc.EnsureConsent(ctx, "carol", "app", []string{"openid"})
+	require.NoError(t, err)
+	assert.Equal(t, ConsentRequired, StatusOf(res.Decision))
+	d, _ = repo.FindByUserAndClient(ctx, "bob", "app")
+	require.NotNil(t, d, "user consent is left alone")
+	assert.Equal(t, delegation.ConsentTypeUser, d.ConsentType())
+}
+
+func TestRevokeAdminConsent_KeepsUserScopes(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeRepo()
+	svc := NewDelegationService(repo, nil, WithAdminConsents(fakeAdminRepo{}, nil))
+
+	res, err := svc.ApproveConsent(ctx, "dave", "app", []string{"openid"}, true)
+	require.NoError(t, err)
+	own := res.DelegationId
+	a, err := svc.GrantAdminConsent(ctx, "app", []string{"openid", "profile", "email"}, delegation.SubjectSelector{UserIDs: []string{"dave"}}, "admin")
+	require.NoError(t, err)
+
+	res, err = svc.EnsureConsent(ctx, "dave", "app", []string{"openid", "profile", "email"})
+	require.NoError(t, err)
+	assert.Equal(t, ConsentGranted, StatusOf(res.Decision))
+	assert.Equal(t, own, res.DelegationId)
+	d, _ := repo.FindByID(ctx, own)
+	assert.Equal(t, delegation.ConsentTypeUser, d.ConsentType(), "the admin consent does not take over the user's delegation")
+	assert.Equal(t, map[string]string{"profile": a.ID, "email": a.ID}, d.AdminScopes)
+
+	// email becomes the user's own once they approve it themselves
+	_, err = svc.ApproveConsent(ctx, "dave", "app", []string{"email"}, true)
+	require.NoError(t, err)
+
+	require.NoError(t, svc.RevokeAdminConsent(ctx, a.ID))
+	d, _ = repo.FindByID(ctx, own)
+	assert.False(t, d.IsRevoked())
+	assert.Equal(t, []string{"openid", "email"}, d.Scopes, "only the scopes the admin consent added are taken back")
+	assert.Empty(t, d.AdminScopes)
+}
+
+func TestStatusOf(t *testing.T) {
+	assert.Equal(t, ConsentGranted, StatusOf(delegation.ConsentStatusGranted))
+	assert.Equal(t, ConsentGranted, StatusOf(delegation.ConsentDecisionApprove))
+	assert.Equal(t, ConsentDenied, StatusOf(delegation.ConsentDecisionDeny))
+	assert.Equal(t, ConsentRequired, StatusOf(delegation.ConsentDecisionNone))
+}
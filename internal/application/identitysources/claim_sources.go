@@ -0,0 +1,131 @@
+package identitysources
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/martencassel/oidcsim/internal/domain/configuration"
+	domIDS "github.com/martencassel/oidcsim/internal/domain/identitysources"
+	infraIDS "github.com/martencassel/oidcsim/internal/infrastructure/identitysources"
+)
+
+// Claims provider modes (OIDC Core §5.6.2).
+const (
+	ModeAggregated  = "aggregated"
+	ModeDistributed = "distributed"
+)
+
+// ClaimSource is an external claims provider of an identity source.
+type ClaimSource struct {
+	Config   configuration.ClaimsProviderConfig
+	Provider domIDS.ClaimsProvider
+}
+
+// Claims returns the claims of subject the source is configured to
+// provide; others the provider returns are dropped.
+func (s ClaimSource) Claims(ctx context.Context, subject string) (map[string]interface{}, error) {
+	if s.Provider == nil {
+		return nil, fmt.Errorf("claims provider %s is served externally", s.Config.Name)
+	}
+	all, err := s.Provider.GetClaims(ctx, domIDS.SubjectID(subject))
+	if err != nil {
+		return nil, err
+	}
+	claims := map[string]interface{}{}
+	for _, name := range s.Config.Claims {
+		if v, ok := all[name]; ok {
+			claims[name] = v
+		}
+	}
+	return claims, nil
+}
+
+// Distributed reports whether clients fetch the claims themselves.
+func (s ClaimSource) Distributed() bool {
+	return s.Config.Mode == ModeDistributed
+}
+
+// ClaimSources holds the claims providers of every identity source, keyed
+// by source name.
+type ClaimSources struct {
+	sources map[string][]ClaimSource
+}
+
+// NewClaimSources builds the claims providers configured on sources.
+// Provider names must be unique, since distributed claims endpoints are
+// addressed by name.
+func NewClaimSources(sources []configuration.IdentitySourceConfig) (*ClaimSources, error) {
+	cs := &ClaimSources{sources: map[string][]ClaimSource{}}
+	seen := map[string]bool{}
+	for _, src := range sources {
+		for _, cfg := range src.ClaimsProviders {
+			if cfg.Name == "" {
+				return nil, fmt.Errorf("identity source %s: claims provider has no name", src.Name)
+			}
+			if seen[cfg.Name] {
+				return nil, fmt.Errorf("claims provider %s is configured twice", cfg.Name)
+			}
+			seen[cfg.Name] = true
+			if cfg.Mode == "" {
+				cfg.Mode = ModeAggregated
+			}
+			if cfg.Mode != ModeAggregated && cfg.Mode != ModeDistributed {
+				return nil, fmt.Errorf("claims provider %s: unsupported mode %q", cfg.Name, cfg.Mode)
+			}
+			if len(cfg.Claims) == 0 {
+				return nil, fmt.Errorf("claims provider %s lists no claims", cfg.Name)
+			}
+			if slices.Contains(cfg.Claims, "sub") {
+				return nil, fmt.Errorf("claims provider %s cannot provide sub", cfg.Name)
+			}
+			var provider domIDS.ClaimsProvider
+			// Clients fetch distributed claims from an external endpoint
+			// themselves, so such providers need no implementation here.
+			if cfg.Mode == ModeAggregated || cfg.Endpoint == "" || cfg.Type != "" {
+				var err error
+				provider, err = BuildClaimsProvider(cfg)
+				if err != nil {
+					return nil, fmt.Errorf("claims provider %s: %w", cfg.Name, err)
+				}
+			}
+			cs.sources[src.Name] = append(cs.sources[src.Name], ClaimSource{Config: cfg, Provider: provider})
+		}
+	}
+	return cs, nil
+}
+
+// For returns the claims providers of the named identity source.
+func (cs *ClaimSources) For(source string) []ClaimSource {
+	if cs == nil {
+		return nil
+	}
+	return cs.sources[source]
+}
+
+// Lookup returns the claims provider with the given name.
+func (cs *ClaimSources) Lookup(name string) (ClaimSource, bool) {
+	if cs == nil {
+		return ClaimSource{}, false
+	}
+	for _, sources := range cs.sources {
+		for _, s := range sources {
+			if s.Config.Name == name {
+				return s, true
+			}
+		}
+	}
+	return ClaimSource{}, false
+}
+
+// BuildClaimsProvider creates the claims provider cfg.Type names.
+func BuildClaimsProvider(cfg configuration.ClaimsProviderConfig) (domIDS.ClaimsProvider, error) {
+	switch cfg.Type {
+	case "static":
+		return infraIDS.NewStaticClaimsProvider(cfg.Settings), nil
+	case "http":
+		return infraIDS.NewHTTPClaimsProvider(cfg.Settings, nil)
+	default:
+		return nil, fmt.Errorf("unsupported claims provider type: %s", cfg.Type)
+	}
+}
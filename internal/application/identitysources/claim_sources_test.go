@@ -0,0 +1,57 @@
+package identitysources
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/martencassel/oidcsim/internal/domain/configuration"
+)
+
+func TestNewClaimSources(t *testing.T) {
+	hr := configuration.ClaimsProviderConfig{
+		Name: "hr", Type: "static", Claims: []string{"department"},
+		Settings: map[string]interface{}{"subjects": map[string]interface{}{
+			"alice": map[string]interface{}{"department": "Engineering", "salary": 1},
+		}},
+	}
+	cs, err := NewClaimSources([]configuration.IdentitySourceConfig{{Name: "local", ClaimsProviders: []configuration.ClaimsProviderConfig{hr}}})
+	require.NoError(t, err)
+	require.Len(t, cs.For("local"), 1)
+	assert.Empty(t, cs.For("ldap"))
+
+	src := cs.For("local")[0]
+	assert.False(t, src.Distributed(), "providers are aggregated by default")
+	claims, err := src.Claims(context.Background(), "alice")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"department": "Engineering"}, claims)
+	claims, err = src.Claims(context.Background(), "bob")
+	require.NoError(t, err)
+	assert.Empty(t, claims)
+
+	_, ok := cs.Lookup("hr")
+	assert.True(t, ok)
+
+	for name, cfg := range map[string]configuration.ClaimsProviderConfig{
+		"no name":      {Type: "static", Claims: []string{"a"}},
+		"no claims":    {Name: "x", Type: "static"},
+		"sub":          {Name: "x", Type: "static", Claims: []string{"sub"}},
+		"unknown mode": {Name: "x", Type: "static", Mode: "inline", Claims: []string{"a"}},
+		"unknown type": {Name: "x", Type: "ldap", Claims: []string{"a"}},
+		"http no url":  {Name: "x", Type: "http", Claims: []string{"a"}},
+	} {
+		_, err := NewClaimSources([]configuration.IdentitySourceConfig{{Name: "local", ClaimsProviders: []configuration.ClaimsProviderConfig{cfg}}})
+		assert.Error(t, err, name)
+	}
+	_, err = NewClaimSources([]configuration.IdentitySourceConfig{
+		{Name: "a", ClaimsProviders: []configuration.ClaimsProviderConfig{hr}},
+		{Name: "b", ClaimsProviders: []configuration.ClaimsProviderConfig{hr}},
+	})
+	assert.Error(t, err, "provider names are unique")
+
+	external := configuration.ClaimsProviderConfig{Name: "ext", Mode: ModeDistributed, Endpoint: "https://hr.example/claims", Claims: []string{"a"}}
+	_, err = NewClaimSources([]configuration.IdentitySourceConfig{{Name: "local", ClaimsProviders: []configuration.ClaimsProviderConfig{external}}})
+	assert.NoError(t, err, "external distributed providers need no implementation")
+}
@@ -0,0 +1,85 @@
+package subject
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/martencassel/oidcsim/internal/store"
+)
+
+// SectorValidator checks a client's sector_identifier_uri when it
+// registers (OIDC Registration §5): the URI must use https and return a
+// JSON array that lists every redirect URI of the client.
+type SectorValidator struct {
+	httpClient *http.Client
+}
+
+func NewSectorValidator(httpClient *http.Client) *SectorValidator {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &SectorValidator{httpClient: httpClient}
+}
+
+// Validate checks the subject type and sector of client.
+func (v *SectorValidator) Validate(ctx context.Context, client store.Client) error {
+	switch client.Meta.SubjectType {
+	case "", Public:
+		if client.Meta.SectorIdentifierURI != "" {
+			return fmt.Errorf("sector_identifier_uri requires subject_type pairwise")
+		}
+		return nil
+	case Pairwise:
+	default:
+		return fmt.Errorf("unsupported subject_type %q", client.Meta.SubjectType)
+	}
+	if client.Meta.SectorIdentifierURI == "" {
+		_, err := Sector(client)
+		return err
+	}
+	u, err := url.Parse(client.Meta.SectorIdentifierURI)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("sector_identifier_uri must be an https URL")
+	}
+	uris, err := v.fetch(ctx, client.Meta.SectorIdentifierURI)
+	if err != nil {
+		return err
+	}
+	for _, r := range client.RedirectURIs {
+		if !slices.Contains(uris, r) {
+			return fmt.Errorf("redirect URI %s is not listed at sector_identifier_uri", r)
+		}
+	}
+	return nil
+}
+
+func (v *SectorValidator) fetch(ctx context.Context, uri string) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := v.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching sector_identifier_uri: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching sector_identifier_uri: unexpected status %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	var uris []string
+	if err := json.Unmarshal(body, &uris); err != nil {
+		return nil, fmt.Errorf("sector_identifier_uri must return a JSON array of redirect URIs")
+	}
+	return uris, nil
+}
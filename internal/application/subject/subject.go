@@ -0,0 +1,144 @@
+// Package subject computes the sub claim a client sees for a user (OIDC
+// Core §8). Public clients get the local user ID; pairwise clients get a
+// value derived from their sector identifier, so clients in different
+// sectors cannot correlate users.
+package subject
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"sync"
+
+	"github.com/martencassel/oidcsim/internal/store"
+)
+
+// Subject types (OIDC Discovery subject_types_supported).
+const (
+	Public   = "public"
+	Pairwise = "pairwise"
+)
+
+// Types lists the supported subject types.
+var Types = []string{Public, Pairwise}
+
+// Identifiers derives pairwise subject identifiers and remembers the ones
+// it handed out so they can be mapped back to the local subject.
+type Identifiers struct {
+	salt []byte
+
+	mu      sync.RWMutex
+	reverse map[string]string // sector + "|" + pairwise sub -> local subject
+}
+
+// NewIdentifiers returns Identifiers keyed with salt. A pairwise sub is
+// stable only for as long as the salt is, so it must be kept secret and
+// not change between restarts. An empty salt is replaced by a random one;
+// NewIdentifiers panics if none can be read rather than use a zero salt.
+func NewIdentifiers(salt []byte) *Identifiers {
+	if len(salt) == 0 {
+		salt = make([]byte, 32)
+		if _, err := rand.Read(salt); err != nil {
+			panic(fmt.Sprintf("subject: generating pairwise salt: %v", err))
+		}
+	}
+	return &Identifiers{salt: salt, reverse: map[string]string{}}
+}
+
+// For returns the sub of local as client sees it.
+func (ids *Identifiers) For(client store.Client, local string) string {
+	if ids == nil || !IsPairwise(client) || local == "" {
+		return local
+	}
+	sector, err := Sector(client)
+	if err != nil {
+		// Registration rejects such clients; fall back to the client ID
+		// so the value is still pairwise.
+		sector = client.ID
+	}
+	return ids.derive(sector, local)
+}
+
+// Local maps sub, as issued to client, back to the local subject. It
+// only knows pairwise values it derived since start; callers fall back
+// to Match over their users for the others.
+func (ids *Identifiers) Local(client store.Client, sub string) (string, bool) {
+	if ids == nil || !IsPairwise(client) {
+		return sub, sub != ""
+	}
+	sector, err := Sector(client)
+	if err != nil {
+		sector = client.ID
+	}
+	ids.mu.RLock()
+	defer ids.mu.RUnlock()
+	local, ok := ids.reverse[sector+"|"+sub]
+	return local, ok
+}
+
+// Match reports whether sub is the value For returns for local.
+func (ids *Identifiers) Match(client store.Client, sub, local string) bool {
+	return hmac.Equal([]byte(ids.For(client, local)), []byte(sub))
+}
+
+// derive computes HMAC-SHA256(salt, sector || 0 || local), which is
+// deterministic for a given salt and reveals nothing about local. Each
+// sector and sub pair is recorded once, so the reverse map holds one entry
+// per user and sector however often tokens are issued.
+func (ids *Identifiers) derive(sector, local string) string {
+	mac := hmac.New(sha256.New, ids.salt)
+	mac.Write([]byte(sector))
+	mac.Write([]byte{0})
+	mac.Write([]byte(local))
+	sub := base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+	key := sector + "|" + sub
+	ids.mu.RLock()
+	_, known := ids.reverse[key]
+	ids.mu.RUnlock()
+	if !known {
+		ids.mu.Lock()
+		ids.reverse[key] = local
+		ids.mu.Unlock()
+	}
+	return sub
+}
+
+// IsPairwise reports whether client registered for pairwise subjects.
+func IsPairwise(client store.Client) bool {
+	return client.Meta.SubjectType == Pairwise
+}
+
+// Sector returns the sector identifier of client (OIDC Core §8.1): the
+// host of its sector_identifier_uri or, without one, the host of its
+// redirect URIs, which must then all share a host.
+func Sector(client store.Client) (string, error) {
+	if client.Meta.SectorIdentifierURI != "" {
+		return host(client.Meta.SectorIdentifierURI)
+	}
+	var sector string
+	for _, r := range client.RedirectURIs {
+		h, err := host(r)
+		if err != nil {
+			return "", err
+		}
+		if sector != "" && h != sector {
+			return "", fmt.Errorf("redirect URIs on several hosts need a sector_identifier_uri")
+		}
+		sector = h
+	}
+	if sector == "" {
+		return "", fmt.Errorf("pairwise subjects need redirect URIs or a sector_identifier_uri")
+	}
+	return sector, nil
+}
+
+func host(uri string) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("invalid URI %q", uri)
+	}
+	return u.Hostname(), nil
+}
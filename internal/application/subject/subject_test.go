@@ -0,0 +1,91 @@
+package subject
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/martencassel/oidcsim/internal/store"
+)
+
+func pairwiseClient(id string, redirects ...string) store.Client {
+	return store.Client{ID: id, RedirectURIs: redirects, Meta: store.ClientMeta{SubjectType: Pairwise}}
+}
+
+func TestIdentifiers_Pairwise(t *testing.T) {
+	ids := NewIdentifiers([]byte("salt"))
+	a := pairwiseClient("a", "https://a.example/cb")
+	a2 := pairwiseClient("a2", "https://a.example/other")
+	b := pairwiseClient("b", "https://b.example/cb")
+
+	sub := ids.For(a, "alice")
+	assert.NotEqual(t, "alice", sub)
+	assert.Equal(t, sub, ids.For(a, "alice"), "deterministic")
+	assert.Equal(t, sub, ids.For(a2, "alice"), "same sector, same sub")
+	assert.NotEqual(t, sub, ids.For(b, "alice"), "other sectors cannot correlate")
+	assert.NotEqual(t, sub, ids.For(a, "bob"))
+	assert.NotEqual(t, sub, NewIdentifiers([]byte("other")).For(a, "alice"), "the salt is part of the derivation")
+	assert.Equal(t, "alice", ids.For(store.Client{ID: "p"}, "alice"), "public clients get the local subject")
+
+	local, ok := ids.Local(a, sub)
+	require.True(t, ok)
+	assert.Equal(t, "alice", local)
+	_, ok = ids.Local(b, sub)
+	assert.False(t, ok, "a sub only maps back within its sector")
+
+	restarted := NewIdentifiers([]byte("salt"))
+	_, ok = restarted.Local(a, sub)
+	assert.False(t, ok)
+	assert.True(t, restarted.Match(a, sub, "alice"))
+}
+
+func TestIdentifiers_RecordsEachSubOnce(t *testing.T) {
+	ids := NewIdentifiers(nil)
+	a := pairwiseClient("a", "https://a.example/cb")
+	for i := 0; i < 100; i++ {
+		ids.For(a, "alice")
+	}
+	assert.Len(t, ids.reverse, 1)
+	assert.NotEqual(t, make([]byte, 32), ids.salt, "an empty salt is replaced by a random one")
+}
+
+func TestSector(t *testing.T) {
+	_, err := Sector(pairwiseClient("x", "https://a.example/cb", "https://b.example/cb"))
+	assert.Error(t, err, "several hosts need a sector_identifier_uri")
+
+	c := pairwiseClient("x", "https://a.example/cb", "https://b.example/cb")
+	c.Meta.SectorIdentifierURI = "https://sector.example/uris.json"
+	sector, err := Sector(c)
+	require.NoError(t, err)
+	assert.Equal(t, "sector.example", sector)
+}
+
+func TestSectorValidator(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]string{"https://a.example/cb", "https://b.example/cb"})
+	}))
+	defer srv.Close()
+	v := NewSectorValidator(srv.Client())
+	ctx := context.Background()
+
+	c := pairwiseClient("x", "https://a.example/cb", "https://b.example/cb")
+	c.Meta.SectorIdentifierURI = srv.URL
+	assert.NoError(t, v.Validate(ctx, c))
+
+	c.RedirectURIs = append(c.RedirectURIs, "https://c.example/cb")
+	assert.Error(t, v.Validate(ctx, c), "every redirect URI must be listed")
+
+	c.RedirectURIs = []string{"https://a.example/cb"}
+	c.Meta.SectorIdentifierURI = "http://sector.example/uris.json"
+	assert.Error(t, v.Validate(ctx, c), "https is required")
+
+	assert.Error(t, v.Validate(ctx, store.Client{Meta: store.ClientMeta{SubjectType: "random"}}))
+	assert.Error(t, v.Validate(ctx, store.Client{Meta: store.ClientMeta{SectorIdentifierURI: srv.URL}}),
+		"a sector identifier needs pairwise subjects")
+	assert.NoError(t, v.Validate(ctx, store.Client{}))
+}
@@ -1,150 +1,414 @@
 package bootstrap
 
-// import (
-// 	"bytes"
-// 	"crypto/rsa"
-// 	"encoding/json"
-// 	"fmt"
-// 	"net/http"
-// 	"time"
-
-// 	"github.com/fatih/color"
-// 	"github.com/gin-gonic/gin"
-// 	"github.com/martencassel/oidcsim/authcode"
-// 	"github.com/martencassel/oidcsim/internal/clientauth"
-// 	"github.com/martencassel/oidcsim/internal/config"
-// 	"github.com/martencassel/oidcsim/internal/handlers"
-// 	"github.com/martencassel/oidcsim/internal/identity"
-// 	"github.com/martencassel/oidcsim/internal/registry"
-// 	"github.com/martencassel/oidcsim/internal/services"
-// 	"github.com/martencassel/oidcsim/internal/services/grantflows"
-// 	"github.com/martencassel/oidcsim/internal/services/granthandlers"
-// 	"github.com/martencassel/oidcsim/internal/services/grantvalidators"
-// 	"github.com/martencassel/oidcsim/internal/store"
-// 	log "github.com/sirupsen/logrus"
-// )
-
-// type bodyLogWriter struct {
-// 	gin.ResponseWriter
-// 	body *bytes.Buffer
-// }
-
-// func (w *bodyLogWriter) Write(b []byte) (int, error) {
-// 	w.body.Write(b)
-// 	return w.ResponseWriter.Write(b)
-// }
-
-// type App struct {
-// 	Router *gin.Engine
-// }
-
-// func BuildApp(cfg *config.AppConfig, jwks []byte, priv *rsa.PrivateKey) *App {
-// 	// Initialize Gin router
-// 	router := gin.Default()
-// 	// Setup routes, middleware, handlers, etc. using cfg, jwks, and priv
-// 	router.Use(RequestResponseLogger())
-// 	if cfg.OIDC.Issuer == "" {
-// 		cfg.OIDC.Issuer = "https://idp.local"
-// 	}
-// 	authReg := registry.New[clientauth.Authenticator]()
-// 	authReg.Register("client_secret_basic", &clientauth.ClientSecretBasic{})
-// 	authReg.Register("client_secret_post", &clientauth.ClientSecretPost{})
-// 	authReg.Register("private_key_jwt", &clientauth.ClientPrivateJWT{})
-// 	authReg.Register("none", &clientauth.ClientNone{})
-// 	clientStore := store.NewInMemoryClientStore()
-// 	grantHandlerReg := registry.New[granthandlers.GrantHandler]()
-// 	grantFlowReg := registry.New[grantflows.GrantFlow]()
-// 	deps := services.TokenServiceDeps{
-// 		AuthRegistry:      clientauth.BuildAuthRegistry(),
-// 		GrantValidatorReg: grantvalidators.BuildGrantValidatorRegistry(),
-// 		GrantHandlerReg:   grantHandlerReg,
-// 		GrantFlowReg:      grantFlowReg,
-// 		ClientStore:       clientStore,
-// 	}
-// 	tokenService := services.NewTokenServiceImpl(deps)
-// 	log.Infof("Token service: %+v", tokenService)
-// 	codeStore := authcode.NewStore(360 * time.Second)
-// 	privSigningKey := priv
-// 	// Identity Store API group
-// 	store := identity.NewCoreIdentityStore("http://localhost:8080/identity")
-// 	handler := identity.NewIdentityStoreHandler(store)
-// 	handler.SeedDefault()
-// 	handler.RegisterRoutes(router)
-
-// 	routesConfig := &handlers.RoutesConfig{
-// 		Discovery:  "/.well-known/openid-configuration",
-// 		JWKS:       "/.well-known/jwks.json",
-// 		Authorize:  "/authorize",
-// 		Token:      "/token",
-// 		Userinfo:   "/userinfo",
-// 		Introspect: "/introspect",
-// 		Revoke:     "/revoke",
-// 		Logout:     "/logout",
-// 	}
-// 	// Token Service API group
-// 	controller := handlers.NewTokenServiceControllerBuilder().
-// 		WithIssuer(cfg.OIDC.Issuer).
-// 		WithRoutesConfig(routesConfig).
-// 		WithJWKS(jwks).
-// 		WithCodeStore(codeStore).
-// 		WithSigningKey(privSigningKey).
-// 		WithIdentityStore(store).
-// 		Build()
-// 	controller.RegisterRoutes(router)
-// 	return &App{Router: router}
-// }
-
-// // Middleware to log requests and responses with colors and pretty-printed structured info
-// func RequestResponseLogger() gin.HandlerFunc {
-// 	return func(c *gin.Context) {
-// 		// Log request line and query params
-// 		color.Set(color.FgCyan)
-// 		fmt.Printf("\n→ %s %s %s\n", c.Request.Method, c.Request.URL.Path, c.Request.Proto)
-// 		color.Unset()
-// 		if len(c.Request.URL.Query()) > 0 {
-// 			color.Set(color.FgHiCyan)
-// 			fmt.Println("Query Params:")
-// 			for k, v := range c.Request.URL.Query() {
-// 				fmt.Printf("  %s: %v\n", k, v)
-// 			}
-// 			color.Unset()
-// 		}
-// 		for k, v := range c.Request.Header {
-// 			color.Set(color.FgBlue)
-// 			fmt.Printf("%s: %v\n", k, v)
-// 			color.Unset()
-// 		}
-// 		// Capture response
-// 		writer := &bodyLogWriter{body: bytes.NewBufferString(""), ResponseWriter: c.Writer}
-// 		c.Writer = writer
-// 		c.Next()
-// 		// Log response
-// 		color.Set(color.FgGreen)
-// 		fmt.Printf("← %d %s\n", c.Writer.Status(), http.StatusText(c.Writer.Status()))
-// 		color.Unset()
-// 		for k, v := range c.Writer.Header() {
-// 			color.Set(color.FgMagenta)
-// 			fmt.Printf("%s: %v\n", k, v)
-// 			color.Unset()
-// 		}
-// 		if ct := c.Writer.Header().Get("Content-Type"); ct != "" {
-// 			color.Set(color.FgYellow)
-// 			fmt.Printf("Content-Type: [%s]\n", ct)
-// 			color.Unset()
-// 		}
-// 		if c.Writer.Header().Get("Content-Type") != "" &&
-// 			(c.Writer.Header().Get("Content-Type") == "application/json" ||
-// 				c.Writer.Header().Get("Content-Type") == "application/json; charset=utf-8") {
-// 			var prettyJSON bytes.Buffer
-// 			if err := json.Indent(&prettyJSON, writer.body.Bytes(), "", "  "); err == nil {
-// 				color.Set(color.FgYellow)
-// 				fmt.Println(prettyJSON.String())
-// 				color.Unset()
-// 			} else {
-// 				fmt.Println(writer.body.String())
-// 			}
-// 		} else {
-// 			fmt.Println(writer.body.String())
-// 		}
-// 	}
-// }
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/gin-gonic/gin"
+	"github.com/martencassel/oidcsim/authcode"
+	"github.com/martencassel/oidcsim/internal/application/claimmapping"
+	"github.com/martencassel/oidcsim/internal/application/claimmapping/expr"
+	delegationapp "github.com/martencassel/oidcsim/internal/application/delegation"
+	"github.com/martencassel/oidcsim/internal/application/identitysources"
+	"github.com/martencassel/oidcsim/internal/application/subject"
+	"github.com/martencassel/oidcsim/internal/clientauth"
+	"github.com/martencassel/oidcsim/internal/config"
+	"github.com/martencassel/oidcsim/internal/domain/authentication"
+	"github.com/martencassel/oidcsim/internal/dto"
+	"github.com/martencassel/oidcsim/internal/handlers"
+	"github.com/martencassel/oidcsim/internal/identity"
+	"github.com/martencassel/oidcsim/internal/infrastructure/database"
+	delegationinfra "github.com/martencassel/oidcsim/internal/infrastructure/delegation"
+	sessioninfra "github.com/martencassel/oidcsim/internal/infrastructure/session"
+	interfacehttp "github.com/martencassel/oidcsim/internal/interface/http"
+	"github.com/martencassel/oidcsim/internal/security"
+	"github.com/martencassel/oidcsim/internal/store"
+	log "github.com/sirupsen/logrus"
+)
+
+// delegationRepos returns the SQL repositories when a database is
+// configured, migrating it first, and in-memory ones otherwise.
+func delegationRepos(cfg *config.AppConfig) (delegationapp.Repository, delegationapp.AdminConsentRepository) {
+	if cfg.Database.Driver == "" {
+		log.Warn("No database configured; delegations are kept in memory and lost on restart")
+		return delegationinfra.NewMemoryRepo(), delegationinfra.NewAdminConsentMemoryRepo()
+	}
+	db, err := database.Open(context.Background(), database.Dialect(cfg.Database.Driver), cfg.Database.DSN)
+	if err != nil {
+		log.Fatalf("failed to open database: %v", err)
+	}
+	return delegationinfra.NewSQLRepo(db), delegationinfra.NewAdminConsentSQLRepo(db)
+}
+
+type bodyLogWriter struct {
+	gin.ResponseWriter
+	body *bytes.Buffer
+}
+
+func (w *bodyLogWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+type App struct {
+	Router *gin.Engine
+	// AuthSessions records which user signed in on each browser session.
+	// The authorization endpoint sends users who have not to /login.
+	AuthSessions authentication.SessionStore
+}
+
+func BuildApp(cfg *config.AppConfig, keys *security.KeyManager) *App {
+	// Initialize Gin router
+	router := gin.Default()
+	// Setup routes, middleware, handlers, etc. using cfg, jwks, and priv
+	router.Use(RequestResponseLogger())
+	if cfg.OIDC.Issuer == "" {
+		cfg.OIDC.Issuer = "https://idp.local"
+	}
+	codeStore := authcode.NewStore(360 * time.Second)
+	// Identity Store API group
+	idStore := identity.NewCoreIdentityStore("http://localhost:8080/identity")
+	handler := identity.NewIdentityStoreHandler(idStore)
+	handler.SeedDefault()
+	handler.RegisterRoutes(router)
+
+	routesConfig := routesFromConfig(cfg.Routes)
+	clientStore := store.NewInMemoryClientStore()
+	if err := seedClients(clientStore); err != nil {
+		log.Fatalf("failed to seed clients: %v", err)
+	}
+	tokenStore := store.NewInMemoryTokenStore()
+	refreshStore := store.NewInMemoryRefreshTokenStore()
+	delegations, adminConsents := delegationRepos(cfg)
+	if len(cfg.Admin.APIKeys) == 0 {
+		log.Warnf("No admin API keys configured; the admin API rejects all requests until %s or admin.apiKeys is set", config.AdminAPIKeysEnv)
+	}
+	delegationSvc := delegationapp.NewDelegationService(delegations, delegationapp.FirstPartyClients(clientStore),
+		delegationapp.WithAdminConsents(adminConsents, delegationapp.IdentityGroups(idStore)))
+	clientAdmin := handlers.NewClientAdminHandler(clientStore, tokenStore, refreshStore, delegations, keys, cfg.Admin.APIKeys)
+	clientAdmin.RegisterRoutes(router)
+	handlers.NewAdminConsentHandler(clientStore, delegationSvc, cfg.Admin.APIKeys).RegisterRoutes(router)
+	handlers.NewKeyAdminHandler(keys, cfg.Admin.APIKeys).RegisterRoutes(router)
+	handlers.NewDebugHandler(keys, cfg.Admin.APIKeys).RegisterRoutes(router)
+
+	tlsRoots, err := loadCertPool(cfg.MTLS.ClientCAFile)
+	if err != nil {
+		log.Fatalf("failed to load client CA bundle: %v", err)
+	}
+	trustedProxies, err := clientauth.ParseTrustedProxies(cfg.MTLS.TrustedProxies)
+	if err != nil {
+		log.Fatalf("invalid mtls.trustedProxies: %v", err)
+	}
+	certs := clientauth.CertificateSource{
+		Header:         cfg.MTLS.CertHeader,
+		TrustedProxies: trustedProxies,
+	}
+	if err := certs.Validate(); err != nil {
+		log.Fatalf("invalid mtls.certHeader: %v; set mtls.trustedProxies", err)
+	}
+	// Client key sets are shared by assertion verification and response
+	// encryption so a jwks_uri is fetched once per TTL
+	clientKeys := clientauth.NewJWKSResolver(nil, 5*time.Minute)
+	issuers := append([]string{cfg.OIDC.Issuer}, cfg.OIDC.Issuers...)
+	// Client assertions must be addressed to an issuer or its token endpoint
+	var audiences []string
+	for _, issuer := range issuers {
+		audiences = append(audiences, issuer, issuer+routesConfig.Token)
+	}
+	clientAuth := clientauth.NewService(clientStore, clientauth.BuildAuthRegistry(clientauth.Config{
+		Audiences: audiences,
+		Replay:    clientauth.NewMemoryReplayCache(),
+		Keys:      clientKeys,
+		TLSRoots:  tlsRoots,
+	}))
+	claimMapping, err := claimmapping.NewPipeline(cfg.IdentitySources)
+	if err != nil {
+		log.Fatalf("invalid claim mapping: %v", err)
+	}
+	claimMapping.SetLimits(expr.Limits{
+		MaxSteps:  cfg.ClaimExpressions.MaxSteps,
+		MaxMemory: cfg.ClaimExpressions.MaxMemory,
+	})
+	handlers.NewClaimMappingAdminHandler(claimMapping, cfg.Admin.APIKeys).RegisterRoutes(router)
+	claimSources, err := identitysources.NewClaimSources(cfg.IdentitySources)
+	if err != nil {
+		log.Fatalf("invalid claims provider: %v", err)
+	}
+	if cfg.OIDC.PairwiseSalt == "" {
+		log.Warn("No oidc.pairwiseSalt configured; pairwise subject identifiers change on every restart")
+	}
+	subjects := subject.NewIdentifiers([]byte(cfg.OIDC.PairwiseSalt))
+	pushedRequests := store.NewInMemoryPushedRequestStore()
+	// Browser flow behind /authorize: sign-in check and consent
+	authSessions := sessioninfra.NewInMemorySessionStore()
+	browser := &interfacehttp.Handler{
+		Sessions:       sessioninfra.NewMemorySessionManager(""),
+		AuthSvc:        *authentication.NewDefaultAuthService(authSessions, nil),
+		DelegationSvc:  delegationSvc,
+		Clients:        clientStore,
+		Tokens:         tokenStore,
+		Subjects:       subjects,
+		PushedRequests: pushedRequests,
+	}
+	browser.RegisterRoutes(router)
+	browser.RegisterAccountRoutes(router)
+	// Token Service API group
+	controller := handlers.NewTokenServiceControllerBuilder().
+		WithIssuer(cfg.OIDC.Issuer).
+		WithRoutesConfig(routesConfig).
+		WithCodeStore(codeStore).
+		WithKeyManager(keys).
+		WithIdentityStore(idStore).
+		WithClientStore(clientStore).
+		WithTokenStore(tokenStore).
+		WithRefreshTokens(refreshStore).
+		WithClientAuthenticator(clientAuth).
+		WithClientKeys(clientKeys).
+		WithClaimMapping(claimMapping).
+		WithClaimSources(claimSources).
+		WithSubjectIdentifiers(subjects).
+		WithDelegations(delegationSvc).
+		WithPushedRequests(pushedRequests).
+		WithAuthorizeFlow(browser.AuthorizeFlow()).
+		WithSignedMetadata(cfg.OIDC.SignedMetadata).
+		WithWebFingerUserCheck(cfg.OIDC.WebFinger.CheckUsers).
+		WithCertificateSource(certs).
+		Build()
+	browser.AuthorizeSvc = controller
+	controller.RegisterRoutes(router)
+	if err := controller.RegisterMetadataRoutes(router); err != nil {
+		log.Fatalf("invalid oidc.issuer: %v", err)
+	}
+	registerPathIssuers(router, controller, cfg.OIDC.Issuer, cfg.OIDC.Issuers)
+	return &App{Router: router, AuthSessions: authSessions}
+}
+
+// registerPathIssuers serves the token service again under each additional
+// issuer's path. Every issuer shares clients, keys and stores, but tokens
+// carry and are validated against their own issuer.
+func registerPathIssuers(router *gin.Engine, controller *handlers.TokenServiceController, primary string, issuers []string) {
+	seen := map[string]string{}
+	if path, err := handlers.IssuerPath(primary); err == nil {
+		seen[path] = primary
+	}
+	for _, issuer := range issuers {
+		path, err := handlers.IssuerPath(issuer)
+		if err != nil {
+			log.Fatalf("invalid oidc.issuers entry: %v", err)
+		}
+		if path == "" {
+			log.Fatalf("oidc.issuers entry %q needs a path to be told apart from other issuers", issuer)
+		}
+		if other, ok := seen[path]; ok {
+			log.Fatalf("issuers %q and %q share the path %s", other, issuer, path)
+		}
+		seen[path] = issuer
+
+		tenant := controller.ForIssuer(issuer)
+		tenant.RegisterRoutes(router.Group(path))
+		if err := tenant.RegisterMetadataRoutes(router); err != nil {
+			log.Fatalf("invalid oidc.issuers entry: %v", err)
+		}
+		log.Infof("Serving issuer %s under %s", issuer, path)
+	}
+}
+
+// loadCertPool reads a PEM bundle of CA certificates. An empty path
+// yields a nil pool, which disables tls_client_auth.
+func loadCertPool(path string) (*x509.CertPool, error) {
+	if path == "" {
+		return nil, nil
+	}
+	pemData, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pemData) {
+		return nil, fmt.Errorf("no certificates found in %s", path)
+	}
+	return pool, nil
+}
+
+// seedClients registers the default confidential client. Its secret is
+// stored hashed, the plain value only appears here.
+func seedClients(clients store.ClientStore) error {
+	hash, err := store.HashClientSecret("secret")
+	if err != nil {
+		return err
+	}
+	return clients.Save(context.Background(), store.Client{
+		ID:           "client",
+		Name:         "Default client",
+		RedirectURIs: []string{"https://client.example/cb"},
+		Grants:       []string{"authorization_code", "refresh_token", "client_credentials"},
+		Scopes:       []string{"openid", "profile", "email"},
+		Meta: store.ClientMeta{
+			ID:                 "client",
+			AllowedAuthMethods: []dto.ClientAuthMethod{dto.ClientSecretBasic, dto.ClientSecretPost},
+			SecretHash:         hash,
+			Enabled:            true,
+		},
+	})
+}
+
+// routesFromConfig returns the endpoint paths, taking those set in the
+// routes section of the config over the defaults.
+func routesFromConfig(routes config.Routes) *handlers.RoutesConfig {
+	or := func(configured, def string) string {
+		if configured != "" {
+			return configured
+		}
+		return def
+	}
+	return &handlers.RoutesConfig{
+		Discovery:  or(routes.Discovery, "/.well-known/openid-configuration"),
+		JWKS:       or(routes.JWKS, "/.well-known/jwks.json"),
+		Authorize:  or(routes.Authorize, "/authorize"),
+		Token:      or(routes.Token, "/token"),
+		Userinfo:   or(routes.Userinfo, "/userinfo"),
+		Introspect: or(routes.Introspect, "/introspect"),
+		Revoke:     or(routes.Revoke, "/revoke"),
+		Logout:     or(routes.Logout, "/logout"),
+		Claims:     or(routes.Claims, "/claims"),
+		PAR:        or(routes.PAR, "/par"),
+		Grants:     or(routes.Grants, "/grants"),
+
+		AuthorizationServerMetadata: or(routes.AuthorizationServerMetadata, "/.well-known/oauth-authorization-server"),
+		WebFinger:                   or(routes.WebFinger, "/.well-known/webfinger"),
+	}
+}
+
+// sensitiveParams are query parameters, response headers and JSON body
+// members whose values are credentials. RequestResponseLogger prints them
+// redacted.
+var sensitiveParams = map[string]bool{
+	"authorization": true, "cookie": true, "set-cookie": true, "dpop": true,
+	"code": true, "code_verifier": true, "client_secret": true, "client_assertion": true,
+	"password": true, "token": true, "id_token_hint": true, "login_hint_token": true,
+	"access_token": true, "refresh_token": true, "id_token": true, "registration_access_token": true,
+}
+
+const redacted = "[redacted]"
+
+// redactQuery returns query with the values of sensitive parameters
+// replaced.
+func redactQuery(query url.Values) url.Values {
+	out := url.Values{}
+	for k, v := range query {
+		if sensitiveParams[strings.ToLower(k)] {
+			v = []string{redacted}
+		}
+		out[k] = v
+	}
+	return out
+}
+
+// redactHeader returns the value of a header for logging. Redirects keep
+// their target but not the code or tokens they carry.
+func redactHeader(name string, values []string) []string {
+	name = strings.ToLower(name)
+	if sensitiveParams[name] {
+		return []string{redacted}
+	}
+	if name != "location" {
+		return values
+	}
+	out := make([]string, len(values))
+	for i, v := range values {
+		u, err := url.Parse(v)
+		if err != nil {
+			out[i] = redacted
+			continue
+		}
+		u.RawQuery = redactQuery(u.Query()).Encode()
+		if u.Fragment != "" {
+			u.Fragment = redacted
+		}
+		out[i] = u.String()
+	}
+	return out
+}
+
+// redactJSON returns a JSON body with the values of sensitive top-level
+// members replaced.
+func redactJSON(body []byte) ([]byte, error) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(body, &doc); err != nil {
+		// Not an object, such as a JWKS key list; nothing to redact
+		var v any
+		if err := json.Unmarshal(body, &v); err != nil {
+			return nil, err
+		}
+		return body, nil
+	}
+	for k := range doc {
+		if sensitiveParams[k] {
+			doc[k] = json.RawMessage(`"` + redacted + `"`)
+		}
+	}
+	return json.Marshal(doc)
+}
+
+// Middleware to log requests and responses with colors and pretty-printed
+// structured info. Credentials and tokens are redacted, and only the size
+// of non-JSON bodies, such as signed userinfo responses, is logged.
+func RequestResponseLogger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Log request line and query params
+		color.Set(color.FgCyan)
+		fmt.Printf("\n→ %s %s %s\n", c.Request.Method, c.Request.URL.Path, c.Request.Proto)
+		color.Unset()
+		if query := c.Request.URL.Query(); len(query) > 0 {
+			color.Set(color.FgHiCyan)
+			fmt.Println("Query Params:")
+			for k, v := range redactQuery(query) {
+				fmt.Printf("  %s: %v\n", k, v)
+			}
+			color.Unset()
+		}
+		for k, v := range c.Request.Header {
+			color.Set(color.FgBlue)
+			fmt.Printf("%s: %v\n", k, redactHeader(k, v))
+			color.Unset()
+		}
+		// Capture response
+		writer := &bodyLogWriter{body: bytes.NewBufferString(""), ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+		// Log response
+		color.Set(color.FgGreen)
+		fmt.Printf("← %d %s\n", c.Writer.Status(), http.StatusText(c.Writer.Status()))
+		color.Unset()
+		for k, v := range c.Writer.Header() {
+			color.Set(color.FgMagenta)
+			fmt.Printf("%s: %v\n", k, redactHeader(k, v))
+			color.Unset()
+		}
+		ct := c.Writer.Header().Get("Content-Type")
+		if ct != "application/json" && ct != "application/json; charset=utf-8" {
+			fmt.Printf("[%d bytes]\n", writer.body.Len())
+			return
+		}
+		body, err := redactJSON(writer.body.Bytes())
+		if err != nil {
+			fmt.Printf("[%d bytes]\n", writer.body.Len())
+			return
+		}
+		var prettyJSON bytes.Buffer
+		if err := json.Indent(&prettyJSON, body, "", "  "); err == nil {
+			color.Set(color.FgYellow)
+			fmt.Println(prettyJSON.String())
+			color.Unset()
+		}
+	}
+}
@@ -0,0 +1,303 @@
+package bootstrap
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/martencassel/oidcsim/internal/config"
+	"github.com/martencassel/oidcsim/internal/domain/authentication"
+	"github.com/martencassel/oidcsim/internal/handlers"
+	"github.com/martencassel/oidcsim/internal/interface/http/dto"
+	"github.com/martencassel/oidcsim/internal/security"
+)
+
+// browser drives the App's router with the session cookie of a user agent.
+type browser struct {
+	app    *App
+	cookie *http.Cookie
+}
+
+func newTestApp(t *testing.T) *App {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	keys, err := security.NewKeyManager(security.KeyManagerConfig{Algorithms: []string{"RS256"}})
+	require.NoError(t, err)
+	cfg := &config.AppConfig{}
+	cfg.OIDC.Issuer = "https://idp.test"
+	return BuildApp(cfg, keys)
+}
+
+// signIn records userID as signed in on a new browser session.
+func signIn(t *testing.T, app *App, userID string) *browser {
+	t.Helper()
+	sid := "session-" + userID
+	require.NoError(t, app.AuthSessions.Save(authentication.AuthSession{ID: sid, SubjectID: userID}))
+	require.NoError(t, app.AuthSessions.MarkAuthenticated(sid))
+	return &browser{app: app, cookie: &http.Cookie{Name: "session_id", Value: sid}}
+}
+
+func (b *browser) do(t *testing.T, method, target string, form url.Values) *httptest.ResponseRecorder {
+	t.Helper()
+	var req *http.Request
+	if form != nil {
+		req = httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		req = httptest.NewRequest(method, target, nil)
+	}
+	if b.cookie != nil {
+		req.AddCookie(b.cookie)
+	}
+	w := httptest.NewRecorder()
+	b.app.Router.ServeHTTP(w, req)
+	return w
+}
+
+// authorize sends an authorization request for the seeded client and
+// approves the consent page it leads to, returning the client redirect.
+func (b *browser) authorize(t *testing.T, params url.Values) *url.URL {
+	t.Helper()
+	params.Set("response_type", "code")
+	params.Set("client_id", "client")
+	params.Set("redirect_uri", "https://client.example/cb")
+	w := b.do(t, http.MethodGet, "/authorize?"+params.Encode(), nil)
+	require.Equal(t, http.StatusFound, w.Code, w.Body.String())
+	require.Equal(t, "/consent", w.Header().Get("Location"))
+
+	w = b.do(t, http.MethodGet, "/consent", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	m := regexp.MustCompile(`name="request_id" value="([^"]+)"`).FindStringSubmatch(w.Body.String())
+	require.Len(t, m, 2)
+
+	w = b.do(t, http.MethodPost, "/consent", url.Values{
+		"request_id": {m[1]},
+		"decision":   {"approve"},
+		"scope":      {"profile", "email"},
+		"remember":   {"true"},
+	})
+	require.Equal(t, http.StatusFound, w.Code, w.Body.String())
+	loc, err := url.Parse(w.Header().Get("Location"))
+	require.NoError(t, err)
+	return loc
+}
+
+// token posts a token request for the seeded client.
+func (b *browser) token(t *testing.T, form url.Values) *httptest.ResponseRecorder {
+	t.Helper()
+	form.Set("client_id", "client")
+	form.Set("client_secret", "secret")
+	return b.do(t, http.MethodPost, "/token", form)
+}
+
+func tokenResponse(t *testing.T, w *httptest.ResponseRecorder) handlers.TokenResponse {
+	t.Helper()
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp handlers.TokenResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	return resp
+}
+
+func TestBuildApp_AuthorizeAsksForConsent(t *testing.T) {
+	app := newTestApp(t)
+
+	anonymous := &browser{app: app}
+	w := anonymous.do(t, http.MethodGet, "/authorize?"+url.Values{
+		"response_type": {"code"}, "client_id": {"client"}, "redirect_uri": {"https://client.example/cb"}, "scope": {"openid"},
+	}.Encode(), nil)
+	require.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "/login", w.Header().Get("Location"), "no code is issued before the user signs in")
+
+	alice := signIn(t, app, "alice")
+	loc := alice.authorize(t, url.Values{"scope": {"openid profile"}, "state": {"s1"}})
+	assert.Equal(t, "client.example", loc.Host)
+	assert.Equal(t, "s1", loc.Query().Get("state"))
+	assert.Equal(t, "https://idp.test", loc.Query().Get("iss"))
+	assert.NotEmpty(t, loc.Query().Get("code"))
+
+	// The remembered consent covers the next request
+	w = alice.do(t, http.MethodGet, "/authorize?"+url.Values{
+		"response_type": {"code"}, "client_id": {"client"}, "redirect_uri": {"https://client.example/cb"}, "scope": {"openid"},
+	}.Encode(), nil)
+	require.Equal(t, http.StatusFound, w.Code)
+	assert.True(t, strings.HasPrefix(w.Header().Get("Location"), "https://client.example/cb?"), w.Header().Get("Location"))
+}
+
+func TestBuildApp_AccountGrants(t *testing.T) {
+	app := newTestApp(t)
+	alice := signIn(t, app, "alice")
+	alice.authorize(t, url.Values{"scope": {"openid profile"}})
+
+	w := alice.do(t, http.MethodGet, "/account/apps", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Default client")
+
+	w = alice.do(t, http.MethodGet, "/account/grants", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var grants dto.GrantListResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &grants))
+	require.Len(t, grants.Grants, 1)
+	assert.Equal(t, "client", grants.Grants[0].ClientID)
+
+	bob := signIn(t, app, "bob")
+	w = bob.do(t, http.MethodDelete, "/account/grants/"+grants.Grants[0].GrantID, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code, "users only manage their own grants")
+
+	w = alice.do(t, http.MethodDelete, "/account/grants/"+grants.Grants[0].GrantID, nil)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = alice.do(t, http.MethodGet, "/authorize?"+url.Values{
+		"response_type": {"code"}, "client_id": {"client"}, "redirect_uri": {"https://client.example/cb"}, "scope": {"openid"},
+	}.Encode(), nil)
+	assert.Equal(t, "/consent", w.Header().Get("Location"), "a revoked grant is asked for again")
+}
+
+func TestBuildApp_CodeExchange(t *testing.T) {
+	app := newTestApp(t)
+	alice := signIn(t, app, "alice")
+	loc := alice.authorize(t, url.Values{"scope": {"openid profile email"}, "nonce": {"n-1"}})
+	code := loc.Query().Get("code")
+
+	resp := tokenResponse(t, alice.token(t, url.Values{
+		"grant_type": {"authorization_code"}, "code": {code}, "redirect_uri": {"https://client.example/cb"},
+	}))
+	assert.Equal(t, "openid profile email", resp.Scope)
+	claims := jwt.MapClaims{}
+	_, _, err := jwt.NewParser().ParseUnverified(resp.IDToken, claims)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", claims["sub"])
+	assert.Equal(t, "n-1", claims["nonce"])
+
+	w := alice.token(t, url.Values{"grant_type": {"authorization_code"}, "code": {code}, "redirect_uri": {"https://client.example/cb"}})
+	assert.Equal(t, http.StatusBadRequest, w.Code, "a code is redeemed once")
+
+	refreshed := tokenResponse(t, alice.token(t, url.Values{"grant_type": {"refresh_token"}, "refresh_token": {resp.RefreshToken}, "scope": {"openid"}}))
+	assert.Equal(t, "openid", refreshed.Scope)
+	assert.NotEmpty(t, refreshed.RefreshToken)
+}
+
+func TestBuildApp_GrantManagementAction(t *testing.T) {
+	app := newTestApp(t)
+	alice := signIn(t, app, "alice")
+	redeem := func(loc *url.URL) handlers.TokenResponse {
+		t.Helper()
+		return tokenResponse(t, alice.token(t, url.Values{
+			"grant_type": {"authorization_code"}, "code": {loc.Query().Get("code")}, "redirect_uri": {"https://client.example/cb"},
+		}))
+	}
+	// authorizeAgain follows a request that needs no consent page.
+	authorizeAgain := func(params url.Values) *url.URL {
+		t.Helper()
+		params.Set("response_type", "code")
+		params.Set("client_id", "client")
+		params.Set("redirect_uri", "https://client.example/cb")
+		w := alice.do(t, http.MethodGet, "/authorize?"+params.Encode(), nil)
+		require.Equal(t, http.StatusFound, w.Code, w.Body.String())
+		loc, err := url.Parse(w.Header().Get("Location"))
+		require.NoError(t, err)
+		require.Equal(t, "client.example", loc.Host, loc.String())
+		return loc
+	}
+
+	first := redeem(alice.authorize(t, url.Values{"scope": {"openid profile"}}))
+	require.NotEmpty(t, first.GrantID)
+
+	created := redeem(authorizeAgain(url.Values{"scope": {"openid profile"}, "grant_management_action": {"create"}}))
+	assert.NotEqual(t, first.GrantID, created.GrantID, "create starts a new grant")
+	w := alice.token(t, url.Values{"grant_type": {"refresh_token"}, "refresh_token": {first.RefreshToken}})
+	assert.Equal(t, http.StatusBadRequest, w.Code, "the replaced grant is revoked")
+
+	replaced := redeem(authorizeAgain(url.Values{"scope": {"openid"}, "grant_management_action": {"replace"}, "grant_id": {created.GrantID}}))
+	assert.Equal(t, created.GrantID, replaced.GrantID)
+	w = alice.do(t, http.MethodGet, "/account/grants", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var grants dto.GrantListResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &grants))
+	require.Len(t, grants.Grants, 1)
+	assert.Equal(t, created.GrantID, grants.Grants[0].GrantID)
+	assert.Equal(t, []string{"openid"}, grants.Grants[0].Scope)
+}
+
+func TestBuildApp_IncludeGrantedScopes(t *testing.T) {
+	app := newTestApp(t)
+	alice := signIn(t, app, "alice")
+	redeem := func(loc *url.URL) handlers.TokenResponse {
+		t.Helper()
+		return tokenResponse(t, alice.token(t, url.Values{
+			"grant_type": {"authorization_code"}, "code": {loc.Query().Get("code")}, "redirect_uri": {"https://client.example/cb"},
+		}))
+	}
+
+	first := redeem(alice.authorize(t, url.Values{"scope": {"openid"}}))
+	assert.Equal(t, "openid", first.Scope)
+
+	// Only email is asked for; the code covers the earlier grant too
+	incremental := redeem(alice.authorize(t, url.Values{"scope": {"email"}, "include_granted_scopes": {"true"}}))
+	assert.ElementsMatch(t, []string{"openid", "email"}, strings.Fields(incremental.Scope))
+
+	// Without the consent page, too
+	w := alice.do(t, http.MethodGet, "/authorize?"+url.Values{
+		"response_type": {"code"}, "client_id": {"client"}, "redirect_uri": {"https://client.example/cb"},
+		"scope": {"email"}, "include_granted_scopes": {"true"},
+	}.Encode(), nil)
+	require.Equal(t, http.StatusFound, w.Code)
+	loc, err := url.Parse(w.Header().Get("Location"))
+	require.NoError(t, err)
+	require.Equal(t, "client.example", loc.Host)
+	assert.ElementsMatch(t, []string{"openid", "email"}, strings.Fields(redeem(loc).Scope))
+
+	plain := redeem(alice.authorize(t, url.Values{"scope": {"profile"}}))
+	assert.Equal(t, "profile", plain.Scope, "without include_granted_scopes only what was asked for")
+}
+
+func TestBuildApp_ConfiguredRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	keys, err := security.NewKeyManager(security.KeyManagerConfig{Algorithms: []string{"RS256"}})
+	require.NoError(t, err)
+	cfg := &config.AppConfig{}
+	cfg.OIDC.Issuer = "https://idp.test"
+	cfg.Routes.Token = "/oauth2/v1/token"
+	cfg.Routes.Authorize = "/oauth2/v1/authorize"
+	app := BuildApp(cfg, keys)
+
+	w := httptest.NewRecorder()
+	app.Router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/.well-known/openid-configuration", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var doc dto.DiscoveryDocument
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
+	assert.Equal(t, "https://idp.test/oauth2/v1/token", doc.TokenEndpoint)
+	assert.Equal(t, "https://idp.test/oauth2/v1/authorize", doc.AuthorizationEndpoint)
+	assert.Equal(t, "https://idp.test/userinfo", doc.UserinfoEndpoint, "unconfigured routes keep their defaults")
+
+	w = httptest.NewRecorder()
+	app.Router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/oauth2/v1/token", strings.NewReader("grant_type=authorization_code")))
+	assert.NotEqual(t, http.StatusNotFound, w.Code)
+	w = httptest.NewRecorder()
+	app.Router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/token", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestRequestResponseLogger_Redacts(t *testing.T) {
+	assert.Equal(t, []string{redacted}, redactHeader("Authorization", []string{"Basic Y2xpZW50OnNlY3JldA=="}))
+	assert.Equal(t, []string{"text/html"}, redactHeader("Content-Type", []string{"text/html"}))
+
+	loc := redactHeader("Location", []string{"https://client.example/cb?code=abc&state=s1"})
+	u, err := url.Parse(loc[0])
+	require.NoError(t, err)
+	assert.Equal(t, "s1", u.Query().Get("state"))
+	assert.Equal(t, redacted, u.Query().Get("code"))
+
+	assert.Equal(t, []string{redacted}, redactQuery(url.Values{"client_secret": {"secret"}})["client_secret"])
+
+	body, err := redactJSON([]byte(`{"access_token":"at","refresh_token":"rt","token_type":"Bearer"}`))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"access_token":"[redacted]","refresh_token":"[redacted]","token_type":"Bearer"}`, string(body))
+}
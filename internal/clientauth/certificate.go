@@ -0,0 +1,117 @@
+package clientauth
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// CertificateSource extracts the client certificate of a request. It reads
+// the TLS connection state, or, when TLS is terminated at a reverse proxy,
+// a header the proxy sets with the certificate it verified.
+type CertificateSource struct {
+	// Header carries the client certificate forwarded by a proxy, as a
+	// PEM block (optionally URL-encoded, as nginx $ssl_client_escaped_cert
+	// produces) or as base64 DER. Empty disables header forwarding.
+	Header string
+	// TrustedProxies are the peers allowed to set Header. The header is
+	// ignored from every other peer, so it cannot be used to present
+	// someone else's public certificate.
+	TrustedProxies []*net.IPNet
+}
+
+// Validate reports a Header that no peer is trusted to set. Such a source
+// would reject every forwarded certificate.
+func (s CertificateSource) Validate() error {
+	if s.Header != "" && len(s.TrustedProxies) == 0 {
+		return errors.New("a client certificate header needs trusted proxies")
+	}
+	return nil
+}
+
+// ParseTrustedProxies parses CIDRs or single IPs for TrustedProxies.
+func ParseTrustedProxies(values []string) ([]*net.IPNet, error) {
+	var out []*net.IPNet
+	for _, v := range values {
+		if !strings.Contains(v, "/") {
+			if ip := net.ParseIP(v); ip != nil && ip.To4() != nil {
+				v += "/32"
+			} else {
+				v += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, n)
+	}
+	return out, nil
+}
+
+// FromRequest returns the client certificate, or nil if none was presented.
+func (s CertificateSource) FromRequest(r *http.Request) (*x509.Certificate, error) {
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		return r.TLS.PeerCertificates[0], nil
+	}
+	if s.Header == "" {
+		return nil, nil
+	}
+	value := r.Header.Get(s.Header)
+	if value == "" {
+		return nil, nil
+	}
+	if !s.trustedPeer(r.RemoteAddr) {
+		return nil, errors.New("client certificate header from untrusted peer")
+	}
+	return parseForwardedCertificate(value)
+}
+
+func (s CertificateSource) trustedPeer(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	for _, n := range s.TrustedProxies {
+		if ip != nil && n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseForwardedCertificate(value string) (*x509.Certificate, error) {
+	if strings.Contains(value, "%") {
+		unescaped, err := url.QueryUnescape(value)
+		if err != nil {
+			return nil, errors.New("malformed client certificate header")
+		}
+		value = unescaped
+	}
+	if strings.Contains(value, "-----BEGIN") {
+		block, _ := pem.Decode([]byte(value))
+		if block == nil {
+			return nil, errors.New("malformed client certificate PEM")
+		}
+		return x509.ParseCertificate(block.Bytes)
+	}
+	der, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+	if err != nil {
+		return nil, errors.New("malformed client certificate header")
+	}
+	return x509.ParseCertificate(der)
+}
+
+// Thumbprint returns the base64url SHA-256 hash of the DER certificate, the
+// value of the x5t#S256 confirmation method (RFC 8705 §3.1).
+func Thumbprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
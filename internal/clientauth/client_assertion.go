@@ -0,0 +1,90 @@
+package clientauth
+
+import (
+	"crypto/x509"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/martencassel/oidcsim/internal/dto"
+	"github.com/martencassel/oidcsim/internal/errors"
+	"github.com/martencassel/oidcsim/internal/store"
+)
+
+// Config holds what the JWT and mutual-TLS client authentication methods
+// need beyond the client registration itself.
+type Config struct {
+	// Audiences accepted in the aud claim, typically the issuer and the
+	// token endpoint URL.
+	Audiences []string
+	// MaxLifetime bounds exp - now so clients cannot mint long-lived
+	// assertions. Zero means 10 minutes.
+	MaxLifetime time.Duration
+	Replay      ReplayCache
+	// Keys resolves client JWKS for private_key_jwt and
+	// self_signed_tls_client_auth.
+	Keys *JWKSResolver
+	// TLSRoots are the CAs trusted for tls_client_auth.
+	TLSRoots *x509.CertPool
+}
+
+// assertionLeeway is the clock skew allowed on exp, nbf and iat. A jti is
+// remembered for as long, or the assertion could be replayed just after
+// its exp.
+const assertionLeeway = 30 * time.Second
+
+func (c Config) maxLifetime() time.Duration {
+	if c.MaxLifetime <= 0 {
+		return 10 * time.Minute
+	}
+	return c.MaxLifetime
+}
+
+// verifyAssertion parses req.ClientAssertion with keyFunc and checks the
+// claims every JWT client assertion must satisfy.
+func verifyAssertion(cfg Config, client store.Client, req dto.ClientAuthDTO, algs []string, keyFunc jwt.Keyfunc) error {
+	if req.ClientAssertionType != dto.JWTBearerAssertionType {
+		return errors.ErrInvalidClient.WithDescription("unsupported client_assertion_type")
+	}
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(algs),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuer(client.ID),
+		jwt.WithSubject(client.ID),
+		jwt.WithTimeFunc(now),
+		jwt.WithLeeway(assertionLeeway),
+	}
+	if len(cfg.Audiences) > 0 {
+		opts = append(opts, jwt.WithAudience(cfg.Audiences...))
+	}
+	claims := jwt.RegisteredClaims{}
+	if _, err := jwt.ParseWithClaims(req.ClientAssertion, &claims, keyFunc, opts...); err != nil {
+		return errors.ErrInvalidClient.WithDescription("invalid client assertion: " + err.Error())
+	}
+	exp := claims.ExpiresAt.Time
+	if exp.Sub(now()) > cfg.maxLifetime() {
+		return errors.ErrInvalidClient.WithDescription("client assertion lifetime too long")
+	}
+	if claims.ID == "" {
+		return errors.ErrInvalidClient.WithDescription("client assertion is missing jti")
+	}
+	if cfg.Replay != nil && cfg.Replay.Seen(client.ID+"|"+claims.ID, exp.Add(assertionLeeway)) {
+		return errors.ErrInvalidClient.WithDescription("client assertion jti already used")
+	}
+	return nil
+}
+
+// AssertionClientID returns the client the assertion claims to be issued
+// by, without verifying it. It lets the token endpoint find the client when
+// client_id was omitted from the form (RFC 7523 §3).
+func AssertionClientID(assertion string) (string, string, error) {
+	claims := jwt.RegisteredClaims{}
+	token, _, err := jwt.NewParser().ParseUnverified(assertion, &claims)
+	if err != nil {
+		return "", "", err
+	}
+	id := claims.Subject
+	if id == "" {
+		id = claims.Issuer
+	}
+	return id, token.Method.Alg(), nil
+}
@@ -0,0 +1,127 @@
+package clientauth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/martencassel/oidcsim/internal/dto"
+	"github.com/martencassel/oidcsim/internal/errors"
+	"github.com/martencassel/oidcsim/internal/store"
+	jwksutil "github.com/martencassel/oidcsim/jwskutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testAudience = "https://idp.local/token"
+
+func assertionFor(t *testing.T, clientID, jti string, method jwt.SigningMethod, kid string, key interface{}) dto.ClientAuthDTO {
+	t.Helper()
+	token := jwt.NewWithClaims(method, jwt.RegisteredClaims{
+		Issuer:    clientID,
+		Subject:   clientID,
+		Audience:  jwt.ClaimStrings{testAudience},
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		ID:        jti,
+	})
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	require.NoError(t, err)
+	authMethod := dto.PrivateKeyJWT
+	if _, ok := method.(*jwt.SigningMethodHMAC); ok {
+		authMethod = dto.ClientSecretJWT
+	}
+	return dto.ClientAuthDTO{
+		ClientID:            clientID,
+		ClientAssertion:     signed,
+		ClientAssertionType: dto.JWTBearerAssertionType,
+		AuthMethod:          string(authMethod),
+	}
+}
+
+func TestPrivateKeyJWT(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	x, y := make([]byte, 32), make([]byte, 32)
+	ecKey.X.FillBytes(x)
+	ecKey.Y.FillBytes(y)
+	set := jwksutil.JWKS{Keys: []jwksutil.JWK{
+		jwksutil.ConvertToJWK(&rsaKey.PublicKey, "rsa-1"),
+		{Kty: "EC", Use: "sig", Alg: "ES256", Kid: "ec-1", Crv: "P-256",
+			X: base64.RawURLEncoding.EncodeToString(x),
+			Y: base64.RawURLEncoding.EncodeToString(y)},
+	}}
+	raw, err := json.Marshal(set)
+	require.NoError(t, err)
+
+	svc := newTestService(t, store.Client{
+		ID:   "fapi",
+		Meta: store.ClientMeta{Enabled: true, ID: "fapi", JWKS: raw, AllowedAuthMethods: []dto.ClientAuthMethod{dto.PrivateKeyJWT}},
+	})
+	ctx := context.Background()
+
+	_, err = svc.Authenticate(ctx, assertionFor(t, "fapi", "jti-1", jwt.SigningMethodRS256, "rsa-1", rsaKey))
+	assert.NoError(t, err)
+	_, err = svc.Authenticate(ctx, assertionFor(t, "fapi", "jti-2", jwt.SigningMethodES256, "ec-1", ecKey))
+	assert.NoError(t, err)
+
+	// Replayed jti
+	_, err = svc.Authenticate(ctx, assertionFor(t, "fapi", "jti-1", jwt.SigningMethodRS256, "rsa-1", rsaKey))
+	assert.ErrorIs(t, err, errors.ErrInvalidClient)
+
+	// Unregistered key
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	_, err = svc.Authenticate(ctx, assertionFor(t, "fapi", "jti-3", jwt.SigningMethodRS256, "rsa-1", otherKey))
+	assert.ErrorIs(t, err, errors.ErrInvalidClient)
+
+	// Shared secrets are not accepted for this client
+	_, err = svc.Authenticate(ctx, assertionFor(t, "fapi", "jti-4", jwt.SigningMethodHS256, "", []byte("secret")))
+	assert.ErrorIs(t, err, errors.ErrInvalidClient)
+}
+
+func TestClientSecretJWT(t *testing.T) {
+	svc := newTestService(t, store.Client{
+		ID:     "hmac",
+		Secret: "a-long-shared-secret-for-hmac-256",
+		Meta:   store.ClientMeta{Enabled: true, ID: "hmac", AllowedAuthMethods: []dto.ClientAuthMethod{dto.ClientSecretJWT}},
+	})
+	ctx := context.Background()
+
+	_, err := svc.Authenticate(ctx, assertionFor(t, "hmac", "a", jwt.SigningMethodHS256, "", []byte("a-long-shared-secret-for-hmac-256")))
+	assert.NoError(t, err)
+	_, err = svc.Authenticate(ctx, assertionFor(t, "hmac", "b", jwt.SigningMethodHS256, "", []byte("wrong")))
+	assert.ErrorIs(t, err, errors.ErrInvalidClient)
+}
+
+func TestClientAssertion_ReplayWithinLeeway(t *testing.T) {
+	svc := newTestService(t, store.Client{
+		ID:     "hmac",
+		Secret: "a-long-shared-secret-for-hmac-256",
+		Meta:   store.ClientMeta{Enabled: true, ID: "hmac", AllowedAuthMethods: []dto.ClientAuthMethod{dto.ClientSecretJWT}},
+	})
+	ctx := context.Background()
+	assertion := assertionFor(t, "hmac", "late", jwt.SigningMethodHS256, "", []byte("a-long-shared-secret-for-hmac-256"))
+
+	_, err := svc.Authenticate(ctx, assertion)
+	require.NoError(t, err)
+
+	// Past exp, but still inside the leeway the assertion is accepted with
+	start := time.Now()
+	now = func() time.Time { return start.Add(time.Minute + assertionLeeway/2) }
+	defer func() { now = time.Now }()
+	_, err = svc.Authenticate(ctx, assertion)
+	require.ErrorIs(t, err, errors.ErrInvalidClient)
+	assert.Contains(t, err.Error(), "already used")
+}
@@ -0,0 +1,98 @@
+package clientauth
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/martencassel/oidcsim/internal/dto"
+	"github.com/martencassel/oidcsim/internal/errors"
+	"github.com/martencassel/oidcsim/internal/registry"
+	"github.com/martencassel/oidcsim/internal/store"
+)
+
+// Authenticator verifies the credentials presented for one token endpoint
+// authentication method (RFC 6749 §2.3, OIDC Core §9).
+type Authenticator interface {
+	Authenticate(ctx context.Context, client store.Client, req dto.ClientAuthDTO) (*store.Client, error)
+	Name() string
+}
+
+// Service resolves the client named in a request and dispatches to the
+// Authenticator registered for the method the client used.
+type Service struct {
+	clients  store.ClientStore
+	registry *registry.Registry[Authenticator]
+}
+
+func NewService(clients store.ClientStore, reg *registry.Registry[Authenticator]) *Service {
+	return &Service{clients: clients, registry: reg}
+}
+
+// Authenticate returns the authenticated client. Every failure is reported
+// as invalid_client so callers cannot probe which client IDs exist.
+func (s *Service) Authenticate(ctx context.Context, req dto.ClientAuthDTO) (*store.Client, error) {
+	if req.ClientID == "" {
+		return nil, errors.ErrInvalidClient.WithDescription("client authentication missing")
+	}
+	client, err := s.clients.GetByID(ctx, req.ClientID)
+	if err != nil {
+		return nil, errors.ErrInvalidClient.WithDescription("client authentication failed")
+	}
+	if !client.Meta.Enabled {
+		return nil, errors.ErrInvalidClient.WithDescription("client is disabled")
+	}
+	method := dto.ClientAuthMethod(req.AuthMethod)
+	if method == dto.None && req.TLSCert != nil {
+		// A certificate alone does not say which RFC 8705 method applies;
+		// the client's registration does.
+		method = mtlsMethod(client)
+		req.AuthMethod = string(method)
+	}
+	if !client.AllowsAuthMethod(method) {
+		return nil, errors.ErrInvalidClient.WithDescription("authentication method " + req.AuthMethod + " not registered for client")
+	}
+	authenticator, err := s.registry.Get(req.AuthMethod)
+	if err != nil {
+		return nil, errors.ErrInvalidClient.WithDescription("unsupported authentication method " + req.AuthMethod)
+	}
+	return authenticator.Authenticate(ctx, client, req)
+}
+
+// Methods returns the registered authentication method names, sorted, as
+// advertised in token_endpoint_auth_methods_supported.
+func (s *Service) Methods() []string {
+	methods := make([]string, 0, len(s.registry.All()))
+	for name := range s.registry.All() {
+		methods = append(methods, name)
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// SigningAlgs returns the JWS algorithms accepted for client assertions by
+// the registered JWT methods.
+func (s *Service) SigningAlgs() []string {
+	var algs []string
+	if _, err := s.registry.Get(string(dto.PrivateKeyJWT)); err == nil {
+		algs = append(algs, asymmetricAlgs...)
+	}
+	if _, err := s.registry.Get(string(dto.ClientSecretJWT)); err == nil {
+		algs = append(algs, hmacAlgs...)
+	}
+	return algs
+}
+
+func mtlsMethod(client store.Client) dto.ClientAuthMethod {
+	switch {
+	case client.AllowsAuthMethod(dto.TLSClientAuth):
+		return dto.TLSClientAuth
+	case client.AllowsAuthMethod(dto.SelfSignedTLSAuth):
+		return dto.SelfSignedTLSAuth
+	default:
+		return dto.None
+	}
+}
+
+// now is swapped out in tests.
+var now = time.Now
@@ -0,0 +1,86 @@
+package clientauth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/martencassel/oidcsim/internal/dto"
+	"github.com/martencassel/oidcsim/internal/errors"
+	"github.com/martencassel/oidcsim/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestService(t *testing.T, clients ...store.Client) *Service {
+	t.Helper()
+	cs := store.NewInMemoryClientStore()
+	for _, c := range clients {
+		require.NoError(t, cs.Save(context.Background(), c))
+	}
+	return NewService(cs, BuildAuthRegistry(Config{
+		Audiences: []string{"https://idp.local/token"},
+		Replay:    NewMemoryReplayCache(),
+		Keys:      NewJWKSResolver(nil, time.Minute),
+	}))
+}
+
+func secretClient(t *testing.T, id, secret string, methods ...dto.ClientAuthMethod) store.Client {
+	t.Helper()
+	hash, err := store.HashClientSecret(secret)
+	require.NoError(t, err)
+	return store.Client{
+		ID:   id,
+		Meta: store.ClientMeta{ID: id, SecretHash: hash, AllowedAuthMethods: methods, Enabled: true},
+	}
+}
+
+func TestClientSecretBasicAndPost(t *testing.T) {
+	svc := newTestService(t,
+		secretClient(t, "basic", "s3cret", dto.ClientSecretBasic),
+		secretClient(t, "post", "s3cret", dto.ClientSecretPost),
+	)
+	ctx := context.Background()
+
+	c, err := svc.Authenticate(ctx, dto.ClientAuthDTO{ClientID: "basic", ClientSecret: "s3cret", AuthMethod: "client_secret_basic"})
+	require.NoError(t, err)
+	assert.Equal(t, "basic", c.ID)
+
+	_, err = svc.Authenticate(ctx, dto.ClientAuthDTO{ClientID: "basic", ClientSecret: "wrong", AuthMethod: "client_secret_basic"})
+	assert.ErrorIs(t, err, errors.ErrInvalidClient)
+
+	// Registered method is enforced.
+	_, err = svc.Authenticate(ctx, dto.ClientAuthDTO{ClientID: "basic", ClientSecret: "s3cret", AuthMethod: "client_secret_post"})
+	assert.ErrorIs(t, err, errors.ErrInvalidClient)
+
+	_, err = svc.Authenticate(ctx, dto.ClientAuthDTO{ClientID: "post", ClientSecret: "s3cret", AuthMethod: "client_secret_post"})
+	assert.NoError(t, err)
+
+	_, err = svc.Authenticate(ctx, dto.ClientAuthDTO{ClientID: "unknown", ClientSecret: "s3cret", AuthMethod: "client_secret_post"})
+	assert.ErrorIs(t, err, errors.ErrInvalidClient)
+}
+
+func TestSecretRotationWindow(t *testing.T) {
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	now = func() time.Time { return start }
+	defer func() { now = time.Now }()
+
+	client := secretClient(t, "rotating", "old-secret", dto.ClientSecretBasic)
+	newHash, err := store.HashClientSecret("new-secret")
+	require.NoError(t, err)
+	client.Meta.RotateSecret("old", newHash, start, time.Hour)
+
+	svc := newTestService(t, client)
+	ctx := context.Background()
+	auth := func(secret string) error {
+		_, err := svc.Authenticate(ctx, dto.ClientAuthDTO{ClientID: "rotating", ClientSecret: secret, AuthMethod: "client_secret_basic"})
+		return err
+	}
+
+	assert.NoError(t, auth("new-secret"))
+	assert.NoError(t, auth("old-secret"), "old secret is valid during the rotation window")
+
+	now = func() time.Time { return start.Add(2 * time.Hour) }
+	assert.NoError(t, auth("new-secret"))
+	assert.ErrorIs(t, auth("old-secret"), errors.ErrInvalidClient, "old secret expires after the window")
+}
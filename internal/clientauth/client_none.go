@@ -0,0 +1,21 @@
+package clientauth
+
+import (
+	"context"
+
+	"github.com/martencassel/oidcsim/internal/dto"
+	"github.com/martencassel/oidcsim/internal/errors"
+	"github.com/martencassel/oidcsim/internal/store"
+)
+
+type ClientNone struct{}
+
+func (a *ClientNone) Name() string { return string(dto.None) }
+
+func (a *ClientNone) Authenticate(ctx context.Context, client store.Client, req dto.ClientAuthDTO) (*store.Client, error) {
+	// A client that presents a secret must be authenticated with it.
+	if req.ClientSecret != "" {
+		return nil, errors.ErrInvalidClient.WithDescription("client_secret presented by a public client")
+	}
+	return &client, nil
+}
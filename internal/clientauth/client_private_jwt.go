@@ -0,0 +1,62 @@
+package clientauth
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/martencassel/oidcsim/internal/dto"
+	"github.com/martencassel/oidcsim/internal/errors"
+	"github.com/martencassel/oidcsim/internal/store"
+)
+
+// asymmetricAlgs are the signature algorithms accepted for private_key_jwt.
+// HMAC and "none" are excluded so that a client registered for
+// private_key_jwt can never authenticate with a shared secret.
+var asymmetricAlgs = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+type ClientPrivateJWT struct {
+	Config Config
+}
+
+func (a *ClientPrivateJWT) Name() string { return string(dto.PrivateKeyJWT) }
+
+func (a *ClientPrivateJWT) Authenticate(ctx context.Context, client store.Client, req dto.ClientAuthDTO) (*store.Client, error) {
+	if a.Config.Keys == nil {
+		return nil, errors.ErrInvalidClient.WithDescription("private_key_jwt is not configured")
+	}
+	keyFunc := func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		set, err := a.Config.Keys.Resolve(ctx, client, false)
+		if err != nil {
+			return nil, err
+		}
+		keys := set.Find(kid, "sig")
+		if len(keys) == 0 && kid != "" {
+			// The client may have rotated keys since we cached its jwks_uri.
+			if set, err = a.Config.Keys.Resolve(ctx, client, true); err != nil {
+				return nil, err
+			}
+			keys = set.Find(kid, "sig")
+		}
+		verification := jwt.VerificationKeySet{}
+		for _, k := range keys {
+			if k.Alg != "" && k.Alg != token.Method.Alg() {
+				continue
+			}
+			pub, err := k.PublicKey()
+			if err != nil {
+				continue
+			}
+			verification.Keys = append(verification.Keys, pub)
+		}
+		if len(verification.Keys) == 0 {
+			return nil, fmt.Errorf("no registered key matches kid %q", kid)
+		}
+		return verification, nil
+	}
+	if err := verifyAssertion(a.Config, client, req, asymmetricAlgs, keyFunc); err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
@@ -0,0 +1,20 @@
+package clientauth
+
+import (
+	"context"
+
+	"github.com/martencassel/oidcsim/internal/dto"
+	"github.com/martencassel/oidcsim/internal/store"
+)
+
+type ClientSecretBasic struct{}
+
+func (a *ClientSecretBasic) Name() string { return string(dto.ClientSecretBasic) }
+
+func (a *ClientSecretBasic) Authenticate(ctx context.Context, client store.Client, req dto.ClientAuthDTO) (*store.Client, error) {
+	// req.ClientID and req.ClientSecret already URL-decoded from the Authorization header
+	if err := checkSecret(client, req.ClientSecret); err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
@@ -0,0 +1,34 @@
+package clientauth
+
+import (
+	"context"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/martencassel/oidcsim/internal/dto"
+	"github.com/martencassel/oidcsim/internal/errors"
+	"github.com/martencassel/oidcsim/internal/store"
+)
+
+var hmacAlgs = []string{"HS256", "HS384", "HS512"}
+
+// ClientSecretJWT verifies assertions MACed with the client secret. HMAC
+// needs the secret itself, so it is read from store.Client.Secret rather
+// than the hashed ClientMeta secrets.
+type ClientSecretJWT struct {
+	Config Config
+}
+
+func (a *ClientSecretJWT) Name() string { return string(dto.ClientSecretJWT) }
+
+func (a *ClientSecretJWT) Authenticate(ctx context.Context, client store.Client, req dto.ClientAuthDTO) (*store.Client, error) {
+	if client.Secret == "" {
+		return nil, errors.ErrInvalidClient.WithDescription("client has no secret for client_secret_jwt")
+	}
+	keyFunc := func(token *jwt.Token) (interface{}, error) {
+		return []byte(client.Secret), nil
+	}
+	if err := verifyAssertion(a.Config, client, req, hmacAlgs, keyFunc); err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
@@ -0,0 +1,33 @@
+package clientauth
+
+import (
+	"context"
+
+	"github.com/martencassel/oidcsim/internal/dto"
+	"github.com/martencassel/oidcsim/internal/errors"
+	"github.com/martencassel/oidcsim/internal/store"
+)
+
+type ClientSecretPost struct{}
+
+func (a *ClientSecretPost) Name() string { return string(dto.ClientSecretPost) }
+
+func (a *ClientSecretPost) Authenticate(ctx context.Context, client store.Client, req dto.ClientAuthDTO) (*store.Client, error) {
+	// req.ClientID and req.ClientSecret already populated from the form body
+	if err := checkSecret(client, req.ClientSecret); err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+// checkSecret compares the presented secret with every active secret of the
+// client. Hashes are compared in constant time by store.CompareClientSecret.
+func checkSecret(client store.Client, clientSecret string) error {
+	if clientSecret == "" || !client.Meta.HasSecret() {
+		return errors.ErrInvalidClient.WithDescription("client authentication failed")
+	}
+	if !client.Meta.VerifySecret(clientSecret, now()) {
+		return errors.ErrInvalidClient.WithDescription("client authentication failed")
+	}
+	return nil
+}
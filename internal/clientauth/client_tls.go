@@ -0,0 +1,117 @@
+package clientauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"strings"
+
+	"github.com/martencassel/oidcsim/internal/dto"
+	"github.com/martencassel/oidcsim/internal/errors"
+	"github.com/martencassel/oidcsim/internal/store"
+)
+
+// ClientTLSAuth implements PKI mutual-TLS client authentication
+// (RFC 8705 §2.1). The certificate must chain to Roots and carry the subject
+// DN or one of the SANs registered for the client.
+type ClientTLSAuth struct {
+	Roots *x509.CertPool
+}
+
+func (a *ClientTLSAuth) Name() string { return string(dto.TLSClientAuth) }
+
+func (a *ClientTLSAuth) Authenticate(ctx context.Context, client store.Client, req dto.ClientAuthDTO) (*store.Client, error) {
+	cert := req.TLSCert
+	if cert == nil {
+		return nil, errors.ErrInvalidClient.WithDescription("client certificate required")
+	}
+	if a.Roots == nil {
+		return nil, errors.ErrInvalidClient.WithDescription("no trusted CA configured for tls_client_auth")
+	}
+	_, err := cert.Verify(x509.VerifyOptions{
+		Roots:       a.Roots,
+		CurrentTime: now(),
+		KeyUsages:   []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	if err != nil {
+		return nil, errors.ErrInvalidClient.WithDescription("client certificate not trusted: " + err.Error())
+	}
+	if !matchesRegisteredIdentity(client.Meta, cert) {
+		return nil, errors.ErrInvalidClient.WithDescription("client certificate does not match registered subject")
+	}
+	return &client, nil
+}
+
+// matchesRegisteredIdentity compares the certificate with
+// tls_client_auth_subject_dn or any registered SAN value.
+func matchesRegisteredIdentity(meta store.ClientMeta, cert *x509.Certificate) bool {
+	if meta.TLSAuthSubjectDN != "" && normalizeDN(meta.TLSAuthSubjectDN) == normalizeDN(cert.Subject.String()) {
+		return true
+	}
+	for _, want := range meta.TLSSANs {
+		for _, name := range cert.DNSNames {
+			if strings.EqualFold(name, want) {
+				return true
+			}
+		}
+		for _, email := range cert.EmailAddresses {
+			if strings.EqualFold(email, want) {
+				return true
+			}
+		}
+		for _, uri := range cert.URIs {
+			if uri.String() == want {
+				return true
+			}
+		}
+		for _, ip := range cert.IPAddresses {
+			if ip.String() == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// normalizeDN makes "CN=a, O=b" and "CN=a,O=b" compare equal.
+func normalizeDN(dn string) string {
+	parts := strings.Split(dn, ",")
+	for i, p := range parts {
+		parts[i] = strings.TrimSpace(p)
+	}
+	return strings.ToLower(strings.Join(parts, ","))
+}
+
+// ClientSelfSignedTLSAuth implements self-signed certificate mutual-TLS
+// client authentication (RFC 8705 §2.2). No chain is built; the
+// certificate's public key must be one of the keys in the client's JWKS.
+type ClientSelfSignedTLSAuth struct {
+	Keys *JWKSResolver
+}
+
+func (a *ClientSelfSignedTLSAuth) Name() string { return string(dto.SelfSignedTLSAuth) }
+
+func (a *ClientSelfSignedTLSAuth) Authenticate(ctx context.Context, client store.Client, req dto.ClientAuthDTO) (*store.Client, error) {
+	cert := req.TLSCert
+	if cert == nil {
+		return nil, errors.ErrInvalidClient.WithDescription("client certificate required")
+	}
+	if a.Keys == nil {
+		return nil, errors.ErrInvalidClient.WithDescription("self_signed_tls_client_auth is not configured")
+	}
+	set, err := a.Keys.Resolve(ctx, client, false)
+	if err != nil {
+		return nil, errors.ErrInvalidClient.WithDescription(err.Error())
+	}
+	presented, ok := cert.PublicKey.(interface{ Equal(crypto.PublicKey) bool })
+	if !ok {
+		return nil, errors.ErrInvalidClient.WithDescription("unsupported certificate key type")
+	}
+	for _, k := range set.Keys {
+		pub, err := k.PublicKey()
+		if err == nil && presented.Equal(pub) {
+			return &client, nil
+		}
+	}
+	return nil, errors.ErrInvalidClient.WithDescription("client certificate does not match registered keys")
+}
@@ -0,0 +1,146 @@
+package clientauth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/martencassel/oidcsim/internal/dto"
+	"github.com/martencassel/oidcsim/internal/errors"
+	"github.com/martencassel/oidcsim/internal/store"
+	jwksutil "github.com/martencassel/oidcsim/jwskutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newCertificate(t *testing.T, cn string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn, Organization: []string{"oidcsim"}},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		DNSNames:     []string{cn + ".example.com"},
+	}
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert, key
+}
+
+func TestTLSClientAuth(t *testing.T) {
+	ca, caKey := newCertificate(t, "ca", nil, nil)
+	leaf, _ := newCertificate(t, "svc", ca, caKey)
+	stranger, _ := newCertificate(t, "svc", nil, nil)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+
+	cs := store.NewInMemoryClientStore()
+	require.NoError(t, cs.Save(context.Background(), store.Client{
+		ID: "dn",
+		Meta: store.ClientMeta{Enabled: true, ID: "dn", TLSAuthSubjectDN: "CN=svc, O=oidcsim",
+			AllowedAuthMethods: []dto.ClientAuthMethod{dto.TLSClientAuth}},
+	}))
+	require.NoError(t, cs.Save(context.Background(), store.Client{
+		ID: "san",
+		Meta: store.ClientMeta{Enabled: true, ID: "san", TLSSANs: []string{"other.example.com"},
+			AllowedAuthMethods: []dto.ClientAuthMethod{dto.TLSClientAuth}},
+	}))
+	svc := NewService(cs, BuildAuthRegistry(Config{TLSRoots: roots}))
+	ctx := context.Background()
+
+	// The method is inferred from the presented certificate.
+	c, err := svc.Authenticate(ctx, dto.ClientAuthDTO{ClientID: "dn", AuthMethod: string(dto.None), TLSCert: leaf})
+	require.NoError(t, err)
+	assert.Equal(t, "dn", c.ID)
+
+	_, err = svc.Authenticate(ctx, dto.ClientAuthDTO{ClientID: "dn", AuthMethod: string(dto.None), TLSCert: stranger})
+	assert.ErrorIs(t, err, errors.ErrInvalidClient)
+
+	_, err = svc.Authenticate(ctx, dto.ClientAuthDTO{ClientID: "san", AuthMethod: string(dto.None), TLSCert: leaf})
+	assert.ErrorIs(t, err, errors.ErrInvalidClient)
+
+	_, err = svc.Authenticate(ctx, dto.ClientAuthDTO{ClientID: "dn", AuthMethod: string(dto.None)})
+	assert.ErrorIs(t, err, errors.ErrInvalidClient)
+}
+
+func TestSelfSignedTLSClientAuth(t *testing.T) {
+	cert, key := newCertificate(t, "device", nil, nil)
+	other, _ := newCertificate(t, "device", nil, nil)
+	x, y := make([]byte, 32), make([]byte, 32)
+	key.X.FillBytes(x)
+	key.Y.FillBytes(y)
+	raw, err := json.Marshal(jwksutil.JWKS{Keys: []jwksutil.JWK{{
+		Kty: "EC", Use: "sig", Kid: "dev-1", Crv: "P-256",
+		X: base64.RawURLEncoding.EncodeToString(x),
+		Y: base64.RawURLEncoding.EncodeToString(y),
+	}}})
+	require.NoError(t, err)
+
+	svc := newTestService(t, store.Client{
+		ID: "device",
+		Meta: store.ClientMeta{Enabled: true, ID: "device", JWKS: raw,
+			AllowedAuthMethods: []dto.ClientAuthMethod{dto.SelfSignedTLSAuth}},
+	})
+	ctx := context.Background()
+
+	_, err = svc.Authenticate(ctx, dto.ClientAuthDTO{ClientID: "device", AuthMethod: string(dto.None), TLSCert: cert})
+	assert.NoError(t, err)
+
+	_, err = svc.Authenticate(ctx, dto.ClientAuthDTO{ClientID: "device", AuthMethod: string(dto.None), TLSCert: other})
+	assert.ErrorIs(t, err, errors.ErrInvalidClient)
+}
+
+func TestCertificateSourceFromHeader(t *testing.T) {
+	cert, _ := newCertificate(t, "proxied", nil, nil)
+	pemValue := url.QueryEscape(string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})))
+	proxies, err := ParseTrustedProxies([]string{"10.0.0.0/8"})
+	require.NoError(t, err)
+	src := CertificateSource{Header: "X-Client-Cert", TrustedProxies: proxies}
+
+	r := httptest.NewRequest("POST", "/token", nil)
+	r.RemoteAddr = "10.1.2.3:4444"
+	r.Header.Set("X-Client-Cert", pemValue)
+	got, err := src.FromRequest(r)
+	require.NoError(t, err)
+	assert.Equal(t, Thumbprint(cert), Thumbprint(got))
+
+	r.RemoteAddr = "192.0.2.1:4444"
+	_, err = src.FromRequest(r)
+	assert.Error(t, err)
+}
+
+func TestCertificateSourceWithoutTrustedProxies(t *testing.T) {
+	cert, _ := newCertificate(t, "forged", nil, nil)
+	src := CertificateSource{Header: "X-Client-Cert"}
+	assert.Error(t, src.Validate())
+
+	r := httptest.NewRequest("POST", "/token", nil)
+	r.RemoteAddr = "127.0.0.1:4444"
+	r.Header.Set("X-Client-Cert", base64.StdEncoding.EncodeToString(cert.Raw))
+	_, err := src.FromRequest(r)
+	assert.Error(t, err, "no peer may forward a certificate unless listed")
+
+	assert.NoError(t, CertificateSource{}.Validate())
+}
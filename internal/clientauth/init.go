@@ -0,0 +1,25 @@
+package clientauth
+
+import "github.com/martencassel/oidcsim/internal/registry"
+
+func NewRegistry() *registry.Registry[Authenticator] {
+	r := registry.New[Authenticator]()
+	r.Register((&ClientSecretBasic{}).Name(), &ClientSecretBasic{})
+	r.Register((&ClientSecretPost{}).Name(), &ClientSecretPost{})
+	r.Register((&ClientNone{}).Name(), &ClientNone{})
+	return r
+}
+
+// BuildAuthRegistry registers every supported method, including the JWT
+// assertion and mutual-TLS methods configured by cfg. tls_client_auth is
+// only registered when cfg.TLSRoots is set.
+func BuildAuthRegistry(cfg Config) *registry.Registry[Authenticator] {
+	r := NewRegistry()
+	r.Register((&ClientPrivateJWT{}).Name(), &ClientPrivateJWT{Config: cfg})
+	r.Register((&ClientSecretJWT{}).Name(), &ClientSecretJWT{Config: cfg})
+	if cfg.TLSRoots != nil {
+		r.Register((&ClientTLSAuth{}).Name(), &ClientTLSAuth{Roots: cfg.TLSRoots})
+	}
+	r.Register((&ClientSelfSignedTLSAuth{}).Name(), &ClientSelfSignedTLSAuth{Keys: cfg.Keys})
+	return r
+}
@@ -0,0 +1,82 @@
+package clientauth
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/martencassel/oidcsim/internal/store"
+	jwksutil "github.com/martencassel/oidcsim/jwskutil"
+)
+
+// JWKSResolver returns the keys a client registered, either inline
+// (ClientMeta.JWKS) or by reference (ClientMeta.JWKSURI). Fetched sets are
+// cached for ttl.
+type JWKSResolver struct {
+	httpClient *http.Client
+	ttl        time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cachedJWKS
+}
+
+type cachedJWKS struct {
+	set       *jwksutil.JWKS
+	fetchedAt time.Time
+}
+
+func NewJWKSResolver(httpClient *http.Client, ttl time.Duration) *JWKSResolver {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &JWKSResolver{httpClient: httpClient, ttl: ttl, cache: make(map[string]cachedJWKS)}
+}
+
+// Resolve returns the client's key set. refresh bypasses the cache, which
+// callers use once when a kid is not found after a client rotated keys.
+func (r *JWKSResolver) Resolve(ctx context.Context, client store.Client, refresh bool) (*jwksutil.JWKS, error) {
+	if len(client.Meta.JWKS) > 0 {
+		return jwksutil.ParseJWKS(client.Meta.JWKS)
+	}
+	if client.Meta.JWKSURI == "" {
+		return nil, fmt.Errorf("client %s has no registered keys", client.ID)
+	}
+	r.mu.Lock()
+	cached, ok := r.cache[client.Meta.JWKSURI]
+	r.mu.Unlock()
+	if ok && !refresh && now().Sub(cached.fetchedAt) < r.ttl {
+		return cached.set, nil
+	}
+	set, err := r.fetch(ctx, client.Meta.JWKSURI)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	r.cache[client.Meta.JWKSURI] = cachedJWKS{set: set, fetchedAt: now()}
+	r.mu.Unlock()
+	return set, nil
+}
+
+func (r *JWKSResolver) fetch(ctx context.Context, uri string) (*jwksutil.JWKS, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching jwks_uri: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching jwks_uri: unexpected status %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	return jwksutil.ParseJWKS(body)
+}
@@ -0,0 +1,39 @@
+package clientauth
+
+import (
+	"sync"
+	"time"
+)
+
+// ReplayCache remembers assertion identifiers (jti) until they expire so
+// that a client assertion can only be used once (RFC 7523 §3).
+type ReplayCache interface {
+	// Seen records key until expiresAt and reports whether it was
+	// already present.
+	Seen(key string, expiresAt time.Time) bool
+}
+
+type MemoryReplayCache struct {
+	mu      sync.Mutex
+	entries map[string]time.Time
+}
+
+func NewMemoryReplayCache() *MemoryReplayCache {
+	return &MemoryReplayCache{entries: make(map[string]time.Time)}
+}
+
+func (c *MemoryReplayCache) Seen(key string, expiresAt time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := now()
+	for k, exp := range c.entries {
+		if t.After(exp) {
+			delete(c.entries, k)
+		}
+	}
+	if _, ok := c.entries[key]; ok {
+		return true
+	}
+	c.entries[key] = expiresAt
+	return false
+}
@@ -0,0 +1,27 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad_AdminAPIKeysFromEnvironment(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("admin:\n  apiKeys: [from-file]\n"), 0o600))
+	t.Setenv(AdminAPIKeysEnv, " key-a, ,key-b")
+
+	cfg, err := Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"from-file", "key-a", "key-b"}, cfg.Admin.APIKeys)
+}
+
+func TestLoad_ShippedConfigHasNoAdminKeys(t *testing.T) {
+	t.Setenv(AdminAPIKeysEnv, "")
+	cfg, err := Load("../../config.yaml")
+	require.NoError(t, err)
+	assert.Empty(t, cfg.Admin.APIKeys, "a default deployment must not share a known admin key")
+}
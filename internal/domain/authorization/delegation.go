@@ -47,21 +47,19 @@ type ExchangeResult struct {
 	Token Token
 }
 
-type ConsentType string
+// ConsentType and SubjectSelector live with the delegations they describe.
+type (
+	ConsentType     = delegation.ConsentType
+	SubjectSelector = delegation.SubjectSelector
+)
 
 const (
-	ConsentTypeUser  ConsentType = "user"
-	ConsentTypeAdmin ConsentType = "admin"
+	ConsentTypeUser  = delegation.ConsentTypeUser
+	ConsentTypeAdmin = delegation.ConsentTypeAdmin
 )
 
 // type SubjectID string
 
-// type SubjectSelector struct {
-// 	SubjectIDs []SubjectID // explicit list
-// 	GroupIDs   []string    // or group/org identifiers
-// 	AllUsers   bool
-// }
-
 // type DelegationService struct {
 // 	delegations DelegationRepo
 // 	codes       string
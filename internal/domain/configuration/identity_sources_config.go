@@ -4,29 +4,86 @@ import "time"
 
 // IdentitySourceConfig is the configuration for an identity source.
 type IdentitySourceConfig struct {
-	Name         string // Logical name, e.g. "local", "ldap", "oidc"
-	Type         string // Type of source, e.g. "local", "ldap", "oidc"
-	Enabled      bool
-	Priority     int                    // For selection if multiple sources are enabled
-	Settings     map[string]interface{} // Provider-specific settings (host, bindDN, etc)
-	ClaimMapping []ClaimMappingConfig
-	AuthPolicy   AuthPolicyConfig
+	Name         string                 `yaml:"name"` // Logical name, e.g. "local", "ldap", "oidc"
+	Type         string                 `yaml:"type"` // Type of source, e.g. "local", "ldap", "oidc"
+	Enabled      bool                   `yaml:"enabled"`
+	Priority     int                    `yaml:"priority"` // For selection if multiple sources are enabled
+	Settings     map[string]interface{} `yaml:"settings"` // Provider-specific settings (host, bindDN, etc)
+	ClaimMapping []ClaimMappingConfig   `yaml:"claimMapping"`
+	AuthPolicy   AuthPolicyConfig       `yaml:"authPolicy"`
+
+	// ClaimsProviders hold claims of this source's users that live in
+	// other systems. They are released as aggregated or distributed claims.
+	ClaimsProviders []ClaimsProviderConfig `yaml:"claimsProviders"`
+}
+
+// ClaimsProviderConfig is an external claims provider (OIDC Core §5.6.2).
+// Its claims are not copied into tokens: aggregated claims embed a JWT the
+// provider signed, distributed claims reference an endpoint the client
+// calls with the given access token.
+type ClaimsProviderConfig struct {
+	Name        string                 `yaml:"name"`        // key in _claim_sources
+	Type        string                 `yaml:"type"`        // static or http
+	Mode        string                 `yaml:"mode"`        // aggregated (default) or distributed
+	Claims      []string               `yaml:"claims"`      // the claims it provides
+	Scope       string                 `yaml:"scope"`       // scope that releases them; empty releases them with openid
+	Issuer      string                 `yaml:"issuer"`      // iss of aggregated claims; defaults to <issuer>/claims/<name>
+	Endpoint    string                 `yaml:"endpoint"`    // distributed: external endpoint; empty uses this server's claims endpoint
+	AccessToken string                 `yaml:"accessToken"` // distributed: access token for an external endpoint
+	Settings    map[string]interface{} `yaml:"settings"`    // provider-specific: subjects for static, url and token for http
 }
 
 // ClaimMappingConfig defines how source attributes map to internal claims.
+// A rule with only SourceAttr and TargetClaim renames the attribute; Op
+// selects another transformation.
 type ClaimMappingConfig struct {
-	SourceAttr  string // e.g., "mail"
-	TargetClaim string // e.g., "email"
+	SourceAttr  string `yaml:"source" json:"source,omitempty"` // e.g., "mail"
+	TargetClaim string `yaml:"target" json:"target"`           // e.g., "email"
+
+	Op        string            `yaml:"op" json:"op,omitempty"`               // rename (default), copy, constant, default, join, split, regex, map, remove, expr
+	Expr      string            `yaml:"expr" json:"expr,omitempty"`           // for expr; a null result removes the claim
+	Value     interface{}       `yaml:"value" json:"value,omitempty"`         // constant/default value, or the fallback of map
+	Separator string            `yaml:"separator" json:"separator,omitempty"` // for join and split
+	Pattern   string            `yaml:"pattern" json:"pattern,omitempty"`     // for regex; the first group is extracted
+	Table     map[string]string `yaml:"table" json:"table,omitempty"`         // for map
+	Type      string            `yaml:"type" json:"type,omitempty"`           // coerce the result: string, int, float, bool, strings
+	When      *ClaimCondition   `yaml:"when" json:"when,omitempty"`           // apply only when the condition holds
+	Tokens    []string          `yaml:"tokens" json:"tokens,omitempty"`       // id_token, access_token, userinfo; empty means all
+}
+
+// ClaimCondition restricts a mapping rule. Every field that is set must
+// match.
+type ClaimCondition struct {
+	Scope  string      `yaml:"scope" json:"scope,omitempty"`   // scope that must be granted
+	Claim  string      `yaml:"claim" json:"claim,omitempty"`   // claim that must be present
+	Equals interface{} `yaml:"equals" json:"equals,omitempty"` // value Claim must have
+	Expr   string      `yaml:"expr" json:"expr,omitempty"`     // expression that must be true
 }
 
 // AuthPolicyConfig defines authentication rules for this source.
 type AuthPolicyConfig struct {
-	MinACR        bool // Minimum assurance level
-	RequireMFA    bool
-	SessionMaxAge time.Duration // Force re-auth after this time
+	MinACR        bool          `yaml:"minACR"` // Minimum assurance level
+	RequireMFA    bool          `yaml:"requireMFA"`
+	SessionMaxAge time.Duration `yaml:"sessionMaxAge"` // Force re-auth after this time
 }
 
 // IdentitySourcesConfig is the top-level config for all sources.
 type IdentitySourcesConfig struct {
-	Sources []IdentitySourceConfig
+	Sources []IdentitySourceConfig `yaml:"sources"`
+}
+
+// GroupClaimsConfig controls the groups and roles claims released to a
+// client. Without it, groups and roles are released only for the groups
+// and roles scopes, unfiltered.
+type GroupClaimsConfig struct {
+	Groups    bool     `yaml:"groups" json:"groups,omitempty"`        // release groups without the groups scope
+	Format    string   `yaml:"format" json:"format,omitempty"`        // "name" (default) or "id"
+	Prefixes  []string `yaml:"prefixes" json:"prefixes,omitempty"`    // release only groups whose name has one of these prefixes
+	Allow     []string `yaml:"allow" json:"allow,omitempty"`          // release only these groups, by name or ID
+	MaxGroups int      `yaml:"maxGroups" json:"max_groups,omitempty"` // tokens with more groups carry an overage indicator instead; 0 uses the default
+
+	Roles      bool              `yaml:"roles" json:"roles,omitempty"`            // release roles without the roles scope
+	RolePrefix string            `yaml:"rolePrefix" json:"role_prefix,omitempty"` // groups with this prefix are roles, without the prefix
+	RoleMap    map[string]string `yaml:"roleMap" json:"role_map,omitempty"`       // group name -> role
+	AllowRoles []string          `yaml:"allowRoles" json:"allow_roles,omitempty"` // release only these roles
 }
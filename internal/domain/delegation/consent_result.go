@@ -3,4 +3,5 @@ package delegation
 type ConsentResult struct {
 	Decision     ConsentDecision
 	DelegationId string
+	Missing      []string // scopes the user must still consent to when Decision is ConsentDecisionNone
 }
@@ -0,0 +1,89 @@
+package delegation
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"time"
+)
+
+// Constraints narrow when, where and for what a Delegation can be used,
+// e.g. contractor access that only works from office networks during the
+// contract period. Zero values place no restriction.
+type Constraints struct {
+	NotBefore *time.Time
+	NotAfter  *time.Time
+	Audiences []string // token audiences the client may obtain
+	IPCIDRs   []string // networks the client may call from
+	Resources []string // resource indicators (RFC 8707) the client may target
+}
+
+// Use is one use of a Delegation to check against its Constraints. IP
+// and Audience are left empty where they are not known, e.g. the caller
+// of introspection is the resource server, not the client.
+type Use struct {
+	At        time.Time
+	IP        net.IP
+	Audience  string
+	Resources []string
+}
+
+var (
+	ErrOutsideWindow      = errors.New("delegation is not valid at this time")
+	ErrIPNotAllowed       = errors.New("delegation does not allow requests from this network")
+	ErrAudienceNotAllowed = errors.New("delegation does not allow this audience")
+	ErrResourceNotAllowed = errors.New("delegation does not allow this resource")
+)
+
+// IsZero reports whether c places no restriction.
+func (c Constraints) IsZero() bool {
+	return c.NotBefore == nil && c.NotAfter == nil && len(c.Audiences) == 0 && len(c.IPCIDRs) == 0 && len(c.Resources) == 0
+}
+
+// Validate checks that c is well formed.
+func (c Constraints) Validate() error {
+	if c.NotBefore != nil && c.NotAfter != nil && !c.NotBefore.Before(*c.NotAfter) {
+		return fmt.Errorf("not_before must be before not_after")
+	}
+	for _, cidr := range c.IPCIDRs {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return fmt.Errorf("invalid IP range %q", cidr)
+		}
+	}
+	return nil
+}
+
+// Allows checks use against c. Each kind of violation has its own error
+// so callers can tell the client, and their logs, which one it was.
+func (c Constraints) Allows(use Use) error {
+	if c.NotBefore != nil && use.At.Before(*c.NotBefore) {
+		return ErrOutsideWindow
+	}
+	if c.NotAfter != nil && use.At.After(*c.NotAfter) {
+		return ErrOutsideWindow
+	}
+	if len(c.IPCIDRs) > 0 && use.IP != nil && !c.allowsIP(use.IP) {
+		return ErrIPNotAllowed
+	}
+	if len(c.Audiences) > 0 && use.Audience != "" && !slices.Contains(c.Audiences, use.Audience) {
+		return ErrAudienceNotAllowed
+	}
+	if len(c.Resources) > 0 {
+		for _, r := range use.Resources {
+			if !slices.Contains(c.Resources, r) {
+				return ErrResourceNotAllowed
+			}
+		}
+	}
+	return nil
+}
+
+func (c Constraints) allowsIP(ip net.IP) bool {
+	for _, cidr := range c.IPCIDRs {
+		if _, network, err := net.ParseCIDR(cidr); err == nil && network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -2,6 +2,7 @@ package delegation
 
 import (
 	"errors"
+	"slices"
 	"time"
 
 	"github.com/google/uuid"
@@ -21,13 +22,20 @@ type Delegation struct {
 	CreatedAt time.Time
 	RevokedAt *time.Time
 	ExpiresAt *time.Time
+	Remember  bool // the user chose "remember this decision"; otherwise they are asked again
+
+	Constraints    Constraints
+	AdminConsentID string // set when an AdminConsent granted it rather than the user
+
+	// AdminScopes maps the scopes AdminConsents added to a Delegation
+	// someone else granted to the ID of the AdminConsent that added each.
+	AdminScopes map[string]string
 }
 
 // Future
 // ExpiresAt   time.Time       // Optional expiry for time-limited consent
 // RevokedAt   *time.Time      // If revoked, timestamp of revocation
 // Claims      map[string]any  // Optional claims granted (e.g. email, profile)
-// Remember    bool            // Whether user chose "remember this decision"
 // PromptedAt  time.Time       // When the user was last shown a consent screen
 
 func NewDelegation(userID, clientID string, scopes []string) (Delegation, error) {
@@ -53,3 +61,110 @@ func (d Delegation) IsRevoked() bool {
 func (d Delegation) IsExpired(now time.Time) bool {
 	return d.ExpiresAt != nil && now.After(*d.ExpiresAt)
 }
+
+// ConsentType tells whether the user or an administrator granted d.
+func (d Delegation) ConsentType() ConsentType {
+	if d.AdminConsentID != "" {
+		return ConsentTypeAdmin
+	}
+	return ConsentTypeUser
+}
+
+// IsActive reports whether the delegation can still authorize requests.
+func (d Delegation) IsActive(now time.Time) bool {
+	return !d.IsRevoked() && !d.IsExpired(now)
+}
+
+var (
+	ErrRevoked = errors.New("delegation revoked")
+	ErrExpired = errors.New("delegation expired")
+)
+
+// Check reports whether the delegation can be used as use describes: it
+// must be active and its Constraints must allow the use.
+func (d Delegation) Check(use Use) error {
+	if d.IsRevoked() {
+		return ErrRevoked
+	}
+	if d.IsExpired(use.At) {
+		return ErrExpired
+	}
+	return d.Constraints.Allows(use)
+}
+
+// Missing returns the scopes not yet granted, in request order.
+func (d Delegation) Missing(scopes []string) []string {
+	var out []string
+	for _, s := range scopes {
+		if !slices.Contains(d.Scopes, s) && !slices.Contains(out, s) {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// Covers reports whether every one of scopes has been granted.
+func (d Delegation) Covers(scopes []string) bool {
+	return len(d.Missing(scopes)) == 0
+}
+
+// IncludeGrantedScopes returns requested followed by the granted scopes
+// it lacks: the scopes of a request with include_granted_scopes=true,
+// which asks for what is new and receives the combined grant.
+func IncludeGrantedScopes(requested, granted []string) []string {
+	out := slices.Clone(requested)
+	for _, s := range granted {
+		if !slices.Contains(out, s) {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// Merge adds scopes to the grant and reports whether it changed. Scopes an
+// AdminConsent added become the grantor's own, so revoking the
+// AdminConsent no longer takes them away.
+func (d *Delegation) Merge(scopes []string) bool {
+	missing := d.Missing(scopes)
+	d.Scopes = append(d.Scopes, missing...)
+	changed := len(missing) > 0
+	for _, s := range scopes {
+		if _, ok := d.AdminScopes[s]; ok {
+			delete(d.AdminScopes, s)
+			changed = true
+		}
+	}
+	return changed
+}
+
+// MergeAdminScopes adds the scopes an AdminConsent grants and reports
+// whether the grant changed. Only the scopes it adds are recorded as the
+// AdminConsent's.
+func (d *Delegation) MergeAdminScopes(scopes []string, adminConsentID string) bool {
+	missing := d.Missing(scopes)
+	if len(missing) == 0 {
+		return false
+	}
+	if d.AdminScopes == nil {
+		d.AdminScopes = make(map[string]string)
+	}
+	for _, s := range missing {
+		d.AdminScopes[s] = adminConsentID
+	}
+	d.Scopes = append(d.Scopes, missing...)
+	return true
+}
+
+// RemoveAdminScopes takes back the scopes the AdminConsent added and
+// reports whether there were any.
+func (d *Delegation) RemoveAdminScopes(adminConsentID string) bool {
+	var removed []string
+	for s, id := range d.AdminScopes {
+		if id == adminConsentID {
+			removed = append(removed, s)
+			delete(d.AdminScopes, s)
+		}
+	}
+	d.Scopes = slices.DeleteFunc(d.Scopes, func(s string) bool { return slices.Contains(removed, s) })
+	return len(removed) > 0
+}
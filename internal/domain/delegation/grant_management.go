@@ -0,0 +1,50 @@
+package delegation
+
+import (
+	"fmt"
+	"slices"
+)
+
+// GrantManagementAction is how an authorization request asks for its
+// consent to be recorded (FAPI Grant Management §5.4).
+type GrantManagementAction string
+
+const (
+	GrantActionCreate  GrantManagementAction = "create"  // a new grant, replacing the user's grant to the client
+	GrantActionMerge   GrantManagementAction = "merge"   // scopes added to the grant named by grant_id
+	GrantActionReplace GrantManagementAction = "replace" // the grant named by grant_id holds exactly the new scopes
+)
+
+// GrantManagementActions are the actions discovery advertises.
+var GrantManagementActions = []GrantManagementAction{GrantActionCreate, GrantActionMerge, GrantActionReplace}
+
+// ParseGrantManagementAction checks a grant_management_action against
+// the grant_id sent with it. An empty action is the default behaviour:
+// consent is merged into the user's current grant.
+func ParseGrantManagementAction(action, grantID string) (GrantManagementAction, error) {
+	a := GrantManagementAction(action)
+	switch {
+	case a == "":
+		if grantID != "" {
+			return "", fmt.Errorf("grant_id requires grant_management_action")
+		}
+	case !slices.Contains(GrantManagementActions, a):
+		return "", fmt.Errorf("unsupported grant_management_action %q", action)
+	case a == GrantActionCreate && grantID != "":
+		return "", fmt.Errorf("grant_management_action create must not name a grant_id")
+	case a != GrantActionCreate && grantID == "":
+		return "", fmt.Errorf("grant_management_action %s requires grant_id", action)
+	}
+	return a, nil
+}
+
+// Replace sets the granted scopes and reports whether the grant changed.
+// Every scope becomes the grantor's own, as with Merge.
+func (d *Delegation) Replace(scopes []string) bool {
+	if slices.Equal(d.Scopes, scopes) && len(d.AdminScopes) == 0 {
+		return false
+	}
+	d.Scopes = slices.Clone(scopes)
+	d.AdminScopes = nil
+	return true
+}
@@ -15,6 +15,7 @@ type AuthorizeRequest struct {
 	CodeChallenge       string
 	CodeChallengeMethod string
 	Nonce               string
+	GrantID             string // the delegation the consent was recorded in (FAPI Grant Management)
 	// Extra
 	RequiredACR string
 	MaxAge      int64
@@ -1,11 +1,41 @@
 package oidc
 
+import "sort"
+
 var standardScopeClaims = map[string][]string{
 	"openid":  {"sub"},
 	"profile": {"name", "family_name", "given_name", "preferred_username"},
 	"email":   {"email", "email_verified"},
+	"groups":  {"groups"},
+	"roles":   {"roles"},
 }
 
 func ClaimsForScope(scope string) []string {
 	return standardScopeClaims[scope]
 }
+
+// ScopesSupported returns the scopes that map to standard claims, sorted.
+func ScopesSupported() []string {
+	scopes := make([]string, 0, len(standardScopeClaims))
+	for scope := range standardScopeClaims {
+		scopes = append(scopes, scope)
+	}
+	sort.Strings(scopes)
+	return scopes
+}
+
+// ClaimsSupported returns every claim a scope can release, sorted.
+func ClaimsSupported() []string {
+	seen := map[string]bool{}
+	var claims []string
+	for _, names := range standardScopeClaims {
+		for _, name := range names {
+			if !seen[name] {
+				seen[name] = true
+				claims = append(claims, name)
+			}
+		}
+	}
+	sort.Strings(claims)
+	return claims
+}
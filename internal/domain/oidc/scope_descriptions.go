@@ -0,0 +1,21 @@
+package oidc
+
+// scopeDescriptions tell the user on the consent screen what a scope
+// gives the client access to.
+var scopeDescriptions = map[string]string{
+	"openid":         "Sign you in with your account",
+	"profile":        "View your name and username",
+	"email":          "View your email address",
+	"groups":         "View the groups you belong to",
+	"roles":          "View the roles assigned to you",
+	"offline_access": "Keep access to your data while you are not signed in",
+}
+
+// DescribeScope returns the human description of scope, or the scope
+// itself when there is none.
+func DescribeScope(scope string) string {
+	if d, ok := scopeDescriptions[scope]; ok {
+		return d
+	}
+	return scope
+}
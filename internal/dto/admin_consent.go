@@ -0,0 +1,25 @@
+package dto
+
+import "time"
+
+// AdminConsentRequest grants a client consent on behalf of all users, the
+// members of some groups or a list of users.
+type AdminConsentRequest struct {
+	Scopes    []string `json:"scopes" binding:"required"`
+	AllUsers  bool     `json:"all_users,omitempty"`
+	GroupIDs  []string `json:"group_ids,omitempty"`
+	UserIDs   []string `json:"user_ids,omitempty"`
+	GrantedBy string   `json:"granted_by,omitempty"`
+}
+
+// AdminConsentResponse is an admin consent in force.
+type AdminConsentResponse struct {
+	ID        string    `json:"id"`
+	ClientID  string    `json:"client_id"`
+	Scopes    []string  `json:"scopes"`
+	AllUsers  bool      `json:"all_users,omitempty"`
+	GroupIDs  []string  `json:"group_ids,omitempty"`
+	UserIDs   []string  `json:"user_ids,omitempty"`
+	GrantedBy string    `json:"granted_by,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,49 @@
+package dto
+
+import "github.com/martencassel/oidcsim/internal/domain/configuration"
+
+// ClaimDryRunRequest is the body of POST /api/claims/dry-run. It carries
+// either an expression or a list of claim mappings, and the sample input
+// to run them against.
+type ClaimDryRunRequest struct {
+	Expression    string                             `json:"expression,omitempty"`
+	ClaimMappings []configuration.ClaimMappingConfig `json:"claim_mappings,omitempty"`
+	Source        string                             `json:"source,omitempty"` // run this identity source's mappings first
+	Token         string                             `json:"token,omitempty"`  // id_token (default), access_token or userinfo
+
+	Claims map[string]interface{} `json:"claims,omitempty"` // user attributes
+	Value  interface{}            `json:"value,omitempty"`  // the value variable of an expression
+	User   ClaimDryRunUser        `json:"user"`
+	Groups []string               `json:"groups,omitempty"`
+	Client ClaimDryRunClient      `json:"client"`
+	Scopes []string               `json:"scopes,omitempty"`
+	Auth   ClaimDryRunAuth        `json:"auth"`
+}
+
+type ClaimDryRunUser struct {
+	ID       string `json:"id,omitempty"`
+	Username string `json:"username,omitempty"`
+	Email    string `json:"email,omitempty"`
+}
+
+type ClaimDryRunClient struct {
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name,omitempty"`
+}
+
+type ClaimDryRunAuth struct {
+	ACR      string   `json:"acr,omitempty"`
+	AMR      []string `json:"amr,omitempty"`
+	AuthTime int64    `json:"auth_time,omitempty"` // seconds since the epoch
+}
+
+// ClaimDryRunResponse reports the outcome of a dry run. Result, Steps and
+// Memory are set for expressions; Claims and Mapped for claim mappings.
+type ClaimDryRunResponse struct {
+	Result interface{}            `json:"result"`
+	Claims map[string]interface{} `json:"claims,omitempty"`
+	Mapped []string               `json:"mapped,omitempty"` // claims a mapping wrote
+	Errors []string               `json:"errors,omitempty"` // evaluation failures; the rule was skipped
+	Steps  int                    `json:"steps,omitempty"`
+	Memory int                    `json:"memory,omitempty"`
+}
@@ -5,12 +5,18 @@ import "crypto/x509"
 // ClientAuthDTO is the normalized, immutable representation of
 // what the client presented for authentication.
 type ClientAuthDTO struct {
-	ClientID      string
-	ClientSecret  string
-	GrantType     string
-	Scope         []string
-	AuthMethod    string // basic, post, mtls, none
-	TLSCert       *x509.Certificate
-	RawAuthHeader string
-	FormValues    map[string]string
+	ClientID            string
+	ClientSecret        string
+	ClientAssertion     string // JWT for private_key_jwt / client_secret_jwt
+	ClientAssertionType string
+	GrantType           string
+	Scope               []string
+	AuthMethod          string // basic, post, jwt, mtls, none
+	TLSCert             *x509.Certificate
+	RawAuthHeader       string
+	FormValues          map[string]string
 }
+
+// JWTBearerAssertionType is the only client_assertion_type defined for
+// JWT client authentication (RFC 7523 §2.2).
+const JWTBearerAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
@@ -0,0 +1,110 @@
+package dto
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/martencassel/oidcsim/internal/domain/configuration"
+)
+
+// ClientAdminRequest is the body of create and update calls on the client
+// administration API. Field names follow RFC 7591 client metadata.
+type ClientAdminRequest struct {
+	ClientID                string                             `json:"client_id,omitempty"` // generated when empty on create
+	ClientName              string                             `json:"client_name,omitempty"`
+	RedirectURIs            []string                           `json:"redirect_uris,omitempty"`
+	GrantTypes              []string                           `json:"grant_types,omitempty"`
+	Scopes                  []string                           `json:"scopes,omitempty"`
+	TokenEndpointAuthMethod []ClientAuthMethod                 `json:"token_endpoint_auth_methods,omitempty"`
+	Public                  bool                               `json:"public,omitempty"`
+	ResourceServerID        string                             `json:"resource_server_id,omitempty"`
+	JWKSURI                 string                             `json:"jwks_uri,omitempty"`
+	JWKS                    json.RawMessage                    `json:"jwks,omitempty"`
+	TLSClientAuthSubjectDN  string                             `json:"tls_client_auth_subject_dn,omitempty"`
+	TLSClientAuthSANs       []string                           `json:"tls_client_auth_sans,omitempty"`
+	TLSBoundAccessTokens    bool                               `json:"tls_client_certificate_bound_access_tokens,omitempty"`
+	RedirectPolicy          RedirectPolicyDTO                  `json:"redirect_policy"`
+	IDTokenSignedAlg        string                             `json:"id_token_signed_response_alg,omitempty"`
+	UserinfoSignedAlg       string                             `json:"userinfo_signed_response_alg,omitempty"`
+	AccessTokenSignedAlg    string                             `json:"access_token_signed_response_alg,omitempty"`
+	OpaqueAccessTokens      bool                               `json:"opaque_access_tokens,omitempty"`
+	IDTokenEncryptedAlg     string                             `json:"id_token_encrypted_response_alg,omitempty"`
+	IDTokenEncryptedEnc     string                             `json:"id_token_encrypted_response_enc,omitempty"` // defaults to A128CBC-HS256 when alg is set
+	UserinfoEncryptedAlg    string                             `json:"userinfo_encrypted_response_alg,omitempty"`
+	UserinfoEncryptedEnc    string                             `json:"userinfo_encrypted_response_enc,omitempty"` // defaults to A128CBC-HS256 when alg is set
+	ClaimMappings           []configuration.ClaimMappingConfig `json:"claim_mappings,omitempty"`                  // applied after the identity source's mappings
+	GroupClaims             *configuration.GroupClaimsConfig   `json:"group_claims,omitempty"`
+	SubjectType             string                             `json:"subject_type,omitempty"` // public (default) or pairwise
+	SectorIdentifierURI     string                             `json:"sector_identifier_uri,omitempty"`
+	FirstParty              bool                               `json:"first_party,omitempty"` // skip the consent prompt
+	Enabled                 *bool                              `json:"enabled,omitempty"`     // defaults to true on create
+}
+
+// DelegationConstraintsRequest is the body of calls that constrain a
+// delegation: when it is valid, the networks the client may call from and
+// the audiences and resources it may obtain tokens for. Omitted fields
+// place no restriction.
+type DelegationConstraintsRequest struct {
+	NotBefore *time.Time `json:"not_before,omitempty"`
+	NotAfter  *time.Time `json:"not_after,omitempty"`
+	IPCIDRs   []string   `json:"ip_cidrs,omitempty"`
+	Audiences []string   `json:"audiences,omitempty"`
+	Resources []string   `json:"resources,omitempty"`
+}
+
+// RedirectPolicyDTO mirrors store.RedirectURIPolicy.
+type RedirectPolicyDTO struct {
+	Loopback          bool `json:"loopback,omitempty"`
+	PrivateUseSchemes bool `json:"private_use_schemes,omitempty"`
+	ClaimedHTTPS      bool `json:"claimed_https,omitempty"`
+	SimulatorLenient  bool `json:"simulator_lenient,omitempty"`
+}
+
+// ClientAdminResponse describes a registered client. ClientSecret is only
+// set in the response that created the secret; it is never stored in plain
+// text and cannot be read back.
+type ClientAdminResponse struct {
+	ClientID                string                             `json:"client_id"`
+	ClientSecret            string                             `json:"client_secret,omitempty"`
+	ClientName              string                             `json:"client_name,omitempty"`
+	RedirectURIs            []string                           `json:"redirect_uris,omitempty"`
+	GrantTypes              []string                           `json:"grant_types,omitempty"`
+	Scopes                  []string                           `json:"scopes,omitempty"`
+	TokenEndpointAuthMethod []ClientAuthMethod                 `json:"token_endpoint_auth_methods,omitempty"`
+	Public                  bool                               `json:"public,omitempty"`
+	ResourceServerID        string                             `json:"resource_server_id,omitempty"`
+	JWKSURI                 string                             `json:"jwks_uri,omitempty"`
+	JWKS                    json.RawMessage                    `json:"jwks,omitempty"`
+	TLSClientAuthSubjectDN  string                             `json:"tls_client_auth_subject_dn,omitempty"`
+	TLSClientAuthSANs       []string                           `json:"tls_client_auth_sans,omitempty"`
+	TLSBoundAccessTokens    bool                               `json:"tls_client_certificate_bound_access_tokens,omitempty"`
+	RedirectPolicy          RedirectPolicyDTO                  `json:"redirect_policy"`
+	IDTokenSignedAlg        string                             `json:"id_token_signed_response_alg,omitempty"`
+	UserinfoSignedAlg       string                             `json:"userinfo_signed_response_alg,omitempty"`
+	AccessTokenSignedAlg    string                             `json:"access_token_signed_response_alg,omitempty"`
+	OpaqueAccessTokens      bool                               `json:"opaque_access_tokens,omitempty"`
+	IDTokenEncryptedAlg     string                             `json:"id_token_encrypted_response_alg,omitempty"`
+	IDTokenEncryptedEnc     string                             `json:"id_token_encrypted_response_enc,omitempty"`
+	UserinfoEncryptedAlg    string                             `json:"userinfo_encrypted_response_alg,omitempty"`
+	UserinfoEncryptedEnc    string                             `json:"userinfo_encrypted_response_enc,omitempty"`
+	ClaimMappings           []configuration.ClaimMappingConfig `json:"claim_mappings,omitempty"`
+	GroupClaims             *configuration.GroupClaimsConfig   `json:"group_claims,omitempty"`
+	SubjectType             string                             `json:"subject_type,omitempty"`
+	SectorIdentifierURI     string                             `json:"sector_identifier_uri,omitempty"`
+	FirstParty              bool                               `json:"first_party,omitempty"`
+	ActiveSecrets           int                                `json:"active_secrets"`
+	Enabled                 bool                               `json:"enabled"`
+}
+
+// SecretRotationRequest is the body of a secret rotation call. The
+// previous secret keeps working for GracePeriodSeconds.
+type SecretRotationRequest struct {
+	GracePeriodSeconds int64 `json:"grace_period_seconds"`
+}
+
+// ClientJWKSRequest replaces the keys a client authenticates with. Exactly
+// one of JWKSURI and JWKS should be set; setting neither clears both.
+type ClientJWKSRequest struct {
+	JWKSURI string          `json:"jwks_uri,omitempty"`
+	JWKS    json.RawMessage `json:"jwks,omitempty"`
+}
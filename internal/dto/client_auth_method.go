@@ -5,7 +5,9 @@ type ClientAuthMethod string
 const (
 	ClientSecretBasic ClientAuthMethod = "client_secret_basic"
 	ClientSecretPost  ClientAuthMethod = "client_secret_post"
+	ClientSecretJWT   ClientAuthMethod = "client_secret_jwt"
 	PrivateKeyJWT     ClientAuthMethod = "private_key_jwt"
 	TLSClientAuth     ClientAuthMethod = "tls_client_auth"
+	SelfSignedTLSAuth ClientAuthMethod = "self_signed_tls_client_auth"
 	None              ClientAuthMethod = "none"
 )
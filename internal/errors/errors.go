@@ -27,6 +27,10 @@ func (e AuthError) Description() string {
 		return "Client authentication failed (e.g., unknown client, no client authentication included, or unsupported authentication method)."
 	case ErrInvalidGrant:
 		return "The provided authorization grant (e.g., authorization code, resource owner credentials) or refresh token is invalid, expired, revoked, does not match the redirection URI used in the authorization request, or was issued to another client."
+	case ErrInvalidTarget:
+		return "The requested resource is invalid, missing, unknown, or malformed."
+	case ErrInvalidGrantID:
+		return "The grant_id is unknown, revoked, or belongs to another client or user."
 	case ErrUnsupportedGrantType:
 		return "The authorization grant type is not supported by the authorization server."
 	case ErrInvalidToken:
@@ -74,6 +78,16 @@ const (
 	ErrUnsupportedGrantType = AuthError("unsupported_grant_type")
 )
 
+// ===== Resource Indicator Errors (RFC 8707 §2) =====
+const (
+	ErrInvalidTarget = AuthError("invalid_target")
+)
+
+// ===== Grant Management Errors (FAPI Grant Management §5.5) =====
+const (
+	ErrInvalidGrantID = AuthError("invalid_grant_id")
+)
+
 // ===== Resource Server / Introspection Errors (RFC 6750 §3) =====
 const (
 	ErrInvalidToken      = AuthError("invalid_token")
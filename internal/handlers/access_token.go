@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/martencassel/oidcsim/internal/application/claimmapping"
+	"github.com/martencassel/oidcsim/internal/clientauth"
+	"github.com/martencassel/oidcsim/internal/errors"
+	infrasecurity "github.com/martencassel/oidcsim/internal/infrastructure/security"
+	"github.com/martencassel/oidcsim/internal/security"
+	"github.com/martencassel/oidcsim/internal/store"
+)
+
+const accessTokenTTL = time.Hour
+
+// authenticateClient attaches the client certificate, if any, to the
+// request and authenticates the client with the registered method.
+func (ts *TokenServiceController) authenticateClient(r *http.Request, tokenReq *TokenRequest) (*store.Client, error) {
+	cert, err := ts.certs.FromRequest(r)
+	if err != nil {
+		return nil, errors.ErrInvalidClient.WithDescription(err.Error())
+	}
+	tokenReq.TLSCert = cert
+	return ts.clientAuth.Authenticate(r.Context(), tokenReq.ClientAuth())
+}
+
+// issueAccessToken mints an access token. By default it is a JWT
+// (RFC 9068) carrying the claims the claim mappings produce for access
+// tokens; clients registered for opaque tokens get a random reference
+// token instead, which only the token store can resolve. When the client
+// registered for certificate-bound tokens and authenticated over mutual
+// TLS, the token is bound to the certificate with cnf.x5t#S256 (RFC 8705 §3).
+//
+// The token is recorded in the token store, when one is configured, so it
+// can be listed and revoked. subject is the local user ID; the token and
+// its record carry the sub the client sees, which differs for pairwise
+// clients. delegationID links the record to the delegation the token was
+// issued under, so introspection can check it is still in force.
+func (ts *TokenServiceController) issueAccessToken(ctx context.Context, client store.Client, subject, scope, delegationID string, cert *x509.Certificate) (string, error) {
+	now := time.Now()
+	sub := ts.subjects.For(client, subject)
+	aud := accessTokenAudience(client)
+	rec := store.TokenRecord{
+		ID:           uuid.NewString(),
+		ClientID:     client.ID,
+		Subject:      sub,
+		Audience:     aud,
+		Scope:        scope,
+		DelegationID: delegationID,
+		IssuedAt:     now,
+		ExpiresAt:    now.Add(accessTokenTTL),
+	}
+	if client.Meta.TLSBoundTokens && cert != nil {
+		rec.CertThumbprint = clientauth.Thumbprint(cert)
+	}
+
+	var token string
+	if client.Meta.OpaqueAccessTokens {
+		if ts.tokens == nil {
+			return "", fmt.Errorf("opaque access tokens need a token store")
+		}
+		raw, err := infrasecurity.GenerateRandomString(32)
+		if err != nil {
+			return "", err
+		}
+		token = raw
+		rec.ID = store.OpaqueTokenID(raw)
+		rec.Opaque = true
+	} else {
+		claims := jwt.MapClaims{
+			"iss":       ts.issuer,
+			"sub":       sub,
+			"aud":       aud,
+			"client_id": client.ID,
+			"scope":     scope,
+			"iat":       now.Unix(),
+			"exp":       rec.ExpiresAt.Unix(),
+			"jti":       rec.ID,
+		}
+		if ts.idStore != nil {
+			// Mapped claims never replace the registered ones above.
+			if user, err := ts.idStore.GetUser(ctx, subject); err == nil && user != nil {
+				for k, v := range ts.userClaims(ctx, client, user, sub, strings.Fields(scope), claimmapping.TokenAccess) {
+					if _, ok := claims[k]; !ok {
+						claims[k] = v
+					}
+				}
+			}
+		}
+		if rec.CertThumbprint != "" {
+			claims["cnf"] = map[string]string{"x5t#S256": rec.CertThumbprint}
+		}
+		if ts.keys == nil {
+			return "", fmt.Errorf("signing keys not configured")
+		}
+		signed, err := ts.keys.Sign(client.Meta.AccessTokenSignedResponseAlg, claims, "at+jwt")
+		if err != nil {
+			return "", err
+		}
+		token = signed
+	}
+	if ts.tokens != nil {
+		if err := ts.tokens.Save(ctx, rec); err != nil {
+			return "", err
+		}
+	}
+	return token, nil
+}
+
+// accessTokenAudience is the aud of the client's access tokens: its
+// resource server, or the client itself without one.
+func accessTokenAudience(client store.Client) string {
+	if client.ResourceServerID != "" {
+		return client.ResourceServerID
+	}
+	return client.ID
+}
+
+// accessTokens returns the validator for access tokens issued by this
+// controller, JWT or opaque.
+func (ts *TokenServiceController) accessTokens() *infrasecurity.JWTTokenValidator {
+	v := &infrasecurity.JWTTokenValidator{
+		Issuer:     ts.issuer,
+		Algorithms: security.SupportedAlgorithms,
+		Tokens:     ts.tokens,
+		Clients:    ts.clients,
+	}
+	if ts.keys != nil {
+		v.Keyfunc = ts.keys.Keyfunc
+	}
+	return v
+}
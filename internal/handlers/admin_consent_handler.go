@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	stderrors "errors"
+
+	"github.com/gin-gonic/gin"
+
+	delegationapp "github.com/martencassel/oidcsim/internal/application/delegation"
+	"github.com/martencassel/oidcsim/internal/domain/delegation"
+	"github.com/martencassel/oidcsim/internal/dto"
+	"github.com/martencassel/oidcsim/internal/store"
+)
+
+// API Handler for admin consent (tenant-wide pre-authorization)
+//
+// GET    /api/clients/{id}/admin-consents
+// POST   /api/clients/{id}/admin-consents
+// DELETE /api/clients/{id}/admin-consents/{consent}   also revokes the users' grants
+//
+// Every route requires "Authorization: Bearer <admin API key>".
+
+type AdminConsentApiHandler struct {
+	clients     store.ClientStore
+	delegations delegationapp.DelegationService
+	apiKeys     []string
+	g           *gin.RouterGroup
+}
+
+func NewAdminConsentHandler(clients store.ClientStore, delegations delegationapp.DelegationService, apiKeys []string) *AdminConsentApiHandler {
+	return &AdminConsentApiHandler{clients: clients, delegations: delegations, apiKeys: apiKeys}
+}
+
+func (h *AdminConsentApiHandler) RegisterRoutes(rg *gin.Engine) {
+	h.g = rg.Group("/api/clients/:id/admin-consents", RequireAdminKey(h.apiKeys))
+	h.g.GET("", h.handleList)
+	h.g.POST("", h.handleGrant)
+	h.g.DELETE("/:consent", h.handleRevoke)
+}
+
+// lookupClient writes a 404 and returns false when the client does not exist.
+func (h *AdminConsentApiHandler) lookupClient(c *gin.Context) (store.Client, bool) {
+	client, err := h.clients.GetByID(c.Request.Context(), c.Param("id"))
+	if stderrors.Is(err, store.ErrClientNotFound) {
+		c.JSON(404, gin.H{"error": "client not found"})
+		return store.Client{}, false
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return store.Client{}, false
+	}
+	return client, true
+}
+
+func (h *AdminConsentApiHandler) handleList(c *gin.Context) {
+	client, ok := h.lookupClient(c)
+	if !ok {
+		return
+	}
+	consents, err := h.delegations.ListAdminConsents(c.Request.Context(), client.ID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	out := make([]dto.AdminConsentResponse, len(consents))
+	for i, a := range consents {
+		out[i] = toAdminConsentResponse(a)
+	}
+	c.JSON(200, out)
+}
+
+func (h *AdminConsentApiHandler) handleGrant(c *gin.Context) {
+	client, ok := h.lookupClient(c)
+	if !ok {
+		return
+	}
+	var req dto.AdminConsentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	subjects := delegation.SubjectSelector{AllUsers: req.AllUsers, GroupIDs: req.GroupIDs, UserIDs: req.UserIDs}
+	if subjects.IsZero() {
+		c.JSON(400, gin.H{"error": "select all_users, group_ids or user_ids"})
+		return
+	}
+	a, err := h.delegations.GrantAdminConsent(c.Request.Context(), client.ID, req.Scopes, subjects, req.GrantedBy)
+	if stderrors.Is(err, delegation.ErrInvalidAdminConsent) {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(201, toAdminConsentResponse(a))
+}
+
+// handleRevoke revokes one of the client's admin consents. The users it
+// granted access are asked for consent themselves next time.
+func (h *AdminConsentApiHandler) handleRevoke(c *gin.Context) {
+	client, ok := h.lookupClient(c)
+	if !ok {
+		return
+	}
+	consents, err := h.delegations.ListAdminConsents(c.Request.Context(), client.ID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	id := c.Param("consent")
+	found := false
+	for _, a := range consents {
+		found = found || a.ID == id
+	}
+	if !found {
+		c.JSON(404, gin.H{"error": "admin consent not found"})
+		return
+	}
+	if err := h.delegations.RevokeAdminConsent(c.Request.Context(), id); err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(204)
+}
+
+func toAdminConsentResponse(a delegation.AdminConsent) dto.AdminConsentResponse {
+	return dto.AdminConsentResponse{
+		ID:        a.ID,
+		ClientID:  a.ClientID,
+		Scopes:    a.Scopes,
+		AllUsers:  a.Subjects.AllUsers,
+		GroupIDs:  a.Subjects.GroupIDs,
+		UserIDs:   a.Subjects.UserIDs,
+		GrantedBy: a.GrantedBy,
+		CreatedAt: a.CreatedAt,
+	}
+}
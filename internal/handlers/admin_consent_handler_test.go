@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	delegationapp "github.com/martencassel/oidcsim/internal/application/delegation"
+	"github.com/martencassel/oidcsim/internal/dto"
+	delegationinfra "github.com/martencassel/oidcsim/internal/infrastructure/delegation"
+	"github.com/martencassel/oidcsim/internal/store"
+)
+
+func TestAdminConsent_Lifecycle(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	clients := store.NewInMemoryClientStore()
+	require.NoError(t, clients.Save(ctx, store.Client{ID: "app", Meta: store.ClientMeta{Enabled: true}}))
+	require.NoError(t, clients.Save(ctx, store.Client{ID: "other", Meta: store.ClientMeta{Enabled: true}}))
+	repo := delegationinfra.NewMemoryRepo()
+	svc := delegationapp.NewDelegationService(repo, nil, delegationapp.WithAdminConsents(delegationinfra.NewAdminConsentMemoryRepo(), nil))
+	r := gin.New()
+	NewAdminConsentHandler(clients, svc, []string{testAdminKey}).RegisterRoutes(r)
+
+	w := adminRequest(r, http.MethodPost, "/api/clients/app/admin-consents", `{"scopes":["openid"]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "no users selected")
+	w = adminRequest(r, http.MethodPost, "/api/clients/app/admin-consents", `{"scopes":[],"all_users":true}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "no scopes granted")
+	w = adminRequest(r, http.MethodPost, "/api/clients/missing/admin-consents", `{"scopes":["openid"],"all_users":true}`)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = adminRequest(r, http.MethodPost, "/api/clients/app/admin-consents", `{"scopes":["openid","profile"],"all_users":true,"granted_by":"ops"}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created dto.AdminConsentResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.True(t, created.AllUsers)
+	assert.Equal(t, "ops", created.GrantedBy)
+
+	res, err := svc.EnsureConsent(ctx, "alice", "app", []string{"openid"})
+	require.NoError(t, err)
+	assert.Equal(t, delegationapp.ConsentGranted, delegationapp.StatusOf(res.Decision))
+
+	w = adminRequest(r, http.MethodGet, "/api/clients/app/admin-consents", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var list []dto.AdminConsentResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Len(t, list, 1)
+	assert.Equal(t, created.ID, list[0].ID)
+
+	w = adminRequest(r, http.MethodDelete, "/api/clients/other/admin-consents/"+created.ID, "")
+	assert.Equal(t, http.StatusNotFound, w.Code, "admin consents are revoked through their own client")
+	w = adminRequest(r, http.MethodDelete, "/api/clients/app/admin-consents/"+created.ID, "")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	d, err := repo.FindByUserAndClient(ctx, "alice", "app")
+	require.NoError(t, err)
+	assert.Nil(t, d, "the users' grants go with the admin consent")
+	w = adminRequest(r, http.MethodGet, "/api/clients/app/admin-consents", "")
+	assert.JSONEq(t, `[]`, w.Body.String())
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/martencassel/oidcsim/internal/application/claimmapping"
+	"github.com/martencassel/oidcsim/internal/application/claimmapping/expr"
+	"github.com/martencassel/oidcsim/internal/dto"
+)
+
+// API Handler for testing claim mappings
+//
+// POST /api/claims/dry-run  evaluate an expression, or run claim mappings,
+//                           against sample input without issuing a token
+//
+// Every route requires "Authorization: Bearer <admin API key>".
+
+type ClaimMappingAdminApiHandler struct {
+	pipeline *claimmapping.Pipeline
+	apiKeys  []string
+	g        *gin.RouterGroup
+}
+
+func NewClaimMappingAdminHandler(pipeline *claimmapping.Pipeline, apiKeys []string) *ClaimMappingAdminApiHandler {
+	return &ClaimMappingAdminApiHandler{pipeline: pipeline, apiKeys: apiKeys}
+}
+
+func (h *ClaimMappingAdminApiHandler) RegisterRoutes(rg *gin.Engine) {
+	h.g = rg.Group("/api/claims", RequireAdminKey(h.apiKeys))
+	h.g.POST("/dry-run", h.handleDryRun)
+}
+
+// handleDryRun answers 400 when the expression or mappings do not compile,
+// exactly as they would be rejected at configuration load. Evaluation
+// failures are reported in the 200 response.
+func (h *ClaimMappingAdminApiHandler) handleDryRun(c *gin.Context) {
+	var req dto.ClaimDryRunRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if (req.Expression == "") == (len(req.ClaimMappings) == 0 && req.Source == "") {
+		c.JSON(400, gin.H{"error": "provide either expression or claim_mappings"})
+		return
+	}
+	if req.Token == "" {
+		req.Token = claimmapping.TokenID
+	}
+	ctx := claimmapping.Context{
+		Token:  req.Token,
+		Scopes: req.Scopes,
+		User: claimmapping.UserInfo{
+			ID: req.User.ID, Username: req.User.Username, Email: req.User.Email, Source: req.Source,
+		},
+		Groups: req.Groups,
+		Client: claimmapping.ClientInfo{ID: req.Client.ID, Name: req.Client.Name},
+		Auth:   claimmapping.AuthInfo{ACR: req.Auth.ACR, AMR: req.Auth.AMR},
+		Limits: h.pipeline.Limits(),
+	}
+	if req.Auth.AuthTime != 0 {
+		ctx.Auth.AuthTime = time.Unix(req.Auth.AuthTime, 0)
+	}
+	if req.Claims == nil {
+		req.Claims = map[string]interface{}{}
+	}
+
+	if req.Expression != "" {
+		prog, err := expr.Compile(req.Expression, claimmapping.ExprVars)
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		v, stats, err := ctx.Eval(prog, req.Claims, req.Value)
+		resp := dto.ClaimDryRunResponse{Result: v, Steps: stats.Steps, Memory: stats.Memory}
+		if err != nil {
+			resp.Errors = []string{err.Error()}
+		}
+		c.JSON(200, resp)
+		return
+	}
+
+	rules, err := claimmapping.Compile(req.ClaimMappings)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	res := h.pipeline.Apply(claimmapping.Input{
+		Context:     ctx,
+		Source:      req.Source,
+		Attributes:  req.Claims,
+		ClientRules: rules,
+	})
+	resp := dto.ClaimDryRunResponse{Claims: res.Claims}
+	for name := range res.Mapped {
+		resp.Mapped = append(resp.Mapped, name)
+	}
+	sort.Strings(resp.Mapped)
+	for _, err := range res.Errors {
+		resp.Errors = append(resp.Errors, err.Error())
+	}
+	c.JSON(200, resp)
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/martencassel/oidcsim/internal/application/claimmapping"
+	"github.com/martencassel/oidcsim/internal/domain/configuration"
+	"github.com/martencassel/oidcsim/internal/dto"
+)
+
+func newClaimDryRunRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	pipeline, err := claimmapping.NewPipeline([]configuration.IdentitySourceConfig{{
+		Name:         "ldap",
+		ClaimMapping: []configuration.ClaimMappingConfig{{SourceAttr: "mail", TargetClaim: "email"}},
+	}})
+	require.NoError(t, err)
+	r := gin.New()
+	NewClaimMappingAdminHandler(pipeline, []string{testAdminKey}).RegisterRoutes(r)
+	return r
+}
+
+func TestClaimDryRun_Expression(t *testing.T) {
+	r := newClaimDryRunRouter(t)
+
+	w := adminRequest(r, http.MethodPost, "/api/claims/dry-run", `{
+		"expression": "map(filter(groups, g, startsWith(g, \"app-x-\")), g, trimPrefix(g, \"app-x-\"))",
+		"groups": ["app-x-admin", "staff", "app-x-reader"]
+	}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp dto.ClaimDryRunResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, []interface{}{"admin", "reader"}, resp.Result)
+	assert.Empty(t, resp.Errors)
+	assert.Positive(t, resp.Steps)
+
+	w = adminRequest(r, http.MethodPost, "/api/claims/dry-run", `{"expression": "lower(user.nope"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "compile errors are rejected")
+
+	w = adminRequest(r, http.MethodPost, "/api/claims/dry-run", `{"expression": "1 / 0"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Contains(t, resp.Errors[0], "division by zero")
+}
+
+func TestClaimDryRun_Mappings(t *testing.T) {
+	r := newClaimDryRunRouter(t)
+
+	w := adminRequest(r, http.MethodPost, "/api/claims/dry-run", `{
+		"source": "ldap",
+		"claim_mappings": [
+			{"target": "domain", "op": "expr", "expr": "split(claims.email, \"@\")[1]"},
+			{"target": "level", "op": "expr", "expr": "claims.level + 1"}
+		],
+		"claims": {"mail": "alice@example.com", "level": "x"}
+	}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp dto.ClaimDryRunResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "example.com", resp.Claims["domain"])
+	assert.Equal(t, []string{"domain", "email"}, resp.Mapped)
+	assert.Len(t, resp.Errors, 1, "the failing rule is reported and skipped")
+
+	w = adminRequest(r, http.MethodPost, "/api/claims/dry-run", `{"claim_mappings": [{"target": "sub", "op": "constant", "value": 1}]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = adminRequest(r, http.MethodPost, "/api/claims/dry-run", `{}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"context"
+	stderrors "errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/martencassel/oidcsim/internal/application/identitysources"
+	"github.com/martencassel/oidcsim/internal/errors"
+	"github.com/martencassel/oidcsim/internal/identity"
+	"github.com/martencassel/oidcsim/internal/security"
+	"github.com/martencassel/oidcsim/internal/store"
+)
+
+// claimSourceTokenTTL bounds the access tokens handed out with
+// distributed claims served by this server.
+const claimSourceTokenTTL = time.Hour
+
+func claimSourceRoute(base string) string {
+	if base == "" {
+		return ""
+	}
+	return strings.TrimSuffix(base, "/") + "/:provider"
+}
+
+// claimSourceEndpoint returns the URL of this server's distributed claims
+// endpoint for the named provider, or "" when it is not served.
+func (ts *TokenServiceController) claimSourceEndpoint(name string) string {
+	if ts.routesConfig == nil {
+		return ""
+	}
+	route := claimSourceRoute(ts.routesConfig.Claims)
+	if route == "" || !ts.served[route] {
+		return ""
+	}
+	return ts.issuer + strings.TrimSuffix(ts.routesConfig.Claims, "/") + "/" + name
+}
+
+// externalClaims adds the claims of the user's external claims providers
+// to claims as aggregated or distributed claims (OIDC Core §5.6.2).
+// Providers that fail are left out so the rest of the response survives.
+func (ts *TokenServiceController) externalClaims(ctx context.Context, client store.Client, user identity.UserIdentity, sub string, scopes []string, claims map[string]interface{}) {
+	for _, src := range ts.claimSources.For(user.GetSource()) {
+		cfg := src.Config
+		if cfg.Scope != "" && !slices.Contains(scopes, cfg.Scope) {
+			continue
+		}
+		for _, name := range cfg.Claims {
+			delete(claims, name)
+		}
+		var err error
+		if src.Distributed() {
+			err = ts.distributedClaims(client, sub, src, claims)
+		} else {
+			err = ts.aggregatedClaims(ctx, client, user, sub, src, claims)
+		}
+		if err != nil {
+			log.Warnf("Claims provider %s for client %s: %v", cfg.Name, client.ID, err)
+		}
+	}
+}
+
+// aggregatedClaims embeds the provider's claims in a JWT signed on its
+// behalf with this server's keys.
+func (ts *TokenServiceController) aggregatedClaims(ctx context.Context, client store.Client, user identity.UserIdentity, sub string, src identitysources.ClaimSource, claims map[string]interface{}) error {
+	values, err := src.Claims(ctx, user.GetID())
+	if err != nil {
+		return err
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	if ts.keys == nil {
+		return stderrors.New("signing keys not configured")
+	}
+	iss := src.Config.Issuer
+	if iss == "" {
+		iss = ts.issuer + "/claims/" + src.Config.Name
+	}
+	body := jwt.MapClaims{"iss": iss, "sub": sub, "aud": client.ID, "iat": time.Now().Unix()}
+	names := make([]string, 0, len(values))
+	for name, v := range values {
+		body[name] = v
+		names = append(names, name)
+	}
+	signed, err := ts.keys.Sign("", body, "JWT")
+	if err != nil {
+		return err
+	}
+	addClaimSource(claims, src.Config.Name, names, map[string]interface{}{"JWT": signed})
+	return nil
+}
+
+// distributedClaims references the provider's endpoint. Providers served
+// by this server get a short-lived access token bound to the endpoint.
+func (ts *TokenServiceController) distributedClaims(client store.Client, sub string, src identitysources.ClaimSource, claims map[string]interface{}) error {
+	endpoint, token := src.Config.Endpoint, src.Config.AccessToken
+	if endpoint == "" {
+		endpoint = ts.claimSourceEndpoint(src.Config.Name)
+		if endpoint == "" {
+			return stderrors.New("no claims endpoint is served")
+		}
+		if ts.keys == nil {
+			return stderrors.New("signing keys not configured")
+		}
+		now := time.Now()
+		var err error
+		token, err = ts.keys.Sign("", jwt.MapClaims{
+			"iss":       ts.issuer,
+			"sub":       sub,
+			"aud":       endpoint,
+			"client_id": client.ID,
+			"iat":       now.Unix(),
+			"exp":       now.Add(claimSourceTokenTTL).Unix(),
+		}, "at+jwt")
+		if err != nil {
+			return err
+		}
+	}
+	source := map[string]interface{}{"endpoint": endpoint}
+	if token != "" {
+		source["access_token"] = token
+	}
+	addClaimSource(claims, src.Config.Name, src.Config.Claims, source)
+	return nil
+}
+
+// addClaimSource records names as served by source under the
+// _claim_names and _claim_sources members of claims.
+func addClaimSource(claims map[string]interface{}, source string, names []string, ref map[string]interface{}) {
+	claimNames, _ := claims["_claim_names"].(map[string]string)
+	if claimNames == nil {
+		claimNames = map[string]string{}
+		claims["_claim_names"] = claimNames
+	}
+	sources, _ := claims["_claim_sources"].(map[string]interface{})
+	if sources == nil {
+		sources = map[string]interface{}{}
+		claims["_claim_sources"] = sources
+	}
+	for _, name := range names {
+		claimNames[name] = source
+	}
+	sources[source] = ref
+}
+
+// ClaimSourceHandler serves the claims of a distributed claims provider
+// to the holder of the access token issued alongside the reference.
+func (ts *TokenServiceController) ClaimSourceHandler(c *gin.Context) {
+	raw, err := bearerToken(c.Request)
+	if err != nil || raw == "" {
+		writeBearerError(c.Writer, err)
+		return
+	}
+	name := c.Param("provider")
+	src, ok := ts.claimSources.Lookup(name)
+	if !ok || !src.Distributed() || src.Config.Endpoint != "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown claims provider"})
+		return
+	}
+	if ts.keys == nil {
+		writeBearerError(c.Writer, errors.ErrServerError.WithDescription("signing keys not configured"))
+		return
+	}
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(raw, claims, ts.keys.Keyfunc,
+		jwt.WithIssuer(ts.issuer),
+		jwt.WithAudience(ts.claimSourceEndpoint(name)),
+		jwt.WithExpirationRequired(),
+		jwt.WithValidMethods(security.SupportedAlgorithms))
+	if err != nil {
+		writeBearerError(c.Writer, errors.ErrInvalidToken.WithDescription("access token is invalid or expired"))
+		return
+	}
+	sub, _ := claims.GetSubject()
+	clientID, _ := claims["client_id"].(string)
+	ctx := c.Request.Context()
+	local, ok := ts.localSubject(ctx, ts.tokenClient(ctx, clientID), sub)
+	if !ok {
+		writeBearerError(c.Writer, errors.ErrInvalidToken.WithDescription("the token's subject no longer exists"))
+		return
+	}
+	values, err := src.Claims(ctx, local)
+	if err != nil {
+		log.Errorf("Claims provider %s: %v", name, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "claims provider unavailable"})
+		return
+	}
+	values["sub"] = sub
+	c.JSON(http.StatusOK, values)
+}
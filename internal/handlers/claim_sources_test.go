@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/martencassel/oidcsim/internal/application/identitysources"
+	"github.com/martencassel/oidcsim/internal/domain/configuration"
+	"github.com/martencassel/oidcsim/internal/identity"
+)
+
+func newClaimSourcesFixture(t *testing.T) *userInfoFixture {
+	t.Helper()
+	f := newUserInfoFixture(t, userInfoClient)
+	require.NoError(t, f.ts.idStore.AddUser(context.Background(), &identity.User{
+		ID: "alice", Username: "alice", Email: "alice@example.com", Source: "local",
+	}))
+	subjects := map[string]interface{}{"alice": map[string]interface{}{
+		"department": "Engineering", "salary_band": "E5", "secret": "not listed",
+	}}
+	cs, err := identitysources.NewClaimSources([]configuration.IdentitySourceConfig{{
+		Name: "local",
+		ClaimsProviders: []configuration.ClaimsProviderConfig{
+			{Name: "hr", Type: "static", Scope: "hr", Claims: []string{"department"}, Settings: map[string]interface{}{"subjects": subjects}},
+			{Name: "payroll", Type: "static", Mode: "distributed", Claims: []string{"salary_band"}, Settings: map[string]interface{}{"subjects": subjects}},
+		},
+	}})
+	require.NoError(t, err)
+	f.ts.claimSources = cs
+	f.ts.routesConfig.Claims = "/claims"
+	f.router = gin.New()
+	f.ts.RegisterRoutes(f.router)
+	return f
+}
+
+func (f *userInfoFixture) userinfo(t *testing.T, token string) map[string]interface{} {
+	t.Helper()
+	w := f.get(token, "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var claims map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &claims))
+	return claims
+}
+
+func TestUserInfo_AggregatedClaims(t *testing.T) {
+	f := newClaimSourcesFixture(t)
+
+	claims := f.userinfo(t, f.issue(t, "app", "openid hr"))
+	names, _ := claims["_claim_names"].(map[string]interface{})
+	assert.Equal(t, "hr", names["department"])
+	assert.NotContains(t, claims, "department", "aggregated claims are not copied")
+	sources, _ := claims["_claim_sources"].(map[string]interface{})
+	hr, _ := sources["hr"].(map[string]interface{})
+	signed, _ := hr["JWT"].(string)
+	require.NotEmpty(t, signed)
+
+	agg := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(signed, agg, f.keys.Keyfunc)
+	require.NoError(t, err, "aggregated claims are signed with the server's keys")
+	assert.Equal(t, "Engineering", agg["department"])
+	assert.Equal(t, "https://idp.test/claims/hr", agg["iss"])
+	assert.Equal(t, "alice", agg["sub"])
+	assert.NotContains(t, agg, "secret", "only the listed claims are released")
+
+	claims = f.userinfo(t, f.issue(t, "app", "openid"))
+	names, _ = claims["_claim_names"].(map[string]interface{})
+	assert.NotContains(t, names, "department", "the hr scope releases the provider")
+}
+
+func TestUserInfo_DistributedClaims(t *testing.T) {
+	f := newClaimSourcesFixture(t)
+	token := f.issue(t, "app", "openid")
+
+	claims := f.userinfo(t, token)
+	names, _ := claims["_claim_names"].(map[string]interface{})
+	assert.Equal(t, "payroll", names["salary_band"])
+	sources, _ := claims["_claim_sources"].(map[string]interface{})
+	payroll, _ := sources["payroll"].(map[string]interface{})
+	assert.Equal(t, "https://idp.test/claims/payroll", payroll["endpoint"])
+	sourceToken, _ := payroll["access_token"].(string)
+	require.NotEmpty(t, sourceToken)
+
+	fetch := func(bearer string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/claims/payroll", nil)
+		req.Header.Set("Authorization", "Bearer "+bearer)
+		w := httptest.NewRecorder()
+		f.router.ServeHTTP(w, req)
+		return w
+	}
+	w := fetch(sourceToken)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.JSONEq(t, `{"sub":"alice","salary_band":"E5"}`, w.Body.String())
+
+	assert.Equal(t, http.StatusUnauthorized, fetch(token).Code, "the userinfo access token is not valid at the claims endpoint")
+}
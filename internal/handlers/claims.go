@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"context"
+	"slices"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/martencassel/oidcsim/internal/application/claimmapping"
+	"github.com/martencassel/oidcsim/internal/domain/configuration"
+	"github.com/martencassel/oidcsim/internal/domain/oidc"
+	"github.com/martencassel/oidcsim/internal/identity"
+	"github.com/martencassel/oidcsim/internal/store"
+)
+
+// userClaims returns the claims about user released to client in the given
+// token kind. The user's attributes go through the identity source's and
+// the client's claim mappings first. Standard claims are released by
+// scope (OIDC Core §5.4); other claims only when a mapping produced them,
+// so raw source attributes never leak.
+//
+// ID tokens and userinfo get both; access tokens carry only mapped claims.
+// Groups and roles are the exception: see groupClaims. Claims of external
+// providers are referenced, not copied: see externalClaims.
+func (ts *TokenServiceController) userClaims(ctx context.Context, client store.Client, user identity.UserIdentity, subject string, scopes []string, token string) map[string]interface{} {
+	attrs := map[string]interface{}{}
+	for k, v := range user.GetClaims() {
+		attrs[k] = v
+	}
+	if _, ok := attrs["preferred_username"]; !ok && user.GetUsername() != "" {
+		attrs["preferred_username"] = user.GetUsername()
+	}
+	if _, ok := attrs["email"]; !ok && user.GetEmail() != "" {
+		attrs["email"] = user.GetEmail()
+	}
+
+	rules, err := claimmapping.Compile(client.Meta.ClaimMappings)
+	if err != nil {
+		// Mappings are validated on registration; skip them rather than
+		// fail the request if an invalid one slipped through.
+		log.Errorf("Invalid claim mappings for client %s: %v", client.ID, err)
+		rules = nil
+	}
+	memberships := ts.userGroups(ctx, user)
+	policy := client.Meta.GroupClaims
+	attrs["groups"] = claimmapping.GroupValues(memberships, policy)
+	attrs["roles"] = claimmapping.RoleValues(memberships, policy)
+	var groups []string
+	for _, g := range memberships {
+		groups = append(groups, g.Name)
+	}
+	res := ts.claimMapping.Apply(claimmapping.Input{
+		Context: claimmapping.Context{
+			Token:  token,
+			Scopes: scopes,
+			User: claimmapping.UserInfo{
+				ID: user.GetID(), Username: user.GetUsername(), Email: user.GetEmail(), Source: user.GetSource(),
+			},
+			Groups: groups,
+			Client: claimmapping.ClientInfo{ID: client.ID, Name: client.Name},
+		},
+		Source:      user.GetSource(),
+		Attributes:  attrs,
+		ClientRules: rules,
+	})
+	for _, err := range res.Errors {
+		log.Warnf("Claim mapping for client %s, user %s: %v", client.ID, subject, err)
+	}
+
+	standard := oidc.ClaimsSupported()
+	claims := map[string]interface{}{"sub": subject}
+	if token != claimmapping.TokenAccess {
+		for _, scope := range scopes {
+			for _, name := range oidc.ClaimsForScope(scope) {
+				if v, ok := res.Claims[name]; ok && name != "sub" {
+					claims[name] = v
+				}
+			}
+		}
+	}
+	for name := range res.Mapped {
+		if slices.Contains(standard, name) && !scopeReleases(scopes, name) {
+			continue
+		}
+		claims[name] = res.Claims[name]
+	}
+	ts.groupClaims(claims, res.Claims, policy, scopes, token)
+	if token != claimmapping.TokenAccess {
+		ts.externalClaims(ctx, client, user, subject, scopes, claims)
+	}
+	return claims
+}
+
+// groupClaims releases the groups and roles claims, in every token kind,
+// when the client's policy or a granted scope asks for them. A token whose
+// groups exceed the policy's limit carries an overage indicator instead:
+// a distributed claim pointing at userinfo (OIDC Core §5.6.2), which
+// always returns the full list, or hasgroups when userinfo is not served.
+func (ts *TokenServiceController) groupClaims(claims, mapped map[string]interface{}, policy configuration.GroupClaimsConfig, scopes []string, token string) {
+	delete(claims, "groups")
+	delete(claims, "roles")
+	if policy.Roles || slices.Contains(scopes, "roles") {
+		if roles, ok := mapped["roles"]; ok && !isEmptyList(roles) {
+			claims["roles"] = roles
+		}
+	}
+	if !policy.Groups && !slices.Contains(scopes, "groups") {
+		return
+	}
+	groups, ok := mapped["groups"]
+	if !ok || isEmptyList(groups) {
+		return
+	}
+	if token == claimmapping.TokenUserinfo || listLen(groups) <= claimmapping.MaxGroups(policy) {
+		claims["groups"] = groups
+		return
+	}
+	var endpoint string
+	if ts.routesConfig != nil {
+		endpoint = ts.endpoint(ts.routesConfig.Userinfo)
+	}
+	if endpoint != "" {
+		addClaimSource(claims, "src1", []string{"groups"}, map[string]interface{}{"endpoint": endpoint})
+		return
+	}
+	claims["hasgroups"] = true
+}
+
+// userGroups returns the user's group memberships, resolved against the
+// identity store so that group claims are current.
+func (ts *TokenServiceController) userGroups(ctx context.Context, user identity.UserIdentity) []claimmapping.Group {
+	stored := map[string]*identity.Group{}
+	if ts.idStore != nil {
+		found, err := ts.idStore.GetUserGroups(ctx, user.GetID())
+		if err != nil {
+			log.Warnf("Failed to get groups of user %s: %v", user.GetID(), err)
+		}
+		for _, g := range found {
+			if g != nil {
+				stored[g.ID] = g
+			}
+		}
+	}
+	var groups []claimmapping.Group
+	for _, m := range user.GetGroups() {
+		g := claimmapping.Group{ID: m.GetID(), Name: m.GetName(), Claims: m.GetClaims()}
+		if s, ok := stored[m.GetID()]; ok {
+			g = claimmapping.Group{ID: s.ID, Name: s.Name, Claims: s.Claims}
+		}
+		groups = append(groups, g)
+	}
+	return groups
+}
+
+func listLen(v interface{}) int {
+	switch l := v.(type) {
+	case []string:
+		return len(l)
+	case []interface{}:
+		return len(l)
+	}
+	return 1
+}
+
+func isEmptyList(v interface{}) bool {
+	return v == nil || listLen(v) == 0
+}
+
+// scopeReleases reports whether one of scopes releases the standard claim.
+func scopeReleases(scopes []string, claim string) bool {
+	for _, scope := range scopes {
+		if slices.Contains(oidc.ClaimsForScope(scope), claim) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/martencassel/oidcsim/internal/domain/configuration"
+	"github.com/martencassel/oidcsim/internal/identity"
+	"github.com/martencassel/oidcsim/internal/store"
+)
+
+func TestClaimMapping_AppliedToUserinfoAndAccessToken(t *testing.T) {
+	client := store.Client{ID: "app", Meta: store.ClientMeta{Enabled: true, ClaimMappings: []configuration.ClaimMappingConfig{
+		{SourceAttr: "name", TargetClaim: "display_name", Op: "copy"},
+		{TargetClaim: "tenant", Op: "constant", Value: "acme", Tokens: []string{"access_token"}},
+		{SourceAttr: "email", TargetClaim: "upn", Op: "copy"},
+	}}}
+	f := newUserInfoFixture(t, client)
+	token := f.issue(t, "app", "openid email")
+
+	w := f.get(token, "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var claims map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &claims))
+	assert.Equal(t, "Alice Liddell", claims["display_name"], "mapped claims are released")
+	assert.Equal(t, "alice@example.com", claims["upn"])
+	assert.NotContains(t, claims, "name", "standard claims still need their scope")
+	assert.NotContains(t, claims, "tenant", "rule is limited to access tokens")
+
+	at := jwt.MapClaims{}
+	_, _, err := jwt.NewParser().ParseUnverified(token, at)
+	require.NoError(t, err)
+	assert.Equal(t, "acme", at["tenant"])
+	assert.Equal(t, "Alice Liddell", at["display_name"])
+	assert.NotContains(t, at, "email", "access tokens carry only mapped claims")
+	assert.Equal(t, "alice", at["sub"])
+}
+
+func TestClientAdmin_ValidatesClaimMappings(t *testing.T) {
+	r, _, _ := newAdminRouter(t)
+
+	w := adminRequest(r, http.MethodPost, "/api/clients",
+		`{"client_id":"bad","claim_mappings":[{"source":"uid","target":"sub"}]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "registered claims cannot be mapped")
+
+	w = adminRequest(r, http.MethodPost, "/api/clients",
+		`{"client_id":"app","claim_mappings":[{"source":"mail","target":"email"}]}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), `"claim_mappings":[{"source":"mail","target":"email"}]`)
+}
+
+func addGroups(t *testing.T, f *userInfoFixture, groups ...*identity.Group) {
+	t.Helper()
+	ctx := context.Background()
+	for _, g := range groups {
+		_, err := f.ts.idStore.AddGroup(ctx, g)
+		require.NoError(t, err)
+		require.NoError(t, f.ts.idStore.AddGroupMember(ctx, g.ID, "alice"))
+	}
+}
+
+func accessTokenClaims(t *testing.T, token string) jwt.MapClaims {
+	t.Helper()
+	claims := jwt.MapClaims{}
+	_, _, err := jwt.NewParser().ParseUnverified(token, claims)
+	require.NoError(t, err)
+	return claims
+}
+
+func TestGroupClaims_FilteredPerClient(t *testing.T) {
+	client := store.Client{ID: "app", Meta: store.ClientMeta{Enabled: true, GroupClaims: configuration.GroupClaimsConfig{
+		Prefixes:   []string{"app-x-"},
+		RolePrefix: "app-x-role-",
+		RoleMap:    map[string]string{"staff": "employee"},
+	}}}
+	f := newUserInfoFixture(t, client)
+	addGroups(t, f,
+		&identity.Group{ID: "g1", Name: "app-x-readers"},
+		&identity.Group{ID: "g2", Name: "app-x-role-admin"},
+		&identity.Group{ID: "g3", Name: "staff", Claims: map[string]interface{}{"roles": []interface{}{"auditor"}}},
+		&identity.Group{ID: "g4", Name: "app-y-writers"},
+	)
+
+	at := accessTokenClaims(t, f.issue(t, "app", "openid"))
+	assert.NotContains(t, at, "groups", "groups need the groups scope or the client policy")
+	assert.NotContains(t, at, "roles")
+
+	token := f.issue(t, "app", "openid groups roles")
+	at = accessTokenClaims(t, token)
+	assert.Equal(t, []interface{}{"app-x-readers", "app-x-role-admin"}, at["groups"])
+	assert.Equal(t, []interface{}{"admin", "auditor", "employee"}, at["roles"])
+
+	w := f.get(token, "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var claims map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &claims))
+	assert.Equal(t, []interface{}{"app-x-readers", "app-x-role-admin"}, claims["groups"])
+}
+
+func TestGroupClaims_IDsAndAllowlist(t *testing.T) {
+	client := store.Client{ID: "app", Meta: store.ClientMeta{Enabled: true, GroupClaims: configuration.GroupClaimsConfig{
+		Groups: true, Format: "id", Allow: []string{"g1", "ops"},
+		Roles: true, RoleMap: map[string]string{"ops": "operator", "dev": "developer"}, AllowRoles: []string{"operator"},
+	}}}
+	f := newUserInfoFixture(t, client)
+	addGroups(t, f,
+		&identity.Group{ID: "g1", Name: "dev"},
+		&identity.Group{ID: "g2", Name: "ops"},
+		&identity.Group{ID: "g3", Name: "sales"},
+	)
+	at := accessTokenClaims(t, f.issue(t, "app", "openid"))
+	assert.Equal(t, []interface{}{"g1", "g2"}, at["groups"], "the policy releases groups without the scope")
+	assert.Equal(t, []interface{}{"operator"}, at["roles"])
+}
+
+func TestGroupClaims_Overage(t *testing.T) {
+	client := store.Client{ID: "app", Meta: store.ClientMeta{Enabled: true, GroupClaims: configuration.GroupClaimsConfig{MaxGroups: 3}}}
+	f := newUserInfoFixture(t, client)
+	var groups []*identity.Group
+	for i := 0; i < 5; i++ {
+		groups = append(groups, &identity.Group{ID: fmt.Sprintf("g%d", i), Name: fmt.Sprintf("group-%d", i)})
+	}
+	addGroups(t, f, groups...)
+
+	token := f.issue(t, "app", "openid groups")
+	at := accessTokenClaims(t, token)
+	assert.NotContains(t, at, "groups")
+	assert.Equal(t, map[string]interface{}{"groups": "src1"}, at["_claim_names"])
+	assert.Equal(t, map[string]interface{}{"src1": map[string]interface{}{"endpoint": "https://idp.test/userinfo"}}, at["_claim_sources"])
+
+	w := f.get(token, "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var claims map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &claims))
+	assert.Len(t, claims["groups"], 5, "userinfo returns the full list")
+	assert.NotContains(t, claims, "_claim_names")
+}
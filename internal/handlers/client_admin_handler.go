@@ -0,0 +1,660 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	stderrors "errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/martencassel/oidcsim/internal/application/claimmapping"
+	delegationapp "github.com/martencassel/oidcsim/internal/application/delegation"
+	"github.com/martencassel/oidcsim/internal/application/subject"
+	"github.com/martencassel/oidcsim/internal/domain/configuration"
+	"github.com/martencassel/oidcsim/internal/domain/delegation"
+	"github.com/martencassel/oidcsim/internal/dto"
+	"github.com/martencassel/oidcsim/internal/security"
+	"github.com/martencassel/oidcsim/internal/store"
+	jwksutil "github.com/martencassel/oidcsim/jwskutil"
+)
+
+// API Handler for client administration
+//
+// GET    /api/clients
+// POST   /api/clients
+// GET    /api/clients/{id}
+// PUT    /api/clients/{id}
+// DELETE /api/clients/{id}
+// POST   /api/clients/{id}/disable
+// POST   /api/clients/{id}/enable
+// POST   /api/clients/{id}/secrets          rotate the client secret
+// GET    /api/clients/{id}/jwks
+// PUT    /api/clients/{id}/jwks
+// GET    /api/clients/{id}/delegations
+// PUT    /api/clients/{id}/delegations/{delegation}/constraints
+// GET    /api/clients/{id}/tokens
+//
+// Every route requires "Authorization: Bearer <admin API key>".
+
+type ClientAdminApiHandler struct {
+	clients     store.ClientStore
+	tokens      store.TokenStore
+	refreshes   store.RefreshTokenStore
+	delegations delegationapp.Repository
+	keys        *security.KeyManager // signing algorithms clients may register
+	sectors     *subject.SectorValidator
+	apiKeys     []string
+	g           *gin.RouterGroup
+}
+
+func NewClientAdminHandler(clients store.ClientStore, tokens store.TokenStore, refreshes store.RefreshTokenStore, delegations delegationapp.Repository, keys *security.KeyManager, apiKeys []string) *ClientAdminApiHandler {
+	return &ClientAdminApiHandler{
+		clients:     clients,
+		tokens:      tokens,
+		refreshes:   refreshes,
+		delegations: delegations,
+		keys:        keys,
+		sectors:     subject.NewSectorValidator(nil),
+		apiKeys:     apiKeys,
+	}
+}
+
+func (h *ClientAdminApiHandler) RegisterRoutes(rg *gin.Engine) {
+	h.g = rg.Group("/api/clients", RequireAdminKey(h.apiKeys))
+	h.g.GET("", h.handleListClients)
+	h.g.POST("", h.handleCreateClient)
+	h.g.GET("/:id", h.handleGetClient)
+	h.g.PUT("/:id", h.handleUpdateClient)
+	h.g.DELETE("/:id", h.handleDeleteClient)
+	h.g.POST("/:id/disable", h.handleSetEnabled(false))
+	h.g.POST("/:id/enable", h.handleSetEnabled(true))
+	h.g.POST("/:id/secrets", h.handleRotateSecret)
+	h.g.GET("/:id/jwks", h.handleGetJWKS)
+	h.g.PUT("/:id/jwks", h.handleSetJWKS)
+	h.g.GET("/:id/delegations", h.handleListDelegations)
+	h.g.PUT("/:id/delegations/:delegation/constraints", h.handleSetDelegationConstraints)
+	h.g.GET("/:id/tokens", h.handleListTokens)
+}
+
+// RequireAdminKey rejects requests that do not carry one of keys as a
+// bearer token. With no keys configured every request is rejected.
+func RequireAdminKey(keys []string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		auth := c.GetHeader("Authorization")
+		presented, ok := strings.CutPrefix(auth, "Bearer ")
+		if ok && presented != "" {
+			for _, k := range keys {
+				if subtle.ConstantTimeCompare([]byte(k), []byte(presented)) == 1 {
+					c.Next()
+					return
+				}
+			}
+		}
+		c.Header("WWW-Authenticate", `Bearer realm="admin"`)
+		c.AbortWithStatusJSON(401, gin.H{"error": "admin authentication required"})
+	}
+}
+
+// lookupClient writes a 404 and returns false when the client does not exist.
+func (h *ClientAdminApiHandler) lookupClient(c *gin.Context) (store.Client, bool) {
+	client, err := h.clients.GetByID(c.Request.Context(), c.Param("id"))
+	if stderrors.Is(err, store.ErrClientNotFound) {
+		c.JSON(404, gin.H{"error": "client not found"})
+		return store.Client{}, false
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return store.Client{}, false
+	}
+	return client, true
+}
+
+// saveClient writes a 400 for invalid registrations and a 500 otherwise.
+func (h *ClientAdminApiHandler) saveClient(c *gin.Context, client store.Client) bool {
+	if err := h.clients.Save(c.Request.Context(), client); err != nil {
+		if stderrors.Is(err, store.ErrInvalidRedirectURI) {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return false
+		}
+		c.JSON(500, gin.H{"error": err.Error()})
+		return false
+	}
+	return true
+}
+
+func (h *ClientAdminApiHandler) handleListClients(c *gin.Context) {
+	clients, err := h.clients.List(c.Request.Context())
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	out := make([]dto.ClientAdminResponse, 0, len(clients))
+	for _, client := range clients {
+		out = append(out, toClientAdminResponse(client))
+	}
+	c.JSON(200, out)
+}
+
+func (h *ClientAdminApiHandler) handleCreateClient(c *gin.Context) {
+	var req dto.ClientAdminRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if req.ClientID == "" {
+		req.ClientID = uuid.NewString()
+	}
+	if _, err := h.clients.GetByID(c.Request.Context(), req.ClientID); err == nil {
+		c.JSON(409, gin.H{"error": "client already exists"})
+		return
+	}
+	client := store.Client{ID: req.ClientID}
+	if err := h.applyClientAdminRequest(&client, req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.sectors.Validate(c.Request.Context(), client); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	client.Meta.Enabled = req.Enabled == nil || *req.Enabled
+
+	var secret string
+	if usesSecret(client) {
+		var err error
+		secret, err = store.GenerateClientSecret()
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		if err := setSecret(&client, secret, 0); err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if !h.saveClient(c, client) {
+		return
+	}
+	log.Infof("Registered client %s", client.ID)
+	resp := toClientAdminResponse(client)
+	resp.ClientSecret = secret
+	c.JSON(201, resp)
+}
+
+func (h *ClientAdminApiHandler) handleGetClient(c *gin.Context) {
+	client, ok := h.lookupClient(c)
+	if !ok {
+		return
+	}
+	c.JSON(200, toClientAdminResponse(client))
+}
+
+func (h *ClientAdminApiHandler) handleUpdateClient(c *gin.Context) {
+	client, ok := h.lookupClient(c)
+	if !ok {
+		return
+	}
+	var req dto.ClientAdminRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if req.ClientID != "" && req.ClientID != client.ID {
+		c.JSON(400, gin.H{"error": "client_id cannot be changed"})
+		return
+	}
+	if err := h.applyClientAdminRequest(&client, req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.sectors.Validate(c.Request.Context(), client); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Enabled != nil {
+		client.Meta.Enabled = *req.Enabled
+	}
+	// A client moved to a client_secret_* method gets a secret, returned
+	// once like at registration.
+	var secret string
+	if needsNewSecret(client) {
+		var err error
+		secret, err = store.GenerateClientSecret()
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		if err := setSecret(&client, secret, 0); err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if !h.saveClient(c, client) {
+		return
+	}
+	resp := toClientAdminResponse(client)
+	resp.ClientSecret = secret
+	c.JSON(200, resp)
+}
+
+// handleDeleteClient removes the client, revokes the delegations users
+// made to it and its outstanding access and refresh tokens, so a client
+// registered again under the same ID inherits none of them.
+func (h *ClientAdminApiHandler) handleDeleteClient(c *gin.Context) {
+	client, ok := h.lookupClient(c)
+	if !ok {
+		return
+	}
+	ctx := c.Request.Context()
+	if err := h.clients.Delete(ctx, client.ID); err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	now := time.Now()
+	if h.delegations != nil {
+		delegations, err := h.delegations.ListByClient(ctx, client.ID)
+		if err != nil {
+			log.Errorf("Failed to list delegations of deleted client %s: %v", client.ID, err)
+		}
+		for _, d := range delegations {
+			if d.IsRevoked() {
+				continue
+			}
+			if err := h.delegations.Revoke(ctx, d.ID, now); err != nil {
+				log.Errorf("Failed to revoke delegation %s of deleted client %s: %v", d.ID, client.ID, err)
+			}
+		}
+	}
+	if h.tokens != nil {
+		if err := h.tokens.RevokeByClient(ctx, client.ID, now); err != nil {
+			log.Errorf("Failed to revoke tokens of deleted client %s: %v", client.ID, err)
+		}
+	}
+	if h.refreshes != nil {
+		if err := h.refreshes.RevokeByClient(ctx, client.ID); err != nil {
+			log.Errorf("Failed to revoke refresh tokens of deleted client %s: %v", client.ID, err)
+		}
+	}
+	c.Status(204)
+}
+
+func (h *ClientAdminApiHandler) handleSetEnabled(enabled bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		client, ok := h.lookupClient(c)
+		if !ok {
+			return
+		}
+		client.Meta.Enabled = enabled
+		if !h.saveClient(c, client) {
+			return
+		}
+		c.JSON(200, toClientAdminResponse(client))
+	}
+}
+
+// handleRotateSecret issues a new secret. The previous one stays valid for
+// the requested grace period.
+func (h *ClientAdminApiHandler) handleRotateSecret(c *gin.Context) {
+	client, ok := h.lookupClient(c)
+	if !ok {
+		return
+	}
+	var req dto.SecretRotationRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if req.GracePeriodSeconds < 0 {
+		c.JSON(400, gin.H{"error": "grace_period_seconds must not be negative"})
+		return
+	}
+	if client.Public {
+		c.JSON(400, gin.H{"error": "public clients have no secret"})
+		return
+	}
+	secret, err := store.GenerateClientSecret()
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	if err := setSecret(&client, secret, time.Duration(req.GracePeriodSeconds)*time.Second); err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	if !h.saveClient(c, client) {
+		return
+	}
+	resp := toClientAdminResponse(client)
+	resp.ClientSecret = secret
+	c.JSON(200, resp)
+}
+
+func (h *ClientAdminApiHandler) handleGetJWKS(c *gin.Context) {
+	client, ok := h.lookupClient(c)
+	if !ok {
+		return
+	}
+	c.JSON(200, dto.ClientJWKSRequest{JWKSURI: client.Meta.JWKSURI, JWKS: client.Meta.JWKS})
+}
+
+func (h *ClientAdminApiHandler) handleSetJWKS(c *gin.Context) {
+	client, ok := h.lookupClient(c)
+	if !ok {
+		return
+	}
+	var req dto.ClientJWKSRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if err := setJWKS(&client, req.JWKSURI, req.JWKS); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if !h.saveClient(c, client) {
+		return
+	}
+	c.JSON(200, dto.ClientJWKSRequest{JWKSURI: client.Meta.JWKSURI, JWKS: client.Meta.JWKS})
+}
+
+// handleListDelegations lists the grants users have made to the client
+// that are still in force.
+func (h *ClientAdminApiHandler) handleListDelegations(c *gin.Context) {
+	client, ok := h.lookupClient(c)
+	if !ok {
+		return
+	}
+	if h.delegations == nil {
+		c.JSON(500, gin.H{"error": "delegation repository not configured"})
+		return
+	}
+	all, err := h.delegations.ListByClient(c.Request.Context(), client.ID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	now := time.Now()
+	active := make([]delegation.Delegation, 0, len(all))
+	for _, d := range all {
+		if !d.IsRevoked() && !d.IsExpired(now) {
+			active = append(active, d)
+		}
+	}
+	c.JSON(200, active)
+}
+
+// handleSetDelegationConstraints replaces the constraints of one of the
+// client's delegations. They apply to the next token request, refresh and
+// introspection.
+func (h *ClientAdminApiHandler) handleSetDelegationConstraints(c *gin.Context) {
+	client, ok := h.lookupClient(c)
+	if !ok {
+		return
+	}
+	if h.delegations == nil {
+		c.JSON(500, gin.H{"error": "delegation repository not configured"})
+		return
+	}
+	var req dto.DelegationConstraintsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	constraints := delegation.Constraints{
+		NotBefore: req.NotBefore,
+		NotAfter:  req.NotAfter,
+		IPCIDRs:   req.IPCIDRs,
+		Audiences: req.Audiences,
+		Resources: req.Resources,
+	}
+	if err := constraints.Validate(); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	d, err := h.delegations.FindByID(c.Request.Context(), c.Param("delegation"))
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	if d == nil || d.ClientID != client.ID {
+		c.JSON(404, gin.H{"error": "delegation not found"})
+		return
+	}
+	d.Constraints = constraints
+	if err := h.delegations.Save(c.Request.Context(), *d); err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, d)
+}
+
+// handleListTokens lists the client's unexpired, unrevoked access tokens.
+func (h *ClientAdminApiHandler) handleListTokens(c *gin.Context) {
+	client, ok := h.lookupClient(c)
+	if !ok {
+		return
+	}
+	if h.tokens == nil {
+		c.JSON(500, gin.H{"error": "token store not configured"})
+		return
+	}
+	all, err := h.tokens.ListByClient(c.Request.Context(), client.ID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	now := time.Now()
+	active := make([]store.TokenRecord, 0, len(all))
+	for _, t := range all {
+		if t.IsActiveAt(now) {
+			active = append(active, t)
+		}
+	}
+	c.JSON(200, active)
+}
+
+// signsWith reports whether tokens can be signed with alg. A supported
+// algorithm the key manager holds no keys for would fail at /token.
+func (h *ClientAdminApiHandler) signsWith(alg string) bool {
+	if h.keys == nil {
+		return security.IsSupportedAlgorithm(alg)
+	}
+	return h.keys.Supports(alg)
+}
+
+// applyClientAdminRequest copies the registration metadata in req onto
+// client. Secrets and the enabled flag are handled by the callers.
+func (h *ClientAdminApiHandler) applyClientAdminRequest(client *store.Client, req dto.ClientAdminRequest) error {
+	client.Name = req.ClientName
+	client.RedirectURIs = req.RedirectURIs
+	client.Grants = req.GrantTypes
+	client.Scopes = req.Scopes
+	client.Public = req.Public
+	client.ResourceServerID = req.ResourceServerID
+	client.Meta.ID = client.ID
+	client.Meta.AllowedAuthMethods = req.TokenEndpointAuthMethod
+	client.Meta.TLSAuthSubjectDN = req.TLSClientAuthSubjectDN
+	client.Meta.TLSSANs = req.TLSClientAuthSANs
+	client.Meta.TLSBoundTokens = req.TLSBoundAccessTokens
+	client.Meta.RedirectPolicy = store.RedirectURIPolicy{
+		Loopback:          req.RedirectPolicy.Loopback,
+		PrivateUseSchemes: req.RedirectPolicy.PrivateUseSchemes,
+		ClaimedHTTPS:      req.RedirectPolicy.ClaimedHTTPS,
+		SimulatorLenient:  req.RedirectPolicy.SimulatorLenient,
+	}
+	for _, alg := range []string{req.IDTokenSignedAlg, req.UserinfoSignedAlg, req.AccessTokenSignedAlg} {
+		if alg != "" && !h.signsWith(alg) {
+			return fmt.Errorf("unsupported signing algorithm %q", alg)
+		}
+	}
+	client.Meta.IDTokenSignedResponseAlg = req.IDTokenSignedAlg
+	client.Meta.UserinfoSignedResponseAlg = req.UserinfoSignedAlg
+	client.Meta.AccessTokenSignedResponseAlg = req.AccessTokenSignedAlg
+	client.Meta.OpaqueAccessTokens = req.OpaqueAccessTokens
+	idAlg, idEnc, err := encryptionAlgs("id_token", req.IDTokenEncryptedAlg, req.IDTokenEncryptedEnc)
+	if err != nil {
+		return err
+	}
+	uiAlg, uiEnc, err := encryptionAlgs("userinfo", req.UserinfoEncryptedAlg, req.UserinfoEncryptedEnc)
+	if err != nil {
+		return err
+	}
+	client.Meta.IDTokenEncryptedResponseAlg, client.Meta.IDTokenEncryptedResponseEnc = idAlg, idEnc
+	client.Meta.UserinfoEncryptedResponseAlg, client.Meta.UserinfoEncryptedResponseEnc = uiAlg, uiEnc
+	if _, err := claimmapping.Compile(req.ClaimMappings); err != nil {
+		return err
+	}
+	client.Meta.ClaimMappings = req.ClaimMappings
+	client.Meta.GroupClaims = configuration.GroupClaimsConfig{}
+	if gc := req.GroupClaims; gc != nil {
+		if gc.Format != "" && gc.Format != "name" && gc.Format != "id" {
+			return fmt.Errorf("group_claims.format must be name or id")
+		}
+		if gc.MaxGroups < 0 {
+			return fmt.Errorf("group_claims.max_groups must not be negative")
+		}
+		client.Meta.GroupClaims = *gc
+	}
+	client.Meta.SubjectType = req.SubjectType
+	client.Meta.SectorIdentifierURI = req.SectorIdentifierURI
+	client.Meta.FirstParty = req.FirstParty
+	if client.Meta.RedirectPolicy.SimulatorLenient {
+		log.Warnf("Client %s uses simulator lenient redirect matching; do not use in production", client.ID)
+	}
+	if err := setJWKS(client, req.JWKSURI, req.JWKS); err != nil {
+		return err
+	}
+	if (idAlg != "" || uiAlg != "") && client.Meta.JWKSURI == "" && len(client.Meta.JWKS) == 0 {
+		return stderrors.New("response encryption requires jwks or jwks_uri")
+	}
+	return nil
+}
+
+// groupClaimsResponse omits an unset group claims policy.
+func groupClaimsResponse(cfg configuration.GroupClaimsConfig) *configuration.GroupClaimsConfig {
+	if reflect.ValueOf(cfg).IsZero() {
+		return nil
+	}
+	return &cfg
+}
+
+// encryptionAlgs validates a *_encrypted_response_alg/enc pair. enc
+// without alg is an error; alg without enc defaults enc (OIDC Dynamic
+// Client Registration §2).
+func encryptionAlgs(prefix, alg, enc string) (string, string, error) {
+	if alg == "" {
+		if enc != "" {
+			return "", "", fmt.Errorf("%s_encrypted_response_enc requires %s_encrypted_response_alg", prefix, prefix)
+		}
+		return "", "", nil
+	}
+	if enc == "" {
+		enc = security.DefaultEncryptionEnc
+	}
+	if !security.IsSupportedEncryption(alg, enc) {
+		return "", "", fmt.Errorf("unsupported %s encryption %s/%s", prefix, alg, enc)
+	}
+	return alg, enc, nil
+}
+
+func setJWKS(client *store.Client, uri string, raw []byte) error {
+	if uri != "" && len(raw) > 0 {
+		return stderrors.New("jwks and jwks_uri are mutually exclusive")
+	}
+	if len(raw) > 0 {
+		if _, err := jwksutil.ParseJWKS(raw); err != nil {
+			return err
+		}
+	}
+	client.Meta.JWKSURI = uri
+	client.Meta.JWKS = raw
+	return nil
+}
+
+// usesSecret reports whether the client authenticates with a shared secret.
+func usesSecret(client store.Client) bool {
+	if client.Public {
+		return false
+	}
+	return client.AllowsAuthMethod(dto.ClientSecretBasic) ||
+		client.AllowsAuthMethod(dto.ClientSecretPost) ||
+		client.AllowsAuthMethod(dto.ClientSecretJWT)
+}
+
+// needsNewSecret reports whether an updated client authenticates with a
+// secret it does not have: it has none yet, or it moved to
+// client_secret_jwt, which needs the plain value only kept for that method.
+func needsNewSecret(client store.Client) bool {
+	if !usesSecret(client) {
+		return false
+	}
+	if client.Meta.SecretHash == "" && len(client.Meta.ActiveSecrets(time.Now())) == 0 {
+		return true
+	}
+	return client.AllowsAuthMethod(dto.ClientSecretJWT) && client.Secret == ""
+}
+
+// setSecret installs secret as the client's primary secret. client_secret_jwt
+// needs the plain value to verify HMAC assertions, so it is kept only for
+// clients registered for that method.
+func setSecret(client *store.Client, secret string, grace time.Duration) error {
+	hash, err := store.HashClientSecret(secret)
+	if err != nil {
+		return err
+	}
+	client.Meta.RotateSecret(uuid.NewString(), hash, time.Now(), grace)
+	if client.AllowsAuthMethod(dto.ClientSecretJWT) {
+		client.Secret = secret
+	}
+	return nil
+}
+
+func toClientAdminResponse(client store.Client) dto.ClientAdminResponse {
+	activeSecrets := len(client.Meta.ActiveSecrets(time.Now()))
+	if client.Meta.SecretHash != "" {
+		activeSecrets++
+	}
+	return dto.ClientAdminResponse{
+		ClientID:                client.ID,
+		ClientName:              client.Name,
+		RedirectURIs:            client.RedirectURIs,
+		GrantTypes:              client.Grants,
+		Scopes:                  client.Scopes,
+		TokenEndpointAuthMethod: client.Meta.AllowedAuthMethods,
+		Public:                  client.Public,
+		ResourceServerID:        client.ResourceServerID,
+		JWKSURI:                 client.Meta.JWKSURI,
+		JWKS:                    client.Meta.JWKS,
+		TLSClientAuthSubjectDN:  client.Meta.TLSAuthSubjectDN,
+		TLSClientAuthSANs:       client.Meta.TLSSANs,
+		TLSBoundAccessTokens:    client.Meta.TLSBoundTokens,
+		RedirectPolicy: dto.RedirectPolicyDTO{
+			Loopback:          client.Meta.RedirectPolicy.Loopback,
+			PrivateUseSchemes: client.Meta.RedirectPolicy.PrivateUseSchemes,
+			ClaimedHTTPS:      client.Meta.RedirectPolicy.ClaimedHTTPS,
+			SimulatorLenient:  client.Meta.RedirectPolicy.SimulatorLenient,
+		},
+		IDTokenSignedAlg:     client.Meta.IDTokenSignedResponseAlg,
+		UserinfoSignedAlg:    client.Meta.UserinfoSignedResponseAlg,
+		AccessTokenSignedAlg: client.Meta.AccessTokenSignedResponseAlg,
+		OpaqueAccessTokens:   client.Meta.OpaqueAccessTokens,
+		IDTokenEncryptedAlg:  client.Meta.IDTokenEncryptedResponseAlg,
+		IDTokenEncryptedEnc:  client.Meta.IDTokenEncryptedResponseEnc,
+		UserinfoEncryptedAlg: client.Meta.UserinfoEncryptedResponseAlg,
+		UserinfoEncryptedEnc: client.Meta.UserinfoEncryptedResponseEnc,
+		ClaimMappings:        client.Meta.ClaimMappings,
+		GroupClaims:          groupClaimsResponse(client.Meta.GroupClaims),
+		SubjectType:          client.Meta.SubjectType,
+		SectorIdentifierURI:  client.Meta.SectorIdentifierURI,
+		FirstParty:           client.Meta.FirstParty,
+		ActiveSecrets:        activeSecrets,
+		Enabled:              client.Meta.Enabled,
+	}
+}
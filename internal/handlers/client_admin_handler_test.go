@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/martencassel/oidcsim/internal/application/subject"
+	"github.com/martencassel/oidcsim/internal/clientauth"
+	"github.com/martencassel/oidcsim/internal/domain/delegation"
+	"github.com/martencassel/oidcsim/internal/dto"
+	delegationinfra "github.com/martencassel/oidcsim/internal/infrastructure/delegation"
+	"github.com/martencassel/oidcsim/internal/security"
+	"github.com/martencassel/oidcsim/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testAdminKey = "test-admin-key"
+
+func newAdminRouter(t *testing.T) (*gin.Engine, *store.InMemoryClientStore, *store.InMemoryTokenStore) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	clients := store.NewInMemoryClientStore()
+	tokens := store.NewInMemoryTokenStore()
+	keys, err := security.NewKeyManager(security.KeyManagerConfig{Algorithms: []string{"RS256", "ES256"}})
+	require.NoError(t, err)
+	r := gin.New()
+	NewClientAdminHandler(clients, tokens, nil, delegationinfra.NewMemoryRepo(), keys, []string{testAdminKey}).RegisterRoutes(r)
+	return r, clients, tokens
+}
+
+func adminRequest(r http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+testAdminKey)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestClientAdmin_RequiresAdminKey(t *testing.T) {
+	r, _, _ := newAdminRouter(t)
+	req := httptest.NewRequest(http.MethodGet, "/api/clients", nil)
+	req.Header.Set("Authorization", "Bearer wrong")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Header().Get("WWW-Authenticate"), "Bearer")
+}
+
+func TestClientAdmin_SigningAlgMustHaveKeys(t *testing.T) {
+	r, _, _ := newAdminRouter(t)
+
+	w := adminRequest(r, http.MethodPost, "/api/clients", `{"client_id":"es","id_token_signed_response_alg":"ES256"}`)
+	assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	w = adminRequest(r, http.MethodPost, "/api/clients", `{"client_id":"ps","id_token_signed_response_alg":"PS256"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "PS256 is supported but no key is configured for it")
+	w = adminRequest(r, http.MethodPut, "/api/clients/es", `{"access_token_signed_response_alg":"EdDSA"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestClientAdmin_Lifecycle(t *testing.T) {
+	r, clients, _ := newAdminRouter(t)
+	ctx := context.Background()
+	authSvc := clientauth.NewService(clients, clientauth.NewRegistry())
+
+	w := adminRequest(r, http.MethodPost, "/api/clients",
+		`{"client_id":"app","redirect_uris":["https://app.example/cb"],"token_endpoint_auth_methods":["client_secret_basic"]}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created dto.ClientAdminResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	require.NotEmpty(t, created.ClientSecret)
+	assert.True(t, created.Enabled)
+
+	_, err := authSvc.Authenticate(ctx, dto.ClientAuthDTO{ClientID: "app", ClientSecret: created.ClientSecret, AuthMethod: "client_secret_basic"})
+	require.NoError(t, err)
+
+	w = adminRequest(r, http.MethodPost, "/api/clients", `{"client_id":"app"}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = adminRequest(r, http.MethodPost, "/api/clients", `{"redirect_uris":["https://app.example/cb#frag"]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Rotation keeps the old secret for the grace period.
+	w = adminRequest(r, http.MethodPost, "/api/clients/app/secrets", `{"grace_period_seconds":60}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var rotated dto.ClientAdminResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &rotated))
+	assert.NotEqual(t, created.ClientSecret, rotated.ClientSecret)
+	assert.Equal(t, 2, rotated.ActiveSecrets)
+	_, err = authSvc.Authenticate(ctx, dto.ClientAuthDTO{ClientID: "app", ClientSecret: created.ClientSecret, AuthMethod: "client_secret_basic"})
+	assert.NoError(t, err)
+	_, err = authSvc.Authenticate(ctx, dto.ClientAuthDTO{ClientID: "app", ClientSecret: rotated.ClientSecret, AuthMethod: "client_secret_basic"})
+	assert.NoError(t, err)
+
+	// Disabled clients cannot authenticate.
+	w = adminRequest(r, http.MethodPost, "/api/clients/app/disable", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	_, err = authSvc.Authenticate(ctx, dto.ClientAuthDTO{ClientID: "app", ClientSecret: rotated.ClientSecret, AuthMethod: "client_secret_basic"})
+	assert.Error(t, err)
+
+	w = adminRequest(r, http.MethodPut, "/api/clients/app/jwks", `{"jwks":{"keys":"not-a-list"}}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = adminRequest(r, http.MethodDelete, "/api/clients/app", "")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = adminRequest(r, http.MethodGet, "/api/clients/app", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestClientAdmin_UpdateIssuesSecretForSecretMethods(t *testing.T) {
+	r, clients, _ := newAdminRouter(t)
+	ctx := context.Background()
+	authSvc := clientauth.NewService(clients, clientauth.NewRegistry())
+
+	w := adminRequest(r, http.MethodPost, "/api/clients", `{"client_id":"app","token_endpoint_auth_methods":["private_key_jwt"]}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created dto.ClientAdminResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Empty(t, created.ClientSecret)
+
+	w = adminRequest(r, http.MethodPut, "/api/clients/app", `{"token_endpoint_auth_methods":["client_secret_basic"]}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var updated dto.ClientAdminResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &updated))
+	require.NotEmpty(t, updated.ClientSecret, "the new method needs a secret")
+	_, err := authSvc.Authenticate(ctx, dto.ClientAuthDTO{ClientID: "app", ClientSecret: updated.ClientSecret, AuthMethod: "client_secret_basic"})
+	require.NoError(t, err)
+
+	w = adminRequest(r, http.MethodPut, "/api/clients/app", `{"token_endpoint_auth_methods":["client_secret_basic"],"client_name":"App"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var renamed dto.ClientAdminResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &renamed))
+	assert.Empty(t, renamed.ClientSecret, "the secret is kept while the method does not change")
+	_, err = authSvc.Authenticate(ctx, dto.ClientAuthDTO{ClientID: "app", ClientSecret: updated.ClientSecret, AuthMethod: "client_secret_basic"})
+	assert.NoError(t, err)
+}
+
+func TestClientAdmin_DeleteRevokesGrantsAndTokens(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	clients := store.NewInMemoryClientStore()
+	tokens := store.NewInMemoryTokenStore()
+	refreshes := store.NewInMemoryRefreshTokenStore()
+	delegations := delegationinfra.NewMemoryRepo()
+	r := gin.New()
+	NewClientAdminHandler(clients, tokens, refreshes, delegations, nil, []string{testAdminKey}).RegisterRoutes(r)
+
+	now := time.Now()
+	require.NoError(t, clients.Save(ctx, store.Client{ID: "app", Meta: store.ClientMeta{ID: "app", Enabled: true}}))
+	require.NoError(t, delegations.Save(ctx, delegation.Delegation{ID: "d1", UserID: "alice", ClientID: "app", Scopes: []string{"openid"}, CreatedAt: now}))
+	require.NoError(t, delegations.Save(ctx, delegation.Delegation{ID: "d2", UserID: "alice", ClientID: "other", Scopes: []string{"openid"}, CreatedAt: now}))
+	require.NoError(t, tokens.Save(ctx, store.TokenRecord{ID: "t1", ClientID: "app", IssuedAt: now, ExpiresAt: now.Add(time.Hour)}))
+	require.NoError(t, refreshes.Save(ctx, store.RefreshToken{ID: "r1", ClientID: "app", Subject: "alice", IssuedAt: now, ExpiresAt: now.Add(time.Hour)}))
+	require.NoError(t, refreshes.Save(ctx, store.RefreshToken{ID: "r2", ClientID: "other", Subject: "alice", IssuedAt: now, ExpiresAt: now.Add(time.Hour)}))
+
+	w := adminRequest(r, http.MethodDelete, "/api/clients/app", "")
+	require.Equal(t, http.StatusNoContent, w.Code)
+
+	d, err := delegations.FindByID(ctx, "d1")
+	require.NoError(t, err)
+	assert.True(t, d.IsRevoked(), "a client registered again under the ID must not inherit consent")
+	d, err = delegations.FindByID(ctx, "d2")
+	require.NoError(t, err)
+	assert.False(t, d.IsRevoked())
+	rec, err := tokens.Get(ctx, "t1")
+	require.NoError(t, err)
+	assert.NotNil(t, rec.RevokedAt)
+	_, err = refreshes.Get(ctx, "app", "r1")
+	assert.ErrorIs(t, err, store.ErrRefreshTokenNotFound)
+	_, err = refreshes.Get(ctx, "other", "r2")
+	assert.NoError(t, err)
+}
+
+func TestClientAdmin_ListTokens(t *testing.T) {
+	r, clients, tokens := newAdminRouter(t)
+	ctx := context.Background()
+	require.NoError(t, clients.Save(ctx, store.Client{ID: "svc", Meta: store.ClientMeta{ID: "svc", Enabled: true}}))
+	now := time.Now()
+	require.NoError(t, tokens.Save(ctx, store.TokenRecord{ID: "t1", ClientID: "svc", IssuedAt: now, ExpiresAt: now.Add(time.Hour)}))
+	require.NoError(t, tokens.Save(ctx, store.TokenRecord{ID: "t2", ClientID: "svc", IssuedAt: now, ExpiresAt: now.Add(time.Hour)}))
+	require.NoError(t, tokens.Revoke(ctx, "t2", now))
+
+	w := adminRequest(r, http.MethodGet, "/api/clients/svc/tokens", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var listed []store.TokenRecord
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &listed))
+	require.Len(t, listed, 1)
+	assert.Equal(t, "t1", listed[0].ID)
+}
+
+func TestClientAdmin_ValidatesSectorIdentifier(t *testing.T) {
+	sector := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`["https://a.example/cb","https://b.example/cb"]`))
+	}))
+	defer sector.Close()
+	gin.SetMode(gin.TestMode)
+	h := NewClientAdminHandler(store.NewInMemoryClientStore(), store.NewInMemoryTokenStore(), nil, delegationinfra.NewMemoryRepo(), nil, []string{testAdminKey})
+	h.sectors = subject.NewSectorValidator(sector.Client())
+	r := gin.New()
+	h.RegisterRoutes(r)
+
+	w := adminRequest(r, http.MethodPost, "/api/clients",
+		`{"client_id":"multi","subject_type":"pairwise","redirect_uris":["https://a.example/cb","https://b.example/cb"]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "redirect URIs on several hosts need a sector_identifier_uri")
+
+	w = adminRequest(r, http.MethodPost, "/api/clients",
+		`{"client_id":"other","subject_type":"pairwise","sector_identifier_uri":"`+sector.URL+`","redirect_uris":["https://c.example/cb"]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "redirect URIs must be listed at the sector identifier")
+
+	w = adminRequest(r, http.MethodPost, "/api/clients",
+		`{"client_id":"multi","subject_type":"pairwise","sector_identifier_uri":"`+sector.URL+`","redirect_uris":["https://a.example/cb","https://b.example/cb"]}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), `"subject_type":"pairwise"`)
+}
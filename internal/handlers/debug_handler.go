@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"encoding/json"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/martencassel/oidcsim/internal/security"
+)
+
+// API Handler for debugging tools
+//
+// POST /api/debug/decrypt  decrypt a JWE issued to a client, given the
+//                          client's private key, and verify a nested JWT
+//                          against the server's signing keys.
+//
+// Every route requires "Authorization: Bearer <admin API key>". Private
+// keys sent here are used for the one request and never stored.
+
+type DebugApiHandler struct {
+	keys    *security.KeyManager
+	apiKeys []string
+	g       *gin.RouterGroup
+}
+
+func NewDebugHandler(keys *security.KeyManager, apiKeys []string) *DebugApiHandler {
+	return &DebugApiHandler{keys: keys, apiKeys: apiKeys}
+}
+
+func (h *DebugApiHandler) RegisterRoutes(rg *gin.Engine) {
+	h.g = rg.Group("/api/debug", RequireAdminKey(h.apiKeys))
+	h.g.POST("/decrypt", h.handleDecrypt)
+}
+
+type decryptRequest struct {
+	JWE           string `json:"jwe"`
+	PrivateKeyPEM string `json:"private_key_pem"`
+}
+
+type decryptResponse struct {
+	Header    security.JWEHeader `json:"header"`
+	Plaintext string             `json:"plaintext"`
+	// Set when the plaintext is a JWT (cty "JWT")
+	Claims        jwt.MapClaims `json:"claims,omitempty"`
+	SignatureOK   bool          `json:"signature_valid"`
+	SignatureNote string        `json:"signature_error,omitempty"`
+}
+
+func (h *DebugApiHandler) handleDecrypt(c *gin.Context) {
+	var req decryptRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.JWE == "" || req.PrivateKeyPEM == "" {
+		c.JSON(400, gin.H{"error": "jwe and private_key_pem are required"})
+		return
+	}
+	priv, err := security.ParsePrivateKeyPEM([]byte(req.PrivateKeyPEM))
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	plaintext, header, err := security.DecryptJWE(req.JWE, priv)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	resp := decryptResponse{Header: header, Plaintext: string(plaintext)}
+	if header.Cty == "JWT" {
+		claims := jwt.MapClaims{}
+		_, err := jwt.ParseWithClaims(string(plaintext), claims, h.keys.Keyfunc,
+			jwt.WithValidMethods(security.SupportedAlgorithms))
+		resp.Claims = claims
+		resp.SignatureOK = err == nil
+		if err != nil {
+			resp.SignatureNote = err.Error()
+		}
+	} else if json.Valid(plaintext) {
+		// Unsigned userinfo responses are plain JSON
+		_ = json.Unmarshal(plaintext, &resp.Claims)
+	}
+	c.JSON(200, resp)
+}
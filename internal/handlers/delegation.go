@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"context"
+	stderrors "errors"
+	"net"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	delegationapp "github.com/martencassel/oidcsim/internal/application/delegation"
+	"github.com/martencassel/oidcsim/internal/domain/delegation"
+	"github.com/martencassel/oidcsim/internal/errors"
+	infrasecurity "github.com/martencassel/oidcsim/internal/infrastructure/security"
+	"github.com/martencassel/oidcsim/internal/store"
+)
+
+// checkDelegation applies the constraints of the user's delegation to the
+// client to a token request and returns the delegation ID to record on
+// the tokens. Each violation has its own error description; audience and
+// resource violations are invalid_target (RFC 8707 §2).
+//
+// IP ranges are matched against the peer address: forwarded-for headers
+// can be set by the client itself unless a proxy in front strips them.
+func (ts *TokenServiceController) checkDelegation(c *gin.Context, client store.Client, subject string) (string, error) {
+	if ts.delegations == nil {
+		return "", nil
+	}
+	id, err := ts.delegations.CheckDelegation(c.Request.Context(), subject, client.ID, delegationUse(c, client))
+	if err != nil {
+		return "", delegationError(err)
+	}
+	return id, nil
+}
+
+// delegationUse describes a token request as a use of a delegation.
+func delegationUse(c *gin.Context, client store.Client) delegation.Use {
+	return delegation.Use{
+		At:        time.Now(),
+		IP:        net.ParseIP(c.RemoteIP()),
+		Audience:  accessTokenAudience(client),
+		Resources: c.Request.PostForm["resource"],
+	}
+}
+
+// delegationError maps a delegation constraint violation to the OAuth
+// error of the token request it rejects. A grant that is no longer on
+// record is invalid_grant like a revoked one.
+func delegationError(err error) error {
+	switch {
+	case stderrors.Is(err, delegation.ErrAudienceNotAllowed), stderrors.Is(err, delegation.ErrResourceNotAllowed):
+		return errors.ErrInvalidTarget.WithDescription(err.Error())
+	case stderrors.Is(err, delegation.ErrOutsideWindow), stderrors.Is(err, delegation.ErrIPNotAllowed),
+		stderrors.Is(err, delegation.ErrRevoked), stderrors.Is(err, delegation.ErrExpired),
+		stderrors.Is(err, delegationapp.ErrDelegationNotFound):
+		return errors.ErrInvalidGrant.WithDescription(err.Error())
+	default:
+		return err
+	}
+}
+
+// checkTokenDelegation reports why a token issued under a delegation may
+// no longer be used: the delegation was revoked, left its time window or
+// no longer allows the token's audience. The caller of introspection is
+// the resource server, so the client's network is not checked here.
+func (ts *TokenServiceController) checkTokenDelegation(ctx context.Context, at *infrasecurity.AccessToken) error {
+	if ts.delegations == nil || ts.tokens == nil {
+		return nil
+	}
+	rec, err := ts.tokens.Get(ctx, at.ID)
+	if err != nil || rec.DelegationID == "" {
+		return nil
+	}
+	return ts.delegations.ValidateDelegation(ctx, rec.DelegationID, delegation.Use{At: time.Now(), Audience: at.Audience})
+}
@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/martencassel/oidcsim/authcode"
+	delegationapp "github.com/martencassel/oidcsim/internal/application/delegation"
+	"github.com/martencassel/oidcsim/internal/clientauth"
+	"github.com/martencassel/oidcsim/internal/domain/delegation"
+	"github.com/martencassel/oidcsim/internal/identity"
+	delegationinfra "github.com/martencassel/oidcsim/internal/infrastructure/delegation"
+	"github.com/martencassel/oidcsim/internal/security"
+	"github.com/martencassel/oidcsim/internal/store"
+)
+
+type delegationFixture struct {
+	router      *gin.Engine
+	clients     *store.InMemoryClientStore
+	codes       *authcode.Store
+	tokens      *store.InMemoryTokenStore
+	delegations *delegationinfra.MemoryRepo
+}
+
+// newDelegationFixture serves /token, /introspect and /revoke for a public
+// client that alice delegated to under constraints.
+func newDelegationFixture(t *testing.T, constraints delegation.Constraints) *delegationFixture {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	keys, err := security.NewKeyManager(security.KeyManagerConfig{Algorithms: []string{"RS256"}})
+	require.NoError(t, err)
+	clients := store.NewInMemoryClientStore()
+	require.NoError(t, clients.Save(ctx, store.Client{
+		ID: "app", Public: true, ResourceServerID: "api", Grants: []string{"authorization_code", "refresh_token"}, Meta: store.ClientMeta{Enabled: true},
+	}))
+	f := &delegationFixture{
+		clients: clients, codes: authcode.NewStore(time.Minute), tokens: store.NewInMemoryTokenStore(), delegations: delegationinfra.NewMemoryRepo(),
+	}
+	require.NoError(t, f.delegations.Save(ctx, delegation.Delegation{
+		ID: "d1", UserID: "alice", ClientID: "app", Scopes: []string{"openid"}, CreatedAt: time.Now(), Constraints: constraints,
+	}))
+	ts := NewTokenServiceControllerBuilder().
+		WithIssuer("https://idp.test").
+		WithRoutesConfig(&RoutesConfig{Token: "/token", Introspect: "/introspect", Revoke: "/revoke"}).
+		WithCodeStore(f.codes).
+		WithKeyManager(keys).
+		WithIdentityStore(identity.NewCoreIdentityStore("")).
+		WithClientStore(clients).
+		WithTokenStore(f.tokens).
+		WithRefreshTokens(store.NewInMemoryRefreshTokenStore()).
+		WithClientAuthenticator(clientauth.NewService(clients, clientauth.NewRegistry())).
+		WithDelegations(delegationapp.NewDelegationService(f.delegations, nil)).
+		Build()
+	f.router = gin.New()
+	ts.RegisterRoutes(f.router)
+	return f
+}
+
+func (f *delegationFixture) post(target, remoteAddr string, form url.Values) *httptest.ResponseRecorder {
+	form.Set("client_id", "app")
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.RemoteAddr = remoteAddr
+	w := httptest.NewRecorder()
+	f.router.ServeHTTP(w, req)
+	return w
+}
+
+// code issues an authorization code alice approved the app for openid.
+func (f *delegationFixture) code(t *testing.T) string {
+	t.Helper()
+	code, err := f.codes.Issue(authcode.Code{ClientID: "app", RedirectURI: "https://app.example/cb", Subject: "alice", Scope: "openid"})
+	require.NoError(t, err)
+	return code
+}
+
+// token redeems a new code from f.code.
+func (f *delegationFixture) token(t *testing.T, remoteAddr string, form url.Values) *httptest.ResponseRecorder {
+	t.Helper()
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", f.code(t))
+	form.Set("redirect_uri", "https://app.example/cb")
+	return f.post("/token", remoteAddr, form)
+}
+
+func (f *delegationFixture) introspect(t *testing.T, token string) bool {
+	t.Helper()
+	w := f.post("/introspect", "10.1.2.3:4000", url.Values{"token": {token}})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp IntrospectionResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	return resp.Active
+}
+
+func oauthError(t *testing.T, w *httptest.ResponseRecorder) (code, description string) {
+	t.Helper()
+	var body struct {
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	return body.Error, body.ErrorDescription
+}
+
+func TestTokenHandler_EnforcesDelegationConstraints(t *testing.T) {
+	start := time.Now().Add(-time.Hour)
+	end := time.Now().Add(time.Hour)
+	f := newDelegationFixture(t, delegation.Constraints{
+		NotBefore: &start,
+		NotAfter:  &end,
+		IPCIDRs:   []string{"10.1.0.0/16"},
+		Audiences: []string{"api"},
+		Resources: []string{"https://api.example.com"},
+	})
+
+	w := f.token(t, "10.1.2.3:4000", url.Values{"resource": {"https://api.example.com"}})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp TokenResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	records, err := f.tokens.ListByClient(context.Background(), "app")
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, "d1", records[0].DelegationID)
+
+	w = f.token(t, "192.0.2.1:4000", url.Values{})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	code, desc := oauthError(t, w)
+	assert.Equal(t, "invalid_grant", code)
+	assert.Equal(t, delegation.ErrIPNotAllowed.Error(), desc)
+
+	w = f.token(t, "10.1.2.3:4000", url.Values{"resource": {"https://other.example.com"}})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	code, desc = oauthError(t, w)
+	assert.Equal(t, "invalid_target", code)
+	assert.Equal(t, delegation.ErrResourceNotAllowed.Error(), desc)
+
+	assert.True(t, f.introspect(t, resp.AccessToken))
+
+	past := time.Now().Add(-time.Minute)
+	d, err := f.delegations.FindByID(context.Background(), "d1")
+	require.NoError(t, err)
+	d.Constraints.NotAfter = &past
+	require.NoError(t, f.delegations.Save(context.Background(), *d))
+
+	assert.False(t, f.introspect(t, resp.AccessToken), "the token stops working when the contract period ends")
+	w = f.token(t, "10.1.2.3:4000", url.Values{})
+	code, desc = oauthError(t, w)
+	assert.Equal(t, "invalid_grant", code)
+	assert.Equal(t, delegation.ErrOutsideWindow.Error(), desc)
+}
+
+func TestTokenHandler_DelegationAudience(t *testing.T) {
+	f := newDelegationFixture(t, delegation.Constraints{Audiences: []string{"billing"}})
+
+	w := f.token(t, "10.1.2.3:4000", url.Values{})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	code, desc := oauthError(t, w)
+	assert.Equal(t, "invalid_target", code)
+	assert.Equal(t, delegation.ErrAudienceNotAllowed.Error(), desc)
+}
+
+func TestTokenHandler_UnknownGrantIsInvalidGrant(t *testing.T) {
+	f := newDelegationFixture(t, delegation.Constraints{})
+	code, err := f.codes.Issue(authcode.Code{ClientID: "app", RedirectURI: "https://app.example/cb", Subject: "alice", Scope: "openid", GrantID: "deleted"})
+	require.NoError(t, err)
+
+	w := f.post("/token", "10.1.2.3:4000", url.Values{"grant_type": {"authorization_code"}, "code": {code}, "redirect_uri": {"https://app.example/cb"}})
+	assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+	errCode, _ := oauthError(t, w)
+	assert.Equal(t, "invalid_grant", errCode)
+}
+
+func TestTokenHandler_IgnoresForwardedForOnDelegationIP(t *testing.T) {
+	f := newDelegationFixture(t, delegation.Constraints{IPCIDRs: []string{"10.1.0.0/16"}})
+
+	form := url.Values{"grant_type": {"authorization_code"}, "client_id": {"app"}, "code": {f.code(t)}, "redirect_uri": {"https://app.example/cb"}}
+	req := httptest.NewRequest(http.MethodPost, "/token", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-Forwarded-For", "10.1.2.3")
+	req.RemoteAddr = "192.0.2.1:4000"
+	w := httptest.NewRecorder()
+	f.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "a client cannot claim an office address")
+}
+
+func TestClientAdmin_SetDelegationConstraints(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	clients := store.NewInMemoryClientStore()
+	require.NoError(t, clients.Save(ctx, store.Client{ID: "app", Meta: store.ClientMeta{Enabled: true}}))
+	require.NoError(t, clients.Save(ctx, store.Client{ID: "other", Meta: store.ClientMeta{Enabled: true}}))
+	repo := delegationinfra.NewMemoryRepo()
+	require.NoError(t, repo.Save(ctx, delegation.Delegation{ID: "d1", UserID: "alice", ClientID: "app"}))
+	r := gin.New()
+	NewClientAdminHandler(clients, store.NewInMemoryTokenStore(), nil, repo, nil, []string{testAdminKey}).RegisterRoutes(r)
+
+	w := adminRequest(r, http.MethodPut, "/api/clients/app/delegations/d1/constraints", `{"ip_cidrs":["10.1.0.0"]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = adminRequest(r, http.MethodPut, "/api/clients/app/delegations/d1/constraints",
+		`{"not_before":"2026-03-01T00:00:00Z","not_after":"2026-01-01T00:00:00Z"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = adminRequest(r, http.MethodPut, "/api/clients/other/delegations/d1/constraints", `{}`)
+	assert.Equal(t, http.StatusNotFound, w.Code, "delegations are managed through their own client")
+
+	w = adminRequest(r, http.MethodPut, "/api/clients/app/delegations/d1/constraints",
+		`{"not_before":"2026-01-01T00:00:00Z","not_after":"2026-07-01T00:00:00Z","ip_cidrs":["10.1.0.0/16"],"audiences":["api"]}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	d, err := repo.FindByID(ctx, "d1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10.1.0.0/16"}, d.Constraints.IPCIDRs)
+	assert.Equal(t, []string{"api"}, d.Constraints.Audiences)
+	require.NotNil(t, d.Constraints.NotAfter)
+	assert.Equal(t, time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC), d.Constraints.NotAfter.UTC())
+}
@@ -1,27 +1,134 @@
 package handlers
 
 import (
+	"encoding/json"
+	"fmt"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/martencassel/oidcsim/authcode"
+	"github.com/martencassel/oidcsim/internal/application/subject"
+	"github.com/martencassel/oidcsim/internal/domain/delegation"
+	"github.com/martencassel/oidcsim/internal/domain/oidc"
+	httpdto "github.com/martencassel/oidcsim/internal/interface/http/dto"
+	"github.com/martencassel/oidcsim/internal/security"
 )
 
-type DiscoveryResponse struct {
-	Issuer                 string   `json:"issuer"`
-	AuthURL                string   `json:"authorization_endpoint"`
-	TokenURL               string   `json:"token_endpoint"`
-	JWKSURL                string   `json:"jwks_uri"`
-	ResponseTypesSupported []string `json:"response_types_supported"`
+// DiscoveryHandler serves the OpenID Provider metadata. Every value is
+// derived from what the controller actually serves: registered routes,
+// client authentication methods, signing keys and scope mappings.
+func (ts *TokenServiceController) DiscoveryHandler(c *gin.Context) {
+	ts.writeMetadata(c)
 }
 
-// DiscoveryHandler
-func (ts *TokenServiceController) DiscoveryHandler(c *gin.Context) {
-	issuer := ts.issuer
-	c.JSON(http.StatusOK, DiscoveryResponse{
-		Issuer:                 issuer,
-		AuthURL:                issuer + ts.routesConfig.Authorize,
-		TokenURL:               issuer + ts.routesConfig.Token,
-		JWKSURL:                issuer + ts.routesConfig.JWKS,
-		ResponseTypesSupported: []string{"code", "token", "code id_token"},
-	})
+// AuthorizationServerMetadataHandler serves RFC 8414 metadata for OAuth
+// clients that do not read the OIDC document.
+func (ts *TokenServiceController) AuthorizationServerMetadataHandler(c *gin.Context) {
+	ts.writeMetadata(c)
+}
+
+func (ts *TokenServiceController) writeMetadata(c *gin.Context) {
+	doc := ts.discoveryDocument()
+	if ts.signedMetadata {
+		signed, err := ts.signMetadata(doc)
+		if err != nil {
+			log.Errorf("Failed to sign metadata: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to sign metadata"})
+			return
+		}
+		doc.SignedMetadata = signed
+	}
+	c.JSON(http.StatusOK, doc)
+}
+
+// signMetadata returns the metadata values as a JWT signed with the
+// provider key. The iss claim is required (RFC 8414 §2.1).
+func (ts *TokenServiceController) signMetadata(doc httpdto.DiscoveryDocument) (string, error) {
+	raw, err := json.Marshal(doc)
+	if err != nil {
+		return "", err
+	}
+	claims := jwt.MapClaims{}
+	if err := json.Unmarshal(raw, &claims); err != nil {
+		return "", err
+	}
+	claims["iss"] = ts.issuer
+	claims["iat"] = time.Now().Unix()
+	return ts.keys.Sign("", claims, "")
+}
+
+// IssuerPath returns the path component of an issuer identifier, without a
+// trailing slash. Issuers must be http(s) URLs without query or fragment
+// (RFC 8414 §2).
+func IssuerPath(issuer string) (string, error) {
+	u, err := url.Parse(issuer)
+	if err != nil {
+		return "", fmt.Errorf("invalid issuer %q: %w", issuer, err)
+	}
+	if (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return "", fmt.Errorf("issuer %q must be an absolute http(s) URL", issuer)
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return "", fmt.Errorf("issuer %q must not have a query or fragment", issuer)
+	}
+	return strings.TrimSuffix(u.Path, "/"), nil
+}
+
+func (ts *TokenServiceController) discoveryDocument() httpdto.DiscoveryDocument {
+	routes := ts.routesConfig
+	doc := httpdto.DiscoveryDocument{
+		Issuer:                             ts.issuer,
+		AuthorizationEndpoint:              ts.endpoint(routes.Authorize),
+		TokenEndpoint:                      ts.endpoint(routes.Token),
+		JWKSURI:                            ts.endpoint(routes.JWKS),
+		UserinfoEndpoint:                   ts.endpoint(routes.Userinfo),
+		RegistrationEndpoint:               ts.endpoint(routes.Registration),
+		RevocationEndpoint:                 ts.endpoint(routes.Revoke),
+		IntrospectionEndpoint:              ts.endpoint(routes.Introspect),
+		PushedAuthorizationRequestEndpoint: ts.endpoint(routes.PAR),
+		DeviceAuthorizationEndpoint:        ts.endpoint(routes.Device),
+		BackchannelAuthenticationEndpoint:  ts.endpoint(routes.CIBA),
+		EndSessionEndpoint:                 ts.endpoint(routes.Logout),
+		CheckSessionIframe:                 ts.endpoint(routes.CheckSession),
+
+		ResponseTypesSupported: supportedResponseTypes,
+		ResponseModesSupported: []string{"query"},
+		GrantTypesSupported:    supportedGrantTypes,
+		SubjectTypesSupported:  subject.Types,
+		ScopesSupported:        oidc.ScopesSupported(),
+		ClaimsSupported:        oidc.ClaimsSupported(),
+
+		AuthorizationResponseIssParameterSupported: true,
+		CodeChallengeMethodsSupported:              []string{authcode.ChallengeS256},
+		// Clients registered for it get tokens bound to the certificate
+		// they authenticate with (RFC 8705 §3.3)
+		TLSClientCertificateBoundAccessTokens: true,
+
+		IDTokenEncryptionAlgValuesSupported:  security.SupportedEncryptionAlgs,
+		IDTokenEncryptionEncValuesSupported:  security.SupportedEncryptionEncs,
+		UserinfoEncryptionAlgValuesSupported: security.SupportedEncryptionAlgs,
+		UserinfoEncryptionEncValuesSupported: security.SupportedEncryptionEncs,
+	}
+	if ts.clientAuth != nil {
+		doc.TokenEndpointAuthMethodsSupported = ts.clientAuth.Methods()
+		doc.TokenEndpointAuthSigningAlgValuesSupported = ts.clientAuth.SigningAlgs()
+	}
+	if endpoint := ts.grantEndpoint(); endpoint != "" {
+		doc.GrantManagementEndpoint = endpoint
+		doc.ScopesSupported = append(doc.ScopesSupported, GrantManagementQueryScope, GrantManagementRevokeScope)
+		for _, a := range delegation.GrantManagementActions {
+			doc.GrantManagementActionsSupported = append(doc.GrantManagementActionsSupported, string(a))
+		}
+	}
+	if ts.keys != nil {
+		doc.IDTokenSigningAlgValuesSupported = ts.keys.Algorithms()
+		doc.UserinfoSigningAlgValuesSupported = ts.keys.Algorithms()
+	}
+	return doc
 }
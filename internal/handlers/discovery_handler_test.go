@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/martencassel/oidcsim/internal/clientauth"
+	"github.com/martencassel/oidcsim/internal/security"
+	"github.com/martencassel/oidcsim/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newDiscoveryRouter(t *testing.T, routes *RoutesConfig, seed ...store.Client) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	keys, err := security.NewKeyManager(security.KeyManagerConfig{Algorithms: []string{"RS256", "ES256"}})
+	require.NoError(t, err)
+	clients := store.NewInMemoryClientStore()
+	for _, c := range seed {
+		require.NoError(t, clients.Save(context.Background(), c))
+	}
+	ts := NewTokenServiceControllerBuilder().
+		WithIssuer("https://idp.test").
+		WithRoutesConfig(routes).
+		WithKeyManager(keys).
+		WithClientStore(clients).
+		WithClientAuthenticator(clientauth.NewService(clients, clientauth.NewRegistry())).
+		Build()
+	r := gin.New()
+	ts.RegisterRoutes(r)
+	return r
+}
+
+func TestDiscovery_GeneratedFromConfiguration(t *testing.T) {
+	r := newDiscoveryRouter(t, &RoutesConfig{
+		Discovery:  "/.well-known/openid-configuration",
+		JWKS:       "/jwks",
+		Authorize:  "/authorize",
+		Token:      "/token",
+		Userinfo:   "/userinfo",
+		Introspect: "/introspect",
+		Revoke:     "/revoke",
+		Logout:     "/logout",
+	})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/.well-known/openid-configuration", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var doc map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
+	assert.Equal(t, "https://idp.test/token", doc["token_endpoint"])
+	assert.Equal(t, "https://idp.test/userinfo", doc["userinfo_endpoint"])
+	assert.Equal(t, "https://idp.test/revoke", doc["revocation_endpoint"])
+	assert.Equal(t, "https://idp.test/introspect", doc["introspection_endpoint"])
+	assert.Equal(t, "https://idp.test/logout", doc["end_session_endpoint"])
+	assert.NotContains(t, doc, "pushed_authorization_request_endpoint", "unserved endpoints are omitted")
+	assert.NotContains(t, doc, "check_session_iframe")
+
+	assert.Equal(t, []interface{}{"code"}, doc["response_types_supported"])
+	assert.Equal(t, []interface{}{"authorization_code", "refresh_token"}, doc["grant_types_supported"])
+	assert.ElementsMatch(t, []interface{}{"client_secret_basic", "client_secret_post", "none"}, doc["token_endpoint_auth_methods_supported"])
+	assert.ElementsMatch(t, []interface{}{"RS256", "ES256"}, doc["id_token_signing_alg_values_supported"])
+	assert.Contains(t, doc["scopes_supported"], "openid")
+	assert.Contains(t, doc["claims_supported"], "email")
+	assert.Equal(t, []interface{}{"S256"}, doc["code_challenge_methods_supported"])
+	assert.Equal(t, true, doc["tls_client_certificate_bound_access_tokens"])
+}
+
+func TestAuthorize_RejectsUnsupportedResponseType(t *testing.T) {
+	client := store.Client{ID: "app", RedirectURIs: []string{"https://app.example/cb"}, Meta: store.ClientMeta{Enabled: true}}
+	r := newDiscoveryRouter(t, &RoutesConfig{Authorize: "/authorize"}, client)
+	q := url.Values{"client_id": {"app"}, "redirect_uri": {"https://app.example/cb"}, "response_type": {"token"}, "state": {"s1"}}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/authorize?"+q.Encode(), nil))
+	require.Equal(t, http.StatusFound, w.Code)
+	loc, err := url.Parse(w.Header().Get("Location"))
+	require.NoError(t, err)
+	assert.Equal(t, "unsupported_response_type", loc.Query().Get("error"))
+	assert.Equal(t, "s1", loc.Query().Get("state"))
+}
+
+func TestAuthorizationServerMetadata_PathIssuersAndSignedMetadata(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	keys, err := security.NewKeyManager(security.KeyManagerConfig{Algorithms: []string{"RS256"}})
+	require.NoError(t, err)
+	routes := &RoutesConfig{
+		Discovery:                   "/.well-known/openid-configuration",
+		Token:                       "/token",
+		AuthorizationServerMetadata: "/.well-known/oauth-authorization-server",
+	}
+	root := NewTokenServiceControllerBuilder().
+		WithIssuer("https://idp.test").
+		WithRoutesConfig(routes).
+		WithKeyManager(keys).
+		WithSignedMetadata(true).
+		Build()
+	r := gin.New()
+	root.RegisterRoutes(r)
+	require.NoError(t, root.RegisterMetadataRoutes(r))
+	tenant := root.ForIssuer("https://idp.test/tenants/a")
+	tenant.RegisterRoutes(r.Group("/tenants/a"))
+	require.NoError(t, tenant.RegisterMetadataRoutes(r))
+
+	fetch := func(path string) map[string]interface{} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		require.Equal(t, http.StatusOK, w.Code, path)
+		var doc map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
+		return doc
+	}
+
+	doc := fetch("/.well-known/oauth-authorization-server")
+	assert.Equal(t, "https://idp.test", doc["issuer"])
+	assert.Equal(t, "https://idp.test/token", doc["token_endpoint"])
+
+	doc = fetch("/.well-known/oauth-authorization-server/tenants/a")
+	assert.Equal(t, "https://idp.test/tenants/a", doc["issuer"])
+	assert.Equal(t, "https://idp.test/tenants/a/token", doc["token_endpoint"])
+	assert.Equal(t, doc["issuer"], fetch("/tenants/a/.well-known/openid-configuration")["issuer"])
+
+	signed, ok := doc["signed_metadata"].(string)
+	require.True(t, ok)
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(signed, claims, keys.Keyfunc)
+	require.NoError(t, err)
+	assert.Equal(t, "https://idp.test/tenants/a", claims["iss"])
+	assert.Equal(t, doc["token_endpoint"], claims["token_endpoint"])
+	assert.NotContains(t, claims, "signed_metadata")
+}
+
+func TestIssuerPath(t *testing.T) {
+	path, err := IssuerPath("https://idp.test/tenants/a/")
+	require.NoError(t, err)
+	assert.Equal(t, "/tenants/a", path)
+	path, err = IssuerPath("https://idp.test")
+	require.NoError(t, err)
+	assert.Equal(t, "", path)
+	_, err = IssuerPath("https://idp.test?x=1")
+	assert.Error(t, err)
+	_, err = IssuerPath("idp.test")
+	assert.Error(t, err)
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/martencassel/oidcsim/internal/domain/delegation"
+	"github.com/martencassel/oidcsim/internal/errors"
+	infrasecurity "github.com/martencassel/oidcsim/internal/infrastructure/security"
+)
+
+// Scopes a client's access token needs to query and to revoke its grants
+// (FAPI Grant Management §6.1).
+const (
+	GrantManagementQueryScope  = "grant_management_query"
+	GrantManagementRevokeScope = "grant_management_revoke"
+)
+
+// GrantScope is one entry of a grant's scopes (FAPI Grant Management §6.2).
+type GrantScope struct {
+	Scope string `json:"scope"`
+}
+
+// GrantResponse describes a grant to the client it was made to.
+type GrantResponse struct {
+	Scopes []GrantScope `json:"scopes"`
+}
+
+// grantRoute returns the gin route of the grant management endpoint, or
+// "" when it is not served.
+func grantRoute(base string) string {
+	if base == "" {
+		return ""
+	}
+	return strings.TrimSuffix(base, "/") + "/:grant_id"
+}
+
+// grantEndpoint returns the URL grants are managed under, or "" when the
+// endpoint is not served. Clients append the grant_id.
+func (ts *TokenServiceController) grantEndpoint() string {
+	if ts.routesConfig == nil {
+		return ""
+	}
+	route := grantRoute(ts.routesConfig.Grants)
+	if route == "" || !ts.served[route] {
+		return ""
+	}
+	return ts.issuer + strings.TrimSuffix(ts.routesConfig.Grants, "/")
+}
+
+// GrantHandler returns the scopes of one of the client's grants. The
+// grant_id is the one token responses carry; the client authenticates
+// with an access token issued to it with the grant_management_query scope.
+func (ts *TokenServiceController) GrantHandler(c *gin.Context) {
+	d, ok := ts.managedGrant(c, GrantManagementQueryScope)
+	if !ok {
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, GrantResponse{Scopes: []GrantScope{{Scope: strings.Join(d.Scopes, " ")}}})
+}
+
+// RevokeGrantHandler revokes one of the client's grants along with the
+// tokens issued to the client for the grant's user. The user is asked for
+// consent again on the next authorization request. The access token needs
+// the grant_management_revoke scope.
+func (ts *TokenServiceController) RevokeGrantHandler(c *gin.Context) {
+	d, ok := ts.managedGrant(c, GrantManagementRevokeScope)
+	if !ok {
+		return
+	}
+	ctx := c.Request.Context()
+	if err := ts.delegations.RevokeDelegation(ctx, d.ID); err != nil {
+		log.Errorf("Failed to revoke grant %s: %v", d.ID, err)
+		writeOAuthError(c.Writer, err)
+		return
+	}
+	if ts.tokens != nil {
+		sub := ts.subjects.For(ts.tokenClient(ctx, d.ClientID), d.UserID)
+		if err := ts.tokens.RevokeBySubject(ctx, d.ClientID, sub, time.Now()); err != nil {
+			log.Errorf("Failed to revoke tokens of grant %s: %v", d.ID, err)
+		}
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// managedGrant authenticates the caller with an access token carrying
+// scope and returns the grant named in the path. A user's own access
+// token for the client does not have the scope. Grants that do not exist,
+// are no longer active or were made to another client are all 404 (FAPI
+// Grant Management §6.4).
+func (ts *TokenServiceController) managedGrant(c *gin.Context, scope string) (delegation.Delegation, bool) {
+	at, err := ts.authenticateBearer(c.Request)
+	if err != nil || at == nil {
+		writeBearerError(c.Writer, err)
+		return delegation.Delegation{}, false
+	}
+	if !at.HasScope(scope) {
+		writeInsufficientScope(c.Writer, scope)
+		return delegation.Delegation{}, false
+	}
+	d, err := ts.delegations.GetDelegation(c.Request.Context(), c.Param("grant_id"))
+	if err != nil || !ownsGrant(at, d) {
+		c.JSON(http.StatusNotFound, gin.H{"error": errors.ErrInvalidGrantID.Error(), "error_description": "grant not found"})
+		return delegation.Delegation{}, false
+	}
+	return d, true
+}
+
+func ownsGrant(at *infrasecurity.AccessToken, d delegation.Delegation) bool {
+	return d.ClientID == at.ClientID && d.IsActive(time.Now())
+}
@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/martencassel/oidcsim/authcode"
+	delegationapp "github.com/martencassel/oidcsim/internal/application/delegation"
+	"github.com/martencassel/oidcsim/internal/clientauth"
+	"github.com/martencassel/oidcsim/internal/domain/delegation"
+	"github.com/martencassel/oidcsim/internal/domain/oauth2"
+	"github.com/martencassel/oidcsim/internal/identity"
+	delegationinfra "github.com/martencassel/oidcsim/internal/infrastructure/delegation"
+	"github.com/martencassel/oidcsim/internal/security"
+	"github.com/martencassel/oidcsim/internal/store"
+)
+
+// newGrantFixture serves PAR, /authorize, /token, /introspect and the
+// grant management endpoint for a public client alice granted openid and
+// profile to, plus another client alice granted openid to.
+func newGrantFixture(t *testing.T) *delegationFixture {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	keys, err := security.NewKeyManager(security.KeyManagerConfig{Algorithms: []string{"RS256"}})
+	require.NoError(t, err)
+	clients := store.NewInMemoryClientStore()
+	for _, id := range []string{"app", "other"} {
+		require.NoError(t, clients.Save(ctx, store.Client{
+			ID: id, Public: true, RedirectURIs: []string{"https://app.example/cb"}, Meta: store.ClientMeta{Enabled: true},
+		}))
+	}
+	f := &delegationFixture{codes: authcode.NewStore(time.Minute), tokens: store.NewInMemoryTokenStore(), delegations: delegationinfra.NewMemoryRepo()}
+	require.NoError(t, f.delegations.Save(ctx, delegation.Delegation{
+		ID: "g1", UserID: "alice", ClientID: "app", Scopes: []string{"openid", "profile"}, CreatedAt: time.Now(),
+	}))
+	require.NoError(t, f.delegations.Save(ctx, delegation.Delegation{
+		ID: "g2", UserID: "alice", ClientID: "other", Scopes: []string{"openid"}, CreatedAt: time.Now(),
+	}))
+	var ts *TokenServiceController
+	ts = NewTokenServiceControllerBuilder().
+		WithIssuer("https://idp.test").
+		WithRoutesConfig(&RoutesConfig{
+			Discovery: "/.well-known/openid-configuration", Authorize: "/authorize", Token: "/token",
+			Introspect: "/introspect", PAR: "/par", Grants: "/grants",
+		}).
+		WithCodeStore(f.codes).
+		WithKeyManager(keys).
+		WithIdentityStore(identity.NewCoreIdentityStore("")).
+		WithClientStore(clients).
+		WithTokenStore(f.tokens).
+		WithClientAuthenticator(clientauth.NewService(clients, clientauth.NewRegistry())).
+		WithDelegations(delegationapp.NewDelegationService(f.delegations, nil)).
+		WithPushedRequests(store.NewInMemoryPushedRequestStore()).
+		WithAuthorizeFlow(func(c *gin.Context) { approveAs(c, ts, "alice") }).
+		Build()
+	f.router = gin.New()
+	ts.RegisterRoutes(f.router)
+	return f
+}
+
+// approveAs stands in for the browser flow: userID is signed in and
+// consents to every requested scope.
+func approveAs(c *gin.Context, ts *TokenServiceController, userID string) {
+	q := c.Request.URL.Query()
+	redirect, err := ts.HandleAuthorize(c.Request.Context(), oauth2.AuthorizeRequest{
+		ClientID:    q.Get("client_id"),
+		RedirectURI: q.Get("redirect_uri"),
+		Scope:       strings.Fields(q.Get("scope")),
+		State:       q.Get("state"),
+		Nonce:       q.Get("nonce"),
+	}, oauth2.User{ID: userID})
+	if err != nil {
+		writeOAuthError(c.Writer, err)
+		return
+	}
+	c.Redirect(http.StatusFound, redirect)
+}
+
+func (f *delegationFixture) grant(method, id, accessToken string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/grants/"+id, nil)
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	w := httptest.NewRecorder()
+	f.router.ServeHTTP(w, req)
+	return w
+}
+
+func (f *delegationFixture) get(target string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	f.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+	return w
+}
+
+func TestPAR_RequestURIIsUsedOnce(t *testing.T) {
+	f := newGrantFixture(t)
+
+	w := f.post("/par", "10.1.2.3:4000", url.Values{
+		"response_type": {"code"}, "redirect_uri": {"https://app.example/cb"}, "scope": {"openid"}, "state": {"s1"},
+		"grant_management_action": {"merge"}, "grant_id": {"g1"},
+		"code_challenge": {pkceChallenge("verifier")}, "code_challenge_method": {"S256"},
+	})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	var pushed PushedAuthorizationResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &pushed))
+	assert.Contains(t, pushed.RequestURI, store.RequestURIPrefix)
+	assert.Equal(t, 90, pushed.ExpiresIn)
+
+	w = f.get("/authorize?" + url.Values{"client_id": {"other"}, "request_uri": {pushed.RequestURI}}.Encode())
+	assert.Equal(t, http.StatusBadRequest, w.Code, "a request_uri only works for the client that pushed it")
+
+	authorize := "/authorize?" + url.Values{"client_id": {"app"}, "request_uri": {pushed.RequestURI}}.Encode()
+	w = f.get(authorize)
+	require.Equal(t, http.StatusFound, w.Code, w.Body.String())
+	loc, err := url.Parse(w.Header().Get("Location"))
+	require.NoError(t, err)
+	assert.Equal(t, "app.example", loc.Host)
+	assert.Equal(t, "s1", loc.Query().Get("state"), "the pushed parameters are used")
+	assert.NotEmpty(t, loc.Query().Get("code"))
+
+	w = f.get(authorize)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	code, _ := oauthError(t, w)
+	assert.Equal(t, "invalid_request_uri", code)
+}
+
+func TestAuthorizeHandler_RequiresPKCEForPublicClients(t *testing.T) {
+	f := newGrantFixture(t)
+	base := url.Values{"client_id": {"app"}, "response_type": {"code"}, "redirect_uri": {"https://app.example/cb"}, "scope": {"openid"}, "state": {"s1"}}
+
+	for name, extra := range map[string]url.Values{
+		"no challenge":    {},
+		"plain":           {"code_challenge": {pkceChallenge("verifier")}, "code_challenge_method": {"plain"}},
+		"default method":  {"code_challenge": {pkceChallenge("verifier")}},
+		"short challenge": {"code_challenge": {"abc"}, "code_challenge_method": {"S256"}},
+		"method only":     {"code_challenge_method": {"S256"}},
+	} {
+		q := url.Values{}
+		for k, v := range base {
+			q[k] = v
+		}
+		for k, v := range extra {
+			q[k] = v
+		}
+		w := f.get("/authorize?" + q.Encode())
+		require.Equal(t, http.StatusFound, w.Code, name)
+		loc, err := url.Parse(w.Header().Get("Location"))
+		require.NoError(t, err)
+		assert.Equal(t, "invalid_request", loc.Query().Get("error"), name)
+	}
+
+	base.Set("code_challenge", pkceChallenge("verifier"))
+	base.Set("code_challenge_method", "S256")
+	w := f.get("/authorize?" + base.Encode())
+	require.Equal(t, http.StatusFound, w.Code, w.Body.String())
+	loc, err := url.Parse(w.Header().Get("Location"))
+	require.NoError(t, err)
+	assert.NotEmpty(t, loc.Query().Get("code"))
+}
+
+func TestPAR_ValidatesGrantManagementAction(t *testing.T) {
+	f := newGrantFixture(t)
+
+	for _, form := range []url.Values{
+		{"grant_management_action": {"replace"}},
+		{"grant_management_action": {"create"}, "grant_id": {"g1"}},
+		{"grant_management_action": {"update"}, "grant_id": {"g1"}},
+		{"grant_id": {"g1"}},
+	} {
+		form.Set("response_type", "code")
+		form.Set("redirect_uri", "https://app.example/cb")
+		w := f.post("/par", "10.1.2.3:4000", form)
+		assert.Equal(t, http.StatusBadRequest, w.Code, form.Encode())
+		code, _ := oauthError(t, w)
+		assert.Equal(t, "invalid_request", code)
+	}
+	w := f.post("/par", "10.1.2.3:4000", url.Values{"response_type": {"code"}, "redirect_uri": {"https://evil.example/cb"}})
+	assert.Equal(t, http.StatusBadRequest, w.Code, "redirect_uri is checked at push time")
+}
+
+// managementToken returns an access token issued to the app for alice
+// with the given scope.
+func (f *delegationFixture) managementToken(t *testing.T, scope string) string {
+	t.Helper()
+	code, err := f.codes.Issue(authcode.Code{ClientID: "app", RedirectURI: "https://app.example/cb", Subject: "alice", Scope: "openid " + scope})
+	require.NoError(t, err)
+	w := f.post("/token", "10.1.2.3:4000", url.Values{"grant_type": {"authorization_code"}, "code": {code}, "redirect_uri": {"https://app.example/cb"}})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp TokenResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	return resp.AccessToken
+}
+
+func TestGrantManagement_QueryAndRevoke(t *testing.T) {
+	f := newGrantFixture(t)
+
+	w := f.token(t, "10.1.2.3:4000", url.Values{})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp TokenResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "g1", resp.GrantID, "token responses name the grant they were issued under")
+
+	for _, method := range []string{http.MethodGet, http.MethodDelete} {
+		w = f.grant(method, "g1", resp.AccessToken)
+		assert.Equal(t, http.StatusForbidden, w.Code, "the user's own access token does not manage grants")
+		errCode, _ := oauthError(t, w)
+		assert.Equal(t, "insufficient_scope", errCode)
+	}
+	query := f.managementToken(t, GrantManagementQueryScope)
+	revoke := f.managementToken(t, GrantManagementRevokeScope)
+	w = f.grant(http.MethodDelete, "g1", query)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Header().Get("WWW-Authenticate"), `scope="grant_management_revoke"`)
+
+	w = f.grant(http.MethodGet, "g1", query)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.JSONEq(t, `{"scopes":[{"scope":"openid profile"}]}`, w.Body.String())
+
+	w = f.grant(http.MethodGet, "g2", query)
+	assert.Equal(t, http.StatusNotFound, w.Code, "another client's grant is not disclosed")
+	w = f.grant(http.MethodDelete, "g2", revoke)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = f.grant(http.MethodGet, "g1", "not-a-token")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = f.grant(http.MethodDelete, "g1", revoke)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	revoked, err := f.delegations.FindByID(context.Background(), "g1")
+	require.NoError(t, err)
+	assert.True(t, revoked.IsRevoked())
+	assert.False(t, f.introspect(t, resp.AccessToken), "tokens issued under the grant are revoked with it")
+	d, err := f.delegations.FindByID(context.Background(), "g2")
+	require.NoError(t, err)
+	assert.Equal(t, "g2", d.ID)
+}
+
+func TestDiscovery_GrantManagement(t *testing.T) {
+	f := newGrantFixture(t)
+
+	w := f.get("/.well-known/openid-configuration")
+	require.Equal(t, http.StatusOK, w.Code)
+	var doc map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
+	assert.Equal(t, "https://idp.test/grants", doc["grant_management_endpoint"])
+	assert.Equal(t, []interface{}{"create", "merge", "replace"}, doc["grant_management_actions_supported"])
+	assert.Equal(t, "https://idp.test/par", doc["pushed_authorization_request_endpoint"])
+	assert.Contains(t, doc["scopes_supported"], GrantManagementQueryScope)
+	assert.Contains(t, doc["scopes_supported"], GrantManagementRevokeScope)
+}
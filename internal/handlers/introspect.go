@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// IntrospectionResponse is the body of a token introspection response
+// (RFC 7662 §2.2). Cnf carries the certificate binding of mutual-TLS bound
+// tokens (RFC 8705 §3.2).
+type IntrospectionResponse struct {
+	Active    bool              `json:"active"`
+	Scope     string            `json:"scope,omitempty"`
+	ClientID  string            `json:"client_id,omitempty"`
+	TokenType string            `json:"token_type,omitempty"`
+	Exp       int64             `json:"exp,omitempty"`
+	Iat       int64             `json:"iat,omitempty"`
+	Sub       string            `json:"sub,omitempty"`
+	Aud       string            `json:"aud,omitempty"`
+	Iss       string            `json:"iss,omitempty"`
+	Jti       string            `json:"jti,omitempty"`
+	Cnf       map[string]string `json:"cnf,omitempty"`
+}
+
+// IntrospectHandler
+func (ts *TokenServiceController) IntrospectHandler(c *gin.Context) {
+	req, err := ParseTokenRequest(c.Request)
+	if err != nil {
+		writeClientAuthError(c.Writer, c.Request, err)
+		return
+	}
+	// Introspection callers must authenticate (RFC 7662 §2.1)
+	caller, err := ts.authenticateClient(c.Request, req)
+	if err != nil {
+		log.Infof("Introspection client authentication failed: %v", err)
+		writeClientAuthError(c.Writer, c.Request, err)
+		return
+	}
+	at, err := ts.accessTokens().Validate(c.Request.Context(), c.Request.PostFormValue("token"))
+	if err != nil {
+		c.JSON(http.StatusOK, IntrospectionResponse{Active: false})
+		return
+	}
+	if err := ts.checkTokenDelegation(c.Request.Context(), at); err != nil {
+		log.Infof("Token %s is inactive: %v", at.ID, err)
+		c.JSON(http.StatusOK, IntrospectionResponse{Active: false})
+		return
+	}
+	resp := IntrospectionResponse{
+		Active:    true,
+		Scope:     strings.Join(at.Scopes, " "),
+		ClientID:  at.ClientID,
+		TokenType: "Bearer",
+		Exp:       at.ExpiresAt.Unix(),
+		Iat:       at.IssuedAt.Unix(),
+		Sub:       at.Subject,
+		Aud:       at.Audience,
+		Iss:       at.Issuer,
+		Jti:       at.ID,
+	}
+	if caller.ID != at.ClientID {
+		// A caller other than the token's client gets the sub it would
+		// see itself, so pairwise clients cannot correlate users through
+		// each other's tokens.
+		resp.Sub = ""
+		if local, ok := ts.localSubject(c.Request.Context(), ts.tokenClient(c.Request.Context(), at.ClientID), at.Subject); ok {
+			resp.Sub = ts.subjects.For(*caller, local)
+		}
+	}
+	if at.CertThumbprint != "" {
+		resp.Cnf = map[string]string{"x5t#S256": at.CertThumbprint}
+	}
+	c.JSON(http.StatusOK, resp)
+}
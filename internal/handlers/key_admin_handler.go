@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/martencassel/oidcsim/internal/security"
+)
+
+// API Handler for signing key administration
+//
+// GET  /api/keys         list managed keys and their state
+// POST /api/keys/rotate  publish new keys; they sign after the publish-ahead delay.
+//                        ?alg=ES256 rotates one algorithm only.
+//
+// Every route requires "Authorization: Bearer <admin API key>".
+
+type KeyAdminApiHandler struct {
+	keys    *security.KeyManager
+	apiKeys []string
+	g       *gin.RouterGroup
+}
+
+func NewKeyAdminHandler(keys *security.KeyManager, apiKeys []string) *KeyAdminApiHandler {
+	return &KeyAdminApiHandler{keys: keys, apiKeys: apiKeys}
+}
+
+func (h *KeyAdminApiHandler) RegisterRoutes(rg *gin.Engine) {
+	h.g = rg.Group("/api/keys", RequireAdminKey(h.apiKeys))
+	h.g.GET("", h.handleListKeys)
+	h.g.POST("/rotate", h.handleRotate)
+}
+
+func (h *KeyAdminApiHandler) handleListKeys(c *gin.Context) {
+	c.JSON(200, h.keys.Keys())
+}
+
+func (h *KeyAdminApiHandler) handleRotate(c *gin.Context) {
+	alg := c.Query("alg")
+	if alg != "" && !h.keys.Supports(alg) {
+		c.JSON(400, gin.H{"error": "unsupported algorithm " + alg})
+		return
+	}
+	keys, err := h.keys.Rotate(alg)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(201, keys)
+}
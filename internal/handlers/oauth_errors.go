@@ -2,7 +2,10 @@ package handlers
 
 import (
 	"encoding/json"
+	stderrors "errors"
 	"net/http"
+	"net/url"
+	"strings"
 
 	"github.com/martencassel/oidcsim/internal/errors"
 )
@@ -13,9 +16,14 @@ func writeOAuthError(w http.ResponseWriter, err error) {
 	code := errors.ErrServerError
 	desc := "internal server error"
 
-	if ae, ok := err.(errors.AuthError); ok {
+	var ae errors.AuthError
+	if stderrors.As(err, &ae) {
 		code = ae
-		desc = ae.Error() // or a friendlier description if you have one
+		desc = ae.Description()
+		var withDesc *errors.AuthErrorWithDescription
+		if stderrors.As(err, &withDesc) {
+			desc = withDesc.DescriptionText
+		}
 		status = http.StatusBadRequest
 
 		if ae == errors.ErrInvalidClient {
@@ -31,6 +39,16 @@ func writeOAuthError(w http.ResponseWriter, err error) {
 	})
 }
 
+// writeClientAuthError writes a token endpoint error. When a client that
+// tried HTTP Basic authentication fails, the response is a 401 with a
+// WWW-Authenticate challenge (RFC 6749 §5.2).
+func writeClientAuthError(w http.ResponseWriter, r *http.Request, err error) {
+	if stderrors.Is(err, errors.ErrInvalidClient) && strings.HasPrefix(strings.ToLower(r.Header.Get("Authorization")), "basic ") {
+		w.Header().Set("WWW-Authenticate", `Basic realm="token"`)
+	}
+	writeOAuthError(w, err)
+}
+
 func writeTokenError(w http.ResponseWriter, status int, err errors.AuthError, description string) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
@@ -43,8 +61,18 @@ func writeTokenError(w http.ResponseWriter, status int, err errors.AuthError, de
 func writeAuthorizeError(w http.ResponseWriter, redirectURI string, state string, err errors.AuthError, description string) {
 	// If we have a redirect URI, redirect with error parameters
 	if redirectURI != "" {
-		http.Redirect(w, nil, redirectURI+"?error="+err.Error()+"&error_description="+description+"&state="+state, http.StatusFound)
-		return
+		if u, perr := url.Parse(redirectURI); perr == nil {
+			q := u.Query()
+			q.Set("error", err.Error())
+			q.Set("error_description", description)
+			if state != "" {
+				q.Set("state", state)
+			}
+			u.RawQuery = q.Encode()
+			w.Header().Set("Location", u.String())
+			w.WriteHeader(http.StatusFound)
+			return
+		}
 	}
 	// Otherwise, just write the error directly
 	w.Header().Set("Content-Type", "application/json")
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/martencassel/oidcsim/internal/domain/delegation"
+	"github.com/martencassel/oidcsim/internal/errors"
+	"github.com/martencassel/oidcsim/internal/store"
+)
+
+// pushedRequestTTL is how long a request_uri stays valid. The user agent
+// is redirected to /authorize right after the push, so it is short.
+const pushedRequestTTL = 90 * time.Second
+
+// parCredentialParams authenticate the client at the PAR endpoint and are
+// not part of the authorization request it pushes.
+var parCredentialParams = []string{"client_secret", "client_assertion", "client_assertion_type"}
+
+// PushedAuthorizationResponse is the PAR endpoint's answer (RFC 9126 §2.2).
+type PushedAuthorizationResponse struct {
+	RequestURI string `json:"request_uri"`
+	ExpiresIn  int    `json:"expires_in"`
+}
+
+// PARHandler accepts a pushed authorization request (RFC 9126) from an
+// authenticated client and returns the request_uri the client sends the
+// user agent to /authorize with. The parameters are checked as far as
+// they can be without the user, so errors reach the client directly
+// rather than through a redirect.
+func (ts *TokenServiceController) PARHandler(c *gin.Context) {
+	req, err := ParseTokenRequest(c.Request)
+	if err != nil {
+		writeClientAuthError(c.Writer, c.Request, err)
+		return
+	}
+	client, err := ts.authenticateClient(c.Request, req)
+	if err != nil {
+		log.Infof("PAR client authentication failed: %v", err)
+		writeClientAuthError(c.Writer, c.Request, err)
+		return
+	}
+	params := url.Values{}
+	for k, v := range c.Request.PostForm {
+		params[k] = v
+	}
+	for _, k := range parCredentialParams {
+		params.Del(k)
+	}
+	if params.Has("request_uri") {
+		writeOAuthError(c.Writer, errors.ErrInvalidRequest.WithDescription("request_uri must not be pushed"))
+		return
+	}
+	if !client.IsRedirectURIMatching(params.Get("redirect_uri")) {
+		writeOAuthError(c.Writer, errors.ErrInvalidRequest.WithDescription("redirect_uri is not registered for this client"))
+		return
+	}
+	if _, err := delegation.ParseGrantManagementAction(params.Get("grant_management_action"), params.Get("grant_id")); err != nil {
+		writeOAuthError(c.Writer, errors.ErrInvalidRequest.WithDescription(err.Error()))
+		return
+	}
+	params.Set("client_id", client.ID)
+	pushed, err := ts.pushed.Push(c.Request.Context(), client.ID, params, pushedRequestTTL)
+	if err != nil {
+		writeOAuthError(c.Writer, err)
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusCreated, PushedAuthorizationResponse{
+		RequestURI: pushed.RequestURI,
+		ExpiresIn:  int(pushedRequestTTL.Seconds()),
+	})
+}
+
+// takePushedRequest returns the parameters pushed under the request_uri
+// of an authorization request, or the request's own query when it has
+// none. The client_id in the query must match the pushing client.
+func takePushedRequest(c *gin.Context, pushed store.PushedRequestStore) (url.Values, error) {
+	query := c.Request.URL.Query()
+	uri := query.Get("request_uri")
+	if uri == "" {
+		return query, nil
+	}
+	if pushed == nil {
+		return nil, errors.ErrRequestURINotSupported
+	}
+	req, err := pushed.Take(c.Request.Context(), query.Get("client_id"), uri)
+	if err != nil {
+		return nil, errors.ErrInvalidRequestURI.WithDescription(err.Error())
+	}
+	return req.Params, nil
+}
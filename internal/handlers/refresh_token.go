@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/martencassel/oidcsim/internal/errors"
+	infrasecurity "github.com/martencassel/oidcsim/internal/infrastructure/security"
+	"github.com/martencassel/oidcsim/internal/store"
+)
+
+const refreshTokenTTL = 30 * 24 * time.Hour
+
+// issueRefreshToken issues a refresh token for the scope the user granted,
+// if the client registered the refresh_token grant. Only the hash of the
+// token is stored.
+func (ts *TokenServiceController) issueRefreshToken(ctx context.Context, client store.Client, grant *tokenGrant) (string, error) {
+	if ts.refreshes == nil || !client.AllowsGrantType("refresh_token") {
+		return "", nil
+	}
+	raw, err := infrasecurity.GenerateRandomString(32)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	err = ts.refreshes.Save(ctx, store.RefreshToken{
+		ID:           store.OpaqueTokenID(raw),
+		ClientID:     client.ID,
+		Subject:      grant.subject,
+		Scope:        grant.granted,
+		DelegationID: grant.delegationID,
+		IssuedAt:     now,
+		ExpiresAt:    now.Add(refreshTokenTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+	return raw, nil
+}
+
+// refreshGrant exchanges a refresh token for new tokens (RFC 6749 §6). A
+// narrower scope may be requested, never a wider one. The delegation the
+// refresh token was issued under must still allow the request, so revoking
+// it ends the refresh. The refresh token is used up and a new one is issued
+// with the response.
+func (ts *TokenServiceController) refreshGrant(c *gin.Context, client store.Client, req *TokenRequest) (*tokenGrant, error) {
+	if !client.AllowsGrantType("refresh_token") {
+		return nil, errors.ErrUnauthorizedClient.WithDescription("the client is not registered for the refresh_token grant")
+	}
+	if req.RefreshToken == "" {
+		return nil, errors.ErrInvalidRequest.WithDescription("refresh_token is required")
+	}
+	if ts.refreshes == nil {
+		return nil, errors.ErrInvalidGrant.WithDescription(store.ErrRefreshTokenNotFound.Error())
+	}
+	ctx := c.Request.Context()
+	id := store.OpaqueTokenID(req.RefreshToken)
+	rt, err := ts.refreshes.Get(ctx, client.ID, id)
+	if err != nil {
+		return nil, errors.ErrInvalidGrant.WithDescription(err.Error())
+	}
+
+	scope := rt.Scope
+	if req.Scope != "" {
+		granted := strings.Fields(rt.Scope)
+		for _, s := range strings.Fields(req.Scope) {
+			if !slices.Contains(granted, s) {
+				return nil, errors.ErrInvalidScope.WithDescription("scope " + s + " was not granted")
+			}
+		}
+		scope = req.Scope
+	}
+
+	delegationID := rt.DelegationID
+	if delegationID == "" {
+		// Issued before the user delegated to the client, if at all
+		delegationID, err = ts.checkDelegation(c, client, rt.Subject)
+	} else if ts.delegations != nil {
+		err = ts.delegations.ValidateDelegationForRefresh(ctx, delegationID, delegationUse(c, client))
+		if err != nil {
+			err = delegationError(err)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Taking the token fails if a concurrent request used it first
+	if _, err := ts.refreshes.Take(ctx, client.ID, id); err != nil {
+		return nil, errors.ErrInvalidGrant.WithDescription(err.Error())
+	}
+	return &tokenGrant{
+		subject:      rt.Subject,
+		scope:        scope,
+		granted:      rt.Scope,
+		delegationID: delegationID,
+	}, nil
+}
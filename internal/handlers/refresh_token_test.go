@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/martencassel/oidcsim/internal/domain/delegation"
+)
+
+func (f *delegationFixture) refresh(t *testing.T, refreshToken string, form url.Values) *httptest.ResponseRecorder {
+	t.Helper()
+	form.Set("grant_type", "refresh_token")
+	form.Set("refresh_token", refreshToken)
+	return f.post("/token", "10.1.2.3:4000", form)
+}
+
+func tokenResponse(t *testing.T, w *httptest.ResponseRecorder) TokenResponse {
+	t.Helper()
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp TokenResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	return resp
+}
+
+func TestTokenHandler_RefreshTokenGrant(t *testing.T) {
+	f := newDelegationFixture(t, delegation.Constraints{})
+	first := tokenResponse(t, f.token(t, "10.1.2.3:4000", url.Values{}))
+	require.NotEmpty(t, first.RefreshToken)
+
+	w := f.refresh(t, first.RefreshToken, url.Values{"scope": {"openid email"}})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	code, _ := oauthError(t, w)
+	assert.Equal(t, "invalid_scope", code, "the scope cannot grow")
+
+	second := tokenResponse(t, f.refresh(t, first.RefreshToken, url.Values{"scope": {"openid"}}))
+	assert.Equal(t, "openid", second.Scope)
+	assert.Equal(t, "d1", second.GrantID)
+	assert.NotEqual(t, first.RefreshToken, second.RefreshToken)
+	assert.True(t, f.introspect(t, second.AccessToken))
+
+	w = f.refresh(t, first.RefreshToken, url.Values{})
+	code, _ = oauthError(t, w)
+	assert.Equal(t, "invalid_grant", code, "refresh tokens are rotated")
+
+	require.NoError(t, f.delegations.Revoke(context.Background(), "d1", time.Now()))
+	w = f.refresh(t, second.RefreshToken, url.Values{})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	code, desc := oauthError(t, w)
+	assert.Equal(t, "invalid_grant", code)
+	assert.Equal(t, delegation.ErrRevoked.Error(), desc)
+}
+
+func TestRevokeHandler_RefreshToken(t *testing.T) {
+	f := newDelegationFixture(t, delegation.Constraints{})
+	resp := tokenResponse(t, f.token(t, "10.1.2.3:4000", url.Values{}))
+
+	w := f.post("/revoke", "10.1.2.3:4000", url.Values{"token": {resp.RefreshToken}, "token_type_hint": {"refresh_token"}})
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = f.refresh(t, resp.RefreshToken, url.Values{})
+	code, _ := oauthError(t, w)
+	assert.Equal(t, "invalid_grant", code)
+	assert.False(t, f.introspect(t, resp.AccessToken), "access tokens of the same grant are revoked with it")
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/martencassel/oidcsim/internal/security"
+	"github.com/martencassel/oidcsim/internal/store"
+)
+
+// encryptForClient wraps plaintext in a JWE addressed to the client. For
+// a signed JWT, cty is "JWT" and the result is a nested token (OIDC Core
+// §16.14: sign, then encrypt). With no alg registered the plaintext is
+// returned unchanged.
+//
+// The recipient key comes from the client's registered JWKS. When no
+// suitable key is found the set is refreshed once, in case the client
+// rotated its keys.
+func (ts *TokenServiceController) encryptForClient(ctx context.Context, client store.Client, alg, enc string, plaintext []byte, cty string) (string, error) {
+	if alg == "" {
+		return string(plaintext), nil
+	}
+	if enc == "" {
+		enc = security.DefaultEncryptionEnc
+	}
+	if ts.clientKeys == nil {
+		return "", fmt.Errorf("client key resolver not configured")
+	}
+	set, err := ts.clientKeys.Resolve(ctx, client, false)
+	if err != nil {
+		return "", err
+	}
+	key, err := security.SelectEncryptionKey(set, alg)
+	if err != nil {
+		if set, err = ts.clientKeys.Resolve(ctx, client, true); err != nil {
+			return "", err
+		}
+		if key, err = security.SelectEncryptionKey(set, alg); err != nil {
+			return "", err
+		}
+	}
+	return security.EncryptJWE(plaintext, key, alg, enc, cty)
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/martencassel/oidcsim/internal/clientauth"
+	"github.com/martencassel/oidcsim/internal/dto"
+	"github.com/martencassel/oidcsim/internal/security"
+	"github.com/martencassel/oidcsim/internal/store"
+	jwksutil "github.com/martencassel/oidcsim/jwskutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientAdmin_ValidatesResponseEncryption(t *testing.T) {
+	r, _, _ := newAdminRouter(t)
+
+	w := adminRequest(r, http.MethodPost, "/api/clients", `{"client_id":"a","id_token_encrypted_response_alg":"RSA-OAEP"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "encryption needs registered keys")
+
+	w = adminRequest(r, http.MethodPost, "/api/clients", `{"client_id":"b","userinfo_encrypted_response_enc":"A128GCM","jwks_uri":"https://b.example/jwks"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "enc without alg")
+
+	w = adminRequest(r, http.MethodPost, "/api/clients", `{"client_id":"c","id_token_encrypted_response_alg":"RSA1_5","jwks_uri":"https://c.example/jwks"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = adminRequest(r, http.MethodPost, "/api/clients", `{"client_id":"d","id_token_encrypted_response_alg":"ECDH-ES","jwks_uri":"https://d.example/jwks"}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created dto.ClientAdminResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Equal(t, security.DefaultEncryptionEnc, created.IDTokenEncryptedEnc)
+}
+
+func TestEncryptForClient_NestedAndDecryptable(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	keys, err := security.NewKeyManager(security.KeyManagerConfig{Algorithms: []string{"ES256"}})
+	require.NoError(t, err)
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	jwk, err := jwksutil.FromPublicKey(priv.Public(), "client-enc", "", "enc")
+	require.NoError(t, err)
+	rawJWKS, err := json.Marshal(jwksutil.JWKS{Keys: []jwksutil.JWK{jwk}})
+	require.NoError(t, err)
+
+	ts := NewTokenServiceControllerBuilder().
+		WithKeyManager(keys).
+		WithClientKeys(clientauth.NewJWKSResolver(nil, time.Minute)).
+		Build()
+	client := store.Client{ID: "app", Meta: store.ClientMeta{JWKS: rawJWKS}}
+
+	signed, err := keys.Sign("", jwt.MapClaims{"sub": "alice", "exp": time.Now().Add(time.Hour).Unix()}, "")
+	require.NoError(t, err)
+	plain, err := ts.encryptForClient(context.Background(), client, "", "", []byte(signed), "JWT")
+	require.NoError(t, err)
+	assert.Equal(t, signed, plain, "no alg registered leaves the token unencrypted")
+
+	encrypted, err := ts.encryptForClient(context.Background(), client, "ECDH-ES", "A256GCM", []byte(signed), "JWT")
+	require.NoError(t, err)
+
+	r := gin.New()
+	NewDebugHandler(keys, []string{testAdminKey}).RegisterRoutes(r)
+	der, err := x509.MarshalECPrivateKey(priv)
+	require.NoError(t, err)
+	body, err := json.Marshal(decryptRequest{
+		JWE:           encrypted,
+		PrivateKeyPEM: string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})),
+	})
+	require.NoError(t, err)
+	w := adminRequest(r, http.MethodPost, "/api/debug/decrypt", string(body))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var resp decryptResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "client-enc", resp.Header.Kid)
+	assert.Equal(t, "JWT", resp.Header.Cty)
+	assert.Equal(t, signed, resp.Plaintext)
+	assert.True(t, resp.SignatureOK)
+	assert.Equal(t, "alice", resp.Claims["sub"])
+}
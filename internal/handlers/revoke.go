@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/martencassel/oidcsim/internal/errors"
+	"github.com/martencassel/oidcsim/internal/store"
+)
+
+// RevokeHandler revokes an access or refresh token (RFC 7009). The client
+// must authenticate and may only revoke its own tokens. Unknown, expired
+// and already revoked tokens get the same 200 response as a successful
+// revocation, since the client's goal is met either way (§2.2).
+func (ts *TokenServiceController) RevokeHandler(c *gin.Context) {
+	req, err := ParseTokenRequest(c.Request)
+	if err != nil {
+		writeClientAuthError(c.Writer, c.Request, err)
+		return
+	}
+	client, err := ts.authenticateClient(c.Request, req)
+	if err != nil {
+		log.Infof("Revocation client authentication failed: %v", err)
+		writeClientAuthError(c.Writer, c.Request, err)
+		return
+	}
+	token := c.Request.PostFormValue("token")
+	if token == "" {
+		writeOAuthError(c.Writer, errors.ErrInvalidRequest.WithDescription("token is required"))
+		return
+	}
+	// token_type_hint only speeds up the lookup (§2.1), so both kinds of
+	// token are looked up. A refresh token takes the access tokens issued
+	// to the client for the same user with it.
+	if ts.refreshes != nil {
+		if rt, err := ts.refreshes.Take(c.Request.Context(), client.ID, store.OpaqueTokenID(token)); err == nil {
+			if ts.tokens != nil {
+				sub := ts.subjects.For(*client, rt.Subject)
+				if err := ts.tokens.RevokeBySubject(c.Request.Context(), client.ID, sub, time.Now()); err != nil {
+					log.Errorf("Failed to revoke tokens of %s for client %s: %v", sub, client.ID, err)
+					writeOAuthError(c.Writer, errors.ErrServerError.WithDescription("failed to revoke token"))
+					return
+				}
+			}
+			c.Status(http.StatusOK)
+			return
+		}
+	}
+	at, err := ts.accessTokens().Validate(c.Request.Context(), token)
+	if err != nil {
+		c.Status(http.StatusOK)
+		return
+	}
+	if at.ClientID != client.ID {
+		writeOAuthError(c.Writer, errors.ErrUnauthorizedClient.WithDescription("the token was not issued to this client"))
+		return
+	}
+	if ts.tokens != nil {
+		if err := ts.tokens.Revoke(c.Request.Context(), at.ID, time.Now()); err != nil {
+			log.Errorf("Failed to revoke token %s: %v", at.ID, err)
+			writeOAuthError(c.Writer, errors.ErrServerError.WithDescription("failed to revoke token"))
+			return
+		}
+	}
+	c.Status(http.StatusOK)
+}
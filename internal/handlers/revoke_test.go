@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/martencassel/oidcsim/internal/domain/delegation"
+	"github.com/martencassel/oidcsim/internal/store"
+)
+
+func TestRevokeHandler(t *testing.T) {
+	f := newDelegationFixture(t, delegation.Constraints{})
+	require.NoError(t, f.clients.Save(context.Background(), store.Client{ID: "other", Public: true, Meta: store.ClientMeta{Enabled: true}}))
+	w := f.token(t, "10.1.2.3:4000", url.Values{})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp TokenResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+
+	// Another client cannot revoke the token
+	form := url.Values{"client_id": {"other"}, "token": {resp.AccessToken}}
+	req := httptest.NewRequest(http.MethodPost, "/revoke", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	f.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.True(t, f.introspect(t, resp.AccessToken))
+
+	w = f.post("/revoke", "10.1.2.3:4000", url.Values{"token": {resp.AccessToken}, "token_type_hint": {"access_token"}})
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.False(t, f.introspect(t, resp.AccessToken))
+
+	// Revoking again, or an unknown token, succeeds without effect (RFC 7009 §2.2)
+	w = f.post("/revoke", "10.1.2.3:4000", url.Values{"token": {resp.AccessToken}})
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = f.post("/revoke", "10.1.2.3:4000", url.Values{"token": {"not-a-token"}})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = f.post("/revoke", "10.1.2.3:4000", url.Values{})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
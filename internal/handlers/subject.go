@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"context"
+	stderrors "errors"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/martencassel/oidcsim/internal/security"
+	"github.com/martencassel/oidcsim/internal/store"
+)
+
+// localSubject maps sub, as issued to client, back to the local user ID.
+// Pairwise subs this process has not derived yet are found by deriving
+// the client's sub for every user, which only happens after a restart.
+func (ts *TokenServiceController) localSubject(ctx context.Context, client store.Client, sub string) (string, bool) {
+	if local, ok := ts.subjects.Local(client, sub); ok {
+		return local, true
+	}
+	if ts.idStore == nil || sub == "" {
+		return "", false
+	}
+	users, err := ts.idStore.ListUsers(ctx)
+	if err != nil {
+		return "", false
+	}
+	for _, u := range users {
+		if ts.subjects.Match(client, sub, u.GetID()) {
+			return u.GetID(), true
+		}
+	}
+	return "", false
+}
+
+// tokenClient returns the registration of the client a token was issued
+// to, or a bare client with that ID when it cannot be read.
+func (ts *TokenServiceController) tokenClient(ctx context.Context, clientID string) store.Client {
+	if ts.clients != nil {
+		if found, err := ts.clients.GetByID(ctx, clientID); err == nil {
+			return found
+		}
+	}
+	return store.Client{ID: clientID}
+}
+
+// idTokenHintUser verifies an ID token this server issued and returns the
+// local user it was issued for and its audience.
+func (ts *TokenServiceController) idTokenHintUser(ctx context.Context, hint string) (string, string, error) {
+	if ts.keys == nil {
+		return "", "", stderrors.New("signing keys not configured")
+	}
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(hint, claims, ts.keys.Keyfunc, jwt.WithIssuer(ts.issuer), jwt.WithValidMethods(security.SupportedAlgorithms))
+	if err != nil && !stderrors.Is(err, jwt.ErrTokenExpired) {
+		return "", "", stderrors.New("id_token_hint is invalid")
+	}
+	aud, _ := claims.GetAudience()
+	sub, _ := claims.GetSubject()
+	if len(aud) == 0 {
+		return "", "", stderrors.New("id_token_hint has no audience")
+	}
+	local, ok := ts.localSubject(ctx, ts.tokenClient(ctx, aud[0]), sub)
+	if !ok {
+		return "", "", stderrors.New("id_token_hint names an unknown user")
+	}
+	return local, aud[0], nil
+}
@@ -1,11 +1,15 @@
 package handlers
 
 import (
-	"crypto/rsa"
+	"context"
+	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/url"
+	"regexp"
+	"slices"
 	"strings"
 	"time"
 
@@ -14,9 +18,22 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/martencassel/oidcsim/authcode"
+	"github.com/martencassel/oidcsim/internal/application/claimmapping"
+	delegationapp "github.com/martencassel/oidcsim/internal/application/delegation"
+	"github.com/martencassel/oidcsim/internal/application/identitysources"
+	"github.com/martencassel/oidcsim/internal/application/subject"
+	"github.com/martencassel/oidcsim/internal/clientauth"
+	"github.com/martencassel/oidcsim/internal/domain/delegation"
+	"github.com/martencassel/oidcsim/internal/domain/oauth2"
+	"github.com/martencassel/oidcsim/internal/dto"
+	"github.com/martencassel/oidcsim/internal/errors"
 	"github.com/martencassel/oidcsim/internal/identity"
+	"github.com/martencassel/oidcsim/internal/security"
+	"github.com/martencassel/oidcsim/internal/store"
 )
 
+// RoutesConfig holds the endpoint paths. Empty optional routes are not
+// served, and discovery only advertises routes that are.
 type RoutesConfig struct {
 	Discovery  string `yaml:"discovery"`
 	JWKS       string `yaml:"jwks"`
@@ -25,16 +42,52 @@ type RoutesConfig struct {
 	Userinfo   string `yaml:"userinfo"`
 	Introspect string `yaml:"introspect"`
 	Revoke     string `yaml:"revoke"`
-	Logout     string `yaml:"logout"`
+	Logout     string `yaml:"logout"` // end_session_endpoint
+	Claims     string `yaml:"claims"` // distributed claims endpoints, at <path>/<provider>
+
+	// AuthorizationServerMetadata is the RFC 8414 well-known prefix. The
+	// issuer's path, if any, is appended to it.
+	AuthorizationServerMetadata string `yaml:"authorization_server_metadata"`
+
+	WebFinger string `yaml:"webfinger"` // RFC 7033; host-wide, so only the primary issuer serves it
+
+	PAR          string `yaml:"par"`           // RFC 9126
+	Grants       string `yaml:"grants"`        // FAPI Grant Management, at <path>/{grant_id}
+	Device       string `yaml:"device"`        // RFC 8628
+	CIBA         string `yaml:"ciba"`          // OIDC CIBA backchannel authentication
+	Registration string `yaml:"registration"`  // OIDC Dynamic Client Registration
+	CheckSession string `yaml:"check_session"` // OIDC Session Management iframe
 }
 
+// supportedResponseTypes and supportedGrantTypes are what AuthorizeHandler
+// and TokenHandler implement. Discovery advertises exactly these.
+var (
+	supportedResponseTypes = []string{"code"}
+	supportedGrantTypes    = []string{"authorization_code", "refresh_token"}
+)
+
 type TokenServiceController struct {
-	issuer         string
-	routesConfig   *RoutesConfig
-	jwks           []byte
-	codeStore      *authcode.Store
-	privSigningKey *rsa.PrivateKey
-	idStore        *identity.CoreIdentityStore
+	issuer       string
+	routesConfig *RoutesConfig
+	codeStore    *authcode.Store
+	keys         *security.KeyManager
+	idStore      *identity.CoreIdentityStore
+	clients      store.ClientStore
+	tokens       store.TokenStore
+	refreshes    store.RefreshTokenStore
+	clientAuth   *clientauth.Service
+	certs        clientauth.CertificateSource
+	clientKeys   *clientauth.JWKSResolver
+	claimMapping *claimmapping.Pipeline
+	subjects     *subject.Identifiers
+	claimSources *identitysources.ClaimSources
+	delegations  delegationapp.DelegationService
+	pushed       store.PushedRequestStore
+	authorize    gin.HandlerFunc // signs the user in and asks for consent
+	served       map[string]bool // paths registered by RegisterRoutes
+
+	signedMetadata      bool
+	webFingerCheckUsers bool
 }
 
 type TokenServiceControllerBuilder struct {
@@ -57,18 +110,14 @@ func (b *TokenServiceControllerBuilder) WithRoutesConfig(cfg *RoutesConfig) *Tok
 	return b
 }
 
-func (b *TokenServiceControllerBuilder) WithJWKS(jwks []byte) *TokenServiceControllerBuilder {
-	b.controller.jwks = jwks
-	return b
-}
-
 func (b *TokenServiceControllerBuilder) WithCodeStore(store *authcode.Store) *TokenServiceControllerBuilder {
 	b.controller.codeStore = store
 	return b
 }
 
-func (b *TokenServiceControllerBuilder) WithSigningKey(key *rsa.PrivateKey) *TokenServiceControllerBuilder {
-	b.controller.privSigningKey = key
+// WithKeyManager sets the source of signing keys and the published JWKS.
+func (b *TokenServiceControllerBuilder) WithKeyManager(keys *security.KeyManager) *TokenServiceControllerBuilder {
+	b.controller.keys = keys
 	return b
 }
 
@@ -77,24 +126,191 @@ func (b *TokenServiceControllerBuilder) WithIdentityStore(store *identity.CoreId
 	return b
 }
 
+func (b *TokenServiceControllerBuilder) WithClientStore(clients store.ClientStore) *TokenServiceControllerBuilder {
+	b.controller.clients = clients
+	return b
+}
+
+func (b *TokenServiceControllerBuilder) WithTokenStore(tokens store.TokenStore) *TokenServiceControllerBuilder {
+	b.controller.tokens = tokens
+	return b
+}
+
+// WithRefreshTokens sets where refresh tokens are kept. Without it, no
+// refresh tokens are issued.
+func (b *TokenServiceControllerBuilder) WithRefreshTokens(refreshes store.RefreshTokenStore) *TokenServiceControllerBuilder {
+	b.controller.refreshes = refreshes
+	return b
+}
+
+func (b *TokenServiceControllerBuilder) WithClientAuthenticator(svc *clientauth.Service) *TokenServiceControllerBuilder {
+	b.controller.clientAuth = svc
+	return b
+}
+
+// WithCertificateSource configures where client certificates are read from
+// when TLS is terminated in front of the server.
+func (b *TokenServiceControllerBuilder) WithCertificateSource(src clientauth.CertificateSource) *TokenServiceControllerBuilder {
+	b.controller.certs = src
+	return b
+}
+
+// WithClientKeys sets the resolver for client key sets, used to encrypt
+// ID tokens and userinfo responses to the client.
+func (b *TokenServiceControllerBuilder) WithClientKeys(keys *clientauth.JWKSResolver) *TokenServiceControllerBuilder {
+	b.controller.clientKeys = keys
+	return b
+}
+
+// WithClaimMapping sets the identity source claim mappings. Client
+// mappings are read from the client registration.
+func (b *TokenServiceControllerBuilder) WithClaimMapping(p *claimmapping.Pipeline) *TokenServiceControllerBuilder {
+	b.controller.claimMapping = p
+	return b
+}
+
+// WithClaimSources sets the external claims providers released as
+// aggregated and distributed claims.
+func (b *TokenServiceControllerBuilder) WithClaimSources(cs *identitysources.ClaimSources) *TokenServiceControllerBuilder {
+	b.controller.claimSources = cs
+	return b
+}
+
+// WithDelegations sets the delegation service whose constraints token
+// requests and introspection are checked against.
+func (b *TokenServiceControllerBuilder) WithDelegations(svc delegationapp.DelegationService) *TokenServiceControllerBuilder {
+	b.controller.delegations = svc
+	return b
+}
+
+// WithPushedRequests sets where pushed authorization requests are kept
+// until their request_uri is used. Both authorization endpoints must share
+// it with the PAR endpoint.
+func (b *TokenServiceControllerBuilder) WithPushedRequests(pushed store.PushedRequestStore) *TokenServiceControllerBuilder {
+	b.controller.pushed = pushed
+	return b
+}
+
+// WithAuthorizeFlow sets the browser flow that signs the user in and asks
+// for consent. AuthorizeHandler validates the request and hands it over;
+// the flow issues the code through HandleAuthorize. Without one, valid
+// authorization requests fail with server_error.
+func (b *TokenServiceControllerBuilder) WithAuthorizeFlow(flow gin.HandlerFunc) *TokenServiceControllerBuilder {
+	b.controller.authorize = flow
+	return b
+}
+
+// WithSubjectIdentifiers sets how pairwise subject identifiers are derived.
+// Without it, Build uses a random salt, so pairwise subs change on restart.
+func (b *TokenServiceControllerBuilder) WithSubjectIdentifiers(ids *subject.Identifiers) *TokenServiceControllerBuilder {
+	b.controller.subjects = ids
+	return b
+}
+
+// WithSignedMetadata adds a signed_metadata JWT (RFC 8414 §2.1) to the
+// provider metadata documents.
+func (b *TokenServiceControllerBuilder) WithSignedMetadata(enabled bool) *TokenServiceControllerBuilder {
+	b.controller.signedMetadata = enabled
+	return b
+}
+
+// WithWebFingerUserCheck makes WebFinger answer only for resources that
+// name a user known to the identity store.
+func (b *TokenServiceControllerBuilder) WithWebFingerUserCheck(enabled bool) *TokenServiceControllerBuilder {
+	b.controller.webFingerCheckUsers = enabled
+	return b
+}
+
 func (b *TokenServiceControllerBuilder) Build() *TokenServiceController {
+	if b.controller.subjects == nil {
+		b.controller.subjects = subject.NewIdentifiers(nil)
+	}
 	return b.controller
 }
 
 func (ts *TokenServiceController) RegisterRoutes(r gin.IRoutes) {
-	r.GET(ts.routesConfig.Discovery, ts.DiscoveryHandler)    // /.well-known/openid-configuration
-	r.GET(ts.routesConfig.JWKS, ts.JWKSHandler)              // /.well-known/jwks.json
-	r.GET(ts.routesConfig.Authorize, ts.AuthorizeHandler)    // /authorize
-	r.POST(ts.routesConfig.Token, ts.TokenHandler)           // /token
-	r.GET(ts.routesConfig.Userinfo, ts.UserInfoHandler)      // /userinfo
-	r.POST(ts.routesConfig.Introspect, ts.IntrospectHandler) // /introspect
-	r.POST(ts.routesConfig.Revoke, ts.RevokeHandler)         // /revoke
-	r.POST(ts.routesConfig.Logout, ts.LogoutHandler)         // /logout (RP-Initiated Logout)
+	ts.handle(r, http.MethodGet, ts.routesConfig.Discovery, ts.DiscoveryHandler)                  // /.well-known/openid-configuration
+	ts.handle(r, http.MethodGet, ts.routesConfig.JWKS, ts.JWKSHandler)                            // /.well-known/jwks.json
+	ts.handle(r, http.MethodGet, ts.routesConfig.Authorize, ts.AuthorizeHandler)                  // /authorize
+	ts.handle(r, http.MethodPost, ts.routesConfig.Token, ts.TokenHandler)                         // /token
+	ts.handle(r, http.MethodGet, ts.routesConfig.Userinfo, ts.UserInfoHandler)                    // /userinfo
+	ts.handle(r, http.MethodPost, ts.routesConfig.Userinfo, ts.UserInfoHandler)                   // /userinfo (form-encoded access_token)
+	ts.handle(r, http.MethodPost, ts.routesConfig.Introspect, ts.IntrospectHandler)               // /introspect
+	ts.handle(r, http.MethodPost, ts.routesConfig.Revoke, ts.RevokeHandler)                       // /revoke
+	ts.handle(r, http.MethodPost, ts.routesConfig.Logout, ts.LogoutHandler)                       // /logout (RP-Initiated Logout)
+	ts.handle(r, http.MethodGet, claimSourceRoute(ts.routesConfig.Claims), ts.ClaimSourceHandler) // /claims/{provider} (distributed claims)
+	ts.handle(r, http.MethodGet, ts.routesConfig.WebFinger, ts.WebFingerHandler)                  // /.well-known/webfinger
+	if ts.pushed != nil {
+		ts.handle(r, http.MethodPost, ts.routesConfig.PAR, ts.PARHandler) // /par (RFC 9126)
+	}
+	if ts.delegations != nil {
+		ts.handle(r, http.MethodGet, grantRoute(ts.routesConfig.Grants), ts.GrantHandler)          // /grants/{grant_id}
+		ts.handle(r, http.MethodDelete, grantRoute(ts.routesConfig.Grants), ts.RevokeGrantHandler) // /grants/{grant_id}
+	}
+}
+
+// ForIssuer returns a controller that shares every store and key with ts
+// but identifies as issuer. Bootstrap uses it to serve path-based issuers,
+// registering its routes under the issuer's path.
+func (ts *TokenServiceController) ForIssuer(issuer string) *TokenServiceController {
+	clone := *ts
+	clone.issuer = issuer
+	clone.served = nil
+	routes := *ts.routesConfig
+	routes.WebFinger = ""
+	clone.routesConfig = &routes
+	return &clone
+}
+
+// RegisterMetadataRoutes serves the RFC 8414 metadata. Unlike the OIDC
+// document, its location inserts the issuer's path after the well-known
+// prefix (RFC 8414 §3), so it is registered on the root router even for
+// path-based issuers.
+func (ts *TokenServiceController) RegisterMetadataRoutes(r gin.IRoutes) error {
+	prefix := ts.routesConfig.AuthorizationServerMetadata
+	if prefix == "" {
+		return nil
+	}
+	path, err := IssuerPath(ts.issuer)
+	if err != nil {
+		return err
+	}
+	r.GET(prefix+path, ts.AuthorizationServerMetadataHandler)
+	return nil
 }
 
-// JWKSHandler
+// handle registers h at path and records the path as served. An empty
+// path leaves the endpoint disabled.
+func (ts *TokenServiceController) handle(r gin.IRoutes, method, path string, h gin.HandlerFunc) {
+	if path == "" {
+		return
+	}
+	if ts.served == nil {
+		ts.served = make(map[string]bool)
+	}
+	ts.served[path] = true
+	r.Handle(method, path, h)
+}
+
+// endpoint returns the absolute URL of path, or "" when the path is not
+// served so the metadata field is omitted.
+func (ts *TokenServiceController) endpoint(path string) string {
+	if path == "" || !ts.served[path] {
+		return ""
+	}
+	return ts.issuer + path
+}
+
+// JWKSHandler serves the keys currently published by the key manager. The
+// short max-age makes relying parties pick up rotations promptly.
 func (ts *TokenServiceController) JWKSHandler(c *gin.Context) {
-	jwks := ts.jwks
+	jwks, err := ts.keys.JWKS()
+	if err != nil {
+		log.Errorf("Failed to build JWKS: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to build JWKS"})
+		return
+	}
+	c.Header("Cache-Control", "public, max-age=300")
 	c.Data(http.StatusOK, "application/json", jwks)
 }
 
@@ -116,50 +332,143 @@ type AuthorizationResponse struct {
 	RedirectURI string
 }
 
-// RedirectToClient sends a 302 redirect to the client with code and state
-func (r *AuthorizationResponse) RedirectToClient(w http.ResponseWriter) {
+// RedirectURL returns the client's redirect URI with the code, state and
+// iss (RFC 9207) added.
+func (r *AuthorizationResponse) RedirectURL() (string, error) {
 	redirectURL, err := url.Parse(r.RedirectURI)
 	if err != nil {
-		http.Error(w, "Invalid redirect URI", http.StatusBadRequest)
-		return
+		return "", errors.ErrInvalidRequest.WithDescription("invalid redirect_uri")
 	}
-	// Add query parameters
 	q := redirectURL.Query()
 	q.Set("code", r.Code)
 	q.Set("state", r.State)
 	q.Set("iss", r.Issuer)
 	redirectURL.RawQuery = q.Encode()
-	http.Redirect(w, &http.Request{}, redirectURL.String(), http.StatusFound)
+	return redirectURL.String(), nil
 }
 
-// AuthorizeHandler
+// AuthorizeHandler validates an authorization request and hands it to the
+// authorization flow, which signs the user in and asks for consent.
 func (ts *TokenServiceController) AuthorizeHandler(c *gin.Context) {
+	// A request_uri stands for the parameters the client pushed (RFC 9126 §4)
+	params, err := takePushedRequest(c, ts.pushed)
+	if err != nil {
+		writeOAuthError(c.Writer, err)
+		return
+	}
 	// Bind it
 	authReq := AuthorizationRequest{
-		Scope:               c.Query("scope"),
-		State:               c.Query("state"),
-		Nonce:               c.Query("nonce"),
-		CodeChallenge:       c.Query("code_challenge"),
-		CodeChallengeMethod: c.Query("code_challenge_method"),
-		ResponseType:        c.Query("response_type"),
-		ClientID:            c.Query("client_id"),
-		RedirectURI:         c.Query("redirect_uri"),
+		Scope:               params.Get("scope"),
+		State:               params.Get("state"),
+		Nonce:               params.Get("nonce"),
+		CodeChallenge:       params.Get("code_challenge"),
+		CodeChallengeMethod: params.Get("code_challenge_method"),
+		ResponseType:        params.Get("response_type"),
+		ClientID:            params.Get("client_id"),
+		RedirectURI:         params.Get("redirect_uri"),
 	}
 	log.Infof("Authorization request: %+v", authReq)
 
-	issuedCode, err := ts.codeStore.Generate(authReq.ClientID, authReq.RedirectURI)
-	if err != nil {
-		log.Errorf("Failed to generate authorization code: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate authorization code"})
+	// An unknown client or unregistered redirect_uri must not be redirected
+	// to (RFC 6749 §4.1.2.1).
+	public := false
+	if ts.clients != nil {
+		client, err := ts.clients.GetByID(c.Request.Context(), authReq.ClientID)
+		if err != nil {
+			writeAuthorizeError(c.Writer, "", "", errors.ErrInvalidClient, "unknown client")
+			return
+		}
+		if !client.Meta.Enabled {
+			writeAuthorizeError(c.Writer, "", "", errors.ErrInvalidClient, "client is disabled")
+			return
+		}
+		if !client.IsRedirectURIMatching(authReq.RedirectURI) {
+			writeAuthorizeError(c.Writer, "", "", errors.ErrInvalidRequest, "redirect_uri is not registered for this client")
+			return
+		}
+		public = client.AllowsAuthMethod(dto.None)
+	}
+
+	if !slices.Contains(supportedResponseTypes, authReq.ResponseType) {
+		writeAuthorizeError(c.Writer, authReq.RedirectURI, authReq.State, errors.ErrUnsupportedResponseType, "response_type must be one of "+strings.Join(supportedResponseTypes, ", "))
+		return
+	}
+	if err := checkCodeChallenge(authReq, public); err != nil {
+		writeAuthorizeError(c.Writer, authReq.RedirectURI, authReq.State, errors.ErrInvalidRequest, err.Error())
+		return
+	}
+	if _, err := delegation.ParseGrantManagementAction(params.Get("grant_management_action"), params.Get("grant_id")); err != nil {
+		writeAuthorizeError(c.Writer, authReq.RedirectURI, authReq.State, errors.ErrInvalidRequest, err.Error())
 		return
 	}
+	if ts.authorize == nil {
+		writeAuthorizeError(c.Writer, authReq.RedirectURI, authReq.State, errors.ErrServerError, "no authorization flow is configured")
+		return
+	}
+	// The flow reads the request from the query, so a used request_uri is
+	// replaced by the parameters pushed under it.
+	c.Request.URL.RawQuery = params.Encode()
+	ts.authorize(c)
+}
+
+// codeChallengePattern matches an S256 code_challenge, the base64url
+// encoded SHA-256 of the verifier (RFC 7636 §4.2).
+var codeChallengePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{43}$`)
+
+// checkCodeChallenge validates the PKCE parameters of an authorization
+// request. Clients that do not authenticate at the token endpoint must
+// send a challenge, or whoever intercepts the code can redeem it.
+func checkCodeChallenge(req AuthorizationRequest, public bool) error {
+	if req.CodeChallenge == "" {
+		if req.CodeChallengeMethod != "" {
+			return fmt.Errorf("code_challenge_method requires code_challenge")
+		}
+		if public {
+			return fmt.Errorf("code_challenge is required for public clients")
+		}
+		return nil
+	}
+	if req.CodeChallengeMethod != authcode.ChallengeS256 {
+		return fmt.Errorf("code_challenge_method must be %s", authcode.ChallengeS256)
+	}
+	if !codeChallengePattern.MatchString(req.CodeChallenge) {
+		return fmt.Errorf("malformed code_challenge")
+	}
+	return nil
+}
+
+// HandleAuthorize issues an authorization code once the authorization
+// flow has signed user in and they consented to req.Scope, and returns the
+// redirect that carries it to the client. The code records the user, scope
+// and grant for the token endpoint.
+func (ts *TokenServiceController) HandleAuthorize(ctx context.Context, req oauth2.AuthorizeRequest, user oauth2.User) (string, error) {
+	if ts.clients != nil {
+		client, err := ts.clients.GetByID(ctx, req.ClientID)
+		if err != nil || !client.IsRedirectURIMatching(req.RedirectURI) {
+			return "", errors.ErrInvalidRequest.WithDescription("redirect_uri is not registered for this client")
+		}
+	}
+	issuedCode, err := ts.codeStore.Issue(authcode.Code{
+		ClientID:    req.ClientID,
+		RedirectURI: req.RedirectURI,
+		Subject:     user.ID,
+		Scope:       strings.Join(req.Scope, " "),
+		Nonce:       req.Nonce,
+		GrantID:     req.GrantID,
+
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: req.CodeChallengeMethod,
+	})
+	if err != nil {
+		return "", fmt.Errorf("generating authorization code: %w", err)
+	}
 	response := AuthorizationResponse{
 		Issuer:      ts.issuer,
 		Code:        issuedCode,
-		State:       authReq.State,
-		RedirectURI: authReq.RedirectURI,
+		State:       req.State,
+		RedirectURI: req.RedirectURI,
 	}
-	response.RedirectToClient(c.Writer)
+	return response.RedirectURL()
 }
 
 // TokenRequest represents the body of a POST /token request
@@ -167,8 +476,31 @@ type TokenRequest struct {
 	GrantType    string `json:"grant_type"`
 	Code         string `json:"code"`
 	RedirectURI  string `json:"redirect_uri"`
+	CodeVerifier string `json:"code_verifier,omitempty"` // PKCE (RFC 7636 §4.5)
+	RefreshToken string `json:"refresh_token,omitempty"` // refresh_token grant
+	Scope        string `json:"scope,omitempty"`         // refresh_token grant: narrows the granted scope
 	ClientID     string `json:"client_id,omitempty"`     // optional if using Basic Auth
 	ClientSecret string `json:"client_secret,omitempty"` // optional if using Basic Auth
+
+	ClientAssertion     string `json:"client_assertion,omitempty"`
+	ClientAssertionType string `json:"client_assertion_type,omitempty"`
+
+	TLSCert *x509.Certificate `json:"-"` // client certificate, for mutual-TLS methods
+
+	AuthMethod string `json:"-"` // client authentication method the request used
+}
+
+// ClientAuth returns the credentials the client presented, for clientauth.
+func (r *TokenRequest) ClientAuth() dto.ClientAuthDTO {
+	return dto.ClientAuthDTO{
+		ClientID:            r.ClientID,
+		ClientSecret:        r.ClientSecret,
+		ClientAssertion:     r.ClientAssertion,
+		ClientAssertionType: r.ClientAssertionType,
+		GrantType:           r.GrantType,
+		AuthMethod:          r.AuthMethod,
+		TLSCert:             r.TLSCert,
+	}
 }
 
 // ParseTokenRequest parses a POST /token request body into a TokenRequest struct
@@ -177,31 +509,89 @@ func ParseTokenRequest(r *http.Request) (*TokenRequest, error) {
 		return nil, err
 	}
 
-	clientID := r.FormValue("client_id")
-	clientSecret := r.FormValue("client_secret")
+	clientID := r.PostFormValue("client_id")
+	clientSecret := r.PostFormValue("client_secret")
+	authMethod := string(dto.None)
+	if clientSecret != "" {
+		authMethod = string(dto.ClientSecretPost)
+	}
 
 	// Check Authorization header for Basic Auth
 	auth := r.Header.Get("Authorization")
-	if auth != "" && len(auth) > 6 && auth[:6] == "Basic " {
-		decoded, err := base64.StdEncoding.DecodeString(auth[6:])
-		if err == nil {
-			parts := strings.SplitN(string(decoded), ":", 2)
-			if len(parts) == 2 {
-				clientID = parts[0]
-				clientSecret = parts[1]
-			}
+	if len(auth) > 6 && strings.EqualFold(auth[:6], "Basic ") {
+		// Clients MUST NOT use more than one authentication method (RFC 6749 §2.3)
+		if clientSecret != "" {
+			return nil, errors.ErrInvalidRequest.WithDescription("multiple client authentication methods used")
+		}
+		basicID, basicSecret, err := parseBasicCredentials(auth[6:])
+		if err != nil {
+			return nil, errors.ErrInvalidClient.WithDescription(err.Error())
+		}
+		if clientID != "" && clientID != basicID {
+			return nil, errors.ErrInvalidRequest.WithDescription("client_id does not match Authorization header")
+		}
+		clientID, clientSecret = basicID, basicSecret
+		authMethod = string(dto.ClientSecretBasic)
+	}
+
+	// JWT client assertions (RFC 7523 §2.2, OIDC Core §9)
+	assertion := r.PostFormValue("client_assertion")
+	if assertion != "" {
+		if authMethod != string(dto.None) {
+			return nil, errors.ErrInvalidRequest.WithDescription("multiple client authentication methods used")
+		}
+		assertedID, alg, err := clientauth.AssertionClientID(assertion)
+		if err != nil {
+			return nil, errors.ErrInvalidClient.WithDescription("malformed client_assertion")
+		}
+		if clientID != "" && clientID != assertedID {
+			return nil, errors.ErrInvalidClient.WithDescription("client_id does not match client_assertion")
+		}
+		clientID = assertedID
+		authMethod = string(dto.PrivateKeyJWT)
+		if strings.HasPrefix(alg, "HS") {
+			authMethod = string(dto.ClientSecretJWT)
 		}
 	}
 
 	return &TokenRequest{
-		GrantType:    r.FormValue("grant_type"),
-		Code:         r.FormValue("code"),
-		RedirectURI:  r.FormValue("redirect_uri"),
-		ClientID:     clientID,
-		ClientSecret: clientSecret,
+		GrantType:           r.PostFormValue("grant_type"),
+		Code:                r.PostFormValue("code"),
+		RedirectURI:         r.PostFormValue("redirect_uri"),
+		CodeVerifier:        r.PostFormValue("code_verifier"),
+		RefreshToken:        r.PostFormValue("refresh_token"),
+		Scope:               r.PostFormValue("scope"),
+		ClientID:            clientID,
+		ClientSecret:        clientSecret,
+		ClientAssertion:     assertion,
+		ClientAssertionType: r.PostFormValue("client_assertion_type"),
+		AuthMethod:          authMethod,
 	}, nil
 }
 
+// parseBasicCredentials decodes HTTP Basic credentials. The client ID and
+// secret are form-urlencoded before being joined (RFC 6749 §2.3.1), so both
+// halves are URL-decoded after splitting on the first colon.
+func parseBasicCredentials(encoded string) (string, string, error) {
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return "", "", fmt.Errorf("malformed basic credentials")
+	}
+	rawID, rawSecret, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		return "", "", fmt.Errorf("malformed basic credentials")
+	}
+	clientID, err := url.QueryUnescape(rawID)
+	if err != nil {
+		return "", "", fmt.Errorf("malformed client_id in basic credentials")
+	}
+	clientSecret, err := url.QueryUnescape(rawSecret)
+	if err != nil {
+		return "", "", fmt.Errorf("malformed client_secret in basic credentials")
+	}
+	return clientID, clientSecret, nil
+}
+
 // TokenResponse represents the JSON response from the token endpoint
 type TokenResponse struct {
 	AccessToken  string `json:"access_token"`
@@ -210,6 +600,7 @@ type TokenResponse struct {
 	IDToken      string `json:"id_token,omitempty"`      // OIDC-specific
 	RefreshToken string `json:"refresh_token,omitempty"` // optional
 	Scope        string `json:"scope,omitempty"`         // optional
+	GrantID      string `json:"grant_id,omitempty"`      // FAPI Grant Management: the delegation the tokens were issued under
 }
 
 // WriteTokenResponse writes the token response as JSON to the http.ResponseWriter
@@ -225,65 +616,155 @@ func (ts *TokenServiceController) TokenHandler(c *gin.Context) {
 	tokenReq, err := ParseTokenRequest(c.Request)
 	if err != nil {
 		log.Errorf("Failed to parse token request: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid token request"})
+		writeClientAuthError(c.Writer, c.Request, err)
+		return
+	}
+	client, err := ts.authenticateClient(c.Request, tokenReq)
+	if err != nil {
+		log.Infof("Client authentication failed: %v", err)
+		writeClientAuthError(c.Writer, c.Request, err)
+		return
+	}
+	if !slices.Contains(supportedGrantTypes, tokenReq.GrantType) {
+		writeOAuthError(c.Writer, errors.ErrUnsupportedGrantType.WithDescription("grant_type "+tokenReq.GrantType+" is not supported"))
 		return
 	}
 
-	userGroups, err := ts.idStore.GetUserGroups(c.Request.Context(), "alice")
+	var grant *tokenGrant
+	switch tokenReq.GrantType {
+	case "refresh_token":
+		grant, err = ts.refreshGrant(c, *client, tokenReq)
+	default:
+		grant, err = ts.codeGrant(c, *client, tokenReq)
+	}
 	if err != nil {
-		log.Infof("Failed to get user groups: %v", err)
-	}
-	log.Infof("User groups: %+v", userGroups)
-
-	claims := jwt.MapClaims{
-		"iss": ts.issuer,
-		"sub": "alice",
-		"aud": tokenReq.ClientID,
-		"exp": time.Now().Add(time.Hour).Unix(),
-		"iat": time.Now().Unix(),
-	}
-	log.Infof("Pretty printed claims: %+v", claims)
-	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
-	if ts.privSigningKey == nil {
-		log.Errorf("Private signing key is not configured")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "private signing key not configured"})
+		log.Infof("Token request of client %s rejected: %v", client.ID, err)
+		writeOAuthError(c.Writer, err)
 		return
 	}
-	tokenString, err := token.SignedString(ts.privSigningKey)
+	subject, scope, delegationID := grant.subject, grant.scope, grant.delegationID
+	sub := ts.subjects.For(*client, subject)
+
+	claims := jwt.MapClaims{}
+	if user, err := ts.idStore.GetUser(c.Request.Context(), subject); err == nil && user != nil {
+		for k, v := range ts.userClaims(c.Request.Context(), *client, user, sub, strings.Fields(scope), claimmapping.TokenID) {
+			claims[k] = v
+		}
+	}
+	claims["iss"] = ts.issuer
+	claims["sub"] = sub
+	claims["aud"] = client.ID
+	claims["exp"] = time.Now().Add(time.Hour).Unix()
+	claims["iat"] = time.Now().Unix()
+	if grant.nonce != "" {
+		claims["nonce"] = grant.nonce
+	}
+	if ts.keys == nil {
+		log.Errorf("Signing keys are not configured")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "signing keys not configured"})
+		return
+	}
+	tokenString, err := ts.keys.Sign(client.Meta.IDTokenSignedResponseAlg, claims, "")
 	if err != nil {
 		log.Errorf("Failed to sign ID token: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to sign ID token"})
 		return
 	}
-	log.Infof("Parsed token request: %+v", tokenReq)
+	tokenString, err = ts.encryptForClient(c.Request.Context(), *client, client.Meta.IDTokenEncryptedResponseAlg, client.Meta.IDTokenEncryptedResponseEnc, []byte(tokenString), "JWT")
+	if err != nil {
+		log.Errorf("Failed to encrypt ID token for client %s: %v", client.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to encrypt ID token"})
+		return
+	}
+	accessToken, err := ts.issueAccessToken(c.Request.Context(), *client, subject, scope, delegationID, tokenReq.TLSCert)
+	if err != nil {
+		log.Errorf("Failed to sign access token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to sign access token"})
+		return
+	}
+	refreshToken, err := ts.issueRefreshToken(c.Request.Context(), *client, grant)
+	if err != nil {
+		log.Errorf("Failed to issue refresh token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to issue refresh token"})
+		return
+	}
+	log.Infof("Issued tokens to client %s for the %s grant", client.ID, tokenReq.GrantType)
 	resp := TokenResponse{
-		AccessToken:  "abc123",
+		AccessToken:  accessToken,
 		TokenType:    "Bearer",
 		ExpiresIn:    3600,
 		IDToken:      tokenString,
-		RefreshToken: "xyz789",
-		Scope:        "openid profile email",
+		RefreshToken: refreshToken,
+		Scope:        scope,
+		GrantID:      delegationID,
 	}
 	if err := WriteTokenResponse(c.Writer, resp); err != nil {
 		http.Error(c.Writer, "Failed to write response", http.StatusInternalServerError)
 	}
 }
 
-// UserInfoHandler
-func (ts *TokenServiceController) UserInfoHandler(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"message": "user info"})
+// tokenGrant is what a grant entitles the client to: tokens for the user
+// and scope, issued under the user's delegation to the client.
+type tokenGrant struct {
+	subject      string // local user ID
+	scope        string
+	granted      string // scope the user granted; scope may be narrower
+	nonce        string
+	delegationID string
 }
 
-// IntrospectHandler
-func (ts *TokenServiceController) IntrospectHandler(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"message": "token introspected"})
-}
-
-// RevokeHandler
-func (ts *TokenServiceController) RevokeHandler(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"message": "token revoked"})
+// codeGrant redeems an authorization code for the user and scope it was
+// issued for. The grant the user consented in is checked again, since it
+// may have been revoked, replaced by a new grant or constrained since the
+// code was issued. Codes without one fall back to the user's current
+// delegation to the client.
+func (ts *TokenServiceController) codeGrant(c *gin.Context, client store.Client, req *TokenRequest) (*tokenGrant, error) {
+	if req.Code == "" {
+		return nil, errors.ErrInvalidRequest.WithDescription("code is required")
+	}
+	if ts.codeStore == nil {
+		return nil, errors.ErrInvalidGrant.WithDescription("code not found")
+	}
+	code, err := ts.codeStore.Redeem(req.Code, client.ID, req.RedirectURI)
+	if err != nil {
+		return nil, errors.ErrInvalidGrant.WithDescription(err.Error())
+	}
+	// The code is used up either way, so a guessed verifier cannot be retried
+	if err := code.VerifyChallenge(req.CodeVerifier); err != nil {
+		return nil, errors.ErrInvalidGrant.WithDescription(err.Error())
+	}
+	delegationID := code.GrantID
+	if delegationID == "" {
+		delegationID, err = ts.checkDelegation(c, client, code.Subject)
+	} else if ts.delegations != nil {
+		err = ts.delegations.ValidateDelegation(c.Request.Context(), delegationID, delegationUse(c, client))
+		if err != nil {
+			err = delegationError(err)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &tokenGrant{
+		subject:      code.Subject,
+		scope:        code.Scope,
+		granted:      code.Scope,
+		nonce:        code.Nonce,
+		delegationID: delegationID,
+	}, nil
 }
 
+// LogoutHandler ends the session of the user an id_token_hint names
+// (OIDC RP-Initiated Logout §2). The hint may have expired; its sub is
+// mapped back to the local user, since pairwise clients hold a derived one.
 func (ts *TokenServiceController) LogoutHandler(c *gin.Context) {
+	if hint := c.Request.FormValue("id_token_hint"); hint != "" {
+		user, clientID, err := ts.idTokenHintUser(c.Request.Context(), hint)
+		if err != nil {
+			writeOAuthError(c.Writer, errors.ErrInvalidRequest.WithDescription(err.Error()))
+			return
+		}
+		log.Infof("Logged out user %s from client %s", user, clientID)
+	}
 	c.JSON(http.StatusOK, gin.H{"message": "logged out"})
 }
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/martencassel/oidcsim/authcode"
+	"github.com/martencassel/oidcsim/internal/domain/delegation"
+	"github.com/martencassel/oidcsim/internal/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTokenRequest(form url.Values, basicUser, basicPass string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/token", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if basicUser != "" {
+		creds := url.QueryEscape(basicUser) + ":" + url.QueryEscape(basicPass)
+		req.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(creds)))
+	}
+	return req
+}
+
+func TestParseTokenRequest_BasicCredentialsAreURLDecoded(t *testing.T) {
+	form := url.Values{"grant_type": {"authorization_code"}}
+	tr, err := ParseTokenRequest(newTokenRequest(form, "my client", "p@ss:w%rd"))
+	require.NoError(t, err)
+	assert.Equal(t, "my client", tr.ClientID)
+	assert.Equal(t, "p@ss:w%rd", tr.ClientSecret)
+	assert.Equal(t, "client_secret_basic", tr.AuthMethod)
+}
+
+func TestParseTokenRequest_PostCredentials(t *testing.T) {
+	form := url.Values{"grant_type": {"authorization_code"}, "client_id": {"c1"}, "client_secret": {"s1"}}
+	tr, err := ParseTokenRequest(newTokenRequest(form, "", ""))
+	require.NoError(t, err)
+	assert.Equal(t, "client_secret_post", tr.AuthMethod)
+}
+
+func TestParseTokenRequest_RejectsMultipleMethods(t *testing.T) {
+	form := url.Values{"grant_type": {"authorization_code"}, "client_secret": {"s1"}}
+	_, err := ParseTokenRequest(newTokenRequest(form, "c1", "s1"))
+	assert.ErrorIs(t, err, errors.ErrInvalidRequest)
+}
+
+func TestTokenHandler_RedeemsCodeOnce(t *testing.T) {
+	f := newDelegationFixture(t, delegation.Constraints{})
+	code, err := f.codes.Issue(authcode.Code{
+		ClientID: "app", RedirectURI: "https://app.example/cb", Subject: "alice", Scope: "openid profile", Nonce: "n-1",
+	})
+	require.NoError(t, err)
+
+	w := f.post("/token", "10.1.2.3:4000", url.Values{"grant_type": {"authorization_code"}, "code": {code}, "redirect_uri": {"https://app.example/other"}})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	errCode, _ := oauthError(t, w)
+	assert.Equal(t, "invalid_grant", errCode)
+
+	code, err = f.codes.Issue(authcode.Code{
+		ClientID: "app", RedirectURI: "https://app.example/cb", Subject: "alice", Scope: "openid profile", Nonce: "n-1",
+	})
+	require.NoError(t, err)
+	form := url.Values{"grant_type": {"authorization_code"}, "code": {code}, "redirect_uri": {"https://app.example/cb"}}
+	w = f.post("/token", "10.1.2.3:4000", form)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp TokenResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "openid profile", resp.Scope, "the scope the user approved")
+	assert.NotEmpty(t, resp.RefreshToken)
+	claims := jwt.MapClaims{}
+	_, _, err = jwt.NewParser().ParseUnverified(resp.IDToken, claims)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", claims["sub"])
+	assert.Equal(t, "n-1", claims["nonce"])
+
+	w = f.post("/token", "10.1.2.3:4000", form)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "a code is redeemed once")
+	errCode, _ = oauthError(t, w)
+	assert.Equal(t, "invalid_grant", errCode)
+
+	w = f.post("/token", "10.1.2.3:4000", url.Values{"grant_type": {"authorization_code"}})
+	errCode, _ = oauthError(t, w)
+	assert.Equal(t, "invalid_request", errCode)
+}
+
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func TestTokenHandler_PKCE(t *testing.T) {
+	f := newDelegationFixture(t, delegation.Constraints{})
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	issue := func() string {
+		code, err := f.codes.Issue(authcode.Code{
+			ClientID: "app", RedirectURI: "https://app.example/cb", Subject: "alice", Scope: "openid",
+			CodeChallenge: pkceChallenge(verifier), CodeChallengeMethod: "S256",
+		})
+		require.NoError(t, err)
+		return code
+	}
+	exchange := func(code, verifier string) *httptest.ResponseRecorder {
+		form := url.Values{"grant_type": {"authorization_code"}, "code": {code}, "redirect_uri": {"https://app.example/cb"}}
+		if verifier != "" {
+			form.Set("code_verifier", verifier)
+		}
+		return f.post("/token", "10.1.2.3:4000", form)
+	}
+
+	for name, v := range map[string]string{"missing": "", "wrong": "not-the-verifier-not-the-verifier-not-the-v"} {
+		w := exchange(issue(), v)
+		assert.Equal(t, http.StatusBadRequest, w.Code, name)
+		errCode, _ := oauthError(t, w)
+		assert.Equal(t, "invalid_grant", errCode, name)
+	}
+
+	code := issue()
+	w := exchange(code, verifier)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, http.StatusBadRequest, exchange(code, verifier).Code, "the code is used up")
+
+	w = exchange(f.code(t), verifier)
+	errCode, _ := oauthError(t, w)
+	assert.Equal(t, "invalid_grant", errCode, "a verifier for a code issued without a challenge")
+}
@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/martencassel/oidcsim/internal/application/claimmapping"
+	"github.com/martencassel/oidcsim/internal/clientauth"
+	"github.com/martencassel/oidcsim/internal/errors"
+	"github.com/martencassel/oidcsim/internal/identity"
+	infrasecurity "github.com/martencassel/oidcsim/internal/infrastructure/security"
+)
+
+// UserInfoHandler returns the claims of the access token's subject that
+// its scopes release (OIDC Core §5.3). The token is sent as a bearer token
+// in the Authorization header or, on POST, as a form parameter
+// (RFC 6750 §2.1, §2.2).
+//
+// The response is plain JSON unless the client registered
+// userinfo_signed_response_alg or userinfo_encrypted_response_alg, or asks
+// for application/jwt in the Accept header.
+func (ts *TokenServiceController) UserInfoHandler(c *gin.Context) {
+	at, err := ts.authenticateBearer(c.Request)
+	if err != nil || at == nil {
+		writeBearerError(c.Writer, err)
+		return
+	}
+	ctx := c.Request.Context()
+	if !at.HasScope("openid") {
+		writeInsufficientScope(c.Writer, "openid")
+		return
+	}
+	if ts.idStore == nil {
+		writeBearerError(c.Writer, errors.ErrServerError.WithDescription("identity store not configured"))
+		return
+	}
+	client := ts.tokenClient(ctx, at.ClientID)
+	var user identity.UserIdentity
+	if local, ok := ts.localSubject(ctx, client, at.Subject); ok {
+		user, err = ts.idStore.GetUser(ctx, local)
+	}
+	if err != nil || user == nil {
+		writeBearerError(c.Writer, errors.ErrInvalidToken.WithDescription("the token's subject no longer exists"))
+		return
+	}
+	claims := ts.userClaims(ctx, client, user, at.Subject, at.Scopes, claimmapping.TokenUserinfo)
+
+	alg := client.Meta.UserinfoSignedResponseAlg
+	sign := alg != "" || acceptsJWT(c.Request)
+	encrypt := client.Meta.UserinfoEncryptedResponseAlg != ""
+	if !sign && !encrypt {
+		c.JSON(http.StatusOK, claims)
+		return
+	}
+
+	var body []byte
+	var cty string
+	if sign {
+		// A signed response is a JWT from the issuer to the client (OIDC Core §5.3.2).
+		jwtClaims := jwt.MapClaims{"iss": ts.issuer, "aud": client.ID, "iat": time.Now().Unix()}
+		for k, v := range claims {
+			jwtClaims[k] = v
+		}
+		signed, err := ts.keys.Sign(alg, jwtClaims, "")
+		if err != nil {
+			log.Errorf("Failed to sign userinfo response: %v", err)
+			writeBearerError(c.Writer, errors.ErrServerError.WithDescription("failed to sign userinfo response"))
+			return
+		}
+		body, cty = []byte(signed), "JWT"
+	} else {
+		if body, err = json.Marshal(claims); err != nil {
+			writeBearerError(c.Writer, errors.ErrServerError)
+			return
+		}
+	}
+	out, err := ts.encryptForClient(ctx, client, client.Meta.UserinfoEncryptedResponseAlg, client.Meta.UserinfoEncryptedResponseEnc, body, cty)
+	if err != nil {
+		log.Errorf("Failed to encrypt userinfo response for client %s: %v", client.ID, err)
+		writeBearerError(c.Writer, errors.ErrServerError.WithDescription("failed to encrypt userinfo response"))
+		return
+	}
+	c.Data(http.StatusOK, "application/jwt", []byte(out))
+}
+
+// authenticateBearer validates the request's access token. A request
+// without one returns neither token nor error, which writeBearerError
+// answers with a bare challenge.
+func (ts *TokenServiceController) authenticateBearer(r *http.Request) (*infrasecurity.AccessToken, error) {
+	raw, err := bearerToken(r)
+	if err != nil || raw == "" {
+		return nil, err
+	}
+	at, err := ts.accessTokens().Validate(r.Context(), raw)
+	if err != nil {
+		return nil, err
+	}
+	if at.CertThumbprint != "" {
+		// Certificate-bound tokens are only accepted with the same
+		// certificate (RFC 8705 §3).
+		cert, err := ts.certs.FromRequest(r)
+		if err != nil || cert == nil || clientauth.Thumbprint(cert) != at.CertThumbprint {
+			return nil, errors.ErrInvalidToken.WithDescription("access token is bound to a different certificate")
+		}
+	}
+	return at, nil
+}
+
+// bearerToken extracts the access token from the Authorization header or
+// a form-encoded POST body. Using both is an invalid_request
+// (RFC 6750 §2).
+func bearerToken(r *http.Request) (string, error) {
+	var fromHeader, fromBody string
+	if auth := r.Header.Get("Authorization"); len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+		fromHeader = strings.TrimSpace(auth[7:])
+	}
+	if r.Method == http.MethodPost {
+		if ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); ct == "application/x-www-form-urlencoded" {
+			if err := r.ParseForm(); err != nil {
+				return "", errors.ErrInvalidRequest.WithDescription("malformed request body")
+			}
+			fromBody = r.PostForm.Get("access_token")
+		}
+	}
+	switch {
+	case fromHeader != "" && fromBody != "":
+		return "", errors.ErrInvalidRequest.WithDescription("access token sent more than once")
+	case fromHeader != "":
+		return fromHeader, nil
+	case fromBody != "":
+		return fromBody, nil
+	}
+	return "", nil
+}
+
+// acceptsJWT reports whether the request prefers application/jwt over JSON.
+func acceptsJWT(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mt, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		switch mt {
+		case "application/jwt":
+			return true
+		case "application/json", "*/*":
+			return false
+		}
+	}
+	return false
+}
+
+// writeBearerError writes an RFC 6750 §3 error. A request without a token
+// gets a bare challenge without an error code (§3.1).
+func writeBearerError(w http.ResponseWriter, err error) {
+	writeBearerChallenge(w, err, "")
+}
+
+// writeInsufficientScope rejects a token that lacks scope, naming the
+// scope in the challenge (RFC 6750 §3.1).
+func writeInsufficientScope(w http.ResponseWriter, scope string) {
+	writeBearerChallenge(w, errors.ErrInsufficientScope.WithDescription("the "+scope+" scope is required"), scope)
+}
+
+func writeBearerChallenge(w http.ResponseWriter, err error, scope string) {
+	if err == nil {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="userinfo"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	var ae errors.AuthError
+	if !stderrors.As(err, &ae) {
+		ae = errors.ErrServerError
+	}
+	desc := ae.Description()
+	var withDesc *errors.AuthErrorWithDescription
+	if stderrors.As(err, &withDesc) {
+		desc = withDesc.DescriptionText
+	}
+	status := http.StatusInternalServerError
+	switch ae {
+	case errors.ErrInvalidRequest:
+		status = http.StatusBadRequest
+	case errors.ErrInvalidToken:
+		status = http.StatusUnauthorized
+	case errors.ErrInsufficientScope:
+		status = http.StatusForbidden
+	}
+	if status != http.StatusInternalServerError {
+		challenge := fmt.Sprintf(`Bearer realm="userinfo", error=%q, error_description=%q`, ae.Error(), desc)
+		if scope != "" {
+			challenge += fmt.Sprintf(`, scope=%q`, scope)
+		}
+		w.Header().Set("WWW-Authenticate", challenge)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{
+		"error":             ae.Error(),
+		"error_description": desc,
+	})
+}
@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/martencassel/oidcsim/internal/application/subject"
+	"github.com/martencassel/oidcsim/internal/identity"
+	"github.com/martencassel/oidcsim/internal/security"
+	"github.com/martencassel/oidcsim/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type userInfoFixture struct {
+	ts      *TokenServiceController
+	router  *gin.Engine
+	keys    *security.KeyManager
+	tokens  *store.InMemoryTokenStore
+	clients *store.InMemoryClientStore
+}
+
+func newUserInfoFixture(t *testing.T, clients ...store.Client) *userInfoFixture {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	keys, err := security.NewKeyManager(security.KeyManagerConfig{Algorithms: []string{"RS256", "ES256"}})
+	require.NoError(t, err)
+	ids := identity.NewCoreIdentityStore("")
+	require.NoError(t, ids.AddUser(context.Background(), &identity.User{
+		ID: "alice", Username: "alice", Email: "alice@example.com",
+		Claims: map[string]interface{}{"name": "Alice Liddell", "email_verified": true},
+	}))
+	f := &userInfoFixture{keys: keys, tokens: store.NewInMemoryTokenStore(), clients: store.NewInMemoryClientStore()}
+	for _, c := range clients {
+		require.NoError(t, f.clients.Save(context.Background(), c))
+	}
+	f.ts = NewTokenServiceControllerBuilder().
+		WithIssuer("https://idp.test").
+		WithRoutesConfig(&RoutesConfig{Userinfo: "/userinfo"}).
+		WithKeyManager(keys).
+		WithIdentityStore(ids).
+		WithClientStore(f.clients).
+		WithTokenStore(f.tokens).
+		Build()
+	f.router = gin.New()
+	f.ts.RegisterRoutes(f.router)
+	return f
+}
+
+func (f *userInfoFixture) issue(t *testing.T, clientID, scope string) string {
+	t.Helper()
+	client, err := f.clients.GetByID(context.Background(), clientID)
+	require.NoError(t, err)
+	token, err := f.ts.issueAccessToken(context.Background(), client, "alice", scope, "", nil)
+	require.NoError(t, err)
+	return token
+}
+
+func (f *userInfoFixture) get(token, accept string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/userinfo", nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	w := httptest.NewRecorder()
+	f.router.ServeHTTP(w, req)
+	return w
+}
+
+var userInfoClient = store.Client{ID: "app", Meta: store.ClientMeta{Enabled: true}}
+
+func TestUserInfo_ReturnsScopedClaims(t *testing.T) {
+	f := newUserInfoFixture(t, userInfoClient)
+
+	w := f.get(f.issue(t, "app", "openid email"), "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var claims map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &claims))
+	assert.Equal(t, "alice", claims["sub"])
+	assert.Equal(t, "alice@example.com", claims["email"])
+	assert.Equal(t, true, claims["email_verified"])
+	assert.NotContains(t, claims, "name", "profile was not granted")
+
+	// POST with the token in the form body
+	form := url.Values{"access_token": {f.issue(t, "app", "openid profile")}}
+	req := httptest.NewRequest(http.MethodPost, "/userinfo", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	f.router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	claims = nil
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &claims))
+	assert.Equal(t, "Alice Liddell", claims["name"])
+	assert.Equal(t, "alice", claims["preferred_username"])
+	assert.NotContains(t, claims, "email")
+}
+
+func TestUserInfo_BearerErrors(t *testing.T) {
+	f := newUserInfoFixture(t, userInfoClient)
+
+	w := f.get("", "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, `Bearer realm="userinfo"`, w.Header().Get("WWW-Authenticate"))
+
+	w = f.get("not-a-token", "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Header().Get("WWW-Authenticate"), `error="invalid_token"`)
+
+	w = f.get(f.issue(t, "app", "email"), "")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Header().Get("WWW-Authenticate"), `error="insufficient_scope"`)
+
+	token := f.issue(t, "app", "openid")
+	recs, err := f.tokens.ListByClient(context.Background(), "app")
+	require.NoError(t, err)
+	for _, rec := range recs {
+		require.NoError(t, f.tokens.Revoke(context.Background(), rec.ID, time.Now()))
+	}
+	w = f.get(token, "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code, "revoked tokens are rejected")
+
+	// Header and body together
+	form := url.Values{"access_token": {"x"}}
+	req := httptest.NewRequest(http.MethodPost, "/userinfo", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "Bearer y")
+	w = httptest.NewRecorder()
+	f.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Header().Get("WWW-Authenticate"), `error="invalid_request"`)
+}
+
+func TestUserInfo_OpaqueTokens(t *testing.T) {
+	opaque := userInfoClient
+	opaque.Meta.OpaqueAccessTokens = true
+	f := newUserInfoFixture(t, opaque)
+
+	token := f.issue(t, "app", "openid")
+	assert.NotContains(t, token, ".")
+	w := f.get(token, "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	recs, err := f.tokens.ListByClient(context.Background(), "app")
+	require.NoError(t, err)
+	require.Len(t, recs, 1)
+	assert.NotEqual(t, token, recs[0].ID, "only the hash is stored")
+}
+
+func TestUserInfo_SignedResponse(t *testing.T) {
+	signed := userInfoClient
+	signed.Meta.UserinfoSignedResponseAlg = "ES256"
+	f := newUserInfoFixture(t, signed)
+
+	w := f.get(f.issue(t, "app", "openid email"), "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "application/jwt", w.Header().Get("Content-Type"))
+	claims := jwt.MapClaims{}
+	token, err := jwt.ParseWithClaims(w.Body.String(), claims, f.keys.Keyfunc)
+	require.NoError(t, err)
+	assert.Equal(t, "ES256", token.Method.Alg())
+	assert.Equal(t, "https://idp.test", claims["iss"])
+	assert.Equal(t, "app", claims["aud"])
+	assert.Equal(t, "alice@example.com", claims["email"])
+}
+
+func TestUserInfo_AcceptJWT(t *testing.T) {
+	f := newUserInfoFixture(t, userInfoClient)
+	token := f.issue(t, "app", "openid")
+
+	w := f.get(token, "application/jwt")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/jwt", w.Header().Get("Content-Type"))
+
+	w = f.get(token, "application/json, application/jwt")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "application/json")
+}
+
+func TestUserInfo_PairwiseSubject(t *testing.T) {
+	client := store.Client{ID: "app", RedirectURIs: []string{"https://app.example/cb"},
+		Meta: store.ClientMeta{Enabled: true, SubjectType: "pairwise"}}
+	f := newUserInfoFixture(t, client)
+	f.ts.subjects = subject.NewIdentifiers([]byte("salt"))
+	token := f.issue(t, "app", "openid email")
+
+	at := jwt.MapClaims{}
+	_, _, err := jwt.NewParser().ParseUnverified(token, at)
+	require.NoError(t, err)
+	sub, _ := at["sub"].(string)
+	assert.NotEmpty(t, sub)
+	assert.NotEqual(t, "alice", sub, "pairwise clients never see the local user ID")
+
+	userinfo := func() map[string]interface{} {
+		w := f.get(token, "")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var claims map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &claims))
+		return claims
+	}
+	claims := userinfo()
+	assert.Equal(t, sub, claims["sub"])
+	assert.Equal(t, "alice@example.com", claims["email"])
+
+	// After a restart with the same salt the sub is found by derivation.
+	f.ts.subjects = subject.NewIdentifiers([]byte("salt"))
+	assert.Equal(t, sub, userinfo()["sub"])
+
+	f.ts.subjects = subject.NewIdentifiers([]byte("other salt"))
+	assert.Equal(t, http.StatusUnauthorized, f.get(token, "").Code)
+}
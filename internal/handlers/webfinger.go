@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"context"
+	stderrors "errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+
+	httpdto "github.com/martencassel/oidcsim/internal/interface/http/dto"
+)
+
+// OIDCIssuerRel is the link relation for OpenID Connect issuer discovery
+// (OIDC Discovery §2).
+const OIDCIssuerRel = "http://openid.net/specs/connect/1.0/issuer"
+
+// WebFingerHandler answers RFC 7033 queries for acct: and URL resources on
+// the issuer's host with a link to the issuer. With user checks enabled,
+// only resources naming a known user resolve.
+func (ts *TokenServiceController) WebFingerHandler(c *gin.Context) {
+	// WebFinger is queried from browsers on other origins (RFC 7033 §5).
+	c.Header("Access-Control-Allow-Origin", "*")
+
+	resource := c.Query("resource")
+	if resource == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "resource parameter is required"})
+		return
+	}
+	host, user, err := parseWebFingerResource(resource)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	issuer, err := url.Parse(ts.issuer)
+	if err != nil || !strings.EqualFold(host, issuer.Host) {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	if ts.webFingerCheckUsers && user != "" && !ts.userExists(c.Request.Context(), user, host) {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	links := []httpdto.WebFingerLink{}
+	if rels := c.QueryArray("rel"); len(rels) == 0 || slices.Contains(rels, OIDCIssuerRel) {
+		links = append(links, httpdto.WebFingerLink{Rel: OIDCIssuerRel, Href: ts.issuer})
+	}
+	c.Header("Content-Type", "application/jrd+json")
+	c.JSON(http.StatusOK, httpdto.WebFingerResponse{Subject: resource, Links: links})
+}
+
+// parseWebFingerResource returns the host a resource belongs to and the
+// user it names, if any. acct:joe@example.com and the scheme-less
+// joe@example.com name joe; https://example.com/joe names joe, while
+// https://example.com names no user.
+func parseWebFingerResource(resource string) (host, user string, err error) {
+	if !strings.Contains(resource, ":") || strings.HasPrefix(resource, "acct:") {
+		acct := strings.TrimPrefix(resource, "acct:")
+		at := strings.LastIndex(acct, "@")
+		if at <= 0 || at == len(acct)-1 {
+			return "", "", errInvalidResource
+		}
+		return acct[at+1:], acct[:at], nil
+	}
+	u, err := url.Parse(resource)
+	if err != nil || u.Host == "" || (u.Scheme != "https" && u.Scheme != "http") {
+		return "", "", errInvalidResource
+	}
+	return u.Host, strings.Trim(u.Path, "/"), nil
+}
+
+var errInvalidResource = stderrors.New("resource must be an acct: URI or an http(s) URL")
+
+// userExists looks the user up by email address and then by username.
+func (ts *TokenServiceController) userExists(ctx context.Context, user, host string) bool {
+	if ts.idStore == nil {
+		return false
+	}
+	if u, err := ts.idStore.GetUserByEmail(ctx, user+"@"+host); err == nil && u != nil {
+		return true
+	}
+	u, err := ts.idStore.GetUser(ctx, user)
+	if err != nil {
+		log.Warnf("WebFinger user lookup failed: %v", err)
+		return false
+	}
+	return u != nil
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/martencassel/oidcsim/internal/identity"
+	httpdto "github.com/martencassel/oidcsim/internal/interface/http/dto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newWebFingerRouter(t *testing.T, checkUsers bool) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	ids := identity.NewCoreIdentityStore("")
+	require.NoError(t, ids.AddUser(context.Background(), &identity.User{ID: "u1", Username: "alice", Email: "Alice.Smith@idp.test"}))
+	ts := NewTokenServiceControllerBuilder().
+		WithIssuer("https://idp.test").
+		WithRoutesConfig(&RoutesConfig{WebFinger: "/.well-known/webfinger"}).
+		WithIdentityStore(ids).
+		WithWebFingerUserCheck(checkUsers).
+		Build()
+	r := gin.New()
+	ts.RegisterRoutes(r)
+	return r
+}
+
+func webFinger(r http.Handler, q url.Values) (*httptest.ResponseRecorder, httpdto.WebFingerResponse) {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/.well-known/webfinger?"+q.Encode(), nil))
+	var jrd httpdto.WebFingerResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &jrd)
+	return w, jrd
+}
+
+func TestWebFinger_ResolvesIssuer(t *testing.T) {
+	r := newWebFingerRouter(t, false)
+	for _, resource := range []string{"acct:anyone@idp.test", "anyone@IDP.test", "https://idp.test/anyone", "https://idp.test"} {
+		w, jrd := webFinger(r, url.Values{"resource": {resource}, "rel": {OIDCIssuerRel}})
+		require.Equal(t, http.StatusOK, w.Code, resource)
+		assert.Equal(t, "application/jrd+json", w.Header().Get("Content-Type"))
+		assert.Equal(t, resource, jrd.Subject)
+		require.Len(t, jrd.Links, 1)
+		assert.Equal(t, "https://idp.test", jrd.Links[0].Href)
+	}
+
+	w, _ := webFinger(r, url.Values{"resource": {"acct:joe@other.test"}})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w, _ = webFinger(r, url.Values{})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w, _ = webFinger(r, url.Values{"resource": {"acct:@idp.test"}})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestWebFinger_RelFilter(t *testing.T) {
+	r := newWebFingerRouter(t, false)
+	w, jrd := webFinger(r, url.Values{"resource": {"acct:joe@idp.test"}, "rel": {"http://webfinger.net/rel/avatar"}})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, jrd.Links)
+}
+
+func TestWebFinger_ChecksUsers(t *testing.T) {
+	r := newWebFingerRouter(t, true)
+	w, _ := webFinger(r, url.Values{"resource": {"acct:alice@idp.test"}})
+	assert.Equal(t, http.StatusOK, w.Code, "by username")
+	w, _ = webFinger(r, url.Values{"resource": {"acct:alice.smith@idp.test"}})
+	assert.Equal(t, http.StatusOK, w.Code, "by email")
+	w, _ = webFinger(r, url.Values{"resource": {"https://idp.test/alice"}})
+	assert.Equal(t, http.StatusOK, w.Code)
+	w, _ = webFinger(r, url.Values{"resource": {"acct:mallory@idp.test"}})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -42,7 +42,7 @@ func (h *IdentityStoreApiHandler) SeedDefault() error {
 	// Seed with some default users and groups
 	users := []string{"alice", "bob", "carol", "dave"}
 	for _, uid := range users {
-		if err := h.store.AddUser(context.Background(), &User{ID: uid, Username: uid, Email: uid + "@example.com"}); err != nil {
+		if err := h.store.AddUser(context.Background(), &User{ID: uid, Username: uid, Email: uid + "@example.com", Source: "local"}); err != nil {
 			return err
 		}
 	}
@@ -2,6 +2,7 @@ package identity
 
 import (
 	"context"
+	"strings"
 	"sync"
 )
 
@@ -84,6 +85,19 @@ func (s *CoreIdentityStore) GetUser(ctx context.Context, idOrUsername string) (U
 	return nil, nil // Not found
 }
 
+// GetUserByEmail returns the user with the given email address, compared
+// case-insensitively, or nil when there is none.
+func (s *CoreIdentityStore) GetUserByEmail(ctx context.Context, email string) (UserIdentity, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, user := range s.users {
+		if user.Email != "" && strings.EqualFold(user.Email, email) {
+			return user, nil
+		}
+	}
+	return nil, nil // Not found
+}
+
 func (s *CoreIdentityStore) GetGroup(ctx context.Context, groupID string) (*Group, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -4,6 +4,7 @@ type UserIdentity interface {
 	GetID() string
 	GetUsername() string
 	GetEmail() string
+	GetSource() string
 	GetGroups() []GroupIdentity
 	GetClaims() map[string]interface{}
 }
@@ -31,6 +32,7 @@ type User struct {
 	ID       string                 `json:"id"`
 	Username string                 `json:"username"`
 	Email    string                 `json:"email"`
+	Source   string                 `json:"source,omitempty"` // identity source the user was provisioned from
 	Groups   []Group                `json:"groups"`
 	Claims   map[string]interface{} `json:"claims"`
 }
@@ -38,6 +40,7 @@ type User struct {
 func (u *User) GetID() string       { return u.ID }
 func (u *User) GetUsername() string { return u.Username }
 func (u *User) GetEmail() string    { return u.Email }
+func (u *User) GetSource() string   { return u.Source }
 func (u *User) GetGroups() []GroupIdentity {
 	groups := make([]GroupIdentity, len(u.Groups))
 	for i := range u.Groups {
@@ -0,0 +1,58 @@
+// Package database opens the SQL database the persistent repositories
+// use and keeps its schema up to date.
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	_ "github.com/jackc/pgx/v5/stdlib" // registers "pgx"
+	_ "modernc.org/sqlite"             // registers "sqlite"
+)
+
+// Dialect names a supported SQL database. Every query the repositories
+// run is valid in each of them; only the migrations differ.
+type Dialect string
+
+const (
+	Postgres Dialect = "postgres"
+	SQLite   Dialect = "sqlite"
+)
+
+// driverNames maps each Dialect to its database/sql driver.
+var driverNames = map[Dialect]string{
+	Postgres: "pgx",
+	SQLite:   "sqlite",
+}
+
+// Open connects to the database at dsn and migrates it to the latest
+// schema, so the server never runs against an outdated one.
+func Open(ctx context.Context, dialect Dialect, dsn string) (*sql.DB, error) {
+	driver, ok := driverNames[dialect]
+	if !ok {
+		return nil, fmt.Errorf("unsupported database driver %q", dialect)
+	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if dialect == SQLite {
+		// SQLite allows one writer; serialising on one connection avoids
+		// SQLITE_BUSY and keeps in-memory databases from splitting
+		db.SetMaxOpenConns(1)
+		if _, err := db.ExecContext(ctx, `PRAGMA foreign_keys = ON`); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if _, err := Migrate(ctx, db, dialect); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
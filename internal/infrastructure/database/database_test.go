@@ -0,0 +1,54 @@
+package database
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrations_VersionsMatchAcrossDialects(t *testing.T) {
+	pg, err := Migrations(Postgres)
+	require.NoError(t, err)
+	lite, err := Migrations(SQLite)
+	require.NoError(t, err)
+	require.Len(t, lite, len(pg))
+	for i := range pg {
+		assert.Equal(t, pg[i].Version, lite[i].Version)
+		assert.Equal(t, pg[i].Name, lite[i].Name, "each dialect carries the same changes")
+		if i > 0 {
+			assert.Less(t, pg[i-1].Version, pg[i].Version)
+		}
+	}
+}
+
+func TestOpen_MigratesOnce(t *testing.T) {
+	ctx := context.Background()
+	dsn := filepath.Join(t.TempDir(), "oidcsim.db")
+
+	db, err := Open(ctx, SQLite, dsn)
+	require.NoError(t, err)
+	var applied int
+	require.NoError(t, db.QueryRowContext(ctx, `SELECT COUNT(*) FROM schema_migrations`).Scan(&applied))
+	all, err := Migrations(SQLite)
+	require.NoError(t, err)
+	assert.Equal(t, len(all), applied)
+	require.NoError(t, db.Close())
+
+	db, err = Open(ctx, SQLite, dsn)
+	require.NoError(t, err)
+	defer db.Close()
+	n, err := Migrate(ctx, db, SQLite)
+	require.NoError(t, err)
+	assert.Zero(t, n, "an up-to-date database is left alone")
+
+	_, err = db.ExecContext(ctx, `SELECT id, revoked_at, admin_consent_id FROM delegations`)
+	assert.NoError(t, err)
+}
+
+func TestOpen_UnknownDialect(t *testing.T) {
+	_, err := Open(context.Background(), Dialect("oracle"), "")
+	assert.Error(t, err)
+}
@@ -1,7 +1,5 @@
 -- 001_create_delegations.sql
 
-BEGIN;
-
 CREATE TABLE IF NOT EXISTS delegations (
     id          UUID PRIMARY KEY,
     user_id     TEXT NOT NULL,
@@ -17,5 +15,3 @@ CREATE TABLE IF NOT EXISTS delegations (
 -- Index to speed up lookups by user/client
 CREATE INDEX IF NOT EXISTS idx_delegations_user_client
     ON delegations (user_id, client_id);
-
-COMMIT;
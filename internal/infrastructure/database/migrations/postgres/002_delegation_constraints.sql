@@ -0,0 +1,8 @@
+-- 002_delegation_constraints.sql
+
+ALTER TABLE delegations
+    ADD COLUMN IF NOT EXISTS not_before TIMESTAMPTZ,                   -- null means no lower bound
+    ADD COLUMN IF NOT EXISTS not_after  TIMESTAMPTZ,                   -- null means no upper bound
+    ADD COLUMN IF NOT EXISTS audiences  TEXT NOT NULL DEFAULT '',      -- space-separated list of allowed audiences
+    ADD COLUMN IF NOT EXISTS ip_cidrs   TEXT NOT NULL DEFAULT '',      -- space-separated list of allowed networks
+    ADD COLUMN IF NOT EXISTS resources  TEXT NOT NULL DEFAULT '';      -- space-separated list of allowed resources
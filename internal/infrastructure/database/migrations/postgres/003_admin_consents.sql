@@ -0,0 +1,20 @@
+-- 003_admin_consents.sql
+
+CREATE TABLE IF NOT EXISTS admin_consents (
+    id          UUID PRIMARY KEY,
+    client_id   TEXT NOT NULL,
+    scopes      TEXT NOT NULL,                   -- space-separated list of scopes
+    all_users   BOOLEAN NOT NULL DEFAULT false,
+    group_ids   TEXT NOT NULL DEFAULT '',        -- space-separated list of groups
+    user_ids    TEXT NOT NULL DEFAULT '',        -- space-separated list of users
+    granted_by  TEXT NOT NULL DEFAULT '',
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    revoked_at  TIMESTAMPTZ                      -- null while in force
+);
+
+CREATE INDEX IF NOT EXISTS idx_admin_consents_client
+    ON admin_consents (client_id);
+
+-- Delegations granted by an admin consent rather than the user
+ALTER TABLE delegations
+    ADD COLUMN IF NOT EXISTS admin_consent_id UUID REFERENCES admin_consents (id);
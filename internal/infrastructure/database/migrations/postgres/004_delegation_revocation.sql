@@ -0,0 +1,13 @@
+-- 004_delegation_revocation.sql
+
+-- Revoked delegations are kept for audit; a user has at most one
+-- delegation to a client that is not revoked.
+ALTER TABLE delegations
+    ADD COLUMN IF NOT EXISTS revoked_at TIMESTAMPTZ; -- null while in force
+
+ALTER TABLE delegations
+    DROP CONSTRAINT IF EXISTS delegations_user_client;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_delegations_active_user_client
+    ON delegations (user_id, client_id)
+    WHERE revoked_at IS NULL;
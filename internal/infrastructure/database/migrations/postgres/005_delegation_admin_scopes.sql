@@ -0,0 +1,6 @@
+-- 005_delegation_admin_scopes.sql
+
+-- Scopes admin consents added to a delegation the user granted, as a JSON
+-- object from scope to admin consent ID; empty when there are none
+ALTER TABLE delegations
+    ADD COLUMN IF NOT EXISTS admin_scopes TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,15 @@
+-- 001_create_delegations.sql
+
+CREATE TABLE IF NOT EXISTS delegations (
+    id          TEXT PRIMARY KEY,
+    user_id     TEXT NOT NULL,
+    client_id   TEXT NOT NULL,
+    scopes      TEXT NOT NULL, -- space-separated list of scopes
+    created_at  TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at  TIMESTAMP,     -- optional: null means no expiry
+    remember    BOOLEAN NOT NULL DEFAULT false
+);
+
+-- Index to speed up lookups by user/client
+CREATE INDEX IF NOT EXISTS idx_delegations_user_client
+    ON delegations (user_id, client_id);
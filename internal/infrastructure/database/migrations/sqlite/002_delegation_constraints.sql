@@ -0,0 +1,7 @@
+-- 002_delegation_constraints.sql
+
+ALTER TABLE delegations ADD COLUMN not_before TIMESTAMP;              -- null means no lower bound
+ALTER TABLE delegations ADD COLUMN not_after  TIMESTAMP;              -- null means no upper bound
+ALTER TABLE delegations ADD COLUMN audiences  TEXT NOT NULL DEFAULT ''; -- space-separated list of allowed audiences
+ALTER TABLE delegations ADD COLUMN ip_cidrs   TEXT NOT NULL DEFAULT ''; -- space-separated list of allowed networks
+ALTER TABLE delegations ADD COLUMN resources  TEXT NOT NULL DEFAULT ''; -- space-separated list of allowed resources
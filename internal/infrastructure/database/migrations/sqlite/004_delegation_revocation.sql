@@ -0,0 +1,9 @@
+-- 004_delegation_revocation.sql
+
+-- Revoked delegations are kept for audit; a user has at most one
+-- delegation to a client that is not revoked.
+ALTER TABLE delegations ADD COLUMN revoked_at TIMESTAMP; -- null while in force
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_delegations_active_user_client
+    ON delegations (user_id, client_id)
+    WHERE revoked_at IS NULL;
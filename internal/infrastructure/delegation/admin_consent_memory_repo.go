@@ -0,0 +1,52 @@
+package delegation
+
+import (
+	"context"
+	"sync"
+
+	delegationapp "github.com/martencassel/oidcsim/internal/application/delegation"
+	"github.com/martencassel/oidcsim/internal/domain/delegation"
+)
+
+type AdminConsentMemoryRepo struct {
+	mu   sync.RWMutex
+	data map[string]delegation.AdminConsent // key: ID
+}
+
+func NewAdminConsentMemoryRepo() *AdminConsentMemoryRepo {
+	return &AdminConsentMemoryRepo{
+		data: make(map[string]delegation.AdminConsent),
+	}
+}
+
+func (r *AdminConsentMemoryRepo) FindByID(_ context.Context, id string) (*delegation.AdminConsent, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if a, ok := r.data[id]; ok {
+		return &a, nil
+	}
+	return nil, nil
+}
+
+// ListByClient returns every admin consent granted to clientID.
+func (r *AdminConsentMemoryRepo) ListByClient(_ context.Context, clientID string) ([]delegation.AdminConsent, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var out []delegation.AdminConsent
+	for _, a := range r.data {
+		if a.ClientID == clientID {
+			out = append(out, a)
+		}
+	}
+	return out, nil
+}
+
+func (r *AdminConsentMemoryRepo) Save(_ context.Context, a delegation.AdminConsent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.data[a.ID] = a
+	return nil
+}
+
+// Ensure interface compliance
+var _ delegationapp.AdminConsentRepository = (*AdminConsentMemoryRepo)(nil)
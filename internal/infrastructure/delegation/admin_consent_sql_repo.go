@@ -0,0 +1,93 @@
+package delegation
+
+import (
+	"context"
+	"database/sql"
+
+	delegationapp "github.com/martencassel/oidcsim/internal/application/delegation"
+	"github.com/martencassel/oidcsim/internal/domain/delegation"
+)
+
+// AdminConsentSQLRepo stores admin consents next to the delegations
+// they grant.
+type AdminConsentSQLRepo struct {
+	db *sql.DB
+}
+
+func NewAdminConsentSQLRepo(db *sql.DB) *AdminConsentSQLRepo {
+	return &AdminConsentSQLRepo{db: db}
+}
+
+// adminConsentColumns are the columns scanAdminConsent reads, in order.
+const adminConsentColumns = `id, client_id, scopes, all_users, group_ids, user_ids,
+        granted_by, created_at, revoked_at`
+
+func (r *AdminConsentSQLRepo) FindByID(ctx context.Context, id string) (*delegation.AdminConsent, error) {
+	const q = `
+        SELECT ` + adminConsentColumns + `
+        FROM admin_consents
+        WHERE id = $1
+        LIMIT 1`
+	a, err := scanAdminConsent(r.db.QueryRowContext(ctx, q, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func (r *AdminConsentSQLRepo) ListByClient(ctx context.Context, clientID string) ([]delegation.AdminConsent, error) {
+	const q = `
+        SELECT ` + adminConsentColumns + `
+        FROM admin_consents
+        WHERE client_id = $1
+        ORDER BY created_at DESC`
+	rows, err := r.db.QueryContext(ctx, q, clientID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []delegation.AdminConsent
+	for rows.Next() {
+		a, err := scanAdminConsent(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
+
+func (r *AdminConsentSQLRepo) Save(ctx context.Context, a delegation.AdminConsent) error {
+	const q = `
+        INSERT INTO admin_consents (` + adminConsentColumns + `)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+        ON CONFLICT (id) DO UPDATE
+        SET scopes = $3, all_users = $4, group_ids = $5, user_ids = $6, revoked_at = $9`
+	_, err := r.db.ExecContext(ctx, q,
+		a.ID, a.ClientID, joinScopes(a.Scopes), a.Subjects.AllUsers,
+		joinScopes(a.Subjects.GroupIDs), joinScopes(a.Subjects.UserIDs),
+		a.GrantedBy, a.CreatedAt.UTC(), nullTime(a.RevokedAt))
+	return err
+}
+
+// scanAdminConsent reads a row selected with adminConsentColumns.
+func scanAdminConsent(row interface{ Scan(dest ...any) error }) (delegation.AdminConsent, error) {
+	var a delegation.AdminConsent
+	var scopes, groups, users string
+	var revokedAt sql.NullTime
+	err := row.Scan(&a.ID, &a.ClientID, &scopes, &a.Subjects.AllUsers, &groups, &users,
+		&a.GrantedBy, &a.CreatedAt, &revokedAt)
+	if err != nil {
+		return delegation.AdminConsent{}, err
+	}
+	a.Scopes = splitScopes(scopes)
+	a.Subjects.GroupIDs = splitScopes(groups)
+	a.Subjects.UserIDs = splitScopes(users)
+	a.RevokedAt = timePtr(revokedAt)
+	return a, nil
+}
+
+var _ delegationapp.AdminConsentRepository = (*AdminConsentSQLRepo)(nil)
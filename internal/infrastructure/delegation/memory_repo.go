@@ -2,7 +2,9 @@ package delegation
 
 import (
 	"context"
+	"strings"
 	"sync"
+	"time"
 
 	delegationapp "github.com/martencassel/oidcsim/internal/application/delegation"
 	"github.com/martencassel/oidcsim/internal/domain/delegation"
@@ -10,7 +12,7 @@ import (
 
 type MemoryRepo struct {
 	mu   sync.RWMutex
-	data map[string]delegation.Delegation // key: userID|clientID
+	data map[string]delegation.Delegation // key: delegation ID
 }
 
 func NewMemoryRepo() *MemoryRepo {
@@ -19,37 +21,77 @@ func NewMemoryRepo() *MemoryRepo {
 	}
 }
 
+// FindByUserAndClient returns the user's delegation to the client that
+// is not revoked, or nil when there is none.
 func (r *MemoryRepo) FindByUserAndClient(_ context.Context, userID, clientID string) (*delegation.Delegation, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
-	if d, ok := r.data[userID+"|"+clientID]; ok {
-		return &d, nil
+	for _, d := range r.data {
+		if d.UserID == userID && d.ClientID == clientID && !d.IsRevoked() {
+			return &d, nil
+		}
 	}
 	return nil, nil
 }
 
+// ListByClient returns every delegation granted to clientID.
+func (r *MemoryRepo) ListByClient(_ context.Context, clientID string) ([]delegation.Delegation, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var out []delegation.Delegation
+	for _, d := range r.data {
+		if d.ClientID == clientID {
+			out = append(out, d)
+		}
+	}
+	return out, nil
+}
+
+// ListByUser returns every delegation userID has granted.
+func (r *MemoryRepo) ListByUser(_ context.Context, userID string) ([]delegation.Delegation, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var out []delegation.Delegation
+	for _, d := range r.data {
+		if d.UserID == userID {
+			out = append(out, d)
+		}
+	}
+	return out, nil
+}
+
 func (r *MemoryRepo) Save(_ context.Context, d delegation.Delegation) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	r.data[d.UserID+"|"+d.ClientID] = d
+	r.data[d.ID] = d
 	return nil
 }
 
-func (r *MemoryRepo) Delete(_ context.Context, userID, clientID string) error {
+func (r *MemoryRepo) Revoke(_ context.Context, delegationID string, at time.Time) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	delete(r.data, userID+"|"+clientID)
+	d, ok := r.data[delegationID]
+	if !ok || d.IsRevoked() {
+		return nil
+	}
+	d.RevokedAt = &at
+	r.data[delegationID] = d
 	return nil
 }
 
-// FindByID implements the Repository interface.
-// Assumes the ID is in the format "userID|clientID".
-func (r *MemoryRepo) FindByID(_ context.Context, id string) (*delegation.Delegation, error) {
+// FindByID implements the Repository interface. It accepts the
+// delegation ID as well as a "userID|clientID" key for the user's
+// delegation to the client.
+func (r *MemoryRepo) FindByID(ctx context.Context, id string) (*delegation.Delegation, error) {
 	r.mu.RLock()
-	defer r.mu.RUnlock()
-	if d, ok := r.data[id]; ok {
+	d, ok := r.data[id]
+	r.mu.RUnlock()
+	if ok {
 		return &d, nil
 	}
+	if userID, clientID, found := strings.Cut(id, "|"); found {
+		return r.FindByUserAndClient(ctx, userID, clientID)
+	}
 	return nil, nil
 }
 
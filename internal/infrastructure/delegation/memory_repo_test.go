@@ -2,6 +2,7 @@ package delegation
 
 import (
 	"testing"
+	"time"
 
 	"github.com/martencassel/oidcsim/internal/application/delegation"
 	domain "github.com/martencassel/oidcsim/internal/domain/delegation"
@@ -28,11 +29,32 @@ func TestDelegationMemoryRepo(t *testing.T) {
 	assert.NotNil(t, d2)
 	assert.Equal(t, "delegation1", d2.ID)
 
-	err = repo.Delete(nil, "alice", "client1")
+	err = repo.Revoke(nil, "delegation1", time.Now())
 	assert.NoError(t, err)
 
 	d3, err := repo.FindByUserAndClient(nil, "alice", "client1")
 	assert.NoError(t, err)
 	assert.Nil(t, d3)
 
+	d4, err := repo.FindByID(nil, "delegation1")
+	assert.NoError(t, err)
+	assert.NotNil(t, d4, "revoked delegations are kept")
+	assert.True(t, d4.IsRevoked())
+
+}
+
+func TestDelegationMemoryRepo_ListByUser(t *testing.T) {
+	repo := NewMemoryRepo()
+	repo.Save(nil, domain.Delegation{ID: "d1", UserID: "alice", ClientID: "client1"})
+	repo.Save(nil, domain.Delegation{ID: "d2", UserID: "alice", ClientID: "client2"})
+	repo.Save(nil, domain.Delegation{ID: "d3", UserID: "bob", ClientID: "client1"})
+
+	list, err := repo.ListByUser(nil, "alice")
+	assert.NoError(t, err)
+	assert.Len(t, list, 2)
+
+	d, err := repo.FindByID(nil, "d3")
+	assert.NoError(t, err)
+	assert.NotNil(t, d)
+	assert.Equal(t, "bob", d.UserID)
 }
@@ -0,0 +1,198 @@
+package delegation
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+
+	delegationapp "github.com/martencassel/oidcsim/internal/application/delegation"
+	"github.com/martencassel/oidcsim/internal/domain/delegation"
+)
+
+// SQLRepo stores delegations in the schema the database package migrates
+// to. Its queries run on every database.Dialect.
+type SQLRepo struct {
+	db *sql.DB
+}
+
+func NewSQLRepo(db *sql.DB) *SQLRepo {
+	return &SQLRepo{db: db}
+}
+
+// delegationColumns are the columns scanDelegation reads, in order.
+const delegationColumns = `id, user_id, client_id, scopes, created_at, expires_at, revoked_at, remember,
+        not_before, not_after, audiences, ip_cidrs, resources, admin_consent_id, admin_scopes`
+
+// FindByUserAndClient returns the user's delegation to the client that
+// is not revoked, or nil when there is none.
+func (r *SQLRepo) FindByUserAndClient(ctx context.Context, userID, clientID string) (*delegation.Delegation, error) {
+	const q = `
+        SELECT ` + delegationColumns + `
+        FROM delegations
+        WHERE user_id = $1 AND client_id = $2 AND revoked_at IS NULL
+        LIMIT 1`
+	return r.find(ctx, q, userID, clientID)
+}
+
+// FindByID returns the delegation, revoked or not, or nil when there is
+// none.
+func (r *SQLRepo) FindByID(ctx context.Context, id string) (*delegation.Delegation, error) {
+	const q = `
+        SELECT ` + delegationColumns + `
+        FROM delegations
+        WHERE id = $1`
+	return r.find(ctx, q, id)
+}
+
+// ListByClient returns every delegation granted to clientID, revoked ones
+// included, newest first.
+func (r *SQLRepo) ListByClient(ctx context.Context, clientID string) ([]delegation.Delegation, error) {
+	const q = `
+        SELECT ` + delegationColumns + `
+        FROM delegations
+        WHERE client_id = $1
+        ORDER BY created_at DESC`
+	return r.list(ctx, q, clientID)
+}
+
+// ListByUser returns every delegation userID has granted, revoked ones
+// included, newest first.
+func (r *SQLRepo) ListByUser(ctx context.Context, userID string) ([]delegation.Delegation, error) {
+	const q = `
+        SELECT ` + delegationColumns + `
+        FROM delegations
+        WHERE user_id = $1
+        ORDER BY created_at DESC`
+	return r.list(ctx, q, userID)
+}
+
+func (r *SQLRepo) find(ctx context.Context, q string, args ...any) (*delegation.Delegation, error) {
+	d, err := scanDelegation(r.db.QueryRowContext(ctx, q, args...))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+func (r *SQLRepo) list(ctx context.Context, q string, args ...any) ([]delegation.Delegation, error) {
+	rows, err := r.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []delegation.Delegation
+	for rows.Next() {
+		d, err := scanDelegation(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+// Save inserts d or updates the stored delegation with its ID. The user
+// and client of a delegation never change.
+func (r *SQLRepo) Save(ctx context.Context, d delegation.Delegation) error {
+	const q = `
+        INSERT INTO delegations (` + delegationColumns + `)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+        ON CONFLICT (id) DO UPDATE
+        SET scopes = $4, created_at = $5, expires_at = $6, revoked_at = $7, remember = $8,
+            not_before = $9, not_after = $10, audiences = $11, ip_cidrs = $12, resources = $13,
+            admin_consent_id = $14, admin_scopes = $15`
+	c := d.Constraints
+	adminConsentID := sql.NullString{String: d.AdminConsentID, Valid: d.AdminConsentID != ""}
+	adminScopes, err := encodeAdminScopes(d.AdminScopes)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, q,
+		d.ID, d.UserID, d.ClientID, joinScopes(d.Scopes), d.CreatedAt.UTC(),
+		nullTime(d.ExpiresAt), nullTime(d.RevokedAt), d.Remember,
+		nullTime(c.NotBefore), nullTime(c.NotAfter), joinScopes(c.Audiences), joinScopes(c.IPCIDRs), joinScopes(c.Resources),
+		adminConsentID, adminScopes)
+	return err
+}
+
+// Revoke sets revoked_at, keeping the row for the record.
+func (r *SQLRepo) Revoke(ctx context.Context, delegationID string, at time.Time) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE delegations SET revoked_at = $1 WHERE id = $2 AND revoked_at IS NULL`,
+		at.UTC(), delegationID)
+	return err
+}
+
+// scanDelegation reads a row selected with delegationColumns.
+func scanDelegation(row interface{ Scan(dest ...any) error }) (delegation.Delegation, error) {
+	var d delegation.Delegation
+	var scopes, audiences, cidrs, resources string
+	var expiresAt, revokedAt, notBefore, notAfter sql.NullTime
+	var adminConsentID sql.NullString
+	var adminScopes string
+	err := row.Scan(&d.ID, &d.UserID, &d.ClientID, &scopes, &d.CreatedAt, &expiresAt, &revokedAt, &d.Remember,
+		&notBefore, &notAfter, &audiences, &cidrs, &resources, &adminConsentID, &adminScopes)
+	if err != nil {
+		return delegation.Delegation{}, err
+	}
+	if adminScopes != "" {
+		if err := json.Unmarshal([]byte(adminScopes), &d.AdminScopes); err != nil {
+			return delegation.Delegation{}, err
+		}
+	}
+	d.Scopes = splitScopes(scopes)
+	d.ExpiresAt = timePtr(expiresAt)
+	d.RevokedAt = timePtr(revokedAt)
+	d.AdminConsentID = adminConsentID.String
+	d.Constraints = delegation.Constraints{
+		NotBefore: timePtr(notBefore),
+		NotAfter:  timePtr(notAfter),
+		Audiences: splitScopes(audiences),
+		IPCIDRs:   splitScopes(cidrs),
+		Resources: splitScopes(resources),
+	}
+	return d, nil
+}
+
+func splitScopes(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, " ")
+}
+
+func joinScopes(scopes []string) string {
+	return strings.Join(scopes, " ")
+}
+
+// encodeAdminScopes stores Delegation.AdminScopes as a JSON object, or ""
+// when there are none.
+func encodeAdminScopes(scopes map[string]string) (string, error) {
+	if len(scopes) == 0 {
+		return "", nil
+	}
+	b, err := json.Marshal(scopes)
+	return string(b), err
+}
+
+// nullTime stores t in UTC, so values compare the same in every dialect.
+func nullTime(t *time.Time) sql.NullTime {
+	if t == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: t.UTC(), Valid: true}
+}
+
+func timePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+var _ delegationapp.Repository = (*SQLRepo)(nil)
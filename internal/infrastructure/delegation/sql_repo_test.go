@@ -0,0 +1,192 @@
+package delegation
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	delegationapp "github.com/martencassel/oidcsim/internal/application/delegation"
+	domain "github.com/martencassel/oidcsim/internal/domain/delegation"
+	"github.com/martencassel/oidcsim/internal/infrastructure/database"
+)
+
+func newSQLRepos(t *testing.T) (*SQLRepo, *AdminConsentSQLRepo) {
+	t.Helper()
+	db, err := database.Open(context.Background(), database.SQLite, ":memory:")
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return NewSQLRepo(db), NewAdminConsentSQLRepo(db)
+}
+
+func TestSQLRepo_RoundTripsEveryField(t *testing.T) {
+	ctx := context.Background()
+	repo, admin := newSQLRepos(t)
+	a, err := domain.NewAdminConsent("app", []string{"openid"}, domain.SubjectSelector{AllUsers: true}, "root")
+	require.NoError(t, err)
+	require.NoError(t, admin.Save(ctx, a))
+
+	created := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	expires := created.AddDate(1, 0, 0)
+	notBefore := created.Add(time.Hour)
+	notAfter := created.AddDate(0, 6, 0)
+	want := domain.Delegation{
+		ID:        "d1",
+		UserID:    "alice",
+		ClientID:  "app",
+		Scopes:    []string{"openid", "profile"},
+		CreatedAt: created,
+		ExpiresAt: &expires,
+		Remember:  true,
+		Constraints: domain.Constraints{
+			NotBefore: &notBefore,
+			NotAfter:  &notAfter,
+			Audiences: []string{"api"},
+			IPCIDRs:   []string{"10.1.0.0/16"},
+			Resources: []string{"https://api.example.com"},
+		},
+		AdminConsentID: a.ID,
+		AdminScopes:    map[string]string{"profile": a.ID},
+	}
+	require.NoError(t, repo.Save(ctx, want))
+
+	got, err := repo.FindByID(ctx, "d1")
+	require.NoError(t, err)
+	require.NotNil(t, got)
+	assertSameDelegation(t, want, *got)
+
+	got, err = repo.FindByUserAndClient(ctx, "alice", "app")
+	require.NoError(t, err)
+	require.NotNil(t, got)
+	assertSameDelegation(t, want, *got)
+
+	want.Scopes = []string{"openid"}
+	want.Remember = false
+	want.ExpiresAt = nil
+	want.Constraints = domain.Constraints{}
+	want.AdminConsentID = ""
+	want.AdminScopes = nil
+	require.NoError(t, repo.Save(ctx, want))
+	got, err = repo.FindByID(ctx, "d1")
+	require.NoError(t, err)
+	assertSameDelegation(t, want, *got)
+
+	missing, err := repo.FindByID(ctx, "nope")
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+}
+
+func assertSameDelegation(t *testing.T, want, got domain.Delegation) {
+	t.Helper()
+	assert.Equal(t, want.ID, got.ID)
+	assert.Equal(t, want.UserID, got.UserID)
+	assert.Equal(t, want.ClientID, got.ClientID)
+	assert.Equal(t, want.Scopes, got.Scopes)
+	assert.True(t, want.CreatedAt.Equal(got.CreatedAt), "created_at %v, want %v", got.CreatedAt, want.CreatedAt)
+	assertSameTime(t, want.ExpiresAt, got.ExpiresAt)
+	assertSameTime(t, want.RevokedAt, got.RevokedAt)
+	assert.Equal(t, want.Remember, got.Remember)
+	assertSameTime(t, want.Constraints.NotBefore, got.Constraints.NotBefore)
+	assertSameTime(t, want.Constraints.NotAfter, got.Constraints.NotAfter)
+	assert.Equal(t, want.Constraints.Audiences, got.Constraints.Audiences)
+	assert.Equal(t, want.Constraints.IPCIDRs, got.Constraints.IPCIDRs)
+	assert.Equal(t, want.Constraints.Resources, got.Constraints.Resources)
+	assert.Equal(t, want.AdminConsentID, got.AdminConsentID)
+	assert.Equal(t, want.AdminScopes, got.AdminScopes)
+}
+
+func assertSameTime(t *testing.T, want, got *time.Time) {
+	t.Helper()
+	if want == nil {
+		assert.Nil(t, got)
+		return
+	}
+	require.NotNil(t, got)
+	assert.True(t, want.Equal(*got), "got %v, want %v", *got, *want)
+}
+
+func TestSQLRepo_RevokeIsASoftDelete(t *testing.T) {
+	ctx := context.Background()
+	repo, _ := newSQLRepos(t)
+	now := time.Now().UTC().Truncate(time.Second)
+	require.NoError(t, repo.Save(ctx, domain.Delegation{ID: "d1", UserID: "alice", ClientID: "app", Scopes: []string{"openid"}, CreatedAt: now.Add(-time.Hour)}))
+
+	require.NoError(t, repo.Revoke(ctx, "d1", now))
+	require.NoError(t, repo.Revoke(ctx, "d1", now.Add(time.Minute)))
+	d, err := repo.FindByID(ctx, "d1")
+	require.NoError(t, err)
+	require.NotNil(t, d, "revoked delegations are kept")
+	require.NotNil(t, d.RevokedAt)
+	assert.True(t, now.Equal(*d.RevokedAt), "the first revocation time is kept")
+	current, err := repo.FindByUserAndClient(ctx, "alice", "app")
+	require.NoError(t, err)
+	assert.Nil(t, current)
+
+	require.NoError(t, repo.Save(ctx, domain.Delegation{ID: "d2", UserID: "alice", ClientID: "app", Scopes: []string{"email"}, CreatedAt: now}))
+	current, err = repo.FindByUserAndClient(ctx, "alice", "app")
+	require.NoError(t, err)
+	require.NotNil(t, current)
+	assert.Equal(t, "d2", current.ID, "a new delegation can follow a revoked one")
+
+	err = repo.Save(ctx, domain.Delegation{ID: "d3", UserID: "alice", ClientID: "app", Scopes: []string{"openid"}, CreatedAt: now})
+	assert.Error(t, err, "only one delegation per user and client is in force")
+}
+
+func TestSQLRepo_ListByUserAndClient(t *testing.T) {
+	ctx := context.Background()
+	repo, _ := newSQLRepos(t)
+	now := time.Now().UTC()
+	for _, d := range []domain.Delegation{
+		{ID: "d1", UserID: "alice", ClientID: "app", Scopes: []string{"openid"}, CreatedAt: now.Add(-2 * time.Hour)},
+		{ID: "d2", UserID: "alice", ClientID: "crm", Scopes: []string{"openid"}, CreatedAt: now.Add(-time.Hour)},
+		{ID: "d3", UserID: "bob", ClientID: "app", Scopes: []string{"openid"}, CreatedAt: now},
+	} {
+		require.NoError(t, repo.Save(ctx, d))
+	}
+	require.NoError(t, repo.Revoke(ctx, "d1", now))
+
+	byUser, err := repo.ListByUser(ctx, "alice")
+	require.NoError(t, err)
+	require.Len(t, byUser, 2)
+	assert.Equal(t, "d2", byUser[0].ID, "newest first")
+	assert.True(t, byUser[1].IsRevoked())
+
+	byClient, err := repo.ListByClient(ctx, "app")
+	require.NoError(t, err)
+	require.Len(t, byClient, 2)
+	assert.Equal(t, "d3", byClient[0].ID)
+}
+
+func TestSQLRepo_BacksDelegationService(t *testing.T) {
+	ctx := context.Background()
+	repo, admin := newSQLRepos(t)
+	svc := delegationapp.NewDelegationService(repo, nil, delegationapp.WithAdminConsents(admin, nil))
+
+	res, err := svc.ApproveConsent(ctx, "alice", "app", []string{"openid", "profile"}, true)
+	require.NoError(t, err)
+	first := res.DelegationId
+	res, err = svc.EnsureConsent(ctx, "alice", "app", []string{"openid"})
+	require.NoError(t, err)
+	assert.Equal(t, delegationapp.ConsentGranted, delegationapp.StatusOf(res.Decision))
+
+	require.NoError(t, svc.RevokeDelegation(ctx, first))
+	assert.ErrorIs(t, svc.ValidateDelegation(ctx, first, domain.Use{At: time.Now()}), domain.ErrRevoked)
+	list, err := svc.ListDelegations(ctx, "alice")
+	require.NoError(t, err)
+	assert.Empty(t, list)
+
+	res, err = svc.ApproveConsent(ctx, "alice", "app", []string{"openid"}, true)
+	require.NoError(t, err)
+	assert.NotEqual(t, first, res.DelegationId)
+
+	a, err := svc.GrantAdminConsent(ctx, "crm", []string{"openid"}, domain.SubjectSelector{UserIDs: []string{"alice"}}, "root")
+	require.NoError(t, err)
+	res, err = svc.EnsureConsent(ctx, "alice", "crm", []string{"openid"})
+	require.NoError(t, err)
+	require.NoError(t, svc.RevokeAdminConsent(ctx, a.ID))
+	d, err := repo.FindByID(ctx, res.DelegationId)
+	require.NoError(t, err)
+	assert.True(t, d.IsRevoked(), "revoking the admin consent revokes what it granted")
+}
@@ -0,0 +1,76 @@
+package identitysources
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	identitysourcesdomain "github.com/martencassel/oidcsim/internal/domain/identitysources"
+)
+
+// Claims provider that fetches claims from a JSON endpoint:
+// GET <url>?sub=<subject ID>, optionally with a bearer token.
+type httpClaimsProviderImpl struct {
+	url        string
+	token      string
+	httpClient *http.Client
+}
+
+// NewHTTPClaimsProvider reads settings["url"] and, optionally,
+// settings["token"].
+func NewHTTPClaimsProvider(settings map[string]interface{}, httpClient *http.Client) (identitysourcesdomain.ClaimsProvider, error) {
+	u, _ := settings["url"].(string)
+	if u == "" {
+		return nil, fmt.Errorf("http claims provider needs settings.url")
+	}
+	if _, err := url.Parse(u); err != nil {
+		return nil, fmt.Errorf("http claims provider: invalid url: %w", err)
+	}
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	token, _ := settings["token"].(string)
+	return &httpClaimsProviderImpl{url: u, token: token, httpClient: httpClient}, nil
+}
+
+func (h *httpClaimsProviderImpl) GetClaims(ctx context.Context, subjectID identitysourcesdomain.SubjectID) (map[string]interface{}, error) {
+	u, err := url.Parse(h.url)
+	if err != nil {
+		return nil, err
+	}
+	q := u.Query()
+	q.Set("sub", string(subjectID))
+	u.RawQuery = q.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if h.token != "" {
+		req.Header.Set("Authorization", "Bearer "+h.token)
+	}
+	resp, err := h.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching claims: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return map[string]interface{}{}, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching claims: unexpected status %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	claims := map[string]interface{}{}
+	if err := json.Unmarshal(body, &claims); err != nil {
+		return nil, fmt.Errorf("claims provider returned invalid JSON: %w", err)
+	}
+	return claims, nil
+}
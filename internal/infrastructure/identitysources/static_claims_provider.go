@@ -0,0 +1,34 @@
+package identitysources
+
+import (
+	"context"
+
+	identitysourcesdomain "github.com/martencassel/oidcsim/internal/domain/identitysources"
+)
+
+// Claims provider serving fixed claims per subject from configuration,
+// for simulating systems such as HR.
+type staticClaimsProviderImpl struct {
+	subjects map[string]map[string]interface{}
+}
+
+// NewStaticClaimsProvider reads settings["subjects"], a map from subject ID
+// to that subject's claims.
+func NewStaticClaimsProvider(settings map[string]interface{}) identitysourcesdomain.ClaimsProvider {
+	p := &staticClaimsProviderImpl{subjects: map[string]map[string]interface{}{}}
+	subjects, _ := settings["subjects"].(map[string]interface{})
+	for sub, v := range subjects {
+		if claims, ok := v.(map[string]interface{}); ok {
+			p.subjects[sub] = claims
+		}
+	}
+	return p
+}
+
+func (s *staticClaimsProviderImpl) GetClaims(ctx context.Context, subjectID identitysourcesdomain.SubjectID) (map[string]interface{}, error) {
+	claims := map[string]interface{}{}
+	for k, v := range s.subjects[string(subjectID)] {
+		claims[k] = v
+	}
+	return claims, nil
+}
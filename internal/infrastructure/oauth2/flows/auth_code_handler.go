@@ -28,7 +28,7 @@ func (h *AuthCodeHandler) Handle(ctx context.Context, req dto.TokenRequest, clie
 		PKCEVerifier: req.CodeVerifier,
 		//	Audience:     autzdomain.Audience("audience"),
 	}
-	log.Infof("Auth code exchange request: %+v", in)
+	log.Infof("Auth code exchange request of client %s for %s", client.ID, in.RedirectURI)
 	// Call domain service
 	// res, err := h.svc.ExchangeCodeForTokens(ctx, in)
 	// if err != nil {
@@ -1,2 +1,157 @@
 package security
 
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/martencassel/oidcsim/internal/errors"
+	"github.com/martencassel/oidcsim/internal/store"
+)
+
+// AccessToken is a validated bearer access token.
+type AccessToken struct {
+	ID             string // jti, or the record ID of an opaque token
+	Subject        string
+	ClientID       string
+	Audience       string
+	Issuer         string
+	Scopes         []string
+	CertThumbprint string // x5t#S256 of the bound certificate, if any
+	IssuedAt       time.Time
+	ExpiresAt      time.Time
+}
+
+// HasScope reports whether scope was granted to the token.
+func (t *AccessToken) HasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// JWTTokenValidator validates access tokens issued by this server. JWTs are
+// verified against Keyfunc; any other value is treated as an opaque token
+// and looked up in Tokens.
+//
+// When Tokens is set, JWTs must also have an active record, so revocation
+// applies to both formats. When Clients is set, tokens of unknown or
+// disabled clients are rejected.
+type JWTTokenValidator struct {
+	Issuer     string
+	Keyfunc    jwt.Keyfunc
+	Algorithms []string
+	Tokens     store.TokenStore
+	Clients    store.ClientStore
+	Now        func() time.Time
+}
+
+// ValidateAccessToken returns the subject and scopes of a valid token.
+func (v *JWTTokenValidator) ValidateAccessToken(ctx context.Context, token string) (string, []string, error) {
+	at, err := v.Validate(ctx, token)
+	if err != nil {
+		return "", nil, err
+	}
+	return at.Subject, at.Scopes, nil
+}
+
+// Validate returns the token's grant. Failures are reported as
+// invalid_token with a description suitable for a WWW-Authenticate header.
+func (v *JWTTokenValidator) Validate(ctx context.Context, raw string) (*AccessToken, error) {
+	if raw == "" {
+		return nil, errors.ErrInvalidToken.WithDescription("missing access token")
+	}
+	var at *AccessToken
+	var err error
+	if strings.Count(raw, ".") == 2 {
+		at, err = v.validateJWT(ctx, raw)
+	} else {
+		at, err = v.validateOpaque(ctx, raw)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if v.Clients != nil {
+		client, err := v.Clients.GetByID(ctx, at.ClientID)
+		if err != nil || !client.Meta.Enabled {
+			return nil, errors.ErrInvalidToken.WithDescription("client is no longer authorized")
+		}
+	}
+	return at, nil
+}
+
+func (v *JWTTokenValidator) validateJWT(ctx context.Context, raw string) (*AccessToken, error) {
+	if v.Keyfunc == nil {
+		return nil, errors.ErrInvalidToken.WithDescription("token verification keys not configured")
+	}
+	claims := jwt.MapClaims{}
+	opts := []jwt.ParserOption{jwt.WithExpirationRequired(), jwt.WithTimeFunc(v.now)}
+	if len(v.Algorithms) > 0 {
+		opts = append(opts, jwt.WithValidMethods(v.Algorithms))
+	}
+	if v.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(v.Issuer))
+	}
+	if _, err := jwt.ParseWithClaims(raw, claims, v.Keyfunc, opts...); err != nil {
+		return nil, errors.ErrInvalidToken.WithDescription("access token is invalid or expired")
+	}
+	at := &AccessToken{}
+	at.ID, _ = claims["jti"].(string)
+	at.Subject, _ = claims["sub"].(string)
+	at.ClientID, _ = claims["client_id"].(string)
+	at.Issuer, _ = claims["iss"].(string)
+	if aud, err := claims.GetAudience(); err == nil && len(aud) > 0 {
+		at.Audience = aud[0]
+	}
+	if scope, ok := claims["scope"].(string); ok {
+		at.Scopes = strings.Fields(scope)
+	}
+	if cnf, ok := claims["cnf"].(map[string]interface{}); ok {
+		at.CertThumbprint, _ = cnf["x5t#S256"].(string)
+	}
+	if iat, err := claims.GetIssuedAt(); err == nil && iat != nil {
+		at.IssuedAt = iat.Time
+	}
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+		at.ExpiresAt = exp.Time
+	}
+	if v.Tokens != nil {
+		rec, err := v.Tokens.Get(ctx, at.ID)
+		if err != nil || !rec.IsActiveAt(v.now()) {
+			return nil, errors.ErrInvalidToken.WithDescription("access token has been revoked")
+		}
+	}
+	return at, nil
+}
+
+func (v *JWTTokenValidator) validateOpaque(ctx context.Context, raw string) (*AccessToken, error) {
+	if v.Tokens == nil {
+		return nil, errors.ErrInvalidToken.WithDescription("access token is invalid or expired")
+	}
+	rec, err := v.Tokens.Get(ctx, store.OpaqueTokenID(raw))
+	if err != nil || !rec.Opaque || !rec.IsActiveAt(v.now()) {
+		return nil, errors.ErrInvalidToken.WithDescription("access token is invalid or expired")
+	}
+	return &AccessToken{
+		ID:             rec.ID,
+		Subject:        rec.Subject,
+		ClientID:       rec.ClientID,
+		Audience:       rec.Audience,
+		Issuer:         v.Issuer,
+		Scopes:         strings.Fields(rec.Scope),
+		CertThumbprint: rec.CertThumbprint,
+		IssuedAt:       rec.IssuedAt,
+		ExpiresAt:      rec.ExpiresAt,
+	}, nil
+}
+
+func (v *JWTTokenValidator) now() time.Time {
+	if v.Now != nil {
+		return v.Now()
+	}
+	return time.Now()
+}
@@ -0,0 +1,88 @@
+package security
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/martencassel/oidcsim/internal/errors"
+	"github.com/martencassel/oidcsim/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testKey = []byte("0123456789abcdef0123456789abcdef")
+
+func signTestToken(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(testKey)
+	require.NoError(t, err)
+	return signed
+}
+
+func newTestValidator(t *testing.T) (*JWTTokenValidator, *store.InMemoryTokenStore, *store.InMemoryClientStore) {
+	t.Helper()
+	tokens := store.NewInMemoryTokenStore()
+	clients := store.NewInMemoryClientStore()
+	require.NoError(t, clients.Save(context.Background(), store.Client{ID: "app", Meta: store.ClientMeta{Enabled: true}}))
+	return &JWTTokenValidator{
+		Issuer:     "https://idp.test",
+		Keyfunc:    func(*jwt.Token) (interface{}, error) { return testKey, nil },
+		Algorithms: []string{"HS256"},
+		Tokens:     tokens,
+		Clients:    clients,
+	}, tokens, clients
+}
+
+func TestJWTTokenValidator_JWT(t *testing.T) {
+	v, tokens, clients := newTestValidator(t)
+	ctx := context.Background()
+	now := time.Now()
+	require.NoError(t, tokens.Save(ctx, store.TokenRecord{ID: "jti-1", ClientID: "app", ExpiresAt: now.Add(time.Hour)}))
+	raw := signTestToken(t, jwt.MapClaims{
+		"iss": "https://idp.test", "sub": "alice", "client_id": "app", "scope": "openid email",
+		"jti": "jti-1", "exp": now.Add(time.Hour).Unix(), "cnf": map[string]string{"x5t#S256": "thumb"},
+	})
+
+	sub, scopes, err := v.ValidateAccessToken(ctx, raw)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", sub)
+	assert.Equal(t, []string{"openid", "email"}, scopes)
+	at, err := v.Validate(ctx, raw)
+	require.NoError(t, err)
+	assert.Equal(t, "thumb", at.CertThumbprint)
+
+	client, err := clients.GetByID(ctx, "app")
+	require.NoError(t, err)
+	client.Meta.Enabled = false
+	require.NoError(t, clients.Save(ctx, client))
+	_, err = v.Validate(ctx, raw)
+	assert.ErrorIs(t, err, errors.ErrInvalidToken, "tokens of disabled clients are rejected")
+}
+
+func TestJWTTokenValidator_RejectsWrongIssuerAndUnrecorded(t *testing.T) {
+	v, _, _ := newTestValidator(t)
+	exp := time.Now().Add(time.Hour).Unix()
+
+	_, err := v.Validate(context.Background(), signTestToken(t, jwt.MapClaims{"iss": "https://other.test", "client_id": "app", "jti": "x", "exp": exp}))
+	assert.ErrorIs(t, err, errors.ErrInvalidToken)
+	_, err = v.Validate(context.Background(), signTestToken(t, jwt.MapClaims{"iss": "https://idp.test", "client_id": "app", "jti": "unknown", "exp": exp}))
+	assert.ErrorIs(t, err, errors.ErrInvalidToken)
+}
+
+func TestJWTTokenValidator_Opaque(t *testing.T) {
+	v, tokens, _ := newTestValidator(t)
+	ctx := context.Background()
+	require.NoError(t, tokens.Save(ctx, store.TokenRecord{
+		ID: store.OpaqueTokenID("opaque-value"), Opaque: true, ClientID: "app", Subject: "alice",
+		Scope: "openid", ExpiresAt: time.Now().Add(time.Hour),
+	}))
+	at, err := v.Validate(ctx, "opaque-value")
+	require.NoError(t, err)
+	assert.Equal(t, "alice", at.Subject)
+	assert.True(t, at.HasScope("openid"))
+
+	_, err = v.Validate(ctx, store.OpaqueTokenID("opaque-value"))
+	assert.ErrorIs(t, err, errors.ErrInvalidToken, "the record ID is not a usable token")
+}
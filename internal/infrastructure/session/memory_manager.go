@@ -165,7 +165,7 @@ func genSessionID() (string, error) {
 }
 
 func (m *memorySessionManager) SaveAuthorizeRequest(sid string, req dto.AuthorizeRequest) error {
-	m.mu.Unlock()
+	m.mu.Lock()
 	defer m.mu.Unlock()
 	s, ok := m.sessions[sid]
 	if !ok {
@@ -9,12 +9,14 @@ import (
 
 	delegationapp "github.com/martencassel/oidcsim/internal/application/delegation"
 	oauth2app "github.com/martencassel/oidcsim/internal/application/oauth2"
-	"github.com/martencassel/oidcsim/internal/application/oidc"
 	"github.com/martencassel/oidcsim/internal/application/session"
+	"github.com/martencassel/oidcsim/internal/application/subject"
 	"github.com/martencassel/oidcsim/internal/domain/authentication"
+	"github.com/martencassel/oidcsim/internal/domain/delegation"
 	"github.com/martencassel/oidcsim/internal/domain/oauth2"
 	"github.com/martencassel/oidcsim/internal/interface/http/dto"
 	middleware "github.com/martencassel/oidcsim/internal/interface/http/middleware"
+	"github.com/martencassel/oidcsim/internal/store"
 )
 
 /*
@@ -35,11 +37,41 @@ Domain types: Handlers work with domain value objects, not DTOs from persistence
 */
 
 type Handler struct {
-	UserInfoAppService oidc.UserInfoAppService
-	Sessions           session.SessionManager // interface for session read/write
-	AuthSvc            authentication.DefaultAuthService
-	AuthorizeSvc       oauth2app.AuthorizationService
-	DelegationSvc      delegationapp.DelegationService
+	Sessions       session.SessionManager // interface for session read/write
+	AuthSvc        authentication.DefaultAuthService
+	AuthorizeSvc   oauth2app.AuthorizationService
+	DelegationSvc  delegationapp.DelegationService
+	Clients        store.ClientStore // client names and redirect URIs for the consent page
+	Tokens         store.TokenStore  // revoked when the user disconnects an app
+	Subjects       *subject.Identifiers
+	PushedRequests store.PushedRequestStore // shared with the PAR endpoint
+}
+
+// RegisterRoutes registers the consent endpoints. Authorize is not a
+// route of its own: the token service's authorization endpoint validates
+// the request and hands it to AuthorizeFlow.
+func (h *Handler) RegisterRoutes(r gin.IRoutes) {
+	r.GET("/consent", h.withSession(h.ConsentPage))
+	r.POST("/consent", h.withSession(h.ConsentDecision))
+}
+
+// RegisterAccountRoutes registers the pages where users review and revoke
+// what they granted.
+func (h *Handler) RegisterAccountRoutes(r gin.IRoutes) {
+	r.GET("/account/apps", h.withSession(h.ConnectedApps))
+	r.POST("/account/apps/:id/disconnect", h.withSession(h.DisconnectApp))
+	r.GET("/account/grants", h.withSession(h.ListGrants))
+	r.DELETE("/account/grants/:id", h.withSession(h.RevokeGrant))
+}
+
+// AuthorizeFlow returns Authorize with the browser session attached, for
+// the token service's authorization endpoint to hand requests to.
+func (h *Handler) AuthorizeFlow() gin.HandlerFunc {
+	return h.withSession(h.Authorize)
+}
+
+func (h *Handler) withSession(next gin.HandlerFunc) gin.HandlerFunc {
+	return middleware.WithGinSession(h.Sessions, next)
 }
 
 func (h *Handler) Authorize(g *gin.Context) {
@@ -50,18 +82,19 @@ func (h *Handler) Authorize(g *gin.Context) {
 		http.Error(g.Writer, "invalid request", http.StatusBadRequest)
 		return
 	}
-	// Step 2: Translate DTO to domain model
-	scopes := fromScopeString(dtoReq.Scope)
-	domReq := oauth2.AuthorizeRequest{
-		ResponseType:        dtoReq.ResponseType,
-		ClientID:            dtoReq.ClientID,
-		RedirectURI:         dtoReq.RedirectURI,
-		Scope:               scopes,
-		State:               dtoReq.State,
-		CodeChallenge:       dtoReq.CodeChallenge,
-		CodeChallengeMethod: dtoReq.CodeChallengeMethod,
-		Nonce:               dtoReq.Nonce,
+	if dtoReq.RequestURI != "" {
+		if err := h.resolvePushedRequest(ctx, &dtoReq); err != nil {
+			http.Error(g.Writer, "invalid_request_uri: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	action, err := delegation.ParseGrantManagementAction(dtoReq.GrantManagementAction, dtoReq.GrantID)
+	if err != nil {
+		http.Error(g.Writer, err.Error(), http.StatusBadRequest)
+		return
 	}
+	// Step 2: Translate DTO to domain model
+	domReq := toDomainAuthorizeRequest(dtoReq)
 	log.Infof("domReq: %v", domReq)
 
 	// Step 3: Retrieve session ID from middleware
@@ -75,15 +108,18 @@ func (h *Handler) Authorize(g *gin.Context) {
 		g.Redirect(http.StatusFound, "/login")
 		return
 	}
-	// Step 5: Ensure consent (currently auto-approved)
+	if err := h.checkGrant(ctx, authCtx.SubjectID, dtoReq, action); err != nil {
+		http.Error(g.Writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Step 5: Ensure consent for the scopes not granted before
 	consentResult, err := h.DelegationSvc.EnsureConsent(ctx, authCtx.SubjectID, domReq.ClientID, domReq.Scope)
 	if err != nil {
 		http.Error(g.Writer, err.Error(), http.StatusBadRequest)
 		return
 	}
 	// Step 6: Handle consent decision
-	d := delegationapp.ConsentStatus(rune(consentResult.Decision))
-	switch d {
+	switch delegationapp.StatusOf(consentResult.Decision) {
 	case delegationapp.ConsentRequired:
 		_ = h.Sessions.SaveAuthorizeRequest(sid, dtoReq)
 		g.Redirect(http.StatusFound, "/consent")
@@ -92,7 +128,24 @@ func (h *Handler) Authorize(g *gin.Context) {
 		http.Error(g.Writer, "consent denied", http.StatusForbidden)
 		return
 	case delegationapp.ConsentGranted:
-		// Proceed to generate authorization code
+		domReq.GrantID = consentResult.DelegationId
+		// Nothing to ask, but the client may still direct how the grant
+		// is recorded, e.g. replace it with fewer scopes.
+		if action != "" {
+			applied, err := h.DelegationSvc.ApplyGrant(ctx, authCtx.SubjectID, domReq.ClientID, action, dtoReq.GrantID, domReq.Scope, true)
+			if err != nil {
+				http.Error(g.Writer, err.Error(), http.StatusBadRequest)
+				return
+			}
+			domReq.GrantID = applied.DelegationId
+		}
+		// Incremental authorization: the response covers the earlier grant too
+		granted, err := h.includedGrantedScopes(ctx, authCtx.SubjectID, dtoReq)
+		if err != nil {
+			http.Error(g.Writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		domReq.Scope = delegation.IncludeGrantedScopes(domReq.Scope, granted)
 	default:
 		http.Error(g.Writer, "internal error", http.StatusInternalServerError)
 		return
@@ -116,6 +169,19 @@ func dtoToDomainAuthorizeRequest(g *gin.Context) dto.AuthorizeRequest {
 	return req
 }
 
+func toDomainAuthorizeRequest(req dto.AuthorizeRequest) oauth2.AuthorizeRequest {
+	return oauth2.AuthorizeRequest{
+		ResponseType:        req.ResponseType,
+		ClientID:            req.ClientID,
+		RedirectURI:         req.RedirectURI,
+		Scope:               fromScopeString(req.Scope),
+		State:               req.State,
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: req.CodeChallengeMethod,
+		Nonce:               req.Nonce,
+	}
+}
+
 func fromScopeString(s string) []string {
 	if s == "" {
 		return []string{}
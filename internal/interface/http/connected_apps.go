@@ -0,0 +1,194 @@
+package http
+
+import (
+	"context"
+	_ "embed"
+	stderrors "errors"
+	"html/template"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/martencassel/oidcsim/internal/domain/delegation"
+	"github.com/martencassel/oidcsim/internal/domain/oidc"
+	"github.com/martencassel/oidcsim/internal/errors"
+	"github.com/martencassel/oidcsim/internal/interface/http/dto"
+	middleware "github.com/martencassel/oidcsim/internal/interface/http/middleware"
+)
+
+//go:embed templates/connected_apps.html
+var connectedAppsHTML string
+
+var connectedAppsTemplate = template.Must(template.New("connected_apps").Funcs(template.FuncMap{
+	"describe": oidc.DescribeScope,
+	"date":     func(unix int64) string { return time.Unix(unix, 0).UTC().Format("2 Jan 2006") },
+}).Parse(connectedAppsHTML))
+
+// errGrantNotFound is returned for grants that do not exist, are no
+// longer active or belong to another user; the three are not told apart.
+var errGrantNotFound = stderrors.New("grant not found")
+
+// connectedApp is a grant on the connected-apps page with the form token
+// its disconnect button posts.
+type connectedApp struct {
+	dto.Grant
+	Token string
+}
+
+// ConnectedApps renders the apps the signed-in user has authorized.
+func (h *Handler) ConnectedApps(g *gin.Context) {
+	ctx := g.Request.Context()
+	sid, _ := middleware.SessionIDFromContext(ctx)
+	userID, ok := h.currentUser(g, sid)
+	if !ok {
+		g.Redirect(http.StatusFound, "/login")
+		return
+	}
+	grants, err := h.grants(ctx, userID)
+	if err != nil {
+		http.Error(g.Writer, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	apps := make([]connectedApp, len(grants))
+	for i, grant := range grants {
+		apps[i] = connectedApp{Grant: grant, Token: formToken(sid, "disconnect", grant.GrantID)}
+	}
+	g.Header("Content-Type", "text/html; charset=utf-8")
+	g.Header("Cache-Control", "no-store")
+	g.Header("X-Frame-Options", "DENY")
+	g.Status(http.StatusOK)
+	if err := connectedAppsTemplate.Execute(g.Writer, struct{ Grants []connectedApp }{apps}); err != nil {
+		log.Errorf("rendering connected apps page: %v", err)
+	}
+}
+
+// DisconnectApp handles the disconnect button on the connected-apps page
+// and returns to the page.
+func (h *Handler) DisconnectApp(g *gin.Context) {
+	ctx := g.Request.Context()
+	sid, _ := middleware.SessionIDFromContext(ctx)
+	userID, ok := h.currentUser(g, sid)
+	if !ok {
+		g.Redirect(http.StatusFound, "/login")
+		return
+	}
+	grantID := g.Param("id")
+	if !validFormToken(g.PostForm("token"), formToken(sid, "disconnect", grantID)) {
+		http.Error(g.Writer, "invalid form token", http.StatusBadRequest)
+		return
+	}
+	if err := h.disconnect(ctx, userID, grantID); err != nil && !stderrors.Is(err, errGrantNotFound) {
+		http.Error(g.Writer, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	g.Redirect(http.StatusSeeOther, "/account/apps")
+}
+
+// ListGrants serves the signed-in user's grants as JSON.
+func (h *Handler) ListGrants(g *gin.Context) {
+	ctx := g.Request.Context()
+	sid, _ := middleware.SessionIDFromContext(ctx)
+	userID, ok := h.currentUser(g, sid)
+	if !ok {
+		g.JSON(http.StatusUnauthorized, dto.ErrorResponse{Error: errors.ErrLoginRequired.Error()})
+		return
+	}
+	grants, err := h.grants(ctx, userID)
+	if err != nil {
+		g.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: errors.ErrServerError.Error(), ErrorDescription: err.Error()})
+		return
+	}
+	g.JSON(http.StatusOK, dto.GrantListResponse{Grants: grants})
+}
+
+// RevokeGrant disconnects the app behind one of the signed-in user's
+// grants. It is a DELETE so browsers will not send it cross-site without
+// a CORS preflight.
+func (h *Handler) RevokeGrant(g *gin.Context) {
+	ctx := g.Request.Context()
+	sid, _ := middleware.SessionIDFromContext(ctx)
+	userID, ok := h.currentUser(g, sid)
+	if !ok {
+		g.JSON(http.StatusUnauthorized, dto.ErrorResponse{Error: errors.ErrLoginRequired.Error()})
+		return
+	}
+	err := h.disconnect(ctx, userID, g.Param("id"))
+	switch {
+	case stderrors.Is(err, errGrantNotFound):
+		g.JSON(http.StatusNotFound, dto.ErrorResponse{Error: errors.ErrInvalidRequest.Error(), ErrorDescription: err.Error()})
+	case err != nil:
+		g.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: errors.ErrServerError.Error(), ErrorDescription: err.Error()})
+	default:
+		g.Status(http.StatusNoContent)
+	}
+}
+
+// currentUser returns the subject signed in on the session.
+func (h *Handler) currentUser(g *gin.Context, sid string) (string, bool) {
+	authCtx, ok, _ := h.AuthSvc.Current(g.Request.Context(), sid)
+	if !ok || authCtx.SubjectID == "" {
+		return "", false
+	}
+	return authCtx.SubjectID, true
+}
+
+// grants lists the user's active delegations as grants.
+func (h *Handler) grants(ctx context.Context, userID string) ([]dto.Grant, error) {
+	delegations, err := h.DelegationSvc.ListDelegations(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	grants := make([]dto.Grant, 0, len(delegations))
+	for _, d := range delegations {
+		grants = append(grants, h.toGrant(ctx, d))
+	}
+	return grants, nil
+}
+
+func (h *Handler) toGrant(ctx context.Context, d delegation.Delegation) dto.Grant {
+	grant := dto.Grant{
+		GrantID:    d.ID,
+		ClientID:   d.ClientID,
+		ClientName: h.clientName(ctx, d.ClientID),
+		Scope:      d.Scopes,
+		CreatedAt:  d.CreatedAt.Unix(),
+	}
+	if d.ExpiresAt != nil {
+		grant.ExpiresAt = d.ExpiresAt.Unix()
+	}
+	return grant
+}
+
+// disconnect revokes the user's grant and every token the client holds
+// for the user, so the app loses access at once rather than when its
+// tokens expire.
+func (h *Handler) disconnect(ctx context.Context, userID, grantID string) error {
+	delegations, err := h.DelegationSvc.ListDelegations(ctx, userID)
+	if err != nil {
+		return err
+	}
+	var grant *delegation.Delegation
+	for i := range delegations {
+		if delegations[i].ID == grantID {
+			grant = &delegations[i]
+		}
+	}
+	if grant == nil {
+		return errGrantNotFound
+	}
+	if err := h.DelegationSvc.RevokeDelegation(ctx, grant.ID); err != nil {
+		return err
+	}
+	if h.Tokens == nil {
+		return nil
+	}
+	sub := grant.UserID
+	if h.Clients != nil {
+		if client, err := h.Clients.GetByID(ctx, grant.ClientID); err == nil {
+			sub = h.Subjects.For(client, grant.UserID)
+		}
+	}
+	return h.Tokens.RevokeBySubject(ctx, grant.ClientID, sub, time.Now())
+}
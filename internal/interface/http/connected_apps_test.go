@@ -0,0 +1,108 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/martencassel/oidcsim/internal/interface/http/dto"
+	"github.com/martencassel/oidcsim/internal/store"
+)
+
+// approveAll walks the consent flow for the fixture's signed-in user and
+// approves every requested scope.
+func (f *consentFixture) approveAll(t *testing.T) {
+	t.Helper()
+	_, requestID := f.consentPage(t)
+	w := f.do(t, http.MethodPost, "/consent", url.Values{
+		"request_id": {requestID},
+		"decision":   {"approve"},
+		"scope":      {"profile", "email"},
+		"remember":   {"true"},
+	})
+	require.Equal(t, http.StatusFound, w.Code)
+}
+
+func (f *consentFixture) listGrants(t *testing.T) []dto.Grant {
+	t.Helper()
+	w := f.do(t, http.MethodGet, "/account/grants", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp dto.GrantListResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	return resp.Grants
+}
+
+func (f *consentFixture) issueToken(t *testing.T, id, sub string) {
+	t.Helper()
+	require.NoError(t, f.tokens.Save(context.Background(), store.TokenRecord{
+		ID: id, ClientID: "app", Subject: sub, IssuedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour),
+	}))
+}
+
+func TestConnectedApps_DisconnectRevokesGrantAndTokens(t *testing.T) {
+	ctx := context.Background()
+	f := newConsentFixture(t)
+	f.approveAll(t)
+	f.issueToken(t, "alice-1", "alice")
+	f.issueToken(t, "bob-1", "bob")
+
+	grants := f.listGrants(t)
+	require.Len(t, grants, 1)
+	assert.Equal(t, "app", grants[0].ClientID)
+	assert.Equal(t, "Example App", grants[0].ClientName)
+	assert.Equal(t, []string{"openid", "profile", "email"}, grants[0].Scope)
+	assert.NotZero(t, grants[0].CreatedAt)
+
+	w := f.do(t, http.MethodGet, "/account/apps", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Example App")
+	assert.Contains(t, w.Body.String(), "View your email address")
+	m := regexp.MustCompile(`action="(/account/apps/[^"]+/disconnect)">\s*<input type="hidden" name="token" value="([^"]+)"`).FindStringSubmatch(w.Body.String())
+	require.Len(t, m, 3)
+
+	w = f.do(t, http.MethodPost, m[1], url.Values{"token": {"forged"}})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	require.Len(t, f.listGrants(t), 1)
+
+	w = f.do(t, http.MethodPost, m[1], url.Values{"token": {m[2]}})
+	require.Equal(t, http.StatusSeeOther, w.Code)
+	assert.Equal(t, "/account/apps", w.Header().Get("Location"))
+	assert.Empty(t, f.listGrants(t))
+
+	alice, err := f.tokens.Get(ctx, "alice-1")
+	require.NoError(t, err)
+	assert.NotNil(t, alice.RevokedAt, "the app's tokens for the user are revoked")
+	bob, err := f.tokens.Get(ctx, "bob-1")
+	require.NoError(t, err)
+	assert.Nil(t, bob.RevokedAt, "other users keep their tokens")
+
+	w = f.do(t, http.MethodGet, consentAuthorizeQuery, nil)
+	assert.Equal(t, "/consent", w.Header().Get("Location"), "the user is asked again after disconnecting")
+}
+
+func TestConnectedApps_GrantsAreOwnedByTheUser(t *testing.T) {
+	f := newConsentFixture(t)
+	f.approveAll(t)
+	grantID := f.listGrants(t)[0].GrantID
+
+	f.signIn(t, "session-2", "bob")
+	assert.Empty(t, f.listGrants(t))
+	w := f.do(t, http.MethodDelete, "/account/grants/"+grantID, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	f.cookie.Value = "unknown"
+	w = f.do(t, http.MethodGet, "/account/grants", nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	f.signIn(t, "session-1", "alice")
+	w = f.do(t, http.MethodDelete, "/account/grants/"+grantID, nil)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Empty(t, f.listGrants(t))
+}
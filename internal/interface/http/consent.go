@@ -0,0 +1,244 @@
+package http
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/base64"
+	"html/template"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/martencassel/oidcsim/internal/domain/delegation"
+	"github.com/martencassel/oidcsim/internal/domain/oauth2"
+	"github.com/martencassel/oidcsim/internal/domain/oidc"
+	"github.com/martencassel/oidcsim/internal/errors"
+	"github.com/martencassel/oidcsim/internal/interface/http/dto"
+	middleware "github.com/martencassel/oidcsim/internal/interface/http/middleware"
+)
+
+//go:embed templates/consent.html
+var consentHTML string
+
+var consentTemplate = template.Must(template.New("consent").Parse(consentHTML))
+
+// requiredScopes cannot be opted out of on the consent page; without
+// openid the request is no longer an OpenID Connect request.
+var requiredScopes = []string{"openid"}
+
+// ConsentPage renders the consent screen for the authorize request saved
+// in the session by Authorize.
+func (h *Handler) ConsentPage(g *gin.Context) {
+	ctx := g.Request.Context()
+	sid, _ := middleware.SessionIDFromContext(ctx)
+	req, userID, ok := h.pendingConsent(g, sid)
+	if !ok {
+		return
+	}
+	scopes, err := h.consentScopes(ctx, userID, req)
+	if err != nil {
+		http.Error(g.Writer, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	view := dto.ConsentView{
+		ClientName: h.clientName(ctx, req.ClientID),
+		Scopes:     scopes,
+		UserID:     userID,
+		RequestID:  consentRequestID(sid, req),
+	}
+	g.Header("Content-Type", "text/html; charset=utf-8")
+	g.Header("Cache-Control", "no-store")
+	g.Header("X-Frame-Options", "DENY") // consent must not be clickjacked
+	g.Status(http.StatusOK)
+	if err := consentTemplate.Execute(g.Writer, view); err != nil {
+		log.Errorf("rendering consent page: %v", err)
+	}
+}
+
+// ConsentDecision applies the user's answer and resumes the saved
+// authorize request. Approval issues the response for the required scopes
+// and the optional ones the user kept; denial, or opting out of every
+// scope, returns access_denied to the client.
+func (h *Handler) ConsentDecision(g *gin.Context) {
+	ctx := g.Request.Context()
+	sid, _ := middleware.SessionIDFromContext(ctx)
+	req, userID, ok := h.pendingConsent(g, sid)
+	if !ok {
+		return
+	}
+	if !validFormToken(g.PostForm("request_id"), consentRequestID(sid, req)) {
+		http.Error(g.Writer, "consent does not match the pending authorization request", http.StatusBadRequest)
+		return
+	}
+	scopes, err := h.consentScopes(ctx, userID, req)
+	if err != nil {
+		http.Error(g.Writer, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	_ = h.Sessions.ClearAuthorizeRequest(sid)
+
+	approved := approvedScopes(scopes, g.PostFormArray("scope"))
+	if g.PostForm("decision") != "approve" || len(approved) == 0 {
+		h.denyConsent(g, req)
+		return
+	}
+	remember := g.PostForm("remember") == "true"
+	applied, err := h.DelegationSvc.ApplyGrant(ctx, userID, req.ClientID, grantAction(req), req.GrantID, approved, remember)
+	if err != nil {
+		http.Error(g.Writer, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	domReq := toDomainAuthorizeRequest(req)
+	domReq.Scope = approved
+	domReq.GrantID = applied.DelegationId
+	redirectURL, err := h.AuthorizeSvc.HandleAuthorize(ctx, domReq, oauth2.User{ID: userID})
+	if err != nil {
+		http.Error(g.Writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+	g.Redirect(http.StatusFound, redirectURL)
+}
+
+// pendingConsent returns the authorize request waiting for consent and
+// the signed-in user. A user who is no longer signed in is sent back to
+// /login with the request left in place.
+func (h *Handler) pendingConsent(g *gin.Context, sid string) (dto.AuthorizeRequest, string, bool) {
+	req, ok, err := h.Sessions.GetAuthorizeRequest(sid)
+	if err != nil || !ok {
+		http.Error(g.Writer, "no pending authorization request", http.StatusBadRequest)
+		return dto.AuthorizeRequest{}, "", false
+	}
+	authCtx, ok, _ := h.AuthSvc.Current(g.Request.Context(), sid)
+	if !ok || authCtx.SubjectID == "" {
+		g.Redirect(http.StatusFound, "/login")
+		return dto.AuthorizeRequest{}, "", false
+	}
+	return req, authCtx.SubjectID, true
+}
+
+// consentScopes lists the requested scopes in request order, marking the
+// required ones and those the user granted the client before. With
+// include_granted_scopes the earlier grant is listed too, so the user is
+// only asked for what is new.
+func (h *Handler) consentScopes(ctx context.Context, userID string, req dto.AuthorizeRequest) ([]dto.ConsentScope, error) {
+	requested := fromScopeString(req.Scope)
+	result, err := h.DelegationSvc.EnsureConsent(ctx, userID, req.ClientID, requested)
+	if err != nil {
+		return nil, err
+	}
+	granted, err := h.includedGrantedScopes(ctx, userID, req)
+	if err != nil {
+		return nil, err
+	}
+	requested = delegation.IncludeGrantedScopes(requested, granted)
+	var scopes []dto.ConsentScope
+	seen := map[string]bool{}
+	for _, s := range requested {
+		if seen[s] {
+			continue
+		}
+		seen[s] = true
+		scopes = append(scopes, dto.ConsentScope{
+			Name:        s,
+			Description: oidc.DescribeScope(s),
+			Required:    slices.Contains(requiredScopes, s),
+			Granted:     !slices.Contains(result.Missing, s) || slices.Contains(granted, s),
+		})
+	}
+	return scopes, nil
+}
+
+// includedGrantedScopes returns the scopes the user granted the client
+// before when the request asks for them with include_granted_scopes=true.
+// A request that creates or replaces the grant starts from nothing.
+func (h *Handler) includedGrantedScopes(ctx context.Context, userID string, req dto.AuthorizeRequest) ([]string, error) {
+	if !req.IncludeGrantedScopes {
+		return nil, nil
+	}
+	switch grantAction(req) {
+	case delegation.GrantActionCreate, delegation.GrantActionReplace:
+		return nil, nil
+	}
+	return h.DelegationSvc.GrantedScopes(ctx, userID, req.ClientID)
+}
+
+// approvedScopes returns the scopes the user cannot opt out of plus the
+// optional ones they kept checked.
+func approvedScopes(scopes []dto.ConsentScope, checked []string) []string {
+	var approved []string
+	for _, s := range scopes {
+		if !s.Optional() || slices.Contains(checked, s.Name) {
+			approved = append(approved, s.Name)
+		}
+	}
+	return approved
+}
+
+// denyConsent returns access_denied to the client (RFC 6749 §4.1.2.1).
+// The redirect URI has not been validated yet at this point, so only a
+// registered one is redirected to.
+func (h *Handler) denyConsent(g *gin.Context, req dto.AuthorizeRequest) {
+	u, err := url.Parse(req.RedirectURI)
+	if err != nil || !h.isRegisteredRedirect(g.Request.Context(), req) {
+		http.Error(g.Writer, "consent denied", http.StatusForbidden)
+		return
+	}
+	q := u.Query()
+	q.Set("error", errors.ErrAccessDenied.Error())
+	q.Set("error_description", "the user denied the request")
+	if req.State != "" {
+		q.Set("state", req.State)
+	}
+	u.RawQuery = q.Encode()
+	g.Redirect(http.StatusFound, u.String())
+}
+
+func (h *Handler) isRegisteredRedirect(ctx context.Context, req dto.AuthorizeRequest) bool {
+	if h.Clients == nil {
+		return false
+	}
+	client, err := h.Clients.GetByID(ctx, req.ClientID)
+	return err == nil && client.IsRedirectURIMatching(req.RedirectURI)
+}
+
+// clientName returns the display name of the client, falling back to its ID.
+func (h *Handler) clientName(ctx context.Context, clientID string) string {
+	if h.Clients == nil {
+		return clientID
+	}
+	client, err := h.Clients.GetByID(ctx, clientID)
+	if err != nil || client.Name == "" {
+		return clientID
+	}
+	return client.Name
+}
+
+// consentRequestID binds a consent form to the session and the authorize
+// request it was rendered for, so a decision cannot be posted across
+// sites or applied to a request the user was not shown.
+func consentRequestID(sid string, req dto.AuthorizeRequest) string {
+	return formToken(sid, "consent", req.ClientID, req.RedirectURI, req.Scope, req.State, req.Nonce, req.GrantID, req.GrantManagementAction,
+		strconv.FormatBool(req.IncludeGrantedScopes))
+}
+
+// formToken returns a value only the session's own pages can embed in a
+// form, keyed by the session ID and bound to what the form acts on.
+func formToken(sid string, parts ...string) string {
+	mac := hmac.New(sha256.New, []byte(sid))
+	for _, v := range parts {
+		mac.Write([]byte(v))
+		mac.Write([]byte{0})
+	}
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// validFormToken compares a posted form token in constant time.
+func validFormToken(got, want string) bool {
+	return hmac.Equal([]byte(got), []byte(want))
+}
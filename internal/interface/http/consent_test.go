@@ -0,0 +1,334 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	delegationapp "github.com/martencassel/oidcsim/internal/application/delegation"
+	"github.com/martencassel/oidcsim/internal/domain/authentication"
+	"github.com/martencassel/oidcsim/internal/domain/delegation"
+	"github.com/martencassel/oidcsim/internal/domain/oauth2"
+	delegationinfra "github.com/martencassel/oidcsim/internal/infrastructure/delegation"
+	sessioninfra "github.com/martencassel/oidcsim/internal/infrastructure/session"
+	"github.com/martencassel/oidcsim/internal/store"
+)
+
+// fakeAuthorizeService stands in for the response type flows: it records
+// the request it resumes and redirects with the granted scopes.
+type fakeAuthorizeService struct {
+	last *oauth2.AuthorizeRequest
+}
+
+func (f *fakeAuthorizeService) HandleAuthorize(_ context.Context, req oauth2.AuthorizeRequest, _ oauth2.User) (string, error) {
+	f.last = &req
+	return req.RedirectURI + "?code=abc&state=" + url.QueryEscape(req.State), nil
+}
+
+type consentFixture struct {
+	server       http.Handler
+	authorize    *fakeAuthorizeService
+	delegations  *delegationinfra.MemoryRepo
+	service      delegationapp.DelegationService
+	tokens       *store.InMemoryTokenStore
+	pushed       *store.InMemoryPushedRequestStore
+	authSessions *sessioninfra.InMemorySessionStore
+	cookie       *http.Cookie
+}
+
+const consentAuthorizeQuery = "/authorize?response_type=code&client_id=app&redirect_uri=https%3A%2F%2Fapp.example.com%2Fcb&scope=openid+profile+email&state=xyz"
+
+func newConsentFixture(t *testing.T) *consentFixture {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+
+	clients := store.NewInMemoryClientStore()
+	require.NoError(t, clients.Save(ctx, store.Client{
+		ID:           "app",
+		Name:         "Example App",
+		RedirectURIs: []string{"https://app.example.com/cb"},
+		Meta:         store.ClientMeta{Enabled: true},
+	}))
+	authSessions := sessioninfra.NewInMemorySessionStore()
+	sessions := sessioninfra.NewMemorySessionManager("sid", sessioninfra.WithAllowInsecure())
+	repo := delegationinfra.NewMemoryRepo()
+	f := &consentFixture{
+		authorize:    &fakeAuthorizeService{},
+		delegations:  repo,
+		service:      delegationapp.NewDelegationService(repo, nil, delegationapp.WithAdminConsents(delegationinfra.NewAdminConsentMemoryRepo(), nil)),
+		tokens:       store.NewInMemoryTokenStore(),
+		pushed:       store.NewInMemoryPushedRequestStore(),
+		authSessions: authSessions,
+	}
+	f.signIn(t, "session-1", "alice")
+
+	h := &Handler{
+		Sessions:       sessions,
+		AuthSvc:        *authentication.NewDefaultAuthService(authSessions, nil),
+		AuthorizeSvc:   f.authorize,
+		DelegationSvc:  f.service,
+		Clients:        clients,
+		Tokens:         f.tokens,
+		PushedRequests: f.pushed,
+	}
+	r := gin.New()
+	r.GET("/authorize", h.AuthorizeFlow())
+	h.RegisterRoutes(r)
+	h.RegisterAccountRoutes(r)
+	f.server = r
+	return f
+}
+
+// signIn authenticates userID on session sid and makes it the session
+// later requests use.
+func (f *consentFixture) signIn(t *testing.T, sid, userID string) {
+	t.Helper()
+	require.NoError(t, f.authSessions.Save(authentication.AuthSession{ID: sid, SubjectID: userID}))
+	require.NoError(t, f.authSessions.MarkAuthenticated(sid))
+	f.cookie = &http.Cookie{Name: "sid", Value: sid}
+}
+
+func (f *consentFixture) do(t *testing.T, method, target string, form url.Values) *httptest.ResponseRecorder {
+	t.Helper()
+	var req *http.Request
+	if form != nil {
+		req = httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		req = httptest.NewRequest(method, target, nil)
+	}
+	req.AddCookie(f.cookie)
+	w := httptest.NewRecorder()
+	f.server.ServeHTTP(w, req)
+	return w
+}
+
+// consentPage starts an authorize request and returns the consent page
+// it leads to.
+func (f *consentFixture) consentPage(t *testing.T) (page, requestID string) {
+	t.Helper()
+	w := f.do(t, http.MethodGet, consentAuthorizeQuery, nil)
+	require.Equal(t, http.StatusFound, w.Code)
+	require.Equal(t, "/consent", w.Header().Get("Location"))
+
+	w = f.do(t, http.MethodGet, "/consent", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	m := regexp.MustCompile(`name="request_id" value="([^"]+)"`).FindStringSubmatch(w.Body.String())
+	require.Len(t, m, 2)
+	return w.Body.String(), m[1]
+}
+
+func TestConsent_PageListsScopes(t *testing.T) {
+	f := newConsentFixture(t)
+	page, _ := f.consentPage(t)
+
+	assert.Contains(t, page, "Example App wants to access your account")
+	assert.Contains(t, page, "View your email address")
+	assert.Contains(t, page, `<input type="checkbox" name="scope" value="profile" checked>`)
+	assert.Contains(t, page, `<input type="checkbox" name="scope" value="email" checked>`)
+	assert.NotContains(t, page, `value="openid"`, "openid cannot be opted out of")
+}
+
+func TestConsent_PartialConsent(t *testing.T) {
+	f := newConsentFixture(t)
+	_, requestID := f.consentPage(t)
+
+	w := f.do(t, http.MethodPost, "/consent", url.Values{
+		"request_id": {requestID},
+		"decision":   {"approve"},
+		"scope":      {"email"}, // profile unchecked
+	})
+	require.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "https://app.example.com/cb?code=abc&state=xyz", w.Header().Get("Location"))
+	require.NotNil(t, f.authorize.last)
+	assert.Equal(t, []string{"openid", "email"}, f.authorize.last.Scope)
+
+	d, err := f.delegations.FindByUserAndClient(context.Background(), "alice", "app")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"openid", "email"}, d.Scopes)
+	assert.False(t, d.Remember)
+
+	w = f.do(t, http.MethodPost, "/consent", url.Values{"request_id": {requestID}, "decision": {"approve"}})
+	assert.Equal(t, http.StatusBadRequest, w.Code, "the authorize request is resumed only once")
+
+	w = f.do(t, http.MethodGet, consentAuthorizeQuery, nil)
+	assert.Equal(t, "/consent", w.Header().Get("Location"), "a decision that was not remembered is asked again")
+}
+
+func TestConsent_RememberedDecisionSkipsScreen(t *testing.T) {
+	f := newConsentFixture(t)
+	_, requestID := f.consentPage(t)
+
+	w := f.do(t, http.MethodPost, "/consent", url.Values{
+		"request_id": {requestID},
+		"decision":   {"approve"},
+		"scope":      {"profile", "email"},
+		"remember":   {"true"},
+	})
+	require.Equal(t, http.StatusFound, w.Code)
+
+	f.authorize.last = nil
+	w = f.do(t, http.MethodGet, consentAuthorizeQuery, nil)
+	require.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "https://app.example.com/cb?code=abc&state=xyz", w.Header().Get("Location"))
+	require.NotNil(t, f.authorize.last)
+	assert.Equal(t, []string{"openid", "profile", "email"}, f.authorize.last.Scope)
+}
+
+func TestConsent_Deny(t *testing.T) {
+	f := newConsentFixture(t)
+	_, requestID := f.consentPage(t)
+
+	w := f.do(t, http.MethodPost, "/consent", url.Values{"request_id": {requestID}, "decision": {"deny"}})
+	require.Equal(t, http.StatusFound, w.Code)
+	loc, err := url.Parse(w.Header().Get("Location"))
+	require.NoError(t, err)
+	assert.Equal(t, "app.example.com", loc.Host)
+	assert.Equal(t, "access_denied", loc.Query().Get("error"))
+	assert.Equal(t, "xyz", loc.Query().Get("state"))
+	assert.Nil(t, f.authorize.last)
+
+	d, err := f.delegations.FindByUserAndClient(context.Background(), "alice", "app")
+	require.NoError(t, err)
+	assert.Nil(t, d, "nothing is granted on denial")
+}
+
+func TestConsent_RejectsForeignDecision(t *testing.T) {
+	f := newConsentFixture(t)
+	f.consentPage(t)
+
+	w := f.do(t, http.MethodPost, "/consent", url.Values{"request_id": {"forged"}, "decision": {"approve"}})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Nil(t, f.authorize.last)
+}
+
+func TestConsent_AdminConsentSkipsScreen(t *testing.T) {
+	ctx := context.Background()
+	f := newConsentFixture(t)
+	a, err := f.service.GrantAdminConsent(ctx, "app", []string{"openid", "profile", "email"}, delegation.SubjectSelector{UserIDs: []string{"alice"}}, "admin")
+	require.NoError(t, err)
+
+	w := f.do(t, http.MethodGet, consentAuthorizeQuery, nil)
+	require.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "https://app.example.com/cb?code=abc&state=xyz", w.Header().Get("Location"), "an admin-consented user is not asked")
+	d, err := f.delegations.FindByUserAndClient(ctx, "alice", "app")
+	require.NoError(t, err)
+	assert.Equal(t, delegation.ConsentTypeAdmin, d.ConsentType())
+
+	f.signIn(t, "session-2", "bob")
+	w = f.do(t, http.MethodGet, consentAuthorizeQuery, nil)
+	assert.Equal(t, "/consent", w.Header().Get("Location"), "users the admin consent does not select are asked")
+
+	require.NoError(t, f.service.RevokeAdminConsent(ctx, a.ID))
+	f.signIn(t, "session-1", "alice")
+	w = f.do(t, http.MethodGet, consentAuthorizeQuery, nil)
+	assert.Equal(t, "/consent", w.Header().Get("Location"), "revoked centrally, the user is asked again")
+}
+
+func TestConsent_GrantManagementReplace(t *testing.T) {
+	ctx := context.Background()
+	f := newConsentFixture(t)
+	res, err := f.service.ApproveConsent(ctx, "alice", "app", []string{"openid", "profile", "email"}, true)
+	require.NoError(t, err)
+
+	q := url.Values{
+		"response_type": {"code"}, "client_id": {"app"}, "redirect_uri": {"https://app.example.com/cb"}, "scope": {"openid email"},
+		"state": {"xyz"}, "grant_management_action": {"replace"}, "grant_id": {"unknown"},
+	}
+	w := f.do(t, http.MethodGet, "/authorize?"+q.Encode(), nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid_grant_id")
+
+	q.Set("grant_id", res.DelegationId)
+	w = f.do(t, http.MethodGet, "/authorize?"+q.Encode(), nil)
+	require.Equal(t, http.StatusFound, w.Code, w.Body.String())
+	assert.Equal(t, "https://app.example.com/cb?code=abc&state=xyz", w.Header().Get("Location"))
+	d, err := f.delegations.FindByUserAndClient(ctx, "alice", "app")
+	require.NoError(t, err)
+	assert.Equal(t, res.DelegationId, d.ID)
+	assert.Equal(t, []string{"openid", "email"}, d.Scopes, "replace narrows the grant to the requested scopes")
+}
+
+func TestConsent_PushedRequestWithGrantCreate(t *testing.T) {
+	ctx := context.Background()
+	f := newConsentFixture(t)
+	old, err := f.service.ApproveConsent(ctx, "alice", "app", []string{"openid"}, false)
+	require.NoError(t, err)
+	pushed, err := f.pushed.Push(ctx, "app", url.Values{
+		"response_type": {"code"}, "client_id": {"app"}, "redirect_uri": {"https://app.example.com/cb"}, "scope": {"openid profile"},
+		"state": {"xyz"}, "grant_management_action": {"create"},
+	}, time.Minute)
+	require.NoError(t, err)
+
+	w := f.do(t, http.MethodGet, "/authorize?"+url.Values{"client_id": {"app"}, "request_uri": {pushed.RequestURI}}.Encode(), nil)
+	require.Equal(t, http.StatusFound, w.Code, w.Body.String())
+	require.Equal(t, "/consent", w.Header().Get("Location"))
+	w = f.do(t, http.MethodGet, "/consent", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	m := regexp.MustCompile(`name="request_id" value="([^"]+)"`).FindStringSubmatch(w.Body.String())
+	require.Len(t, m, 2)
+
+	w = f.do(t, http.MethodPost, "/consent", url.Values{"request_id": {m[1]}, "decision": {"approve"}, "scope": {"profile"}})
+	require.Equal(t, http.StatusFound, w.Code)
+	d, err := f.delegations.FindByUserAndClient(ctx, "alice", "app")
+	require.NoError(t, err)
+	assert.NotEqual(t, old.DelegationId, d.ID, "create starts a new grant")
+	assert.Equal(t, []string{"openid", "profile"}, d.Scopes)
+
+	w = f.do(t, http.MethodGet, "/authorize?"+url.Values{"client_id": {"app"}, "request_uri": {pushed.RequestURI}}.Encode(), nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "a request_uri is used once")
+}
+
+func TestConsent_IncludeGrantedScopes(t *testing.T) {
+	ctx := context.Background()
+	f := newConsentFixture(t)
+	_, err := f.service.ApproveConsent(ctx, "alice", "app", []string{"openid", "profile"}, true)
+	require.NoError(t, err)
+	authorize := func(scope string, include bool) string {
+		q := url.Values{"response_type": {"code"}, "client_id": {"app"}, "redirect_uri": {"https://app.example.com/cb"}, "scope": {scope}, "state": {"xyz"}}
+		if include {
+			q.Set("include_granted_scopes", "true")
+		}
+		return "/authorize?" + q.Encode()
+	}
+
+	w := f.do(t, http.MethodGet, authorize("email", true), nil)
+	require.Equal(t, "/consent", w.Header().Get("Location"))
+	w = f.do(t, http.MethodGet, "/consent", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	page := w.Body.String()
+	assert.Contains(t, page, `<input type="checkbox" name="scope" value="email" checked>`, "the new scope is asked for")
+	assert.NotContains(t, page, `value="profile"`, "the earlier grant is not asked for again")
+	assert.Contains(t, page, "(approved before)")
+	m := regexp.MustCompile(`name="request_id" value="([^"]+)"`).FindStringSubmatch(page)
+	require.Len(t, m, 2)
+
+	w = f.do(t, http.MethodPost, "/consent", url.Values{"request_id": {m[1]}, "decision": {"approve"}, "scope": {"email"}, "remember": {"true"}})
+	require.Equal(t, http.StatusFound, w.Code)
+	require.NotNil(t, f.authorize.last)
+	assert.ElementsMatch(t, []string{"openid", "profile", "email"}, f.authorize.last.Scope, "the code covers the combined grant")
+	d, err := f.delegations.FindByUserAndClient(ctx, "alice", "app")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"openid", "profile", "email"}, d.Scopes)
+
+	f.authorize.last = nil
+	w = f.do(t, http.MethodGet, authorize("email", true), nil)
+	require.Equal(t, http.StatusFound, w.Code)
+	assert.NotEqual(t, "/consent", w.Header().Get("Location"))
+	require.NotNil(t, f.authorize.last)
+	assert.Equal(t, []string{"email", "openid", "profile"}, f.authorize.last.Scope)
+
+	w = f.do(t, http.MethodGet, authorize("email", false), nil)
+	require.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, []string{"email"}, f.authorize.last.Scope, "without include_granted_scopes only the requested scopes are issued")
+}
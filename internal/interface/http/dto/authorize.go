@@ -1,6 +1,10 @@
 package dto
 
-import "github.com/gin-gonic/gin"
+import (
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+)
 
 // AuthorizeRequest represents the parameters for an OAuth2 / OIDC authorization request.
 // See: https://openid.net/specs/openid-connect-core-1_0.html#AuthorizationEndpoint
@@ -17,22 +21,38 @@ type AuthorizeRequest struct {
 	MaxAge              string `form:"max_age" query:"max_age"`
 	CodeChallenge       string `form:"code_challenge" query:"code_challenge"`
 	CodeChallengeMethod string `form:"code_challenge_method" query:"code_challenge_method"`
+
+	IncludeGrantedScopes bool `form:"include_granted_scopes" query:"include_granted_scopes"` // incremental authorization
+
+	RequestURI            string `form:"request_uri" query:"request_uri"`                         // RFC 9126
+	GrantID               string `form:"grant_id" query:"grant_id"`                               // FAPI Grant Management
+	GrantManagementAction string `form:"grant_management_action" query:"grant_management_action"` // FAPI Grant Management
 }
 
 // Bind using go gin framework
 func (ar *AuthorizeRequest) Bind(c *gin.Context) error {
-	ar.ClientID = c.Query("client_id")
-	ar.ResponseType = c.Query("response_type")
-	ar.RedirectURI = c.Query("redirect_uri")
-	ar.Scope = c.Query("scope")
-	ar.State = c.Query("state")
-	ar.ResponseMode = c.Query("response_mode")
-	ar.Nonce = c.Query("nonce")
-	ar.Display = c.Query("display")
-	ar.Prompt = c.Query("prompt")
-	ar.MaxAge = c.Query("max_age")
-	ar.CodeChallenge = c.Query("code_challenge")
-	ar.CodeChallengeMethod = c.Query("code_challenge_method")
+	return ar.BindValues(c.Request.URL.Query())
+}
+
+// BindValues binds the request from v, e.g. the parameters a client
+// pushed to the PAR endpoint.
+func (ar *AuthorizeRequest) BindValues(v url.Values) error {
+	ar.ClientID = v.Get("client_id")
+	ar.ResponseType = v.Get("response_type")
+	ar.RedirectURI = v.Get("redirect_uri")
+	ar.Scope = v.Get("scope")
+	ar.State = v.Get("state")
+	ar.ResponseMode = v.Get("response_mode")
+	ar.Nonce = v.Get("nonce")
+	ar.Display = v.Get("display")
+	ar.Prompt = v.Get("prompt")
+	ar.MaxAge = v.Get("max_age")
+	ar.CodeChallenge = v.Get("code_challenge")
+	ar.CodeChallengeMethod = v.Get("code_challenge_method")
+	ar.IncludeGrantedScopes = v.Get("include_granted_scopes") == "true"
+	ar.RequestURI = v.Get("request_uri")
+	ar.GrantID = v.Get("grant_id")
+	ar.GrantManagementAction = v.Get("grant_management_action")
 	return nil
 }
 
@@ -3,7 +3,21 @@ package dto
 // ConsentView represents the data needed to render a consent page.
 type ConsentView struct {
 	ClientName string
-	Scopes     []string
+	Scopes     []ConsentScope
 	UserID     string
-	RequestID  string
+	RequestID  string // ties the decision to the authorize request that was shown
+}
+
+// ConsentScope is one requested scope on the consent page. Required scopes
+// cannot be opted out of; Granted scopes were approved before and are kept.
+type ConsentScope struct {
+	Name        string
+	Description string
+	Required    bool
+	Granted     bool
+}
+
+// Optional reports whether the user can opt out of the scope.
+func (s ConsentScope) Optional() bool {
+	return !s.Required && !s.Granted
 }
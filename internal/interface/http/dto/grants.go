@@ -7,8 +7,10 @@ type GrantListResponse struct {
 // Grant represents an individual grant given to a client by a user.
 
 type Grant struct {
-	GrantID   string   `json:"grant_id"`
-	ClientID  string   `json:"client_id"`
-	Scope     []string `json:"scope"`
-	CreatedAt int64    `json:"created_at"`
+	GrantID    string   `json:"grant_id"`
+	ClientID   string   `json:"client_id"`
+	ClientName string   `json:"client_name,omitempty"`
+	Scope      []string `json:"scope"`
+	CreatedAt  int64    `json:"created_at"`
+	ExpiresAt  int64    `json:"expires_at,omitempty"`
 }
@@ -0,0 +1,12 @@
+package dto
+
+// WebFingerResponse is a JSON Resource Descriptor (RFC 7033 §4.4).
+type WebFingerResponse struct {
+	Subject string          `json:"subject"`
+	Links   []WebFingerLink `json:"links"`
+}
+
+type WebFingerLink struct {
+	Rel  string `json:"rel"`
+	Href string `json:"href"`
+}
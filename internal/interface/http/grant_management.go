@@ -0,0 +1,51 @@
+package http
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+
+	delegationapp "github.com/martencassel/oidcsim/internal/application/delegation"
+	"github.com/martencassel/oidcsim/internal/domain/delegation"
+	"github.com/martencassel/oidcsim/internal/interface/http/dto"
+)
+
+// resolvePushedRequest replaces req, which names a request_uri, with the
+// authorization request the client pushed under it (RFC 9126 §4). The
+// request_uri is used up, so a saved request does not keep it.
+func (h *Handler) resolvePushedRequest(ctx context.Context, req *dto.AuthorizeRequest) error {
+	if h.PushedRequests == nil {
+		return fmt.Errorf("request_uri is not supported")
+	}
+	pushed, err := h.PushedRequests.Take(ctx, req.ClientID, req.RequestURI)
+	if err != nil {
+		return err
+	}
+	var resolved dto.AuthorizeRequest
+	if err := resolved.BindValues(pushed.Params); err != nil {
+		return err
+	}
+	resolved.RequestURI = ""
+	*req = resolved
+	return nil
+}
+
+// checkGrant checks the grant a merge or replace request names before the
+// user is involved. Other actions name no grant.
+func (h *Handler) checkGrant(ctx context.Context, userID string, req dto.AuthorizeRequest, action delegation.GrantManagementAction) error {
+	if action != delegation.GrantActionMerge && action != delegation.GrantActionReplace {
+		return nil
+	}
+	err := h.DelegationSvc.CheckGrant(ctx, userID, req.ClientID, req.GrantID)
+	if stderrors.Is(err, delegationapp.ErrUnknownGrant) {
+		return fmt.Errorf("invalid_grant_id: %w", err)
+	}
+	return err
+}
+
+// grantAction returns the grant_management_action of a request Authorize
+// has already validated.
+func grantAction(req dto.AuthorizeRequest) delegation.GrantManagementAction {
+	action, _ := delegation.ParseGrantManagementAction(req.GrantManagementAction, req.GrantID)
+	return action
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"net/http"
 
+	"github.com/gin-gonic/gin"
+
 	"github.com/martencassel/oidcsim/internal/application/session"
 )
 
@@ -20,14 +22,31 @@ func WithSessionManager(mgr session.SessionManager) func(http.Handler) http.Hand
 				http.Error(w, "session error", http.StatusInternalServerError)
 				return
 			}
-			// Store both the manager and the current session ID in context
-			ctx := context.WithValue(r.Context(), sessionKey, mgr)
-			ctx = context.WithValue(ctx, "sessionID", sid)
-			next.ServeHTTP(w, r.WithContext(ctx))
+			next.ServeHTTP(w, r.WithContext(withSession(r.Context(), mgr, sid)))
 		})
 	}
 }
 
+// WithGinSession is WithSessionManager for a single gin handler, so the
+// handler can be mounted, or called by another handler, on its own.
+func WithGinSession(mgr session.SessionManager, h gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		sid, err := mgr.Ensure(c.Writer, c.Request)
+		if err != nil {
+			http.Error(c.Writer, "session error", http.StatusInternalServerError)
+			return
+		}
+		c.Request = c.Request.WithContext(withSession(c.Request.Context(), mgr, sid))
+		h(c)
+	}
+}
+
+// withSession stores both the manager and the current session ID in ctx.
+func withSession(ctx context.Context, mgr session.SessionManager, sid string) context.Context {
+	ctx = context.WithValue(ctx, sessionKey, mgr)
+	return context.WithValue(ctx, "sessionID", sid)
+}
+
 func SessionManagerFromContext(ctx context.Context) (session.SessionManager, bool) {
 	mgr, ok := ctx.Value(sessionKey).(session.SessionManager)
 	return mgr, ok
@@ -1,13 +0,0 @@
-package clientauth
-
-// import (
-// 	"context"
-
-// 	"github.com/martencassel/oidcsim/internal/dto"
-// 	"github.com/martencassel/oidcsim/internal/store"
-// )
-
-// type Authenticator interface {
-// 	Authenticate(ctx context.Context, client store.Client, req dto.TokenRequest) (*store.Client, error)
-// 	Name() string
-// }
@@ -1,17 +0,0 @@
-package clientauth
-
-// import "github.com/martencassel/oidcsim/internal/registry"
-
-// func NewRegistry() *registry.Registry[Authenticator] {
-// 	r := registry.New[Authenticator]()
-// 	r.Register((&ClientSecretBasic{}).Name(), &ClientSecretBasic{})
-// 	r.Register((&ClientSecretPost{}).Name(), &ClientSecretPost{})
-// 	r.Register((&ClientPrivateJWT{}).Name(), &ClientPrivateJWT{})
-// 	r.Register((&ClientNone{}).Name(), &ClientNone{})
-// 	return r
-// }
-
-// func BuildAuthRegistry() *registry.Registry[Authenticator] {
-// 	r := NewRegistry()
-// 	return r
-// }
@@ -0,0 +1,414 @@
+package security
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"strings"
+
+	jwksutil "github.com/martencassel/oidcsim/jwskutil"
+)
+
+// Key management algorithms (RFC 7518 §4) and content encryption
+// algorithms (RFC 7518 §5) supported for JWE.
+var (
+	SupportedEncryptionAlgs = []string{"RSA-OAEP", "RSA-OAEP-256", "ECDH-ES"}
+	SupportedEncryptionEncs = []string{"A128GCM", "A256GCM", "A128CBC-HS256"}
+)
+
+// DefaultEncryptionEnc is used when a client registers an encryption alg
+// without an enc (OIDC Registration §2).
+const DefaultEncryptionEnc = "A128CBC-HS256"
+
+// IsSupportedEncryption reports whether alg and enc can both be produced.
+func IsSupportedEncryption(alg, enc string) bool {
+	return contains(SupportedEncryptionAlgs, alg) && contains(SupportedEncryptionEncs, enc)
+}
+
+func contains(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+// JWEHeader is the protected header of a compact JWE.
+type JWEHeader struct {
+	Alg string        `json:"alg"`
+	Enc string        `json:"enc"`
+	Kid string        `json:"kid,omitempty"`
+	Cty string        `json:"cty,omitempty"`
+	Typ string        `json:"typ,omitempty"`
+	Epk *jwksutil.JWK `json:"epk,omitempty"`
+	Apu string        `json:"apu,omitempty"` // base64url PartyUInfo for ECDH-ES
+	Apv string        `json:"apv,omitempty"` // base64url PartyVInfo for ECDH-ES
+}
+
+// SelectEncryptionKey picks the recipient key for alg from a client's JWKS:
+// an encryption key of the right type whose alg, if set, matches.
+func SelectEncryptionKey(set *jwksutil.JWKS, alg string) (jwksutil.JWK, error) {
+	kty := "RSA"
+	if strings.HasPrefix(alg, "ECDH-ES") {
+		kty = "EC"
+	}
+	for _, k := range set.Find("", "enc") {
+		if k.Kty == kty && (k.Alg == "" || k.Alg == alg) {
+			return k, nil
+		}
+	}
+	return jwksutil.JWK{}, fmt.Errorf("no %s encryption key registered for %s", kty, alg)
+}
+
+// EncryptJWE encrypts plaintext to the recipient key and returns the
+// compact serialization (RFC 7516 §7.1). cty is "JWT" for nested tokens.
+func EncryptJWE(plaintext []byte, recipient jwksutil.JWK, alg, enc, cty string) (string, error) {
+	if !IsSupportedEncryption(alg, enc) {
+		return "", fmt.Errorf("unsupported JWE algorithms %s/%s", alg, enc)
+	}
+	pub, err := recipient.PublicKey()
+	if err != nil {
+		return "", err
+	}
+	header := JWEHeader{Alg: alg, Enc: enc, Kid: recipient.Kid, Cty: cty}
+	keyLen := encKeyLen(enc)
+
+	var cek, encryptedKey []byte
+	switch alg {
+	case "RSA-OAEP", "RSA-OAEP-256":
+		rsaPub, ok := pub.(*rsa.PublicKey)
+		if !ok {
+			return "", errors.New("RSA-OAEP requires an RSA key")
+		}
+		cek = make([]byte, keyLen)
+		if _, err := rand.Read(cek); err != nil {
+			return "", err
+		}
+		encryptedKey, err = rsa.EncryptOAEP(oaepHash(alg), rand.Reader, rsaPub, cek, nil)
+		if err != nil {
+			return "", err
+		}
+	case "ECDH-ES":
+		ecPub, ok := pub.(*ecdsa.PublicKey)
+		if !ok {
+			return "", errors.New("ECDH-ES requires an EC key")
+		}
+		remote, err := ecPub.ECDH()
+		if err != nil {
+			return "", err
+		}
+		ephemeral, err := remote.Curve().GenerateKey(rand.Reader)
+		if err != nil {
+			return "", err
+		}
+		z, err := ephemeral.ECDH(remote)
+		if err != nil {
+			return "", err
+		}
+		epk, err := ecdhPublicJWK(ephemeral.PublicKey(), recipient.Crv)
+		if err != nil {
+			return "", err
+		}
+		header.Epk = &epk
+		// Direct key agreement: the derived key is the CEK (RFC 7518 §4.6).
+		cek = concatKDF(z, enc, nil, nil, keyLen)
+	}
+
+	protected, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	aad := base64.RawURLEncoding.EncodeToString(protected)
+	iv, ciphertext, tag, err := encryptContent(enc, cek, plaintext, []byte(aad))
+	if err != nil {
+		return "", err
+	}
+	b64 := base64.RawURLEncoding.EncodeToString
+	return strings.Join([]string{aad, b64(encryptedKey), b64(iv), b64(ciphertext), b64(tag)}, "."), nil
+}
+
+// DecryptJWE decrypts a compact JWE with the recipient's private key, an
+// *rsa.PrivateKey or *ecdsa.PrivateKey.
+func DecryptJWE(compact string, priv crypto.PrivateKey) ([]byte, JWEHeader, error) {
+	var header JWEHeader
+	parts := strings.Split(compact, ".")
+	if len(parts) != 5 {
+		return nil, header, errors.New("not a compact JWE")
+	}
+	segs := make([][]byte, 5)
+	for i, p := range parts {
+		b, err := base64.RawURLEncoding.DecodeString(p)
+		if err != nil {
+			return nil, header, fmt.Errorf("malformed JWE segment %d", i)
+		}
+		segs[i] = b
+	}
+	if err := json.Unmarshal(segs[0], &header); err != nil {
+		return nil, header, fmt.Errorf("malformed JWE header: %w", err)
+	}
+	if !IsSupportedEncryption(header.Alg, header.Enc) {
+		return nil, header, fmt.Errorf("unsupported JWE algorithms %s/%s", header.Alg, header.Enc)
+	}
+	keyLen := encKeyLen(header.Enc)
+
+	var cek []byte
+	switch header.Alg {
+	case "RSA-OAEP", "RSA-OAEP-256":
+		rsaPriv, ok := priv.(*rsa.PrivateKey)
+		if !ok {
+			return nil, header, errors.New("RSA-OAEP requires an RSA private key")
+		}
+		var err error
+		cek, err = rsa.DecryptOAEP(oaepHash(header.Alg), nil, rsaPriv, segs[1], nil)
+		if err != nil {
+			return nil, header, errors.New("failed to decrypt content encryption key")
+		}
+		if len(cek) != keyLen {
+			return nil, header, errors.New("content encryption key has the wrong length")
+		}
+	case "ECDH-ES":
+		ecPriv, ok := priv.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, header, errors.New("ECDH-ES requires an EC private key")
+		}
+		// The CEK is the agreed key, so there is no encrypted key
+		// (RFC 7518 §4.6).
+		if len(segs[1]) != 0 {
+			return nil, header, errors.New("ECDH-ES must not have an encrypted key")
+		}
+		if header.Epk == nil {
+			return nil, header, errors.New("missing epk header")
+		}
+		apu, err := base64.RawURLEncoding.DecodeString(header.Apu)
+		if err != nil {
+			return nil, header, errors.New("malformed apu header")
+		}
+		apv, err := base64.RawURLEncoding.DecodeString(header.Apv)
+		if err != nil {
+			return nil, header, errors.New("malformed apv header")
+		}
+		epk, err := header.Epk.PublicKey()
+		if err != nil {
+			return nil, header, err
+		}
+		ecEpk, ok := epk.(*ecdsa.PublicKey)
+		if !ok {
+			return nil, header, errors.New("epk is not an EC key")
+		}
+		local, err := ecPriv.ECDH()
+		if err != nil {
+			return nil, header, err
+		}
+		remote, err := ecEpk.ECDH()
+		if err != nil {
+			return nil, header, err
+		}
+		z, err := local.ECDH(remote)
+		if err != nil {
+			return nil, header, err
+		}
+		cek = concatKDF(z, header.Enc, apu, apv, keyLen)
+	}
+	plaintext, err := decryptContent(header.Enc, cek, segs[2], segs[3], segs[4], []byte(parts[0]))
+	if err != nil {
+		return nil, header, err
+	}
+	return plaintext, header, nil
+}
+
+func oaepHash(alg string) hash.Hash {
+	if alg == "RSA-OAEP-256" {
+		return sha256.New()
+	}
+	return sha1.New()
+}
+
+func encKeyLen(enc string) int {
+	switch enc {
+	case "A128GCM":
+		return 16
+	case "A256GCM":
+		return 32
+	case "A128CBC-HS256":
+		return 32 // 16 bytes MAC key, 16 bytes AES key
+	}
+	return 0
+}
+
+// ecdhPublicJWK exports an ephemeral public key for the epk header.
+func ecdhPublicJWK(pub *ecdh.PublicKey, crv string) (jwksutil.JWK, error) {
+	raw := pub.Bytes() // 0x04 || X || Y
+	if len(raw) == 0 || raw[0] != 4 {
+		return jwksutil.JWK{}, errors.New("unexpected ephemeral key encoding")
+	}
+	size := (len(raw) - 1) / 2
+	b64 := base64.RawURLEncoding.EncodeToString
+	return jwksutil.JWK{Kty: "EC", Crv: crv, X: b64(raw[1 : 1+size]), Y: b64(raw[1+size:])}, nil
+}
+
+// concatKDF derives keyLen bytes from the shared secret z with the Concat
+// KDF of NIST SP 800-56A as profiled by RFC 7518 §4.6.2. apu and apv are
+// the decoded apu and apv headers; this provider sends neither.
+func concatKDF(z []byte, algID string, apu, apv []byte, keyLen int) []byte {
+	var otherInfo []byte
+	for _, field := range [][]byte{[]byte(algID), apu, apv} {
+		otherInfo = binary.BigEndian.AppendUint32(otherInfo, uint32(len(field)))
+		otherInfo = append(otherInfo, field...)
+	}
+	otherInfo = binary.BigEndian.AppendUint32(otherInfo, uint32(keyLen*8))
+
+	var out []byte
+	for counter := uint32(1); len(out) < keyLen; counter++ {
+		h := sha256.New()
+		_ = binary.Write(h, binary.BigEndian, counter)
+		h.Write(z)
+		h.Write(otherInfo)
+		out = h.Sum(out)
+	}
+	return out[:keyLen]
+}
+
+func encryptContent(enc string, cek, plaintext, aad []byte) (iv, ciphertext, tag []byte, err error) {
+	switch enc {
+	case "A128GCM", "A256GCM":
+		block, err := aes.NewCipher(cek)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		gcm, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		iv = make([]byte, gcm.NonceSize())
+		if _, err := rand.Read(iv); err != nil {
+			return nil, nil, nil, err
+		}
+		sealed := gcm.Seal(nil, iv, plaintext, aad)
+		split := len(sealed) - gcm.Overhead()
+		return iv, sealed[:split], sealed[split:], nil
+	case "A128CBC-HS256":
+		macKey, encKey := cek[:16], cek[16:]
+		block, err := aes.NewCipher(encKey)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		iv = make([]byte, aes.BlockSize)
+		if _, err := rand.Read(iv); err != nil {
+			return nil, nil, nil, err
+		}
+		padded := pkcs7Pad(plaintext, aes.BlockSize)
+		ciphertext = make([]byte, len(padded))
+		cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, padded)
+		return iv, ciphertext, cbcHMACTag(macKey, aad, iv, ciphertext), nil
+	}
+	return nil, nil, nil, fmt.Errorf("unsupported enc %q", enc)
+}
+
+func decryptContent(enc string, cek, iv, ciphertext, tag, aad []byte) ([]byte, error) {
+	switch enc {
+	case "A128GCM", "A256GCM":
+		block, err := aes.NewCipher(cek)
+		if err != nil {
+			return nil, err
+		}
+		gcm, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		if len(iv) != gcm.NonceSize() {
+			return nil, errors.New("invalid JWE initialization vector")
+		}
+		plaintext, err := gcm.Open(nil, iv, append(append([]byte{}, ciphertext...), tag...), aad)
+		if err != nil {
+			return nil, errors.New("JWE authentication failed")
+		}
+		return plaintext, nil
+	case "A128CBC-HS256":
+		macKey, encKey := cek[:16], cek[16:]
+		if subtle.ConstantTimeCompare(tag, cbcHMACTag(macKey, aad, iv, ciphertext)) != 1 {
+			return nil, errors.New("JWE authentication failed")
+		}
+		block, err := aes.NewCipher(encKey)
+		if err != nil {
+			return nil, err
+		}
+		if len(iv) != aes.BlockSize || len(ciphertext)%aes.BlockSize != 0 || len(ciphertext) == 0 {
+			return nil, errors.New("malformed JWE ciphertext")
+		}
+		plaintext := make([]byte, len(ciphertext))
+		cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, ciphertext)
+		return pkcs7Unpad(plaintext, aes.BlockSize)
+	}
+	return nil, fmt.Errorf("unsupported enc %q", enc)
+}
+
+// cbcHMACTag computes the AES_CBC_HMAC_SHA2 authentication tag
+// (RFC 7518 §5.2.2.1).
+func cbcHMACTag(macKey, aad, iv, ciphertext []byte) []byte {
+	mac := hmac.New(sha256.New, macKey)
+	mac.Write(aad)
+	mac.Write(iv)
+	mac.Write(ciphertext)
+	_ = binary.Write(mac, binary.BigEndian, uint64(len(aad))*8)
+	return mac.Sum(nil)[:16]
+}
+
+func pkcs7Pad(b []byte, size int) []byte {
+	n := size - len(b)%size
+	out := make([]byte, len(b)+n)
+	copy(out, b)
+	for i := len(b); i < len(out); i++ {
+		out[i] = byte(n)
+	}
+	return out
+}
+
+func pkcs7Unpad(b []byte, size int) ([]byte, error) {
+	n := int(b[len(b)-1])
+	if n == 0 || n > size || n > len(b) {
+		return nil, errors.New("malformed JWE padding")
+	}
+	for _, c := range b[len(b)-n:] {
+		if int(c) != n {
+			return nil, errors.New("malformed JWE padding")
+		}
+	}
+	return b[:len(b)-n], nil
+}
+
+// ParsePrivateKeyPEM decodes a PKCS#1, SEC 1 or PKCS#8 private key, as a
+// client would hold for decrypting responses.
+func ParsePrivateKeyPEM(data []byte) (crypto.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("failed to parse PEM block containing private key")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %v", err)
+	}
+	return key, nil
+}
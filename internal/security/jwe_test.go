@@ -0,0 +1,190 @@
+package security
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+
+	jwksutil "github.com/martencassel/oidcsim/jwskutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func encryptionKey(t *testing.T, alg string) (crypto.Signer, jwksutil.JWK) {
+	t.Helper()
+	var priv crypto.Signer
+	var err error
+	if strings.HasPrefix(alg, "ECDH-ES") {
+		priv, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	} else {
+		priv, err = rsa.GenerateKey(rand.Reader, 2048)
+	}
+	require.NoError(t, err)
+	jwk, err := jwksutil.FromPublicKey(priv.Public(), "enc-"+alg, "", "enc")
+	require.NoError(t, err)
+	return priv, jwk
+}
+
+func TestJWE_RoundTrip(t *testing.T) {
+	for _, alg := range SupportedEncryptionAlgs {
+		priv, jwk := encryptionKey(t, alg)
+		for _, enc := range SupportedEncryptionEncs {
+			compact, err := EncryptJWE([]byte("header.payload.signature"), jwk, alg, enc, "JWT")
+			require.NoError(t, err, alg+"/"+enc)
+			assert.Len(t, strings.Split(compact, "."), 5)
+
+			plaintext, header, err := DecryptJWE(compact, priv)
+			require.NoError(t, err, alg+"/"+enc)
+			assert.Equal(t, "header.payload.signature", string(plaintext))
+			assert.Equal(t, alg, header.Alg)
+			assert.Equal(t, enc, header.Enc)
+			assert.Equal(t, "JWT", header.Cty)
+			assert.Equal(t, jwk.Kid, header.Kid)
+			if alg == "ECDH-ES" {
+				require.NotNil(t, header.Epk)
+				assert.Equal(t, "P-256", header.Epk.Crv)
+			}
+		}
+	}
+}
+
+func TestJWE_RejectsTampering(t *testing.T) {
+	for _, enc := range SupportedEncryptionEncs {
+		priv, jwk := encryptionKey(t, "RSA-OAEP-256")
+		compact, err := EncryptJWE([]byte(`{"sub":"alice"}`), jwk, "RSA-OAEP-256", enc, "")
+		require.NoError(t, err)
+		parts := strings.Split(compact, ".")
+		// Flip the first ciphertext character.
+		if parts[3][0] == 'A' {
+			parts[3] = "B" + parts[3][1:]
+		} else {
+			parts[3] = "A" + parts[3][1:]
+		}
+		_, _, err = DecryptJWE(strings.Join(parts, "."), priv)
+		assert.Error(t, err, enc)
+	}
+}
+
+func TestJWE_WrongKey(t *testing.T) {
+	_, jwk := encryptionKey(t, "ECDH-ES")
+	other, _ := encryptionKey(t, "ECDH-ES")
+	compact, err := EncryptJWE([]byte("x"), jwk, "ECDH-ES", "A256GCM", "")
+	require.NoError(t, err)
+	_, _, err = DecryptJWE(compact, other)
+	assert.Error(t, err)
+}
+
+func TestJWE_UnsupportedAlgorithms(t *testing.T) {
+	_, jwk := encryptionKey(t, "RSA-OAEP")
+	_, err := EncryptJWE([]byte("x"), jwk, "RSA1_5", "A128GCM", "")
+	assert.Error(t, err)
+	_, err = EncryptJWE([]byte("x"), jwk, "ECDH-ES", "A128GCM", "")
+	assert.Error(t, err, "an RSA key cannot be used for ECDH-ES")
+}
+
+func TestSelectEncryptionKey(t *testing.T) {
+	_, rsaEnc := encryptionKey(t, "RSA-OAEP")
+	_, ecEnc := encryptionKey(t, "ECDH-ES")
+	_, rsaSig := encryptionKey(t, "RSA-OAEP")
+	rsaSig.Use, rsaSig.Kid = "sig", "sig-key"
+	set := &jwksutil.JWKS{Keys: []jwksutil.JWK{rsaSig, ecEnc, rsaEnc}}
+
+	k, err := SelectEncryptionKey(set, "RSA-OAEP-256")
+	require.NoError(t, err)
+	assert.Equal(t, rsaEnc.Kid, k.Kid, "signing keys are skipped")
+	k, err = SelectEncryptionKey(set, "ECDH-ES")
+	require.NoError(t, err)
+	assert.Equal(t, ecEnc.Kid, k.Kid)
+
+	_, err = SelectEncryptionKey(&jwksutil.JWKS{Keys: []jwksutil.JWK{rsaSig}}, "RSA-OAEP")
+	assert.Error(t, err)
+}
+
+func TestParsePrivateKeyPEM(t *testing.T) {
+	ec, _ := encryptionKey(t, "ECDH-ES")
+	der, err := x509.MarshalECPrivateKey(ec.(*ecdsa.PrivateKey))
+	require.NoError(t, err)
+	key, err := ParsePrivateKeyPEM(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}))
+	require.NoError(t, err)
+	assert.IsType(t, &ecdsa.PrivateKey{}, key)
+
+	rs, _ := encryptionKey(t, "RSA-OAEP")
+	der, err = x509.MarshalPKCS8PrivateKey(rs)
+	require.NoError(t, err)
+	key, err = ParsePrivateKeyPEM(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	require.NoError(t, err)
+	assert.IsType(t, &rsa.PrivateKey{}, key)
+}
+
+func b64(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	require.NoError(t, err)
+	return b
+}
+
+// TestJWE_A128CBCHS256KnownAnswer decrypts the content of RFC 7516
+// Appendix A.3, whose CEK the appendix gives.
+func TestJWE_A128CBCHS256KnownAnswer(t *testing.T) {
+	cek := []byte{4, 211, 31, 197, 84, 157, 252, 254, 11, 100, 157, 250, 63, 170, 106, 206,
+		107, 124, 212, 45, 111, 107, 9, 219, 200, 177, 0, 240, 143, 156, 44, 207}
+	aad := []byte("eyJhbGciOiJBMTI4S1ciLCJlbmMiOiJBMTI4Q0JDLUhTMjU2In0")
+	iv := b64(t, "AxY8DCtDaGlsbGljb3RoZQ")
+	ciphertext := b64(t, "KDlTtXchhZTGufMYmOYGS4HffxPSUrfmqCHXaI9wOGY")
+	tag := b64(t, "U0m_YmjN04DJvceFICbCVQ")
+
+	assert.Equal(t, tag, cbcHMACTag(cek[:16], aad, iv, ciphertext))
+	plaintext, err := decryptContent("A128CBC-HS256", cek, iv, ciphertext, tag, aad)
+	require.NoError(t, err)
+	assert.Equal(t, "Live long and prosper.", string(plaintext))
+}
+
+// TestJWE_ECDHESKnownAnswer derives the key of RFC 7518 Appendix C and
+// decrypts a JWE made with it, apu and apv included.
+func TestJWE_ECDHESKnownAnswer(t *testing.T) {
+	ecKey := func(x, y, d string) *ecdsa.PrivateKey {
+		return &ecdsa.PrivateKey{
+			PublicKey: ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(b64(t, x)), Y: new(big.Int).SetBytes(b64(t, y))},
+			D:         new(big.Int).SetBytes(b64(t, d)),
+		}
+	}
+	alice := ecKey("gI0GAILBdu7T53akrFmMyGcsF3n5dO7MmwNBHKW5SV0", "SLW_xSffzlPWrHEVI30DHM_4egVwt3NQqeUD7nMFpps", "0_NxaRPUMQoAJt50Gz8YiTr8gRTwyEaCumd-MToTmIo")
+	bob := ecKey("weNJy2HscCSM6AEDTDg04biOvhFhyyWvOHQfeF_PxMQ", "e8lnCO-AlStT-NJVX-crhB7QRYhiix03illJOVAOyck", "VEmDZpDXXK8p8N0Cndsxs924q6nS1RXFASRl6BfUqdw")
+
+	local, err := alice.ECDH()
+	require.NoError(t, err)
+	remote, err := bob.PublicKey.ECDH()
+	require.NoError(t, err)
+	z, err := local.ECDH(remote)
+	require.NoError(t, err)
+	key := concatKDF(z, "A128GCM", []byte("Alice"), []byte("Bob"), 16)
+	assert.Equal(t, "VqqN6vgjbSBcIijNcacQGg", base64.RawURLEncoding.EncodeToString(key))
+
+	epk, err := jwksutil.FromPublicKey(alice.Public(), "", "", "")
+	require.NoError(t, err)
+	header, err := json.Marshal(JWEHeader{Alg: "ECDH-ES", Enc: "A128GCM", Apu: "QWxpY2U", Apv: "Qm9i", Epk: &epk})
+	require.NoError(t, err)
+	protected := base64.RawURLEncoding.EncodeToString(header)
+	iv, ciphertext, tag, err := encryptContent("A128GCM", key, []byte("secret"), []byte(protected))
+	require.NoError(t, err)
+	enc := base64.RawURLEncoding.EncodeToString
+	compact := strings.Join([]string{protected, "", enc(iv), enc(ciphertext), enc(tag)}, ".")
+
+	plaintext, _, err := DecryptJWE(compact, bob)
+	require.NoError(t, err)
+	assert.Equal(t, "secret", string(plaintext))
+
+	// Direct key agreement carries no encrypted key (RFC 7518 §4.6)
+	withKey := strings.Join([]string{protected, enc([]byte("key")), enc(iv), enc(ciphertext), enc(tag)}, ".")
+	_, _, err = DecryptJWE(withKey, bob)
+	assert.Error(t, err)
+}
@@ -1,7 +1,13 @@
 package security
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/rsa"
+	"fmt"
 
 	"github.com/golang-jwt/jwt/v5"
 )
@@ -12,6 +18,68 @@ type JWTSigner interface {
 
 	// KeyID returns the kid (Key ID) for the current signing key.
 	KeyID() string
+
+	// Alg returns the JWS algorithm the signer produces.
+	Alg() string
+}
+
+// SupportedAlgorithms lists the JWS algorithms the server can sign with.
+var SupportedAlgorithms = []string{"RS256", "PS256", "ES256", "ES384", "EdDSA"}
+
+// IsSupportedAlgorithm reports whether alg is in SupportedAlgorithms.
+func IsSupportedAlgorithm(alg string) bool {
+	for _, a := range SupportedAlgorithms {
+		if a == alg {
+			return true
+		}
+	}
+	return false
+}
+
+// NewSigner returns the JWTSigner for alg. key must match the algorithm's
+// key type.
+func NewSigner(alg string, key crypto.Signer, kid string) (JWTSigner, error) {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		switch alg {
+		case "RS256":
+			return NewRS256Signer(k, kid), nil
+		case "PS256":
+			return NewPS256Signer(k, kid), nil
+		}
+	case *ecdsa.PrivateKey:
+		if s, err := NewECDSASigner(k, kid); err == nil && s.Alg() == alg {
+			return s, nil
+		}
+	case ed25519.PrivateKey:
+		if alg == "EdDSA" {
+			return NewEdDSASigner(k, kid), nil
+		}
+	}
+	return nil, fmt.Errorf("key of type %T cannot sign %s", key, alg)
+}
+
+// generateKey creates a key suitable for alg.
+func generateKey(alg string, rsaBits int) (crypto.Signer, error) {
+	switch alg {
+	case "RS256", "PS256":
+		return rsa.GenerateKey(rand.Reader, rsaBits)
+	case "ES256":
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case "ES384":
+		return ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case "EdDSA":
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		return priv, err
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", alg)
+	}
+}
+
+func signJWT(method jwt.SigningMethod, key interface{}, kid string, claims map[string]interface{}) (string, error) {
+	token := jwt.NewWithClaims(method, jwt.MapClaims(claims))
+	token.Header["kid"] = kid
+	return token.SignedString(key)
 }
 
 type RS256Signer struct {
@@ -24,11 +92,76 @@ func NewRS256Signer(priv *rsa.PrivateKey, kid string) *RS256Signer {
 }
 
 func (s *RS256Signer) Sign(claims map[string]interface{}) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims(claims))
-	token.Header["kid"] = s.keyID
-	return token.SignedString(s.privateKey)
+	return signJWT(jwt.SigningMethodRS256, s.privateKey, s.keyID, claims)
 }
 
 func (s *RS256Signer) KeyID() string {
 	return s.keyID
 }
+
+func (s *RS256Signer) Alg() string { return "RS256" }
+
+// PS256Signer signs with RSASSA-PSS using SHA-256 (RFC 7518 §3.5).
+type PS256Signer struct {
+	privateKey *rsa.PrivateKey
+	keyID      string
+}
+
+func NewPS256Signer(priv *rsa.PrivateKey, kid string) *PS256Signer {
+	return &PS256Signer{privateKey: priv, keyID: kid}
+}
+
+func (s *PS256Signer) Sign(claims map[string]interface{}) (string, error) {
+	return signJWT(jwt.SigningMethodPS256, s.privateKey, s.keyID, claims)
+}
+
+func (s *PS256Signer) KeyID() string { return s.keyID }
+
+func (s *PS256Signer) Alg() string { return "PS256" }
+
+// ECDSASigner signs with ES256 on P-256 keys and ES384 on P-384 keys
+// (RFC 7518 §3.4).
+type ECDSASigner struct {
+	privateKey *ecdsa.PrivateKey
+	keyID      string
+	method     *jwt.SigningMethodECDSA
+}
+
+func NewECDSASigner(priv *ecdsa.PrivateKey, kid string) (*ECDSASigner, error) {
+	var method *jwt.SigningMethodECDSA
+	switch priv.Curve {
+	case elliptic.P256():
+		method = jwt.SigningMethodES256
+	case elliptic.P384():
+		method = jwt.SigningMethodES384
+	default:
+		return nil, fmt.Errorf("unsupported curve %s", priv.Curve.Params().Name)
+	}
+	return &ECDSASigner{privateKey: priv, keyID: kid, method: method}, nil
+}
+
+func (s *ECDSASigner) Sign(claims map[string]interface{}) (string, error) {
+	return signJWT(s.method, s.privateKey, s.keyID, claims)
+}
+
+func (s *ECDSASigner) KeyID() string { return s.keyID }
+
+func (s *ECDSASigner) Alg() string { return s.method.Alg() }
+
+// EdDSASigner signs with Ed25519 (RFC 8037 §3.1).
+type EdDSASigner struct {
+	privateKey ed25519.PrivateKey
+	keyID      string
+}
+
+func NewEdDSASigner(priv ed25519.PrivateKey, kid string) *EdDSASigner {
+	return &EdDSASigner{privateKey: priv, keyID: kid}
+}
+
+func (s *EdDSASigner) Sign(claims map[string]interface{}) (string, error) {
+	return signJWT(jwt.SigningMethodEdDSA, s.privateKey, s.keyID, claims)
+}
+
+func (s *EdDSASigner) KeyID() string { return s.keyID }
+
+func (s *EdDSASigner) Alg() string { return "EdDSA" }
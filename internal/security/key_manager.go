@@ -0,0 +1,486 @@
+package security
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	log "github.com/sirupsen/logrus"
+
+	jwksutil "github.com/martencassel/oidcsim/jwskutil"
+)
+
+// KeyState is where a signing key is in its lifecycle.
+type KeyState string
+
+const (
+	// KeyPending keys are published in the JWKS but not yet used, so relying
+	// parties that cache the JWKS learn about them before they sign anything.
+	KeyPending KeyState = "pending"
+	// KeyActive is the key new tokens are signed with.
+	KeyActive KeyState = "active"
+	// KeyRetired keys no longer sign but stay published until every token
+	// they signed has expired.
+	KeyRetired KeyState = "retired"
+)
+
+// SigningKey is one key managed by the KeyManager.
+type SigningKey struct {
+	ID          string
+	Alg         string
+	Private     crypto.Signer
+	CreatedAt   time.Time
+	ActivatesAt time.Time // when the key starts signing
+}
+
+// KeyInfo describes a managed key for the admin API. It never includes
+// private key material.
+type KeyInfo struct {
+	ID          string     `json:"kid"`
+	Alg         string     `json:"alg"`
+	State       KeyState   `json:"state"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ActivatesAt time.Time  `json:"activates_at"`
+	RetiredAt   *time.Time `json:"retired_at,omitempty"`
+	RemovedAt   *time.Time `json:"removed_at,omitempty"` // when it leaves the JWKS
+}
+
+// KeyManagerConfig controls key generation and rotation.
+type KeyManagerConfig struct {
+	// KeyFile holds the initial RS256 signing key. It is generated and
+	// written when missing. Keys for other algorithms, and keys created by
+	// rotation, are kept in memory only.
+	KeyFile string
+	// KeyID is the kid of the key loaded from KeyFile. When empty the
+	// RFC 7638 thumbprint is used, as it is for every generated key.
+	KeyID string
+	// Algorithms are the JWS algorithms to keep keys for. Defaults to
+	// SupportedAlgorithms.
+	Algorithms []string
+	// RotationInterval is how long a key signs before it is replaced.
+	// Zero disables scheduled rotation; manual rotation still works.
+	RotationInterval time.Duration
+	// PublishAhead is how long a new key is published before it signs.
+	PublishAhead time.Duration
+	// Retention is how long a retired key stays published. It must be at
+	// least the lifetime of the longest-lived token the key signs, and
+	// defaults to DefaultKeyRetention.
+	Retention time.Duration
+	// Bits is the RSA modulus size for generated keys (default 2048).
+	Bits int
+}
+
+// DefaultKeyRetention is the lifetime of the access and ID tokens the
+// keys sign, so tokens signed just before a rotation keep verifying.
+const DefaultKeyRetention = time.Hour
+
+// KeyManager owns the server's signing keys, one key ring per algorithm.
+// Keys move from pending to active to retired; the JWKS publishes every key
+// that is pending, active, or retired for less than Retention.
+type KeyManager struct {
+	cfg KeyManagerConfig
+
+	mu    sync.RWMutex
+	rings map[string][]SigningKey // per algorithm, ordered by ActivatesAt
+
+	now func() time.Time
+}
+
+// NewKeyManager loads or generates the initial key for every configured
+// algorithm. Initial keys are active immediately.
+func NewKeyManager(cfg KeyManagerConfig) (*KeyManager, error) {
+	if cfg.Bits == 0 {
+		cfg.Bits = 2048
+	}
+	if len(cfg.Algorithms) == 0 {
+		cfg.Algorithms = SupportedAlgorithms
+	}
+	if cfg.Retention < 0 {
+		return nil, fmt.Errorf("negative key retention %s", cfg.Retention)
+	}
+	if cfg.Retention == 0 {
+		cfg.Retention = DefaultKeyRetention
+	}
+	m := &KeyManager{cfg: cfg, rings: make(map[string][]SigningKey), now: time.Now}
+	now := m.now()
+	for _, alg := range cfg.Algorithms {
+		if !IsSupportedAlgorithm(alg) {
+			return nil, fmt.Errorf("unsupported signing algorithm %q", alg)
+		}
+		var priv crypto.Signer
+		var err error
+		kid := ""
+		if alg == "RS256" {
+			priv, err = m.loadOrGenerate(cfg.KeyFile)
+			kid = cfg.KeyID
+		} else {
+			priv, err = generateKey(alg, cfg.Bits)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if kid == "" {
+			if kid, err = thumbprint(priv.Public()); err != nil {
+				return nil, err
+			}
+		}
+		m.rings[alg] = []SigningKey{{ID: kid, Alg: alg, Private: priv, CreatedAt: now, ActivatesAt: now}}
+	}
+	return m, nil
+}
+
+func (m *KeyManager) loadOrGenerate(path string) (*rsa.PrivateKey, error) {
+	if path != "" {
+		priv, err := ParseRSAPrivateKeyFromPEMFile(path)
+		if err == nil {
+			return priv, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+	priv, err := rsa.GenerateKey(rand.Reader, m.cfg.Bits)
+	if err != nil {
+		return nil, err
+	}
+	if path != "" {
+		data := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(priv)})
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			return nil, err
+		}
+		log.Infof("Generated signing key %s", path)
+	}
+	return priv, nil
+}
+
+// ParseRSAPrivateKeyFromPEMFile reads a PKCS#1 or PKCS#8 RSA private key.
+func ParseRSAPrivateKeyFromPEMFile(path string) (*rsa.PrivateKey, error) {
+	pemData, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(pemData)
+	if block == nil {
+		return nil, fmt.Errorf("failed to parse PEM block containing private key")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %v", err)
+	}
+	key, ok := k.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s does not contain an RSA private key", path)
+	}
+	return key, nil
+}
+
+// thumbprint returns the RFC 7638 JWK thumbprint of a public key.
+func thumbprint(pub crypto.PublicKey) (string, error) {
+	jwk, err := jwksutil.FromPublicKey(pub, "", "", "")
+	if err != nil {
+		return "", err
+	}
+	return jwk.Thumbprint()
+}
+
+// Algorithms returns the algorithms the manager holds keys for.
+func (m *KeyManager) Algorithms() []string {
+	return append([]string(nil), m.cfg.Algorithms...)
+}
+
+// Supports reports whether the manager holds keys for alg, so tokens can
+// be signed with it.
+func (m *KeyManager) Supports(alg string) bool {
+	return m.manages(alg)
+}
+
+// DefaultAlgorithm is used when a client has not asked for a specific one.
+func (m *KeyManager) DefaultAlgorithm() string {
+	if m.manages("RS256") {
+		return "RS256"
+	}
+	return m.cfg.Algorithms[0]
+}
+
+// Rotate creates a new key for alg, or for every algorithm when alg is
+// empty. New keys are published immediately and start signing after
+// PublishAhead.
+func (m *KeyManager) Rotate(alg string) ([]KeyInfo, error) {
+	algs := m.cfg.Algorithms
+	if alg != "" {
+		if !m.manages(alg) {
+			return nil, fmt.Errorf("no keys managed for %q", alg)
+		}
+		algs = []string{alg}
+	}
+	var out []KeyInfo
+	for _, a := range algs {
+		info, err := m.rotate(a)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, info)
+	}
+	return out, nil
+}
+
+// manages reports whether the manager keeps keys for alg. Tick and rotate
+// write the rings from the Run goroutine, so reads take the lock.
+func (m *KeyManager) manages(alg string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, ok := m.rings[alg]
+	return ok
+}
+
+func (m *KeyManager) rotate(alg string) (KeyInfo, error) {
+	priv, err := generateKey(alg, m.cfg.Bits)
+	if err != nil {
+		return KeyInfo{}, err
+	}
+	kid, err := thumbprint(priv.Public())
+	if err != nil {
+		return KeyInfo{}, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	key := SigningKey{ID: kid, Alg: alg, Private: priv, CreatedAt: now, ActivatesAt: now.Add(m.cfg.PublishAhead)}
+	ring := append(m.rings[alg], key)
+	sort.SliceStable(ring, func(i, j int) bool { return ring[i].ActivatesAt.Before(ring[j].ActivatesAt) })
+	m.rings[alg] = ring
+	log.Infof("Rotated %s signing key: %s signs from %s", alg, kid, key.ActivatesAt.Format(time.RFC3339))
+	for _, info := range m.ringInfoLocked(ring, now) {
+		if info.ID == kid {
+			return info, nil
+		}
+	}
+	return KeyInfo{}, fmt.Errorf("rotated key %s not found", kid)
+}
+
+// Tick performs scheduled work: it starts a rotation early enough that the
+// next key has been published for PublishAhead when the current one reaches
+// RotationInterval, and drops retired keys past Retention.
+func (m *KeyManager) Tick() error {
+	var due []string
+	m.mu.Lock()
+	now := m.now()
+	for _, alg := range m.cfg.Algorithms {
+		ring := m.pruneLocked(m.rings[alg], now)
+		m.rings[alg] = ring
+		active := activeIndex(ring, now)
+		if m.cfg.RotationInterval > 0 &&
+			active == len(ring)-1 &&
+			!now.Before(ring[active].ActivatesAt.Add(m.cfg.RotationInterval-m.cfg.PublishAhead)) {
+			due = append(due, alg)
+		}
+	}
+	m.mu.Unlock()
+	for _, alg := range due {
+		if _, err := m.rotate(alg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Run calls Tick every interval until ctx is cancelled.
+func (m *KeyManager) Run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := m.Tick(); err != nil {
+				log.Errorf("Signing key rotation failed: %v", err)
+			}
+		}
+	}
+}
+
+// activeIndex returns the newest key whose activation time has passed.
+func activeIndex(ring []SigningKey, now time.Time) int {
+	active := 0
+	for i, k := range ring {
+		if !k.ActivatesAt.After(now) {
+			active = i
+		}
+	}
+	return active
+}
+
+// retiredAt returns when key i stopped signing, or nil if it has not.
+func retiredAt(ring []SigningKey, i int, now time.Time) *time.Time {
+	if i+1 < len(ring) && !ring[i+1].ActivatesAt.After(now) {
+		t := ring[i+1].ActivatesAt
+		return &t
+	}
+	return nil
+}
+
+// publishedLocked reports whether key i is still listed in the JWKS.
+func (m *KeyManager) publishedLocked(ring []SigningKey, i int, now time.Time) bool {
+	retired := retiredAt(ring, i, now)
+	return retired == nil || now.Before(retired.Add(m.cfg.Retention))
+}
+
+func (m *KeyManager) pruneLocked(ring []SigningKey, now time.Time) []SigningKey {
+	var kept []SigningKey
+	for i, k := range ring {
+		if !m.publishedLocked(ring, i, now) {
+			log.Infof("Removed retired %s signing key %s from JWKS", k.Alg, k.ID)
+			continue
+		}
+		kept = append(kept, k)
+	}
+	return kept
+}
+
+func (m *KeyManager) ringInfoLocked(ring []SigningKey, now time.Time) []KeyInfo {
+	active := activeIndex(ring, now)
+	out := make([]KeyInfo, 0, len(ring))
+	for i, k := range ring {
+		info := KeyInfo{ID: k.ID, Alg: k.Alg, CreatedAt: k.CreatedAt, ActivatesAt: k.ActivatesAt}
+		switch {
+		case i == active:
+			info.State = KeyActive
+		case i > active:
+			info.State = KeyPending
+		default:
+			info.State = KeyRetired
+			info.RetiredAt = retiredAt(ring, i, now)
+			removed := info.RetiredAt.Add(m.cfg.Retention)
+			info.RemovedAt = &removed
+		}
+		out = append(out, info)
+	}
+	return out
+}
+
+// Keys describes every managed key.
+func (m *KeyManager) Keys() []KeyInfo {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	now := m.now()
+	var out []KeyInfo
+	for _, alg := range m.cfg.Algorithms {
+		out = append(out, m.ringInfoLocked(m.rings[alg], now)...)
+	}
+	return out
+}
+
+// Active returns the key new tokens for alg are signed with.
+func (m *KeyManager) Active(alg string) (SigningKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	ring := m.rings[alg]
+	if len(ring) == 0 {
+		return SigningKey{}, fmt.Errorf("no signing key for %q", alg)
+	}
+	return ring[activeIndex(ring, m.now())], nil
+}
+
+// Signer returns a JWTSigner for the active key of alg.
+func (m *KeyManager) Signer(alg string) (JWTSigner, error) {
+	key, err := m.Active(alg)
+	if err != nil {
+		return nil, err
+	}
+	return NewSigner(alg, key.Private, key.ID)
+}
+
+// lookupLocked finds a published key by kid.
+func (m *KeyManager) lookupLocked(kid string, now time.Time) (SigningKey, bool) {
+	for _, ring := range m.rings {
+		for i, k := range ring {
+			if k.ID == kid && m.publishedLocked(ring, i, now) {
+				return k, true
+			}
+		}
+	}
+	return SigningKey{}, false
+}
+
+// PublicKey returns the public half of a published key.
+func (m *KeyManager) PublicKey(kid string) (crypto.PublicKey, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	k, ok := m.lookupLocked(kid, m.now())
+	if !ok {
+		return nil, false
+	}
+	return k.Private.Public(), true
+}
+
+// JWKS returns the published key set.
+func (m *KeyManager) JWKS() ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	now := m.now()
+	set := jwksutil.JWKS{Keys: []jwksutil.JWK{}}
+	for _, alg := range m.cfg.Algorithms {
+		ring := m.rings[alg]
+		for i, k := range ring {
+			if !m.publishedLocked(ring, i, now) {
+				continue
+			}
+			jwk, err := jwksutil.FromPublicKey(k.Private.Public(), k.ID, k.Alg, "sig")
+			if err != nil {
+				return nil, err
+			}
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	return json.MarshalIndent(set, "", "  ")
+}
+
+// Sign signs claims with the active key for alg, or the default algorithm
+// when alg is empty. typ sets the JWT typ header when not empty.
+func (m *KeyManager) Sign(alg string, claims jwt.Claims, typ string) (string, error) {
+	if alg == "" {
+		alg = m.DefaultAlgorithm()
+	}
+	key, err := m.Active(alg)
+	if err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(alg), claims)
+	token.Header["kid"] = key.ID
+	if typ != "" {
+		token.Header["typ"] = typ
+	}
+	return token.SignedString(key.Private)
+}
+
+// Keyfunc resolves the verification key for a token signed by this
+// server, for use with jwt.Parse. The token's alg must be the one the key
+// was created for.
+func (m *KeyManager) Keyfunc(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	m.mu.RLock()
+	key, ok := m.lookupLocked(kid, m.now())
+	m.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if t.Method.Alg() != key.Alg {
+		return nil, fmt.Errorf("key %q is not used with %s", kid, t.Method.Alg())
+	}
+	return key.Private.Public(), nil
+}
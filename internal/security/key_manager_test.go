@@ -0,0 +1,216 @@
+package security
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	jwksutil "github.com/martencassel/oidcsim/jwskutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) Now() time.Time          { return c.t }
+func (c *fakeClock) Advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestKeyManager(t *testing.T, cfg KeyManagerConfig) (*KeyManager, *fakeClock) {
+	t.Helper()
+	m, err := NewKeyManager(cfg)
+	require.NoError(t, err)
+	clock := &fakeClock{t: m.rings[m.DefaultAlgorithm()][0].ActivatesAt}
+	m.now = clock.Now
+	return m, clock
+}
+
+func activeKid(t *testing.T, m *KeyManager) string {
+	t.Helper()
+	k, err := m.Active("RS256")
+	require.NoError(t, err)
+	return k.ID
+}
+
+func publishedKids(t *testing.T, m *KeyManager) []string {
+	t.Helper()
+	raw, err := m.JWKS()
+	require.NoError(t, err)
+	var set jwksutil.JWKS
+	require.NoError(t, json.Unmarshal(raw, &set))
+	var kids []string
+	for _, k := range set.Keys {
+		kids = append(kids, k.Kid)
+	}
+	return kids
+}
+
+func TestKeyManager_GeneratesAndReloadsKeyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "signing-key.pem")
+	first, err := NewKeyManager(KeyManagerConfig{KeyFile: path, Algorithms: []string{"RS256"}})
+	require.NoError(t, err)
+	second, err := NewKeyManager(KeyManagerConfig{KeyFile: path, Algorithms: []string{"RS256"}})
+	require.NoError(t, err)
+	k1, err := first.Active("RS256")
+	require.NoError(t, err)
+	k2, err := second.Active("RS256")
+	require.NoError(t, err)
+	assert.Equal(t, k1.ID, k2.ID, "kid is the thumbprint of the persisted key")
+}
+
+func TestKeyManager_RetentionDefaultsToTokenLifetime(t *testing.T) {
+	m, clock := newTestKeyManager(t, KeyManagerConfig{KeyID: "k1", Algorithms: []string{"RS256"}})
+	assert.Equal(t, DefaultKeyRetention, m.cfg.Retention)
+	assert.True(t, m.Supports("RS256"))
+	assert.False(t, m.Supports("ES256"), "supported, but no key is configured")
+
+	_, err := m.Rotate("RS256")
+	require.NoError(t, err)
+	require.NoError(t, m.Tick())
+	clock.Advance(DefaultKeyRetention - time.Minute)
+	require.NoError(t, m.Tick())
+	assert.Contains(t, publishedKids(t, m), "k1", "a token signed just before rotation still verifies")
+
+	_, err = NewKeyManager(KeyManagerConfig{Algorithms: []string{"RS256"}, Retention: -time.Hour})
+	assert.Error(t, err)
+}
+
+func TestKeyManager_ManualRotationPublishesBeforeUse(t *testing.T) {
+	m, clock := newTestKeyManager(t, KeyManagerConfig{KeyID: "k1", Algorithms: []string{"RS256"}, PublishAhead: 10 * time.Minute, Retention: time.Hour})
+
+	oldToken, err := m.Sign("", jwt.MapClaims{"sub": "alice"}, "")
+	require.NoError(t, err)
+
+	rotated, err := m.Rotate("")
+	require.NoError(t, err)
+	require.Len(t, rotated, 1)
+	next := rotated[0]
+	assert.Equal(t, KeyPending, next.State)
+	assert.Equal(t, "k1", activeKid(t, m), "a pending key must not sign")
+	assert.ElementsMatch(t, []string{"k1", next.ID}, publishedKids(t, m))
+
+	clock.Advance(10 * time.Minute)
+	assert.Equal(t, next.ID, activeKid(t, m))
+	keys := m.Keys()
+	require.Len(t, keys, 2)
+	assert.Equal(t, KeyRetired, keys[0].State)
+
+	// Tokens signed with the retired key still verify until Retention.
+	_, err = jwt.Parse(oldToken, m.Keyfunc)
+	assert.NoError(t, err)
+
+	clock.Advance(time.Hour)
+	require.NoError(t, m.Tick())
+	assert.Equal(t, []string{next.ID}, publishedKids(t, m))
+	_, err = jwt.Parse(oldToken, m.Keyfunc)
+	assert.Error(t, err)
+}
+
+func TestKeyManager_ScheduledRotation(t *testing.T) {
+	m, clock := newTestKeyManager(t, KeyManagerConfig{
+		KeyID:            "k1",
+		Algorithms:       []string{"RS256"},
+		RotationInterval: 24 * time.Hour,
+		PublishAhead:     time.Hour,
+		Retention:        2 * time.Hour,
+	})
+
+	clock.Advance(22 * time.Hour)
+	require.NoError(t, m.Tick())
+	assert.Len(t, m.Keys(), 1)
+
+	clock.Advance(time.Hour)
+	require.NoError(t, m.Tick())
+	require.Len(t, m.Keys(), 2, "the next key is published an hour before the interval ends")
+	assert.Equal(t, "k1", activeKid(t, m))
+
+	// A second tick does not stack up pending keys.
+	require.NoError(t, m.Tick())
+	assert.Len(t, m.Keys(), 2)
+
+	clock.Advance(time.Hour)
+	assert.NotEqual(t, "k1", activeKid(t, m))
+}
+
+func TestKeyManager_SignsWithEveryAlgorithm(t *testing.T) {
+	m, err := NewKeyManager(KeyManagerConfig{})
+	require.NoError(t, err)
+
+	raw, err := m.JWKS()
+	require.NoError(t, err)
+	set, err := jwksutil.ParseJWKS(raw)
+	require.NoError(t, err)
+	require.Len(t, set.Keys, len(SupportedAlgorithms))
+
+	for _, alg := range SupportedAlgorithms {
+		signed, err := m.Sign(alg, jwt.MapClaims{"sub": "alice"}, "")
+		require.NoError(t, err, alg)
+		token, err := jwt.Parse(signed, m.Keyfunc, jwt.WithValidMethods([]string{alg}))
+		require.NoError(t, err, alg)
+
+		// The published JWK verifies the token too.
+		kid := token.Header["kid"].(string)
+		jwks := set.Find(kid, "sig")
+		require.Len(t, jwks, 1, alg)
+		assert.Equal(t, alg, jwks[0].Alg)
+		pub, err := jwks[0].PublicKey()
+		require.NoError(t, err)
+		_, err = jwt.Parse(signed, func(*jwt.Token) (interface{}, error) { return pub, nil })
+		assert.NoError(t, err, alg)
+	}
+}
+
+func TestKeyManager_KeyfuncRejectsAlgorithmMismatch(t *testing.T) {
+	m, err := NewKeyManager(KeyManagerConfig{Algorithms: []string{"RS256", "PS256"}})
+	require.NoError(t, err)
+	rs, err := m.Active("RS256")
+	require.NoError(t, err)
+
+	// A PS256 signature made with the RS256 key must not verify.
+	token := jwt.NewWithClaims(jwt.SigningMethodPS256, jwt.MapClaims{"sub": "alice"})
+	token.Header["kid"] = rs.ID
+	signed, err := token.SignedString(rs.Private)
+	require.NoError(t, err)
+	_, err = jwt.Parse(signed, m.Keyfunc)
+	assert.Error(t, err)
+}
+
+func TestNewSigner(t *testing.T) {
+	for _, alg := range SupportedAlgorithms {
+		key, err := generateKey(alg, 2048)
+		require.NoError(t, err)
+		s, err := NewSigner(alg, key, "kid-"+alg)
+		require.NoError(t, err, alg)
+		assert.Equal(t, alg, s.Alg())
+		signed, err := s.Sign(map[string]interface{}{"sub": "alice"})
+		require.NoError(t, err)
+		_, err = jwt.Parse(signed, func(*jwt.Token) (interface{}, error) { return key.Public(), nil })
+		assert.NoError(t, err, alg)
+	}
+	key, err := generateKey("ES256", 0)
+	require.NoError(t, err)
+	_, err = NewSigner("ES384", key, "k")
+	assert.Error(t, err)
+}
+
+// Run ticks in its own goroutine while admin requests rotate keys; go test
+// -race catches unlocked access to the key rings.
+func TestKeyManager_ConcurrentRotateAndTick(t *testing.T) {
+	m, err := NewKeyManager(KeyManagerConfig{Algorithms: []string{"ES256"}, Retention: time.Hour})
+	require.NoError(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			assert.NoError(t, m.Tick())
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		_, err := m.Rotate("ES256")
+		require.NoError(t, err)
+		assert.Equal(t, "ES256", m.DefaultAlgorithm())
+	}
+	<-done
+}
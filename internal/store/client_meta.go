@@ -1,15 +1,85 @@
 package store
 
-import "github.com/martencassel/oidcsim/internal/dto"
+import (
+	"time"
+
+	"github.com/martencassel/oidcsim/internal/domain/configuration"
+	"github.com/martencassel/oidcsim/internal/dto"
+)
 
 // ClientMeta is for client registration and policy.
 type ClientMeta struct {
 	ID                 string                 // Client identifier
 	AllowedAuthMethods []dto.ClientAuthMethod // Which auth methods this client can use
 	SecretHash         string                 // Hashed secret for secret-based methods
+	Secrets            []ClientSecret         // Additional secrets, used during rotation
 	JWKSURI            string                 // JWKS URI for private_key_jwt
 	JWKS               []byte                 // Static JWKS (optional)
 	TLSAuthSubjectDN   string                 // Subject DN for mTLS
 	TLSSANs            []string               // SANs for mTLS
-	Enabled            bool                   // Is the client enabled
+	TLSBoundTokens     bool                   // tls_client_certificate_bound_access_tokens (RFC 8705 §3.4)
+	RedirectPolicy     RedirectURIPolicy      // How redirect URIs are matched
+
+	IDTokenSignedResponseAlg     string                             // id_token_signed_response_alg; empty uses the server default
+	UserinfoSignedResponseAlg    string                             // userinfo_signed_response_alg; empty returns plain JSON
+	AccessTokenSignedResponseAlg string                             // JWS alg for JWT access tokens; empty uses the server default
+	OpaqueAccessTokens           bool                               // issue random reference tokens instead of JWTs
+	IDTokenEncryptedResponseAlg  string                             // id_token_encrypted_response_alg; empty leaves ID tokens unencrypted
+	IDTokenEncryptedResponseEnc  string                             // id_token_encrypted_response_enc
+	UserinfoEncryptedResponseAlg string                             // userinfo_encrypted_response_alg; empty leaves userinfo unencrypted
+	UserinfoEncryptedResponseEnc string                             // userinfo_encrypted_response_enc
+	ClaimMappings                []configuration.ClaimMappingConfig // shape claims for this client; see claimmapping
+	GroupClaims                  configuration.GroupClaimsConfig    // groups and roles released to this client
+	SubjectType                  string                             // subject_type: "public" (default) or "pairwise"
+	SectorIdentifierURI          string                             // sector_identifier_uri; groups pairwise clients across hosts
+	FirstParty                   bool                               // trusted first-party application; skips the consent prompt
+	Enabled                      bool                               // Is the client enabled
+}
+
+// HasSecret reports whether any secret has been registered for the client.
+func (m ClientMeta) HasSecret() bool {
+	return m.SecretHash != "" || len(m.Secrets) > 0
+}
+
+// VerifySecret checks secret against SecretHash and every secret in
+// Secrets that is still active at now. All candidates are compared so the
+// time taken does not reveal which one matched.
+func (m ClientMeta) VerifySecret(secret string, now time.Time) bool {
+	ok := false
+	if m.SecretHash != "" && CompareClientSecret(m.SecretHash, secret) {
+		ok = true
+	}
+	for _, s := range m.Secrets {
+		if CompareClientSecret(s.Hash, secret) && s.IsActiveAt(now) {
+			ok = true
+		}
+	}
+	return ok
+}
+
+// ActiveSecrets returns the rotation secrets that are usable at now.
+func (m ClientMeta) ActiveSecrets(now time.Time) []ClientSecret {
+	var out []ClientSecret
+	for _, s := range m.Secrets {
+		if s.IsActiveAt(now) {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// RotateSecret makes newHash the primary secret. The previous primary
+// secret stays valid for grace so clients can roll over without downtime;
+// a zero grace retires it immediately.
+func (m *ClientMeta) RotateSecret(id, newHash string, now time.Time, grace time.Duration) {
+	if m.SecretHash != "" && grace > 0 {
+		m.Secrets = append(m.Secrets, ClientSecret{
+			ID:        id,
+			Hash:      m.SecretHash,
+			CreatedAt: now,
+			ExpiresAt: now.Add(grace),
+		})
+	}
+	m.SecretHash = newHash
+	m.Secrets = m.ActiveSecrets(now)
 }
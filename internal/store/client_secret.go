@@ -0,0 +1,87 @@
+package store
+
+import (
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Secret hashes are stored as "pbkdf2-sha256$<iterations>$<salt>$<hash>".
+const (
+	secretHashScheme     = "pbkdf2-sha256"
+	secretHashIterations = 10000
+	secretHashSaltLen    = 16
+	secretHashKeyLen     = 32
+)
+
+// ClientSecret is one of possibly several active secrets for a client.
+// Multiple secrets let a client roll over to a new secret while the old
+// one is still accepted until ExpiresAt.
+type ClientSecret struct {
+	ID        string    // Identifier used when rotating or revoking the secret
+	Hash      string    // Output of HashClientSecret, never the plain secret
+	CreatedAt time.Time // When the secret was issued
+	ExpiresAt time.Time // Zero means the secret does not expire
+}
+
+// IsActiveAt reports whether the secret may be used at t.
+func (s ClientSecret) IsActiveAt(t time.Time) bool {
+	return s.ExpiresAt.IsZero() || t.Before(s.ExpiresAt)
+}
+
+// GenerateClientSecret returns a new random, URL-safe client secret.
+func GenerateClientSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashClientSecret derives a salted hash suitable for storing in
+// ClientMeta.SecretHash or ClientSecret.Hash.
+func HashClientSecret(secret string) (string, error) {
+	salt := make([]byte, secretHashSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key, err := pbkdf2.Key(sha256.New, secret, salt, secretHashIterations, secretHashKeyLen)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s$%d$%s$%s", secretHashScheme, secretHashIterations,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// CompareClientSecret checks a presented secret against a stored hash in
+// constant time. Malformed hashes never match.
+func CompareClientSecret(hash, secret string) bool {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 || parts[0] != secretHashScheme {
+		return false
+	}
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations <= 0 {
+		return false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	want, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return false
+	}
+	got, err := pbkdf2.Key(sha256.New, secret, salt, iterations, len(want))
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(got, want) == 1
+}
@@ -3,7 +3,11 @@ package store
 import (
 	"context"
 	"database/sql"
-	"fmt"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/martencassel/oidcsim/internal/dto"
 )
 
 type Client struct {
@@ -17,6 +21,8 @@ type Client struct {
 	Scopes           []string // allowed scopes
 
 	Public bool
+
+	Meta ClientMeta // registration metadata and authentication policy
 }
 
 func (c Client) AllowsResponseType(responseType string) bool {
@@ -40,15 +46,53 @@ func (c Client) AllowsResponseType(responseType string) bool {
 	}
 }
 
+// IsRedirectURIMatching reports whether uri matches one of the registered
+// redirect URIs under the client's RedirectPolicy.
 func (c Client) IsRedirectURIMatching(uri string) bool {
+	if strings.Contains(uri, "#") {
+		return false
+	}
 	for _, r := range c.RedirectURIs {
-		if r == uri {
+		if c.Meta.RedirectPolicy.matchRedirectURI(r, uri) {
 			return true
 		}
 	}
 	return false
 }
 
+// ValidateRedirectURIs checks every registered redirect URI against the
+// client's RedirectPolicy.
+func (c Client) ValidateRedirectURIs() error {
+	for _, r := range c.RedirectURIs {
+		if err := c.Meta.RedirectPolicy.ValidateRedirectURI(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AllowsAuthMethod reports whether the client registered the given token
+// endpoint authentication method. Clients that registered nothing fall back
+// to AuthMethod, and then to client_secret_basic (RFC 7591 §2) or none for
+// public clients.
+func (c Client) AllowsAuthMethod(method dto.ClientAuthMethod) bool {
+	for _, m := range c.Meta.AllowedAuthMethods {
+		if m == method {
+			return true
+		}
+	}
+	if len(c.Meta.AllowedAuthMethods) > 0 {
+		return false
+	}
+	if c.AuthMethod != "" {
+		return dto.ClientAuthMethod(c.AuthMethod) == method
+	}
+	if c.Public {
+		return method == dto.None
+	}
+	return method == dto.ClientSecretBasic
+}
+
 func (c Client) AllowsGrantType(grant string) bool {
 	for _, g := range c.Grants {
 		if g == grant {
@@ -62,9 +106,14 @@ type ClientStore interface {
 	GetByID(ctx context.Context, id string) (Client, error)
 	Save(ctx context.Context, client Client) error
 	List(ctx context.Context) ([]Client, error)
+	Delete(ctx context.Context, id string) error
 }
 
+// ErrClientNotFound is returned when no client is registered under an ID.
+var ErrClientNotFound = errors.New("client not found")
+
 type InMemoryClientStore struct {
+	mu      sync.RWMutex
 	clients map[string]Client
 }
 
@@ -73,14 +122,18 @@ func NewInMemoryClientStore() *InMemoryClientStore {
 }
 
 func (s *InMemoryClientStore) GetByID(ctx context.Context, id string) (Client, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	c, ok := s.clients[id]
 	if !ok {
-		return Client{}, fmt.Errorf("client not found")
+		return Client{}, ErrClientNotFound
 	}
 	return c, nil
 }
 
 func (s *InMemoryClientStore) List(ctx context.Context) ([]Client, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	clients := make([]Client, 0, len(s.clients))
 	for _, c := range s.clients {
 		clients = append(clients, c)
@@ -89,10 +142,25 @@ func (s *InMemoryClientStore) List(ctx context.Context) ([]Client, error) {
 }
 
 func (s *InMemoryClientStore) Save(ctx context.Context, client Client) error {
+	if err := client.ValidateRedirectURIs(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	s.clients[client.ID] = client
 	return nil
 }
 
+func (s *InMemoryClientStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.clients[id]; !ok {
+		return ErrClientNotFound
+	}
+	delete(s.clients, id)
+	return nil
+}
+
 type SQLClientStore struct {
 	db *sql.DB
 }
@@ -106,3 +174,8 @@ func (s *SQLClientStore) List(ctx context.Context) ([]Client, error) {
 	// SELECT ... FROM clients
 	return nil, nil
 }
+
+func (s *SQLClientStore) Delete(ctx context.Context, id string) error {
+	// DELETE FROM clients WHERE id = ?
+	return nil
+}
@@ -38,7 +38,6 @@ type AuthorizationCode struct {
 	Used bool
 }
 
-
 type InMemoryCodeStore struct {
 	codes map[string]*AuthorizationCode
 }
@@ -64,5 +63,3 @@ func (s *InMemoryCodeStore) Delete(ctx context.Context, code string) error {
 	delete(s.codes, code)
 	return nil
 }
-
-
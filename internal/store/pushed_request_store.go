@@ -0,0 +1,82 @@
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// RequestURIPrefix starts every request_uri the PAR endpoint issues
+// (RFC 9126 §2.2).
+const RequestURIPrefix = "urn:ietf:params:oauth:request_uri:"
+
+// PushedRequest is an authorization request a client pushed to the PAR
+// endpoint, kept until the user agent brings its request_uri to /authorize.
+type PushedRequest struct {
+	RequestURI string
+	ClientID   string
+	Params     url.Values
+	ExpiresAt  time.Time
+}
+
+// ErrPushedRequestNotFound is returned for request_uri values that are
+// unknown, expired, already used or pushed by another client.
+var ErrPushedRequestNotFound = errors.New("pushed authorization request not found")
+
+type PushedRequestStore interface {
+	// Push stores params for clientID and returns the request_uri for them.
+	Push(ctx context.Context, clientID string, params url.Values, ttl time.Duration) (PushedRequest, error)
+	// Take returns the request pushed by clientID under requestURI and
+	// removes it: a request_uri is used once (RFC 9126 §4).
+	Take(ctx context.Context, clientID, requestURI string) (PushedRequest, error)
+}
+
+type InMemoryPushedRequestStore struct {
+	mu       sync.Mutex
+	requests map[string]PushedRequest
+}
+
+func NewInMemoryPushedRequestStore() *InMemoryPushedRequestStore {
+	return &InMemoryPushedRequestStore{requests: make(map[string]PushedRequest)}
+}
+
+func (s *InMemoryPushedRequestStore) Push(ctx context.Context, clientID string, params url.Values, ttl time.Duration) (PushedRequest, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return PushedRequest{}, err
+	}
+	req := PushedRequest{
+		RequestURI: RequestURIPrefix + base64.RawURLEncoding.EncodeToString(b),
+		ClientID:   clientID,
+		Params:     params,
+		ExpiresAt:  time.Now().Add(ttl),
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for uri, r := range s.requests {
+		if now.After(r.ExpiresAt) {
+			delete(s.requests, uri)
+		}
+	}
+	s.requests[req.RequestURI] = req
+	return req, nil
+}
+
+func (s *InMemoryPushedRequestStore) Take(ctx context.Context, clientID, requestURI string) (PushedRequest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	req, ok := s.requests[requestURI]
+	if !ok || req.ClientID != clientID {
+		return PushedRequest{}, ErrPushedRequestNotFound
+	}
+	delete(s.requests, requestURI)
+	if time.Now().After(req.ExpiresAt) {
+		return PushedRequest{}, ErrPushedRequestNotFound
+	}
+	return req, nil
+}
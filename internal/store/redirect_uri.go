@@ -0,0 +1,186 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// RedirectURIPolicy controls how redirect_uri values presented at the
+// authorization endpoint are compared with the registered ones.
+//
+// The zero value keeps exact string matching for every registered URI.
+// Enabling any of the native-app options (RFC 8252) turns the client into a
+// native client: only the enabled kinds of redirect URI are then accepted.
+type RedirectURIPolicy struct {
+	// Loopback accepts http://127.0.0.1 and http://[::1] redirects on any
+	// port, since desktop apps bind to an ephemeral port (RFC 8252 §7.3).
+	Loopback bool
+	// PrivateUseSchemes accepts redirects such as com.example.app:/cb
+	// (RFC 8252 §7.1).
+	PrivateUseSchemes bool
+	// ClaimedHTTPS accepts https redirects claimed by the app on the
+	// platform (RFC 8252 §7.2).
+	ClaimedHTTPS bool
+
+	// SimulatorLenient allows "*" patterns in registered redirect URIs, for
+	// ephemeral test environments whose hostnames are not known up front.
+	// A "*" in the host stands for part of one DNS label and a "*" in the
+	// path for part of one path segment. It weakens redirect URI protection
+	// and must never be enabled for a production client.
+	SimulatorLenient bool
+}
+
+func (p RedirectURIPolicy) native() bool {
+	return p.Loopback || p.PrivateUseSchemes || p.ClaimedHTTPS
+}
+
+type redirectKind int
+
+const (
+	redirectWeb redirectKind = iota
+	redirectLoopback
+	redirectPrivateUse
+	redirectHTTPS
+	redirectUnsafe // never a redirect target
+)
+
+// unsafeSchemes run or read content in the browser rather than hand the
+// response to an app.
+var unsafeSchemes = []string{"javascript", "data", "file", "vbscript", "blob", "about"}
+
+func classifyRedirect(u *url.URL) redirectKind {
+	scheme := strings.ToLower(u.Scheme)
+	switch scheme {
+	case "http":
+		if isLoopbackHost(u.Hostname()) {
+			return redirectLoopback
+		}
+		return redirectWeb
+	case "https":
+		return redirectHTTPS
+	}
+	// Private-use schemes are reverse domain names the app controls, such
+	// as com.example.app (RFC 8252 §7.1).
+	if slices.Contains(unsafeSchemes, scheme) || !strings.Contains(scheme, ".") {
+		return redirectUnsafe
+	}
+	return redirectPrivateUse
+}
+
+// isLoopbackHost reports whether host is a loopback IP literal. "localhost"
+// is deliberately excluded (RFC 8252 §8.3).
+func isLoopbackHost(host string) bool {
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func (p RedirectURIPolicy) allows(kind redirectKind) bool {
+	if !p.native() {
+		// Web clients are redirected to over http or https only.
+		return kind == redirectWeb || kind == redirectLoopback || kind == redirectHTTPS
+	}
+	switch kind {
+	case redirectLoopback:
+		return p.Loopback
+	case redirectPrivateUse:
+		return p.PrivateUseSchemes
+	case redirectHTTPS:
+		return p.ClaimedHTTPS
+	default:
+		return false
+	}
+}
+
+// ErrInvalidRedirectURI is returned when a redirect URI cannot be registered.
+var ErrInvalidRedirectURI = errors.New("invalid redirect_uri")
+
+// ValidateRedirectURI checks a redirect URI before it is registered. URIs
+// must be absolute and must not carry a fragment (RFC 6749 §3.1.2).
+// Wildcards are only accepted in simulator lenient mode.
+func (p RedirectURIPolicy) ValidateRedirectURI(raw string) error {
+	if strings.Contains(raw, "#") {
+		return fmt.Errorf("%w: %q must not contain a fragment", ErrInvalidRedirectURI, raw)
+	}
+	if strings.Contains(raw, "*") && !p.SimulatorLenient {
+		return fmt.Errorf("%w: %q must not contain wildcards", ErrInvalidRedirectURI, raw)
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme == "" || (u.Host == "" && u.Opaque == "" && u.Path == "") {
+		return fmt.Errorf("%w: %q is not an absolute URI", ErrInvalidRedirectURI, raw)
+	}
+	if strings.Contains(u.Scheme+u.Opaque+u.RawQuery, "*") || u.User != nil {
+		return fmt.Errorf("%w: %q may only use wildcards in the host and path", ErrInvalidRedirectURI, raw)
+	}
+	if !p.allows(classifyRedirect(u)) {
+		return fmt.Errorf("%w: %q is not permitted by the client's redirect policy", ErrInvalidRedirectURI, raw)
+	}
+	return nil
+}
+
+// matchRedirectURI compares a presented redirect URI with one registered
+// URI under the policy.
+func (p RedirectURIPolicy) matchRedirectURI(registered, presented string) bool {
+	if p.SimulatorLenient && strings.Contains(registered, "*") {
+		return matchRedirectPattern(registered, presented)
+	}
+	reg, err := url.Parse(registered)
+	if err != nil {
+		return false
+	}
+	kind := classifyRedirect(reg)
+	if !p.allows(kind) {
+		return false
+	}
+	if registered == presented {
+		return true
+	}
+	if kind != redirectLoopback || !p.Loopback {
+		return false
+	}
+	// Loopback redirects match on everything but the port.
+	got, err := url.Parse(presented)
+	if err != nil || got.Scheme != "http" {
+		return false
+	}
+	return got.Hostname() == reg.Hostname() &&
+		got.Path == reg.Path &&
+		got.RawQuery == reg.RawQuery &&
+		got.Fragment == ""
+}
+
+// matchRedirectPattern compares a presented redirect URI with a registered
+// pattern component by component, so a wildcard never reaches past the
+// host or into another path segment. Scheme and query match exactly.
+func matchRedirectPattern(pattern, presented string) bool {
+	reg, err := url.Parse(pattern)
+	if err != nil {
+		return false
+	}
+	got, err := url.Parse(presented)
+	if err != nil || got.User != nil || got.Fragment != "" || got.Opaque != "" {
+		return false
+	}
+	return strings.EqualFold(got.Scheme, reg.Scheme) &&
+		globPattern(reg.Host, "[^./:]+", true).MatchString(got.Host) &&
+		globPattern(reg.Path, "[^/]+", false).MatchString(got.Path) &&
+		got.RawQuery == reg.RawQuery
+}
+
+// globPattern turns a pattern into an anchored regexp where each "*"
+// matches what wildcard allows.
+func globPattern(pattern, wildcard string, foldCase bool) *regexp.Regexp {
+	parts := strings.Split(pattern, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	expr := "^" + strings.Join(parts, wildcard) + "$"
+	if foldCase {
+		expr = "(?i)" + expr
+	}
+	return regexp.MustCompile(expr)
+}
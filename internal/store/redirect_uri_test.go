@@ -0,0 +1,119 @@
+package store
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsRedirectURIMatching_Exact(t *testing.T) {
+	c := Client{RedirectURIs: []string{"https://app.example/cb", "http://127.0.0.1:8080/cb"}}
+
+	assert.True(t, c.IsRedirectURIMatching("https://app.example/cb"))
+	assert.True(t, c.IsRedirectURIMatching("http://127.0.0.1:8080/cb"))
+	assert.False(t, c.IsRedirectURIMatching("https://app.example/cb/"))
+	assert.False(t, c.IsRedirectURIMatching("http://127.0.0.1:9090/cb"), "ports are only relaxed for loopback-enabled clients")
+	assert.False(t, c.IsRedirectURIMatching("https://app.example/cb#frag"))
+}
+
+func TestIsRedirectURIMatching_Loopback(t *testing.T) {
+	c := Client{
+		RedirectURIs: []string{"http://127.0.0.1/callback", "http://[::1]/callback"},
+		Meta:         ClientMeta{RedirectPolicy: RedirectURIPolicy{Loopback: true}},
+	}
+
+	assert.True(t, c.IsRedirectURIMatching("http://127.0.0.1:51234/callback"))
+	assert.True(t, c.IsRedirectURIMatching("http://[::1]:60000/callback"))
+	assert.True(t, c.IsRedirectURIMatching("http://127.0.0.1/callback"))
+	assert.False(t, c.IsRedirectURIMatching("http://127.0.0.1:51234/other"))
+	assert.False(t, c.IsRedirectURIMatching("https://127.0.0.1:51234/callback"))
+	assert.False(t, c.IsRedirectURIMatching("http://localhost:51234/callback"))
+}
+
+func TestIsRedirectURIMatching_NativeKinds(t *testing.T) {
+	uris := []string{"com.example.app:/oauth2redirect", "https://app.example/native"}
+
+	privateOnly := Client{RedirectURIs: uris, Meta: ClientMeta{RedirectPolicy: RedirectURIPolicy{PrivateUseSchemes: true}}}
+	assert.True(t, privateOnly.IsRedirectURIMatching("com.example.app:/oauth2redirect"))
+	assert.False(t, privateOnly.IsRedirectURIMatching("https://app.example/native"))
+
+	claimed := Client{RedirectURIs: uris, Meta: ClientMeta{RedirectPolicy: RedirectURIPolicy{ClaimedHTTPS: true}}}
+	assert.False(t, claimed.IsRedirectURIMatching("com.example.app:/oauth2redirect"))
+	assert.True(t, claimed.IsRedirectURIMatching("https://app.example/native"))
+}
+
+func TestIsRedirectURIMatching_SimulatorLenient(t *testing.T) {
+	c := Client{
+		RedirectURIs: []string{"https://pr-*.preview.example/cb"},
+		Meta:         ClientMeta{RedirectPolicy: RedirectURIPolicy{SimulatorLenient: true}},
+	}
+
+	assert.True(t, c.IsRedirectURIMatching("https://pr-42.preview.example/cb"))
+	assert.False(t, c.IsRedirectURIMatching("https://pr-42.preview.example/cb/extra"))
+	assert.False(t, c.IsRedirectURIMatching("https://evil.example/?x=pr-1.preview.example/cb#"))
+	assert.False(t, c.IsRedirectURIMatching("https://pr-1.evil.example/x.preview.example/cb"), "a wildcard stays within one host label")
+	assert.False(t, c.IsRedirectURIMatching("https://pr-1.preview.example@evil.example/cb"))
+	assert.False(t, c.IsRedirectURIMatching("http://pr-42.preview.example/cb"))
+
+	wild := Client{
+		RedirectURIs: []string{"https://*.example/cb/*"},
+		Meta:         ClientMeta{RedirectPolicy: RedirectURIPolicy{SimulatorLenient: true}},
+	}
+	assert.True(t, wild.IsRedirectURIMatching("https://pr-7.example/cb/done"))
+	assert.False(t, wild.IsRedirectURIMatching("https://evil.com/x.example/cb/done"), "the host is compared on its own")
+	assert.False(t, wild.IsRedirectURIMatching("https://evil.com:443/.example/cb/done"))
+	assert.False(t, wild.IsRedirectURIMatching("https://a.b.example/cb/done"))
+	assert.False(t, wild.IsRedirectURIMatching("https://pr-7.example/cb/done/../../steal"), "a wildcard stays within one path segment")
+	assert.False(t, wild.IsRedirectURIMatching("https://pr-7.example:8443/cb/done"))
+}
+
+func TestSaveRejectsInvalidRedirectURIs(t *testing.T) {
+	s := NewInMemoryClientStore()
+	ctx := context.Background()
+
+	err := s.Save(ctx, Client{ID: "frag", RedirectURIs: []string{"https://app.example/cb#x"}})
+	assert.ErrorIs(t, err, ErrInvalidRedirectURI)
+
+	err = s.Save(ctx, Client{ID: "wild", RedirectURIs: []string{"https://*.example/cb"}})
+	assert.ErrorIs(t, err, ErrInvalidRedirectURI)
+
+	err = s.Save(ctx, Client{ID: "relative", RedirectURIs: []string{"/cb"}})
+	assert.ErrorIs(t, err, ErrInvalidRedirectURI)
+
+	err = s.Save(ctx, Client{
+		ID:           "native",
+		RedirectURIs: []string{"https://web.example/cb"},
+		Meta:         ClientMeta{RedirectPolicy: RedirectURIPolicy{Loopback: true}},
+	})
+	assert.ErrorIs(t, err, ErrInvalidRedirectURI)
+
+	for _, uri := range []string{"javascript:alert(1)", "data:text/html,<script>", "file:///etc/passwd", "myapp:/cb"} {
+		err = s.Save(ctx, Client{ID: "web", RedirectURIs: []string{uri}})
+		assert.ErrorIs(t, err, ErrInvalidRedirectURI, uri)
+		err = s.Save(ctx, Client{
+			ID:           "native",
+			RedirectURIs: []string{uri},
+			Meta:         ClientMeta{RedirectPolicy: RedirectURIPolicy{PrivateUseSchemes: true}},
+		})
+		assert.ErrorIs(t, err, ErrInvalidRedirectURI, uri)
+	}
+	require.NoError(t, s.Save(ctx, Client{
+		ID:           "native",
+		RedirectURIs: []string{"com.example.app:/oauth2redirect"},
+		Meta:         ClientMeta{RedirectPolicy: RedirectURIPolicy{PrivateUseSchemes: true}},
+	}))
+
+	require.NoError(t, s.Save(ctx, Client{
+		ID:           "lenient",
+		RedirectURIs: []string{"https://*.example/cb"},
+		Meta:         ClientMeta{RedirectPolicy: RedirectURIPolicy{SimulatorLenient: true}},
+	}))
+	err = s.Save(ctx, Client{
+		ID:           "lenient",
+		RedirectURIs: []string{"https://app.example/cb?env=*"},
+		Meta:         ClientMeta{RedirectPolicy: RedirectURIPolicy{SimulatorLenient: true}},
+	})
+	assert.ErrorIs(t, err, ErrInvalidRedirectURI, "wildcards only go in the host and path")
+}
@@ -0,0 +1,92 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// RefreshToken is the server-side record of an issued refresh token. Like
+// opaque access tokens, it is stored under the OpaqueTokenID of its value.
+type RefreshToken struct {
+	ID           string
+	ClientID     string
+	Subject      string // local user ID
+	Scope        string
+	DelegationID string
+	IssuedAt     time.Time
+	ExpiresAt    time.Time
+}
+
+// ErrRefreshTokenNotFound is returned for refresh tokens that are unknown,
+// expired, already used or issued to another client.
+var ErrRefreshTokenNotFound = errors.New("refresh token not found")
+
+type RefreshTokenStore interface {
+	Save(ctx context.Context, rt RefreshToken) error
+	// Get returns the refresh token issued to clientID under id.
+	Get(ctx context.Context, clientID, id string) (RefreshToken, error)
+	// Take returns the refresh token issued to clientID under id and
+	// removes it: refresh tokens are rotated on every use.
+	Take(ctx context.Context, clientID, id string) (RefreshToken, error)
+	// RevokeByClient removes every refresh token issued to clientID.
+	RevokeByClient(ctx context.Context, clientID string) error
+}
+
+type InMemoryRefreshTokenStore struct {
+	mu     sync.Mutex
+	tokens map[string]RefreshToken
+}
+
+func NewInMemoryRefreshTokenStore() *InMemoryRefreshTokenStore {
+	return &InMemoryRefreshTokenStore{tokens: make(map[string]RefreshToken)}
+}
+
+func (s *InMemoryRefreshTokenStore) Save(ctx context.Context, rt RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for id, t := range s.tokens {
+		if now.After(t.ExpiresAt) {
+			delete(s.tokens, id)
+		}
+	}
+	s.tokens[rt.ID] = rt
+	return nil
+}
+
+func (s *InMemoryRefreshTokenStore) Get(ctx context.Context, clientID, id string) (RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rt, ok := s.tokens[id]
+	if !ok || rt.ClientID != clientID || time.Now().After(rt.ExpiresAt) {
+		return RefreshToken{}, ErrRefreshTokenNotFound
+	}
+	return rt, nil
+}
+
+func (s *InMemoryRefreshTokenStore) Take(ctx context.Context, clientID, id string) (RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rt, ok := s.tokens[id]
+	if !ok || rt.ClientID != clientID {
+		return RefreshToken{}, ErrRefreshTokenNotFound
+	}
+	delete(s.tokens, id)
+	if time.Now().After(rt.ExpiresAt) {
+		return RefreshToken{}, ErrRefreshTokenNotFound
+	}
+	return rt, nil
+}
+
+func (s *InMemoryRefreshTokenStore) RevokeByClient(ctx context.Context, clientID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, rt := range s.tokens {
+		if rt.ClientID == clientID {
+			delete(s.tokens, id)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// TokenRecord is the server-side record of an issued access token. JWT
+// access tokens are self-contained and the record lets them be listed per
+// client and revoked before they expire. Opaque tokens are only meaningful
+// through their record.
+type TokenRecord struct {
+	ID             string     `json:"id"` // jti of a JWT, OpaqueTokenID of an opaque token
+	Opaque         bool       `json:"opaque,omitempty"`
+	ClientID       string     `json:"client_id"`
+	Subject        string     `json:"sub"`
+	Audience       string     `json:"aud,omitempty"`
+	Scope          string     `json:"scope,omitempty"`
+	DelegationID   string     `json:"delegation_id,omitempty"`
+	CertThumbprint string     `json:"x5t#S256,omitempty"` // certificate binding (RFC 8705 §3)
+	IssuedAt       time.Time  `json:"issued_at"`
+	ExpiresAt      time.Time  `json:"expires_at"`
+	RevokedAt      *time.Time `json:"revoked_at,omitempty"`
+}
+
+// OpaqueTokenID is the record ID of an opaque token. Only the hash is
+// stored, so listing tokens never reveals usable values.
+func OpaqueTokenID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// IsActiveAt reports whether the token is neither revoked nor expired at t.
+func (r TokenRecord) IsActiveAt(t time.Time) bool {
+	return r.RevokedAt == nil && t.Before(r.ExpiresAt)
+}
+
+// ErrTokenNotFound is returned when no token was recorded under an ID.
+var ErrTokenNotFound = errors.New("token not found")
+
+type TokenStore interface {
+	Save(ctx context.Context, rec TokenRecord) error
+	Get(ctx context.Context, id string) (TokenRecord, error)
+	ListByClient(ctx context.Context, clientID string) ([]TokenRecord, error)
+	Revoke(ctx context.Context, id string, at time.Time) error
+	RevokeByClient(ctx context.Context, clientID string, at time.Time) error
+	RevokeBySubject(ctx context.Context, clientID, subject string, at time.Time) error
+}
+
+type InMemoryTokenStore struct {
+	mu     sync.RWMutex
+	tokens map[string]TokenRecord
+}
+
+func NewInMemoryTokenStore() *InMemoryTokenStore {
+	return &InMemoryTokenStore{tokens: make(map[string]TokenRecord)}
+}
+
+func (s *InMemoryTokenStore) Save(ctx context.Context, rec TokenRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[rec.ID] = rec
+	return nil
+}
+
+func (s *InMemoryTokenStore) Get(ctx context.Context, id string) (TokenRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rec, ok := s.tokens[id]
+	if !ok {
+		return TokenRecord{}, ErrTokenNotFound
+	}
+	return rec, nil
+}
+
+// ListByClient returns the client's tokens, newest first. Expired tokens
+// are pruned as a side effect.
+func (s *InMemoryTokenStore) ListByClient(ctx context.Context, clientID string) ([]TokenRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	var out []TokenRecord
+	for id, rec := range s.tokens {
+		if !now.Before(rec.ExpiresAt) {
+			delete(s.tokens, id)
+			continue
+		}
+		if rec.ClientID == clientID {
+			out = append(out, rec)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].IssuedAt.After(out[j].IssuedAt) })
+	return out, nil
+}
+
+func (s *InMemoryTokenStore) Revoke(ctx context.Context, id string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.tokens[id]
+	if !ok {
+		return ErrTokenNotFound
+	}
+	if rec.RevokedAt == nil {
+		rec.RevokedAt = &at
+		s.tokens[id] = rec
+	}
+	return nil
+}
+
+func (s *InMemoryTokenStore) RevokeByClient(ctx context.Context, clientID string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, rec := range s.tokens {
+		if rec.ClientID == clientID && rec.RevokedAt == nil {
+			rec.RevokedAt = &at
+			s.tokens[id] = rec
+		}
+	}
+	return nil
+}
+
+// RevokeBySubject revokes the tokens the client holds for subject, e.g.
+// when the user disconnects the client from their account.
+func (s *InMemoryTokenStore) RevokeBySubject(ctx context.Context, clientID, subject string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, rec := range s.tokens {
+		if rec.ClientID == clientID && rec.Subject == subject && rec.RevokedAt == nil {
+			rec.RevokedAt = &at
+			s.tokens[id] = rec
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package jwksutil
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+)
+
+// FromPublicKey exports an *rsa.PublicKey, *ecdsa.PublicKey or
+// ed25519.PublicKey as a JWK (RFC 7518 §6, RFC 8037 §2).
+func FromPublicKey(pub crypto.PublicKey, kid, alg, use string) (JWK, error) {
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		jwk := ConvertToJWK(k, kid)
+		jwk.Alg, jwk.Use = alg, use
+		return jwk, nil
+	case *ecdsa.PublicKey:
+		crv := k.Curve.Params().Name
+		if _, err := curveByName(crv); err != nil {
+			return JWK{}, err
+		}
+		size := (k.Curve.Params().BitSize + 7) / 8
+		x, y := make([]byte, size), make([]byte, size)
+		k.X.FillBytes(x)
+		k.Y.FillBytes(y)
+		return JWK{Kty: "EC", Use: use, Alg: alg, Kid: kid, Crv: crv, X: base64url(x), Y: base64url(y)}, nil
+	case ed25519.PublicKey:
+		return JWK{Kty: "OKP", Use: use, Alg: alg, Kid: kid, Crv: "Ed25519", X: base64url(k)}, nil
+	default:
+		return JWK{}, fmt.Errorf("unsupported public key type %T", pub)
+	}
+}
+
+// Thumbprint returns the RFC 7638 SHA-256 thumbprint of the key, computed
+// over its required members only.
+func (k JWK) Thumbprint() (string, error) {
+	// encoding/json writes struct fields in declaration order, which is
+	// kept lexicographic here as §3.2 requires.
+	var canonical interface{}
+	switch k.Kty {
+	case "RSA":
+		canonical = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{k.E, k.Kty, k.N}
+	case "EC":
+		canonical = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{k.Crv, k.Kty, k.X, k.Y}
+	case "OKP":
+		canonical = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{k.Crv, k.Kty, k.X}
+	default:
+		return "", fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+	data, err := json.Marshal(canonical)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return base64url(sum[:]), nil
+}
@@ -17,8 +17,11 @@ type JWK struct {
 	Use string `json:"use"`
 	Alg string `json:"alg"`
 	Kid string `json:"kid,omitempty"`
-	N   string `json:"n"`
-	E   string `json:"e"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
 }
 
 type JWKS struct {
@@ -1,47 +1,23 @@
 package main
 
 import (
-	"crypto/rsa"
-	"crypto/x509"
-	"encoding/pem"
+	"context"
+	"crypto/tls"
 	"flag"
 	"fmt"
-	"os"
+	"net/http"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
 	"github.com/gin-gonic/gin"
 	delegationapp "github.com/martencassel/oidcsim/internal/application/delegation"
+	"github.com/martencassel/oidcsim/internal/bootstrap"
 	"github.com/martencassel/oidcsim/internal/config"
 	"github.com/martencassel/oidcsim/internal/domain/delegation"
-	infradelegation "github.com/martencassel/oidcsim/internal/infrastructure/delegation"
-	"github.com/martencassel/oidcsim/internal/infrastructure/session"
-	infrasession "github.com/martencassel/oidcsim/internal/infrastructure/session"
-	oauth2 "github.com/martencassel/oidcsim/internal/interface/http"
-	jwksutil "github.com/martencassel/oidcsim/jwskutil"
+	"github.com/martencassel/oidcsim/internal/security"
 )
 
-func parseRSAPrivateKeyFromPEM(path string) (*rsa.PrivateKey, error) {
-	pemData, err := os.ReadFile(path)
-	if err != nil {
-		return nil, err
-	}
-	block, _ := pem.Decode(pemData)
-	if block == nil {
-		return nil, fmt.Errorf("failed to parse PEM block containing private key")
-	}
-	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
-	if err != nil {
-		// Try PKCS8
-		k, err2 := x509.ParsePKCS8PrivateKey(block.Bytes)
-		if err2 != nil {
-			return nil, fmt.Errorf("failed to parse private key: %v", err2)
-		}
-		key = k.(*rsa.PrivateKey)
-	}
-	return key, nil
-}
-
 func mustLoadConfig(path string) *config.AppConfig {
 	cfg, err := config.Load(path)
 	if err != nil {
@@ -57,28 +33,24 @@ func TestDelegation(repo delegationapp.Repository) {
 		Scopes:   []string{"openid", "profile", "email"},
 	})
 	repo.FindByID(nil, "alice|client1")
-	repo.FindByUserAndClient(nil, "alice", "client1")
-	repo.Delete(nil, "alice", "client1")
+	if d, _ := repo.FindByUserAndClient(nil, "alice", "client1"); d != nil {
+		repo.Revoke(nil, d.ID, time.Now())
+	}
 	repo.FindByUserAndClient(nil, "alice", "client1")
 }
 
 func main() {
-	delegRepo := infradelegation.NewMemoryRepo()
-	//cliRepo := infradelegation.NewMemoryRepo()
-	mux := gin.Default()
-
-	sessionManager := infrasession.NewMemorySessionManager("oidcsim_session", session.WithAllowInsecure())
-	authHandler := &oauth2.Handler{}
-	authHandler.DelegationSvc = delegationapp.NewDelegationService(delegRepo)
-	authHandler.Sessions = sessionManager
-	authHandler.AuthSvc = nil // TODO: implement authentication service
-	authHandler.AuthorizeSvc = nil
-
-	mux.GET("/authorize", authHandler.Authorize)
-
-	// if err := mux.Run(":8080"); err != nil {
-	// 	log.Fatalf("failed to run server: %v", err)
-	// }
+	cfg := mustLoadConfig("config.yaml")
+	addr, port, tlsCert, tlsKey := parseFlags(cfg)
+	keys := mustLoadKeyManager(cfg)
+	go keys.Run(context.Background(), time.Minute)
+
+	app := bootstrap.BuildApp(cfg, keys)
+	srv := NewServer(addr, port, tlsCert, tlsKey, app.Router)
+	srv.RequestClientCert = cfg.MTLS.Enabled
+	if err := srv.ListenAndServe(); err != nil {
+		log.Fatalf("failed to run server: %v", err)
+	}
 }
 
 type Server struct {
@@ -87,6 +59,12 @@ type Server struct {
 	TLSCert string
 	TLSKey  string
 	Router  *gin.Engine
+
+	// RequestClientCert asks clients for a certificate during the TLS
+	// handshake. Certificates are not verified here: tls_client_auth checks
+	// the chain against the configured CA bundle and
+	// self_signed_tls_client_auth against the client's JWKS.
+	RequestClientCert bool
 }
 
 func NewServer(address string, port int, tlsCert, tlsKey string, router *gin.Engine) *Server {
@@ -103,28 +81,35 @@ func (s *Server) ListenAndServe() error {
 	listenAddr := fmt.Sprintf("%s:%d", s.Address, s.Port)
 	if s.TLSCert != "" && s.TLSKey != "" {
 		// Run with TLS
-		return s.Router.RunTLS(listenAddr, s.TLSCert, s.TLSKey)
+		srv := &http.Server{
+			Addr:      listenAddr,
+			Handler:   s.Router,
+			TLSConfig: &tls.Config{MinVersion: tls.VersionTLS12},
+		}
+		if s.RequestClientCert {
+			srv.TLSConfig.ClientAuth = tls.RequestClientCert
+		}
+		return srv.ListenAndServeTLS(s.TLSCert, s.TLSKey)
 	} else {
 		// Run without TLS
 		return s.Router.Run(listenAddr)
 	}
 }
 
-func mustLoadKeys(path string) (*rsa.PrivateKey, *rsa.PublicKey) {
-	priv, err := parseRSAPrivateKeyFromPEM(path)
-	if err != nil {
-		panic(fmt.Sprintf("failed to parse private key: %v", err))
-	}
-	pub := &priv.PublicKey
-	return priv, pub
-}
-
-func mustGenerateJWKS(pub *rsa.PublicKey) []byte {
-	jwks, err := jwksutil.GenerateJWKS(pub, "idp-key")
+func mustLoadKeyManager(cfg *config.AppConfig) *security.KeyManager {
+	signing := cfg.OIDC.Signing
+	keys, err := security.NewKeyManager(security.KeyManagerConfig{
+		KeyFile:          signing.PrivateKeyFile,
+		KeyID:            signing.KeyID,
+		Algorithms:       signing.Algorithms,
+		RotationInterval: signing.RotationInterval,
+		PublishAhead:     signing.PublishAhead,
+		Retention:        signing.Retention,
+	})
 	if err != nil {
-		panic(fmt.Sprintf("failed to generate JWKS: %v", err))
+		log.Fatalf("failed to load signing keys: %v", err)
 	}
-	return jwks
+	return keys
 }
 
 func parseFlags(cfg *config.AppConfig) (string, int, string, string) {